@@ -0,0 +1,140 @@
+//go:build !nocv
+
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"yolo-server/internal/inference"
+	"yolo-server/internal/postprocess"
+	"yolo-server/internal/server"
+)
+
+// ortLibraryPath is where the Docker image installs ONNX Runtime.
+const ortLibraryPath = "/usr/local/lib/libonnxruntime.so"
+
+// newDetector builds the configured detector. ONNX Runtime is only loaded
+// when it is used, so remote and mock deployments need not ship it.
+func newDetector(cfg server.Config, model inference.ModelInfo) (inference.Detector, func(), error) {
+	var (
+		backend inference.Backend
+		err     error
+	)
+	if cfg.LPRModel != "" && (cfg.Backend == "mock" || cfg.Backend == "workers") {
+		return nil, nil, fmt.Errorf("LPR_MODEL runs in the model engine; set it on the workers instead of the %s backend", cfg.Backend)
+	}
+	if cfg.CrowdModel != "" && (cfg.Backend == "mock" || cfg.Backend == "workers") {
+		return nil, nil, fmt.Errorf("CROWD_MODEL needs the onnxruntime or triton backend, not %s", cfg.Backend)
+	}
+	if cfg.EmbedModel != "" && (cfg.Backend == "mock" || cfg.Backend == "workers") {
+		return nil, nil, fmt.Errorf("EMBED_MODEL needs the onnxruntime or triton backend, not %s", cfg.Backend)
+	}
+	// The workers calibrate their own scores and resolve their own
+	// exclusive classes.
+	var (
+		cal       *postprocess.ScoreCalibration
+		exclusive *postprocess.ExclusiveClasses
+	)
+	if cfg.Backend != "workers" {
+		if cal, err = postprocess.LoadScoreCalibration(cfg.ModelPath); err != nil {
+			return nil, nil, err
+		}
+		if exclusive, err = postprocess.LoadExclusiveClasses(cfg.ModelPath); err != nil {
+			return nil, nil, err
+		}
+	}
+	switch cfg.Backend {
+	case "mock":
+		m, err := inference.NewMock(model.Labels(), cfg.MockFixtures, cfg.MockLatency, cal, exclusive)
+		return m, func() {}, err
+	case "workers":
+		d, err := inference.NewDispatcher(cfg.DispatchConfig())
+		if err != nil {
+			return nil, nil, err
+		}
+		return d, func() { _ = d.Close() }, nil
+	case "triton":
+		backend, err = inference.NewTritonBackend(cfg.TritonConfig())
+	default:
+		if err = inference.Init(ortLibraryPath); err != nil {
+			return nil, nil, err
+		}
+		if cfg.ModelData != nil {
+			backend, err = inference.NewORTBackendData(cfg.ModelData, cfg.SessionOptions())
+		} else {
+			backend, err = inference.NewORTBackend(cfg.ModelPath, cfg.SessionOptions())
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	ec := cfg.EngineConfig()
+	ec.Task = model.Task()
+	ec.Calibration = cal
+	ec.Exclusive = exclusive
+	engine, err := inference.New(backend, model.Labels(), ec)
+	if err != nil {
+		_ = backend.Close()
+		return nil, nil, err
+	}
+	if cfg.LPRModel != "" {
+		// The plate model always runs in ONNX Runtime, which a Triton
+		// deployment has not loaded yet; Init counts references.
+		if err := inference.Init(ortLibraryPath); err != nil {
+			_ = engine.Close()
+			return nil, nil, err
+		}
+		pr, err := inference.NewPlateReader(cfg.PlateConfig(), cfg.SessionOptions())
+		if err != nil {
+			_ = engine.Close()
+			inference.Destroy()
+			return nil, nil, fmt.Errorf("LPR_MODEL: %w", err)
+		}
+		engine.SetPlateReader(pr)
+	}
+	if cfg.CrowdModel != "" {
+		if err := inference.Init(ortLibraryPath); err != nil {
+			_ = engine.Close()
+			return nil, nil, err
+		}
+		dm, err := inference.NewDensityModel(cfg.DensityConfig(), cfg.SessionOptions())
+		if err != nil {
+			_ = engine.Close()
+			inference.Destroy()
+			return nil, nil, fmt.Errorf("CROWD_MODEL: %w", err)
+		}
+		engine.SetDensityModel(dm)
+	}
+	if cfg.EmbedModel != "" {
+		if err := inference.Init(ortLibraryPath); err != nil {
+			_ = engine.Close()
+			return nil, nil, err
+		}
+		em, err := inference.NewEmbedModel(cfg.EmbedConfig(), cfg.SessionOptions())
+		if err != nil {
+			_ = engine.Close()
+			inference.Destroy()
+			return nil, nil, fmt.Errorf("EMBED_MODEL: %w", err)
+		}
+		engine.SetEmbedModel(em)
+	}
+	// The closer may run twice (explicitly before os.Exit, then deferred),
+	// and the sessions must only be destroyed once.
+	var once sync.Once
+	return engine, func() {
+		once.Do(func() {
+			_ = engine.Close()
+			if cfg.LPRModel != "" {
+				inference.Destroy()
+			}
+			if cfg.CrowdModel != "" {
+				inference.Destroy()
+			}
+			if cfg.EmbedModel != "" {
+				inference.Destroy()
+			}
+			inference.Destroy()
+		})
+	}, nil
+}
@@ -0,0 +1,53 @@
+//go:build nocv
+
+package main
+
+import (
+	"fmt"
+
+	"yolo-server/internal/inference"
+	"yolo-server/internal/postprocess"
+	"yolo-server/internal/server"
+)
+
+// newDetector in a nocv build (go build -tags nocv) only offers the mock
+// and workers backends, so the binary needs neither OpenCV nor ONNX
+// Runtime.
+func newDetector(cfg server.Config, model inference.ModelInfo) (inference.Detector, func(), error) {
+	if cfg.LPRModel != "" {
+		return nil, nil, fmt.Errorf("LPR_MODEL needs the OpenCV build")
+	}
+	if cfg.CrowdModel != "" {
+		return nil, nil, fmt.Errorf("CROWD_MODEL needs the OpenCV build")
+	}
+	if cfg.EmbedModel != "" {
+		return nil, nil, fmt.Errorf("EMBED_MODEL needs the OpenCV build")
+	}
+	// The workers calibrate their own scores and resolve their own
+	// exclusive classes.
+	var (
+		cal       *postprocess.ScoreCalibration
+		exclusive *postprocess.ExclusiveClasses
+	)
+	if cfg.Backend != "workers" {
+		var err error
+		if cal, err = postprocess.LoadScoreCalibration(cfg.ModelPath); err != nil {
+			return nil, nil, err
+		}
+		if exclusive, err = postprocess.LoadExclusiveClasses(cfg.ModelPath); err != nil {
+			return nil, nil, err
+		}
+	}
+	switch cfg.Backend {
+	case "mock":
+		m, err := inference.NewMock(model.Labels(), cfg.MockFixtures, cfg.MockLatency, cal, exclusive)
+		return m, func() {}, err
+	case "workers":
+		d, err := inference.NewDispatcher(cfg.DispatchConfig())
+		if err != nil {
+			return nil, nil, err
+		}
+		return d, func() { _ = d.Close() }, nil
+	}
+	return nil, nil, fmt.Errorf("built with -tags nocv: only the mock and workers backends are available")
+}
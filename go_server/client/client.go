@@ -0,0 +1,538 @@
+// Package client is a Go client for the /ws/stream endpoint.
+//
+// Dial opens a single connection for request/response use; Stream wraps it
+// for long-running sources and reconnects with backoff when the server
+// restarts or the network drops:
+//
+//	frames := make(chan []byte, 1)
+//	go capture(frames) // JPEG/PNG/WebP bytes
+//	for r := range client.Stream(ctx, "ws://host:8080/ws/stream", frames, client.Options{APIKey: key}) {
+//		if r.Err != nil { ... }
+//		use(r.Detections)
+//	}
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ── 타입 ─────────────────────────────────────────────────────────────────────
+
+// Detection is one box in source-frame pixels.
+type Detection struct {
+	Box        [4]int      `json:"box"` // x1, y1, x2, y2
+	Score      float64     `json:"score"`
+	Label      int         `json:"label"`
+	Name       string      `json:"name"`
+	Attributes *Attributes `json:"attributes,omitempty"`
+}
+
+// Attributes are what the server's later stages found out about a
+// detection; nil when there is nothing.
+type Attributes struct {
+	Plate      string      `json:"plate,omitempty"`       // licence plate text (LPR_MODEL)
+	PlateScore float64     `json:"plate_score,omitempty"` // its confidence, 0..1
+	Color      string      `json:"color,omitempty"`       // dominant colour (COLOR_CLASSES)
+	Direction  string      `json:"direction,omitempty"`   // way of travel, e.g. "up-left"; "" at rest
+	Velocity   *[2]float64 `json:"velocity,omitempty"`    // box centre, px/s (MOTION_ATTRIBUTES)
+	Ground     *[2]float64 `json:"ground,omitempty"`      // where it stands, metres (calibrated streams)
+	Distance   float64     `json:"distance,omitempty"`    // from the camera, metres
+	SpeedKmh   float64     `json:"speed_kmh,omitempty"`   // over the ground (calibrated, MOTION_ATTRIBUTES)
+	Crop       []byte      `json:"crop,omitempty"`        // JPEG thumbnail (Options.Crops "inline")
+	CropID     string      `json:"crop_id,omitempty"`     // GET /crops/{id} (Options.Crops "ref")
+}
+
+// Options configures the connection. Zero values leave the server defaults.
+type Options struct {
+	APIKey string // sent as X-API-Key
+	Token  string // JWT, sent as Authorization: Bearer
+
+	ROI  image.Rectangle   // run the model on this region only
+	Mask []image.Rectangle // privacy zones: blacked out, never detected, recorded or sent on
+	Tile bool              // tiled inference for small objects
+	TTA  bool              // test-time augmentation
+
+	// ImgSz picks the model input size (e.g. 320 for speed, 960 for small
+	// objects); the server must list it in INPUT_SIZES. 0 = server default.
+	ImgSz int
+
+	// Every and FPS thin the stream server-side: only every Nth frame, and
+	// at most FPS frames per second, are inferred. Zero = server default.
+	Every int
+	FPS   float64
+
+	// Crops asks for a JPEG thumbnail of each detection: "inline" in
+	// Attributes.Crop, or "ref" for an Attributes.CropID to fetch.
+	Crops string
+
+	// Crowd asks for a people count with every inferred frame (Conn.Crowd),
+	// also in each of CrowdZones by name.
+	Crowd      bool
+	CrowdZones map[string]image.Rectangle
+
+	// Backpressure asks the server for load advice (?flow=advise); Stream
+	// then sends no faster than the advised rate.
+	Backpressure bool
+
+	// ResumeToken continues an earlier stream (Conn.ResumeToken) with its
+	// settings, tracks and frame IDs; the settings above are then ignored.
+	// Stream sets it itself on reconnects.
+	ResumeToken string
+
+	// Compress negotiates permessage-deflate. The server only compresses
+	// responses when WS_COMPRESSION is enabled on its side.
+	Compress bool
+
+	HandshakeTimeout time.Duration // default 10s
+	Header           http.Header   // extra handshake headers
+}
+
+// Quality is the degradation the server applies under load. The zero value
+// is full quality.
+type Quality struct {
+	Level int `json:"level"`
+	ImgSz int `json:"imgsz,omitempty"` // model input size cap; 0 = none
+	Skip  int `json:"skip,omitempty"`  // frames answered with the previous result per inferred one
+}
+
+// Advice is the server's backpressure message.
+type Advice struct {
+	QueueDepth int     `json:"queue_depth"` // frames in flight server-wide
+	FPS        float64 `json:"fps"`         // recommended send rate; 0 = no limit
+	Saturated  bool    `json:"saturated"`
+}
+
+// Crowd is the server's estimate of how many people a frame holds, with a
+// 95% interval.
+type Crowd struct {
+	Source string `json:"source"` // "density" (CROWD_MODEL) or "detections"
+	CrowdCount
+	Zones []struct {
+		Name string `json:"name"`
+		CrowdCount
+	} `json:"zones"`
+}
+
+// CrowdCount is a people count and its interval.
+type CrowdCount struct {
+	Count float64 `json:"count"`
+	Low   float64 `json:"low"`
+	High  float64 `json:"high"`
+}
+
+// Frame is the metadata the server sends with each answer.
+type Frame struct {
+	ID           uint64 `json:"-"`     // position among the frames sent on this connection, from 1
+	Width        int    `json:"width"` // source frame after EXIF orientation; 0 when unknown
+	Height       int    `json:"height"`
+	ImgSz        int    `json:"imgsz"` // model input edge the frame ran at
+	Model        string `json:"model"`
+	ModelVersion string `json:"model_version"` // SHA256 prefix of the model file
+	TS           int64  `json:"ts"`            // server clock, Unix milliseconds
+}
+
+// Time is the server clock when the frame was answered.
+func (f Frame) Time() time.Time { return time.UnixMilli(f.TS) }
+
+// ServerError is an error message sent by the server in place of a result,
+// e.g. a frame that could not be decoded or was rate limited.
+type ServerError struct {
+	FrameID uint64 `json:"-"` // the frame it answers; 0 for a bad control message
+	Message string `json:"error"`
+	Code    string `json:"code,omitempty"` // "decode_error", "rate_limited", ...
+}
+
+func (e *ServerError) Error() string {
+	if e.Code != "" {
+		return e.Code + ": " + e.Message
+	}
+	return e.Message
+}
+
+// HandshakeError is returned by Dial when the server refused the upgrade.
+type HandshakeError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *HandshakeError) Error() string {
+	return fmt.Sprintf("handshake: %d %s", e.StatusCode, e.Message)
+}
+
+// Temporary reports whether retrying the handshake can succeed: the server
+// was full or unavailable rather than rejecting the request itself.
+func (e *HandshakeError) Temporary() bool {
+	return e.StatusCode == http.StatusServiceUnavailable || e.StatusCode == http.StatusTooManyRequests ||
+		e.StatusCode >= 500
+}
+
+// ── 연결 ─────────────────────────────────────────────────────────────────────
+
+// Conn is one /ws/stream connection. The server answers frames one at a
+// time and in order, so Detect is safe to call from a single goroutine
+// only; use one Conn per goroutine.
+type Conn struct {
+	ws           *websocket.Conn
+	quality      Quality
+	advice       Advice
+	skipped      bool
+	interpolated bool
+	frame        Frame
+	crowd        *Crowd
+	resume       string
+	resumed      bool
+	arming       string
+}
+
+// Dial connects to rawURL (ws:// or wss://, including the /ws/stream path).
+func Dial(ctx context.Context, rawURL string, opts Options) (*Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	if !opts.ROI.Empty() {
+		r := opts.ROI
+		q.Set("roi", fmt.Sprintf("%d,%d,%d,%d", r.Min.X, r.Min.Y, r.Max.X, r.Max.Y))
+	}
+	for _, r := range opts.Mask {
+		q.Add("mask", fmt.Sprintf("%d,%d,%d,%d", r.Min.X, r.Min.Y, r.Max.X, r.Max.Y))
+	}
+	if opts.Tile {
+		q.Set("tile", "true")
+	}
+	if opts.TTA {
+		q.Set("tta", "true")
+	}
+	if opts.ImgSz > 0 {
+		q.Set("imgsz", strconv.Itoa(opts.ImgSz))
+	}
+	if opts.Every > 0 {
+		q.Set("every", strconv.Itoa(opts.Every))
+	}
+	if opts.FPS > 0 {
+		q.Set("fps", strconv.FormatFloat(opts.FPS, 'f', -1, 64))
+	}
+	if opts.Crops != "" {
+		q.Set("crops", opts.Crops)
+	}
+	if opts.Crowd {
+		q.Set("crowd", "true")
+	}
+	for name, r := range opts.CrowdZones {
+		q.Add("crowd_zone", fmt.Sprintf("%s:%d,%d,%d,%d", name, r.Min.X, r.Min.Y, r.Max.X, r.Max.Y))
+	}
+	if opts.Backpressure {
+		q.Set("flow", "advise")
+	}
+	if opts.ResumeToken != "" {
+		q.Set("resume", opts.ResumeToken)
+	}
+	u.RawQuery = q.Encode()
+
+	header := http.Header{}
+	for k, v := range opts.Header {
+		header[k] = v
+	}
+	if opts.APIKey != "" {
+		header.Set("X-API-Key", opts.APIKey)
+	}
+	if opts.Token != "" {
+		header.Set("Authorization", "Bearer "+opts.Token)
+	}
+	timeout := opts.HandshakeTimeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	dialer := websocket.Dialer{
+		Proxy:             http.ProxyFromEnvironment,
+		HandshakeTimeout:  timeout,
+		EnableCompression: opts.Compress,
+	}
+
+	ws, resp, err := dialer.DialContext(ctx, u.String(), header)
+	if err != nil {
+		if resp != nil {
+			return nil, handshakeError(resp)
+		}
+		return nil, err
+	}
+	return &Conn{ws: ws}, nil
+}
+
+// handshakeError reads the server's {"error": ...} body when there is one.
+func handshakeError(resp *http.Response) error {
+	defer resp.Body.Close()
+	e := &HandshakeError{StatusCode: resp.StatusCode, Message: resp.Status}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var se ServerError
+	if json.Unmarshal(body, &se) == nil && se.Message != "" {
+		e.Message = se.Message
+	}
+	return e
+}
+
+// Detect sends one encoded image and waits for its detections. A frame the
+// server rejected is reported as a *ServerError; the connection stays usable.
+func (c *Conn) Detect(frame []byte) ([]Detection, error) {
+	if err := c.ws.WriteMessage(websocket.BinaryMessage, frame); err != nil {
+		return nil, err
+	}
+	return c.read()
+}
+
+func (c *Conn) read() ([]Detection, error) {
+	for {
+		msgType, data, err := c.ws.ReadMessage()
+		if err != nil {
+			return nil, err
+		}
+		if msgType != websocket.TextMessage {
+			continue
+		}
+		var resp struct {
+			ID         uint64      `json:"frame"`
+			Detections []Detection `json:"detections"`
+			Skipped    bool        `json:"skipped"`
+			Interp     bool        `json:"interpolated"`
+			Crowd      *Crowd      `json:"crowd"`
+			Quality    *Quality    `json:"quality"`
+			Advice     *Advice     `json:"backpressure"`
+			Credits    *int        `json:"credits"`
+			Resume     *string     `json:"resume"`
+			Resumed    bool        `json:"resumed"`
+			Arming     *string     `json:"arming"`
+			Frame
+			ServerError
+		}
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return nil, fmt.Errorf("invalid response: %w", err)
+		}
+		// Notices, not answers. Credits need no tracking: Detect never has
+		// more than one frame outstanding.
+		switch {
+		case resp.Quality != nil:
+			c.quality = *resp.Quality
+			continue
+		case resp.Advice != nil:
+			c.advice = *resp.Advice
+			continue
+		case resp.Credits != nil:
+			continue
+		case resp.Resume != nil:
+			c.resume, c.resumed = *resp.Resume, resp.Resumed
+			continue
+		case resp.Arming != nil:
+			c.arming = *resp.Arming
+			continue
+		}
+		c.skipped, c.interpolated, c.frame, c.crowd = resp.Skipped, resp.Interp, resp.Frame, resp.Crowd
+		c.frame.ID, resp.FrameID = resp.ID, resp.ID
+		if resp.Message != "" {
+			return nil, &resp.ServerError
+		}
+		return resp.Detections, nil
+	}
+}
+
+// Control changes the stream settings mid-connection. A nil roi clears the
+// region of interest; nil tile/tta leave those settings unchanged. The
+// server only replies to an invalid control message, and that reply is
+// returned by the next Detect.
+func (c *Conn) Control(roi *image.Rectangle, tile, tta *bool) error {
+	msg := map[string]any{}
+	if roi != nil {
+		if roi.Empty() {
+			msg["roi"] = nil
+		} else {
+			msg["roi"] = []int{roi.Min.X, roi.Min.Y, roi.Max.X, roi.Max.Y}
+		}
+	}
+	if tile != nil {
+		msg["tile"] = *tile
+	}
+	if tta != nil {
+		msg["tta"] = *tta
+	}
+	return c.ws.WriteJSON(msg)
+}
+
+// Quality is the last quality level the server reported.
+func (c *Conn) Quality() Quality { return c.quality }
+
+// Advice is the last backpressure advice; zero unless Options.Backpressure.
+func (c *Conn) Advice() Advice { return c.advice }
+
+// Skipped reports whether the server did not run the model on the last
+// frame (sampling or adaptive frame skipping).
+func (c *Conn) Skipped() bool { return c.skipped }
+
+// Interpolated reports whether the last Detect result was predicted from
+// earlier frames rather than inferred; only skipped frames are answered
+// that way, and only with echo on (the server default).
+func (c *Conn) Interpolated() bool { return c.interpolated }
+
+// Frame is the metadata of the last answer; zero after an error.
+func (c *Conn) Frame() Frame { return c.frame }
+
+// Crowd is the last answer's people count; nil without Options.Crowd and
+// for skipped frames.
+func (c *Conn) Crowd() *Crowd { return c.crowd }
+
+// ResumeToken is the token that resumes this stream after it drops, once
+// the server has sent one; "" before that or when resuming is off.
+func (c *Conn) ResumeToken() string { return c.resume }
+
+// Resumed reports whether the server took over an earlier stream's state
+// from Options.ResumeToken.
+func (c *Conn) Resumed() bool { return c.resumed }
+
+// Arming is the stream's arming mode once the server has told it, e.g.
+// "disarmed"; frames are skipped without inference while disarmed.
+func (c *Conn) Arming() string { return c.arming }
+
+// Close sends a close frame and closes the connection.
+func (c *Conn) Close() error {
+	_ = c.ws.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	return c.ws.Close()
+}
+
+// ── 스트림 ───────────────────────────────────────────────────────────────────
+
+// Result is the answer to one frame, or a connection event when Err is set
+// and Detections is nil.
+type Result struct {
+	Detections []Detection
+	Latency    time.Duration // send to response
+	Skipped    bool          // the model did not run on this frame
+	Interp     bool          // Detections extrapolated from earlier frames
+	Quality    Quality       // server quality level when answered
+	Frame      Frame         // image size, input size, model and server time
+	Err        error
+}
+
+const (
+	minBackoff = 250 * time.Millisecond
+	maxBackoff = 10 * time.Second
+)
+
+// Stream sends every frame received from frames and delivers one Result
+// per frame on the returned channel, which is closed when ctx is done,
+// frames is closed, or the server rejects the handshake permanently (bad
+// credentials, bad options). Connection failures are reported as a Result
+// with Err set and followed by a reconnect with exponential backoff; the
+// frame in flight at that moment is lost. frames is not read while
+// reconnecting, so live sources should drop frames rather than block.
+func Stream(ctx context.Context, rawURL string, frames <-chan []byte, opts Options) <-chan Result {
+	out := make(chan Result, 1)
+	go func() {
+		defer close(out)
+		emit := func(r Result) bool {
+			select {
+			case out <- r:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		backoff := minBackoff
+		for ctx.Err() == nil {
+			conn, err := Dial(ctx, rawURL, opts)
+			if err != nil {
+				var he *HandshakeError
+				if errors.As(err, &he) && !he.Temporary() {
+					emit(Result{Err: err})
+					return
+				}
+				if !emit(Result{Err: err}) || !sleep(ctx, backoff) {
+					return
+				}
+				backoff = min(2*backoff, maxBackoff)
+				continue
+			}
+			backoff = minBackoff
+			done, err := pump(ctx, conn, frames, emit)
+			conn.Close()
+			if t := conn.ResumeToken(); t != "" {
+				opts.ResumeToken = t
+			}
+			if done {
+				return
+			}
+			if !emit(Result{Err: err}) || !sleep(ctx, backoff) {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// pump runs one connection until it fails (done=false, with the error) or
+// the stream is over (done=true).
+func pump(ctx context.Context, conn *Conn, frames <-chan []byte, emit func(Result) bool) (done bool, err error) {
+	// Unblock a pending read when ctx is cancelled.
+	stop := context.AfterFunc(ctx, func() { conn.ws.Close() })
+	defer stop()
+	var sent time.Time
+	for {
+		// Follow the server's advised rate before taking the next frame,
+		// so the frame sent is the freshest one.
+		if fps := conn.advice.FPS; fps > 0 && !sent.IsZero() {
+			if !sleep(ctx, time.Until(sent.Add(time.Duration(float64(time.Second)/fps)))) {
+				return true, nil
+			}
+		}
+		var frame []byte
+		var ok bool
+		select {
+		case frame, ok = <-frames:
+			if !ok {
+				return true, nil
+			}
+		case <-ctx.Done():
+			return true, nil
+		}
+		start := time.Now()
+		sent = start
+		dets, err := conn.Detect(frame)
+		var se *ServerError
+		if err != nil && !errors.As(err, &se) {
+			if ctx.Err() != nil {
+				return true, nil
+			}
+			return false, err
+		}
+		r := Result{Detections: dets, Latency: time.Since(start), Skipped: conn.Skipped(), Interp: conn.Interpolated(), Quality: conn.Quality(), Frame: conn.Frame(), Err: err}
+		if !emit(r) {
+			return true, nil
+		}
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// String formats d as name(score)[x1,y1,x2,y2], for logging.
+func (d Detection) String() string {
+	return fmt.Sprintf("%s(%.2f)[%d,%d,%d,%d]", d.Name, d.Score, d.Box[0], d.Box[1], d.Box[2], d.Box[3])
+}
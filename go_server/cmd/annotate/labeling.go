@@ -0,0 +1,161 @@
+//go:build !nocv
+
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+
+	"yolo-server/internal/postprocess"
+)
+
+// ── 라벨링 도구 ──────────────────────────────────────────────────────────────
+// Pre-annotations for labelling tools, so a project starts from the
+// model's boxes instead of empty images. labelStudio writes a task list
+// for Label Studio's JSON import, with the boxes as predictions of a
+// RectangleLabels control named "label" on an Image named "image";
+// cvatWriter writes a "CVAT for images 1.1" XML file. Video frames are
+// named "<file>#<frame>" as in the COCO file.
+
+// labelStudioTask is one imported task.
+type labelStudioTask struct {
+	Data struct {
+		Image string `json:"image"`
+	} `json:"data"`
+	Predictions []labelStudioPrediction `json:"predictions"`
+}
+
+type labelStudioPrediction struct {
+	ModelVersion string              `json:"model_version"`
+	Score        float64             `json:"score"` // mean box score
+	Result       []labelStudioResult `json:"result"`
+}
+
+// labelStudioResult is one box. Label Studio wants coordinates in percent
+// of the image.
+type labelStudioResult struct {
+	ID             string  `json:"id"`
+	Type           string  `json:"type"`
+	FromName       string  `json:"from_name"`
+	ToName         string  `json:"to_name"`
+	OriginalWidth  int     `json:"original_width"`
+	OriginalHeight int     `json:"original_height"`
+	ImageRotation  int     `json:"image_rotation"`
+	Score          float64 `json:"score"`
+	Value          struct {
+		X               float64  `json:"x"`
+		Y               float64  `json:"y"`
+		Width           float64  `json:"width"`
+		Height          float64  `json:"height"`
+		Rotation        float64  `json:"rotation"`
+		RectangleLabels []string `json:"rectanglelabels"`
+	} `json:"value"`
+}
+
+type labelStudio struct {
+	url     string // prefix of data.image
+	version string
+	tasks   []labelStudioTask
+}
+
+func newLabelStudio(url, version string) *labelStudio {
+	return &labelStudio{url: url, version: version, tasks: []labelStudioTask{}}
+}
+
+func (l *labelStudio) add(r record) error {
+	var t labelStudioTask
+	t.Data.Image = l.url + r.name()
+	p := labelStudioPrediction{ModelVersion: l.version, Result: []labelStudioResult{}}
+	for i, d := range r.Detections {
+		res := labelStudioResult{
+			ID: fmt.Sprintf("t%d-%d", len(l.tasks)+1, i+1), Type: "rectanglelabels",
+			FromName: "label", ToName: "image",
+			OriginalWidth: r.Width, OriginalHeight: r.Height, Score: d.Score,
+		}
+		w, h := float64(r.Width)/100, float64(r.Height)/100
+		res.Value.X, res.Value.Y = float64(d.Box[0])/w, float64(d.Box[1])/h
+		res.Value.Width, res.Value.Height = float64(d.Box[2]-d.Box[0])/w, float64(d.Box[3]-d.Box[1])/h
+		res.Value.RectangleLabels = []string{d.Name}
+		p.Result = append(p.Result, res)
+		p.Score += d.Score / float64(len(r.Detections))
+	}
+	t.Predictions = []labelStudioPrediction{p}
+	l.tasks = append(l.tasks, t)
+	return nil
+}
+
+func (l *labelStudio) write(w io.Writer) error { return json.NewEncoder(w).Encode(l.tasks) }
+
+// cvatWriter's labels are all the model's classes, so the project's
+// label set can be created from the file.
+
+type cvatLabel struct {
+	Name string `xml:"name"`
+}
+
+type cvatBox struct {
+	Label    string  `xml:"label,attr"`
+	Source   string  `xml:"source,attr"`
+	Occluded int     `xml:"occluded,attr"`
+	XTL      float64 `xml:"xtl,attr"`
+	YTL      float64 `xml:"ytl,attr"`
+	XBR      float64 `xml:"xbr,attr"`
+	YBR      float64 `xml:"ybr,attr"`
+	ZOrder   int     `xml:"z_order,attr"`
+}
+
+type cvatImage struct {
+	ID     int       `xml:"id,attr"`
+	Name   string    `xml:"name,attr"`
+	Width  int       `xml:"width,attr"`
+	Height int       `xml:"height,attr"`
+	Boxes  []cvatBox `xml:"box"`
+}
+
+type cvatWriter struct {
+	XMLName xml.Name    `xml:"annotations"`
+	Version string      `xml:"version"`
+	Labels  []cvatLabel `xml:"meta>task>labels>label"`
+	Images  []cvatImage `xml:"image"`
+}
+
+func newCVAT(labels postprocess.Labels) *cvatWriter {
+	ids := make([]int, 0, len(labels))
+	for id := range labels {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	c := &cvatWriter{Version: "1.1"}
+	for _, id := range ids {
+		c.Labels = append(c.Labels, cvatLabel{Name: labels[id]})
+	}
+	return c
+}
+
+func (c *cvatWriter) add(r record) error {
+	img := cvatImage{ID: len(c.Images), Name: r.name(), Width: r.Width, Height: r.Height}
+	for _, d := range r.Detections {
+		img.Boxes = append(img.Boxes, cvatBox{
+			Label: d.Name, Source: "auto",
+			XTL: float64(d.Box[0]), YTL: float64(d.Box[1]), XBR: float64(d.Box[2]), YBR: float64(d.Box[3]),
+		})
+	}
+	c.Images = append(c.Images, img)
+	return nil
+}
+
+func (c *cvatWriter) write(w io.Writer) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(c); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,300 @@
+//go:build !nocv
+
+// Command annotate runs the model locally, without a server, over a
+// directory of images or a video file and writes the detections as JSON
+// lines (one record per image or frame), as a COCO results file, as
+// Label Studio or CVAT pre-annotations to start a labelling project from,
+// or as Pascal VOC or YOLO txt label files, one per image in the -o
+// directory:
+//
+//	annotate -src ./images -o labels.jsonl
+//	annotate -src clip.mp4 -every 5 -format coco -o clip.json
+//	annotate -src ./images -format labelstudio -url /data/local-files/?d=images/ -o tasks.json
+//	annotate -src ./images -format yolo -o ./labels
+//
+// The pipeline is the server's own Engine, and engine and session settings
+// (TILE_SIZE, TTA_SCALES, INTRA_OP_THREADS, ...) come from the same
+// environment variables, so the output matches what clients would get.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gocv.io/x/gocv"
+
+	"yolo-server/internal/inference"
+	"yolo-server/internal/postprocess"
+	"yolo-server/internal/preprocess"
+	"yolo-server/internal/server"
+)
+
+// record is one JSONL line.
+type record struct {
+	Image      string                  `json:"image"`
+	Frame      *int                    `json:"frame,omitempty"` // video sources only
+	Width      int                     `json:"width"`
+	Height     int                     `json:"height"`
+	Detections []postprocess.Detection `json:"detections"`
+}
+
+func main() {
+	cfg, err := server.LoadConfig()
+	if err != nil {
+		fatal("config", err)
+	}
+	model := flag.String("model", cfg.ModelPath, "ONNX model")
+	ortLib := flag.String("ort", "/usr/local/lib/libonnxruntime.so", "ONNX Runtime shared library")
+	src := flag.String("src", "", "image directory or video file")
+	format := flag.String("format", "jsonl", "output format: jsonl, coco, labelstudio, cvat, voc or yolo")
+	imageURL := flag.String("url", "", "labelstudio: prefix of the tasks' image URLs")
+	outPath := flag.String("o", "-", "output file (- = stdout); voc and yolo: output directory")
+	every := flag.Int("every", 1, "video: annotate every Nth frame")
+	conf := flag.Float64("conf", cfg.ConfThreshold, "confidence threshold")
+	tile := flag.Bool("tile", false, "tiled inference")
+	tta := flag.Bool("tta", false, "test-time augmentation")
+	flag.Parse()
+	if *src == "" {
+		fatal("usage", fmt.Errorf("-src is required"))
+	}
+	switch *format {
+	case "jsonl", "coco", "labelstudio", "cvat":
+	case "voc", "yolo":
+		if *outPath == "-" {
+			fatal("usage", fmt.Errorf("-format %s writes a file per image: -o must be a directory", *format))
+		}
+	default:
+		fatal("usage", fmt.Errorf("unknown -format %q", *format))
+	}
+
+	if err := inference.Init(*ortLib); err != nil {
+		fatal("ORT init", err)
+	}
+	defer inference.Destroy()
+	backend, err := inference.NewORTBackend(*model, cfg.SessionOptions())
+	if err != nil {
+		fatal("model load", err)
+	}
+	info, err := inference.ReadModelInfo(*model)
+	if err != nil {
+		fatal("model metadata", err)
+	}
+	ec := cfg.EngineConfig()
+	ec.Task = info.Task()
+	if ec.Calibration, err = postprocess.LoadScoreCalibration(*model); err != nil {
+		fatal("score calibration", err)
+	}
+	if ec.Exclusive, err = postprocess.LoadExclusiveClasses(*model); err != nil {
+		fatal("exclusive classes", err)
+	}
+	engine, err := inference.New(backend, info.Labels(), ec)
+	if err != nil {
+		fatal("model", err)
+	}
+	defer engine.Close()
+	opts := inference.Options{ConfThreshold: *conf, NMSIoU: cfg.NMSIoU, Tile: *tile, TTA: *tta, Upright: true}
+
+	var out io.Writer = os.Stdout
+	if *format == "voc" || *format == "yolo" {
+		if err := os.MkdirAll(*outPath, 0o755); err != nil {
+			fatal("output", err)
+		}
+		out = io.Discard
+	} else if *outPath != "-" {
+		f, err := os.Create(*outPath)
+		if err != nil {
+			fatal("output", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	w := bufio.NewWriter(out)
+	defer w.Flush()
+
+	// jsonl, voc and yolo write as they go; the other formats are one
+	// document written at the end.
+	var sink func(record) error
+	var doc collector
+	switch *format {
+	case "coco":
+		doc = newCOCO(engine.Labels())
+	case "labelstudio":
+		doc = newLabelStudio(*imageURL, filepath.Base(*model))
+	case "cvat":
+		doc = newCVAT(engine.Labels())
+	case "voc":
+		doc = vocWriter{dir: *outPath}
+	case "yolo":
+		doc = yoloWriter{dir: *outPath, labels: engine.Labels()}
+	default:
+		enc := json.NewEncoder(w)
+		sink = func(r record) error { return enc.Encode(r) }
+	}
+	if doc != nil {
+		sink = doc.add
+	}
+
+	if fi, err := os.Stat(*src); err == nil && fi.IsDir() {
+		err = annotateDir(engine, *src, opts, sink)
+	} else {
+		err = annotateVideo(engine, *src, *every, opts, sink)
+	}
+	if err != nil {
+		fatal("annotate", err)
+	}
+	if doc != nil {
+		if err := doc.write(w); err != nil {
+			fatal("output", err)
+		}
+	}
+}
+
+// collector gathers the records of a whole run into one document, or
+// writes a file per record and whatever index the format needs at the end.
+type collector interface {
+	add(r record) error
+	write(w io.Writer) error
+}
+
+// name is the record's image name; video frames are "<file>#<frame>".
+func (r record) name() string {
+	if r.Frame != nil {
+		return fmt.Sprintf("%s#%d", r.Image, *r.Frame)
+	}
+	return r.Image
+}
+
+func fatal(what string, err error) {
+	slog.Error(what, "err", err)
+	os.Exit(1)
+}
+
+// annotateDir decodes each image like POST /detect does: EXIF orientation
+// applied, boxes in upright-image pixels. Undecodable files are skipped.
+func annotateDir(engine *inference.Engine, dir string, opts inference.Options, sink func(record) error) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	raw, img := gocv.NewMat(), gocv.NewMat()
+	defer raw.Close()
+	defer img.Close()
+	for _, e := range entries {
+		switch strings.ToLower(filepath.Ext(e.Name())) {
+		case ".jpg", ".jpeg", ".png", ".webp":
+		default:
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return err
+		}
+		if err := preprocess.Decode(data, &raw, gocv.IMReadColor|gocv.IMReadIgnoreOrientation); err != nil {
+			slog.Warn("skipped", "image", e.Name(), "err", err)
+			continue
+		}
+		preprocess.ApplyOrientation(raw, &img, preprocess.ExifOrientation(data))
+		dets, err := engine.DetectImage(img, opts)
+		if err != nil {
+			return fmt.Errorf("%s: %w", e.Name(), err)
+		}
+		if err := sink(record{Image: e.Name(), Width: img.Cols(), Height: img.Rows(), Detections: dets}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func annotateVideo(engine *inference.Engine, path string, every int, opts inference.Options, sink func(record) error) error {
+	capture, err := gocv.OpenVideoCapture(path)
+	if err != nil {
+		return err
+	}
+	defer capture.Close()
+	img := gocv.NewMat()
+	defer img.Close()
+	name := filepath.Base(path)
+	for n := 0; capture.Read(&img); n++ {
+		if img.Empty() || n%max(every, 1) != 0 {
+			continue
+		}
+		dets, err := engine.DetectImage(img, opts)
+		if err != nil {
+			return fmt.Errorf("frame %d: %w", n, err)
+		}
+		frame := n
+		if err := sink(record{Image: name, Frame: &frame, Width: img.Cols(), Height: img.Rows(), Detections: dets}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ── COCO ─────────────────────────────────────────────────────────────────────
+// cocoWriter collects the whole run into one COCO detection file: images,
+// annotations with [x, y, width, height] boxes and scores, and categories
+// from the model's class names.
+
+type cocoImage struct {
+	ID       int    `json:"id"`
+	FileName string `json:"file_name"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+}
+
+type cocoAnnotation struct {
+	ID         int        `json:"id"`
+	ImageID    int        `json:"image_id"`
+	CategoryID int        `json:"category_id"`
+	BBox       [4]float64 `json:"bbox"`
+	Area       float64    `json:"area"`
+	Score      float64    `json:"score"`
+	IsCrowd    int        `json:"iscrowd"`
+}
+
+type cocoCategory struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type cocoWriter struct {
+	Images      []cocoImage      `json:"images"`
+	Annotations []cocoAnnotation `json:"annotations"`
+	Categories  []cocoCategory   `json:"categories"`
+}
+
+func newCOCO(labels postprocess.Labels) *cocoWriter {
+	c := &cocoWriter{Images: []cocoImage{}, Annotations: []cocoAnnotation{}, Categories: []cocoCategory{}}
+	for id, name := range labels {
+		c.Categories = append(c.Categories, cocoCategory{ID: id, Name: name})
+	}
+	sort.Slice(c.Categories, func(i, j int) bool { return c.Categories[i].ID < c.Categories[j].ID })
+	return c
+}
+
+func (c *cocoWriter) add(r record) error {
+	img := cocoImage{ID: len(c.Images) + 1, FileName: r.name(), Width: r.Width, Height: r.Height}
+	c.Images = append(c.Images, img)
+	for _, d := range r.Detections {
+		w, h := float64(d.Box[2]-d.Box[0]), float64(d.Box[3]-d.Box[1])
+		c.Annotations = append(c.Annotations, cocoAnnotation{
+			ID:         len(c.Annotations) + 1,
+			ImageID:    img.ID,
+			CategoryID: d.Label,
+			BBox:       [4]float64{float64(d.Box[0]), float64(d.Box[1]), w, h},
+			Area:       w * h,
+			Score:      d.Score,
+		})
+	}
+	return nil
+}
+
+func (c *cocoWriter) write(w io.Writer) error { return json.NewEncoder(w).Encode(c) }
@@ -0,0 +1,132 @@
+//go:build !nocv
+
+package main
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"yolo-server/internal/postprocess"
+)
+
+// ── 학습 데이터 ──────────────────────────────────────────────────────────────
+// Per-image label files for training pipelines, written into the -o
+// directory as records arrive: vocWriter writes Pascal VOC XML, yoloWriter
+// YOLO txt lines "class cx cy w h" normalised to the image size, plus
+// classes.txt with the class names by id at the end. Files are named after
+// the image without its extension; a video's frames are "<video>_<frame>",
+// to pair with frames extracted under that name.
+
+// fileStem is the label file name of r, without extension.
+func fileStem(r record) string {
+	stem := strings.TrimSuffix(r.Image, filepath.Ext(r.Image))
+	if r.Frame != nil {
+		return fmt.Sprintf("%s_%06d", stem, *r.Frame)
+	}
+	return stem
+}
+
+type vocObject struct {
+	Name      string `xml:"name"`
+	Pose      string `xml:"pose"`
+	Truncated int    `xml:"truncated"`
+	Difficult int    `xml:"difficult"`
+	BndBox    struct {
+		XMin int `xml:"xmin"`
+		YMin int `xml:"ymin"`
+		XMax int `xml:"xmax"`
+		YMax int `xml:"ymax"`
+	} `xml:"bndbox"`
+}
+
+type vocAnnotation struct {
+	XMLName  xml.Name `xml:"annotation"`
+	Folder   string   `xml:"folder"`
+	Filename string   `xml:"filename"`
+	Size     struct {
+		Width  int `xml:"width"`
+		Height int `xml:"height"`
+		Depth  int `xml:"depth"`
+	} `xml:"size"`
+	Segmented int         `xml:"segmented"`
+	Objects   []vocObject `xml:"object"`
+}
+
+type vocWriter struct{ dir string }
+
+func (v vocWriter) add(r record) error {
+	a := vocAnnotation{Folder: filepath.Base(v.dir), Filename: r.Image}
+	if r.Frame != nil {
+		a.Filename = fileStem(r) + ".jpg"
+	}
+	a.Size.Width, a.Size.Height, a.Size.Depth = r.Width, r.Height, 3
+	for _, d := range r.Detections {
+		o := vocObject{Name: d.Name, Pose: "Unspecified"}
+		// VOC boxes are 1-based and inclusive.
+		o.BndBox.XMin, o.BndBox.YMin = d.Box[0]+1, d.Box[1]+1
+		o.BndBox.XMax, o.BndBox.YMax = d.Box[2], d.Box[3]
+		o.Truncated = btoi(d.Box[0] <= 0 || d.Box[1] <= 0 || d.Box[2] >= r.Width || d.Box[3] >= r.Height)
+		a.Objects = append(a.Objects, o)
+	}
+	data, err := xml.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(v.dir, fileStem(r)+".xml"), append(data, '\n'), 0o644)
+}
+
+func (vocWriter) write(io.Writer) error { return nil }
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+type yoloWriter struct {
+	dir    string
+	labels postprocess.Labels
+}
+
+// add writes an empty file for an image without boxes, which YOLO trainers
+// read as a background image.
+func (y yoloWriter) add(r record) error {
+	var b strings.Builder
+	w, h := float64(r.Width), float64(r.Height)
+	for _, d := range r.Detections {
+		fmt.Fprintf(&b, "%d %.6f %.6f %.6f %.6f\n", d.Label,
+			float64(d.Box[0]+d.Box[2])/2/w, float64(d.Box[1]+d.Box[3])/2/h,
+			float64(d.Box[2]-d.Box[0])/w, float64(d.Box[3]-d.Box[1])/h)
+	}
+	return os.WriteFile(filepath.Join(y.dir, fileStem(r)+".txt"), []byte(b.String()), 0o644)
+}
+
+// write writes classes.txt, line i holding class i's name.
+func (y yoloWriter) write(io.Writer) error {
+	f, err := os.Create(filepath.Join(y.dir, "classes.txt"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	ids := make([]int, 0, len(y.labels))
+	for id := range y.labels {
+		ids = append(ids, id)
+	}
+	if len(ids) > 0 {
+		for id := 0; id <= slices.Max(ids); id++ {
+			fmt.Fprintln(w, y.labels.Name(id))
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,187 @@
+// Command bench load-tests a server: -c connections each replay the images
+// in -corpus over /ws/stream at -fps for -d, then the latency percentiles,
+// throughput and error counts are printed:
+//
+//	bench -url ws://host:8080/ws/stream -corpus ./frames -c 16 -fps 10 -d 1m
+//
+// Each connection waits for a response before sending the next frame, so
+// when the server can't keep up the achieved rate falls below -c × -fps
+// instead of queuing.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"yolo-server/client"
+	"yolo-server/internal/latency"
+)
+
+type counters struct {
+	frames   atomic.Int64
+	dials    atomic.Int64
+	connErrs atomic.Int64
+
+	mu       sync.Mutex
+	rejected map[string]int // server error code (or message) → count
+}
+
+func (c *counters) reject(err *client.ServerError) {
+	key := err.Code
+	if key == "" {
+		key = err.Message
+	}
+	c.mu.Lock()
+	c.rejected[key]++
+	c.mu.Unlock()
+}
+
+func main() {
+	url := flag.String("url", "ws://localhost:8080/ws/stream", "server /ws/stream URL")
+	corpus := flag.String("corpus", "", "directory of JPEG/PNG/WebP frames to replay")
+	conns := flag.Int("c", 4, "concurrent connections")
+	fps := flag.Float64("fps", 0, "frames per second per connection (0 = as fast as possible)")
+	duration := flag.Duration("d", 30*time.Second, "test duration")
+	key := flag.String("key", os.Getenv("API_KEY"), "API key")
+	token := flag.String("token", "", "JWT bearer token")
+	flag.Parse()
+
+	frames, err := loadCorpus(*corpus)
+	if err != nil {
+		slog.Error("corpus", "err", err)
+		os.Exit(1)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, *duration)
+	defer cancel()
+
+	opts := client.Options{APIKey: *key, Token: *token}
+	c := &counters{rejected: make(map[string]int)}
+	var rec latency.Recorder
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < *conns; i++ {
+		wg.Add(1)
+		go func(offset int) {
+			defer wg.Done()
+			worker(ctx, *url, opts, frames, offset, *fps, c, &rec)
+		}(i)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	s := rec.Summary(false)
+	fmt.Printf("connections  %d (%d dials, %d connection errors)\n", *conns, c.dials.Load(), c.connErrs.Load())
+	fmt.Printf("frames       %d in %s, %.1f successful/s\n", c.frames.Load(), elapsed.Round(time.Millisecond),
+		float64(s.Count)/elapsed.Seconds())
+	fmt.Printf("latency      %s\n", s)
+	var rejected int
+	codes := make([]string, 0, len(c.rejected))
+	for code, n := range c.rejected {
+		rejected += n
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	if total := c.frames.Load(); total > 0 {
+		fmt.Printf("errors       %d (%.2f%%)\n", rejected, 100*float64(rejected)/float64(total))
+	}
+	for _, code := range codes {
+		fmt.Printf("  %-24s %d\n", code, c.rejected[code])
+	}
+}
+
+// worker keeps one connection busy until ctx ends, redialling on failure.
+// offset staggers the corpus so connections don't all send the same frame.
+func worker(ctx context.Context, url string, opts client.Options, frames [][]byte, offset int, fps float64, c *counters, rec *latency.Recorder) {
+	var tick <-chan time.Time
+	if fps > 0 {
+		t := time.NewTicker(time.Duration(float64(time.Second) / fps))
+		defer t.Stop()
+		tick = t.C
+	}
+	i := offset
+	for ctx.Err() == nil {
+		c.dials.Add(1)
+		conn, err := client.Dial(ctx, url, opts)
+		if err != nil {
+			if ctx.Err() == nil {
+				c.connErrs.Add(1)
+				slog.Warn("dial", "err", err)
+				select {
+				case <-time.After(time.Second):
+				case <-ctx.Done():
+				}
+			}
+			continue
+		}
+		stop := context.AfterFunc(ctx, func() { conn.Close() })
+		for ctx.Err() == nil {
+			if tick != nil {
+				select {
+				case <-tick:
+				case <-ctx.Done():
+				}
+				if ctx.Err() != nil {
+					break
+				}
+			}
+			sent := time.Now()
+			_, err := conn.Detect(frames[i%len(frames)])
+			i++
+			if ctx.Err() != nil {
+				break // interrupted, not a server failure
+			}
+			c.frames.Add(1)
+			var se *client.ServerError
+			if errors.As(err, &se) {
+				c.reject(se)
+				continue
+			}
+			if err != nil {
+				c.connErrs.Add(1)
+				slog.Warn("connection", "err", err)
+				break
+			}
+			rec.Add(time.Since(sent))
+		}
+		stop()
+		conn.Close()
+	}
+}
+
+func loadCorpus(dir string) ([][]byte, error) {
+	if dir == "" {
+		return nil, errors.New("-corpus is required")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var frames [][]byte
+	for _, e := range entries {
+		switch strings.ToLower(filepath.Ext(e.Name())) {
+		case ".jpg", ".jpeg", ".png", ".webp":
+			b, err := os.ReadFile(filepath.Join(dir, e.Name()))
+			if err != nil {
+				return nil, err
+			}
+			frames = append(frames, b)
+		}
+	}
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("no images in %s", dir)
+	}
+	return frames, nil
+}
@@ -0,0 +1,55 @@
+//go:build integration && !nocv
+
+package main
+
+import (
+	"flag"
+	"path/filepath"
+	"testing"
+
+	"yolo-server/internal/inference"
+)
+
+// Run with ONNX Runtime installed:
+//
+//	go test -tags integration ./cmd/golden
+//	go test -tags integration ./cmd/golden -args -ort /path/to/libonnxruntime.so
+var ortLib = flag.String("ort", "/usr/local/lib/libonnxruntime.so", "ONNX Runtime shared library")
+
+const (
+	testdata = "../../testdata"
+	boxTol   = 2
+	scoreTol = 0.01
+)
+
+func TestGolden(t *testing.T) {
+	if err := inference.Init(*ortLib); err != nil {
+		t.Fatalf("ORT init: %v", err)
+	}
+	defer inference.Destroy()
+	engine, err := loadEngine(filepath.Join(testdata, "tiny.onnx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close()
+
+	images, err := fixtureImages(filepath.Join(testdata, "golden"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, img := range images {
+		t.Run(filepath.Base(img), func(t *testing.T) {
+			got, err := detectFixture(engine, img, 0.4)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := readGolden(goldenPath(img))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, d := range compare(want, got, boxTol, scoreTol) {
+				t.Error(d)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+//go:build !nocv
+
+// Command golden is the regression check for the inference pipeline. It
+// runs every image in a fixtures directory through the same Engine the
+// server uses (decode, EXIF, resize, CHW, ONNX Runtime, postprocess) and
+// compares the boxes with the <image>.golden.json file next to it:
+//
+//	go run ./cmd/golden                 # compare
+//	go run ./cmd/golden -update         # rewrite goldens
+//
+// The defaults are the fixtures committed in testdata, made for the tiny
+// model there (see testdata/gen.go); golden_test.go runs the same check
+// under the integration build tag. Point -model and -dir elsewhere to
+// check a real model against goldens recorded with it.
+//
+// Boxes match when every corner is within -box-tol pixels and the score is
+// within -score-tol. The exit status is 1 on any mismatch.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"yolo-server/internal/inference"
+	"yolo-server/internal/postprocess"
+)
+
+const goldenSuffix = ".golden.json"
+
+func main() {
+	model := flag.String("model", "testdata/tiny.onnx", "ONNX model")
+	ortLib := flag.String("ort", "/usr/local/lib/libonnxruntime.so", "ONNX Runtime shared library")
+	dir := flag.String("dir", "testdata/golden", "fixture images and their goldens")
+	update := flag.Bool("update", false, "write goldens instead of comparing")
+	conf := flag.Float64("conf", 0.4, "confidence threshold")
+	boxTol := flag.Int("box-tol", 2, "allowed per-corner box difference in pixels")
+	scoreTol := flag.Float64("score-tol", 0.01, "allowed score difference")
+	flag.Parse()
+
+	if err := inference.Init(*ortLib); err != nil {
+		fatal("ORT init", err)
+	}
+	defer inference.Destroy()
+	engine, err := loadEngine(*model)
+	if err != nil {
+		fatal("model", err)
+	}
+	defer engine.Close()
+
+	images, err := fixtureImages(*dir)
+	if err != nil {
+		fatal("fixtures", err)
+	}
+	failed := 0
+	for _, img := range images {
+		got, err := detectFixture(engine, img, *conf)
+		if err != nil {
+			fmt.Printf("FAIL %s: %v\n", img, err)
+			failed++
+			continue
+		}
+		golden := goldenPath(img)
+		if *update {
+			if err := writeGolden(golden, got); err != nil {
+				fatal("write", err)
+			}
+			fmt.Printf("wrote %s (%d boxes)\n", golden, len(got))
+			continue
+		}
+		want, err := readGolden(golden)
+		if err != nil {
+			fmt.Printf("FAIL %s: %v\n", img, err)
+			failed++
+			continue
+		}
+		if diffs := compare(want, got, *boxTol, *scoreTol); len(diffs) > 0 {
+			fmt.Printf("FAIL %s\n", img)
+			for _, d := range diffs {
+				fmt.Printf("    %s\n", d)
+			}
+			failed++
+			continue
+		}
+		fmt.Printf("ok   %s (%d boxes)\n", img, len(got))
+	}
+	if failed > 0 {
+		fmt.Printf("%d of %d fixtures failed\n", failed, len(images))
+		os.Exit(1)
+	}
+}
+
+func fatal(what string, err error) {
+	slog.Error(what, "err", err)
+	os.Exit(2)
+}
+
+// loadEngine opens model in ONNX Runtime the way the server does, with
+// the labels and task from its metadata.
+func loadEngine(model string) (*inference.Engine, error) {
+	info, err := inference.ReadModelInfo(model)
+	if err != nil {
+		return nil, fmt.Errorf("metadata: %w", err)
+	}
+	backend, err := inference.NewORTBackend(model, inference.SessionOptions{CPUMemArena: true, MemPattern: true})
+	if err != nil {
+		return nil, err
+	}
+	engine, err := inference.New(backend, info.Labels(), inference.Config{Task: info.Task()})
+	if err != nil {
+		backend.Close()
+		return nil, err
+	}
+	return engine, nil
+}
+
+// detectFixture runs the image at path upright, as /detect does, with the
+// boxes in sortDetections order.
+func detectFixture(engine *inference.Engine, path string, conf float64) ([]postprocess.Detection, error) {
+	frame, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	got, err := engine.Detect(frame, inference.Options{ConfThreshold: conf, Upright: true})
+	if err != nil {
+		return nil, err
+	}
+	sortDetections(got)
+	return got, nil
+}
+
+// goldenPath is testdata/golden/street.jpg → testdata/golden/street.golden.json.
+func goldenPath(img string) string {
+	return strings.TrimSuffix(img, filepath.Ext(img)) + goldenSuffix
+}
+
+func fixtureImages(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, e := range entries {
+		switch strings.ToLower(filepath.Ext(e.Name())) {
+		case ".jpg", ".jpeg", ".png", ".webp":
+			out = append(out, filepath.Join(dir, e.Name()))
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no images in %s", dir)
+	}
+	return out, nil
+}
+
+// sortDetections gives a stable order independent of the model's output
+// order: by label, then top-left corner.
+func sortDetections(d []postprocess.Detection) {
+	sort.Slice(d, func(i, j int) bool {
+		if d[i].Label != d[j].Label {
+			return d[i].Label < d[j].Label
+		}
+		if d[i].Box[1] != d[j].Box[1] {
+			return d[i].Box[1] < d[j].Box[1]
+		}
+		return d[i].Box[0] < d[j].Box[0]
+	})
+}
+
+func readGolden(path string) ([]postprocess.Detection, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var d []postprocess.Detection
+	if err := json.Unmarshal(raw, &d); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return d, nil
+}
+
+func writeGolden(path string, d []postprocess.Detection) error {
+	raw, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(raw, '\n'), 0o644)
+}
+
+// compare pairs boxes in order; the counts must match exactly.
+func compare(want, got []postprocess.Detection, boxTol int, scoreTol float64) []string {
+	if len(want) != len(got) {
+		return []string{fmt.Sprintf("want %d boxes, got %d", len(want), len(got))}
+	}
+	var diffs []string
+	for i := range want {
+		w, g := want[i], got[i]
+		if w.Label != g.Label {
+			diffs = append(diffs, fmt.Sprintf("#%d: label %d, want %d", i, g.Label, w.Label))
+			continue
+		}
+		for k := range w.Box {
+			if abs(w.Box[k]-g.Box[k]) > boxTol {
+				diffs = append(diffs, fmt.Sprintf("#%d: box %v, want %v", i, g.Box, w.Box))
+				break
+			}
+		}
+		if math.Abs(w.Score-g.Score) > scoreTol {
+			diffs = append(diffs, fmt.Sprintf("#%d: score %.4f, want %.4f", i, g.Score, w.Score))
+		}
+	}
+	return diffs
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,161 @@
+//go:build !nocv
+
+// Command streamcli streams a camera, RTSP stream or video file to a
+// running server's /ws/stream and prints the detections, optionally drawing
+// them in a window, with periodic latency statistics:
+//
+//	streamcli -src 0                                   # first camera
+//	streamcli -src rtsp://cam/stream -fps 10 -show
+//	streamcli -src clip.mp4 -url wss://host/ws/stream -key $KEY
+//
+// Frames are captured at -fps and dropped while the server is still busy
+// with the previous one, like a live client would.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"time"
+
+	"gocv.io/x/gocv"
+
+	"yolo-server/client"
+	"yolo-server/internal/latency"
+)
+
+func main() {
+	url := flag.String("url", "ws://localhost:8080/ws/stream", "server /ws/stream URL")
+	src := flag.String("src", "0", "camera index, RTSP URL or video file")
+	fps := flag.Float64("fps", 0, "frames per second to send (0 = source rate)")
+	quality := flag.Int("quality", 80, "JPEG quality")
+	key := flag.String("key", os.Getenv("API_KEY"), "API key")
+	token := flag.String("token", "", "JWT bearer token")
+	show := flag.Bool("show", false, "draw detections in a window")
+	quiet := flag.Bool("quiet", false, "don't print detections, only stats")
+	statsEvery := flag.Duration("stats", 5*time.Second, "stats interval")
+	limit := flag.Int("n", 0, "stop after this many frames (0 = until the source ends)")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var source any = *src
+	if idx, err := strconv.Atoi(*src); err == nil {
+		source = idx
+	}
+	capture, err := gocv.OpenVideoCapture(source)
+	if err != nil {
+		fatal("open source", err)
+	}
+	defer capture.Close()
+	rate := *fps
+	if rate <= 0 {
+		if rate = capture.Get(gocv.VideoCaptureFPS); rate <= 0 {
+			rate = 30
+		}
+	}
+
+	frames := make(chan []byte) // unbuffered: a send only succeeds when the stream is idle
+	results := client.Stream(ctx, *url, frames, client.Options{APIKey: *key, Token: *token})
+
+	var window *gocv.Window
+	if *show {
+		window = gocv.NewWindow("streamcli")
+		defer window.Close()
+	}
+	img := gocv.NewMat()
+	defer img.Close()
+
+	var rec latency.Recorder
+	var sent, dropped, failed int
+	var last []client.Detection
+	out := json.NewEncoder(os.Stdout)
+	report := func(prefix string) {
+		fmt.Fprintf(os.Stderr, "%s sent=%d dropped=%d errors=%d %s\n", prefix, sent, dropped, failed, rec.Summary(false))
+	}
+	tick := time.NewTicker(time.Duration(float64(time.Second) / rate))
+	defer tick.Stop()
+	statsTick := time.NewTicker(*statsEvery)
+	defer statsTick.Stop()
+
+loop:
+	for *limit == 0 || sent < *limit {
+		select {
+		case <-ctx.Done():
+			break loop
+		case r, ok := <-results:
+			if !ok {
+				break loop
+			}
+			if r.Err != nil {
+				failed++
+				slog.Warn("stream", "err", r.Err)
+				continue
+			}
+			rec.Add(r.Latency)
+			last = r.Detections
+			if !*quiet {
+				_ = out.Encode(r.Detections)
+			}
+			continue
+		case <-statsTick.C:
+			report("stats")
+			continue
+		case <-tick.C:
+		}
+
+		if !capture.Read(&img) {
+			break
+		}
+		if img.Empty() {
+			continue
+		}
+		buf, err := gocv.IMEncodeWithParams(gocv.JPEGFileExt, img, []int{gocv.IMWriteJpegQuality, *quality})
+		if err != nil {
+			fatal("encode", err)
+		}
+		select {
+		case frames <- buf.GetBytes():
+			sent++
+		default:
+			dropped++
+		}
+		buf.Close()
+
+		if window != nil {
+			draw(&img, last)
+			window.IMShow(img)
+			if window.WaitKey(1) == 'q' {
+				break
+			}
+		}
+	}
+	close(frames)
+	report("total")
+}
+
+var boxColor = color.RGBA{0, 255, 0, 0}
+
+// draw paints the latest detections on img. They belong to an earlier
+// frame, which is close enough for eyeballing a live stream.
+func draw(img *gocv.Mat, dets []client.Detection) {
+	for _, d := range dets {
+		r := image.Rect(d.Box[0], d.Box[1], d.Box[2], d.Box[3])
+		gocv.Rectangle(img, r, boxColor, 2)
+		gocv.PutText(img, fmt.Sprintf("%s %.2f", d.Name, d.Score), image.Pt(r.Min.X, r.Min.Y-4),
+			gocv.FontHersheySimplex, 0.5, boxColor, 1)
+	}
+}
+
+func fatal(what string, err error) {
+	slog.Error(what, "err", err)
+	os.Exit(1)
+}
@@ -0,0 +1,226 @@
+// Package calib maps image pixels of calibrated cameras onto a common
+// ground plane, in metres.
+package calib
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+)
+
+// ── 카메라 보정 ──────────────────────────────────────────────────────────────
+// A calibration file names the cameras by stream id. Each is calibrated by
+// a homography, by its intrinsics and pose, or only by a scale:
+//
+//	{"cam-1": {"homography": [[h11, h12, h13], [h21, h22, h23], [h31, h32, h33]],
+//	           "position": [x, y]},
+//	 "cam-2": {"intrinsics": {"fx": 1000, "fy": 1000, "cx": 960, "cy": 540},
+//	           "pose": {"x": 0, "y": 0, "height": 4.5, "yaw": 90, "pitch": 30, "roll": 0}},
+//	 "cam-3": {"pixels_per_metre": 40}}
+//
+// The homography takes image pixels (x, y, 1) to ground-plane metres
+// (X, Y, W) up to scale, as OpenCV's findHomography over four or more
+// surveyed points computes it; the optional position is where the camera
+// stands, for distances. The pose places a pinhole camera height metres
+// above (x, y), looking yaw degrees from +X toward +Y, pitch degrees below
+// the horizon and rolled clockwise by roll; lens distortion is not
+// modelled. A scale places nothing on the plane and only measures speed,
+// for a camera looking square onto a road. Cameras that share a plane's
+// origin and axes see the same point at the same coordinates.
+
+// Homography is a row-major 3×3 matrix.
+type Homography [3][3]float64
+
+// apply maps (x, y) through h; ok is false on the horizon, which maps to
+// infinity.
+func (h *Homography) apply(x, y float64) (gx, gy float64, ok bool) {
+	w := h[2][0]*x + h[2][1]*y + h[2][2]
+	if math.Abs(w) < 1e-12 {
+		return 0, 0, false
+	}
+	gx = (h[0][0]*x + h[0][1]*y + h[0][2]) / w
+	gy = (h[1][0]*x + h[1][1]*y + h[1][2]) / w
+	return gx, gy, true
+}
+
+// inverse is h⁻¹, or false if h is singular.
+func (h *Homography) inverse() (Homography, bool) {
+	a := h
+	c00 := a[1][1]*a[2][2] - a[1][2]*a[2][1]
+	c01 := a[1][2]*a[2][0] - a[1][0]*a[2][2]
+	c02 := a[1][0]*a[2][1] - a[1][1]*a[2][0]
+	det := a[0][0]*c00 + a[0][1]*c01 + a[0][2]*c02
+	if math.Abs(det) < 1e-18 {
+		return Homography{}, false
+	}
+	return Homography{
+		{c00 / det, (a[0][2]*a[2][1] - a[0][1]*a[2][2]) / det, (a[0][1]*a[1][2] - a[0][2]*a[1][1]) / det},
+		{c01 / det, (a[0][0]*a[2][2] - a[0][2]*a[2][0]) / det, (a[0][2]*a[1][0] - a[0][0]*a[1][2]) / det},
+		{c02 / det, (a[0][1]*a[2][0] - a[0][0]*a[2][1]) / det, (a[0][0]*a[1][1] - a[0][1]*a[1][0]) / det},
+	}, true
+}
+
+// Intrinsics are a pinhole camera's focal lengths and principal point, in
+// pixels.
+type Intrinsics struct {
+	FX float64 `json:"fx"`
+	FY float64 `json:"fy"`
+	CX float64 `json:"cx"`
+	CY float64 `json:"cy"`
+}
+
+// Pose is where a camera stands and which way it looks.
+type Pose struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Height float64 `json:"height"`
+	Yaw    float64 `json:"yaw"`   // degrees from +X toward +Y
+	Pitch  float64 `json:"pitch"` // degrees below the horizon
+	Roll   float64 `json:"roll"`  // degrees, clockwise as the camera sees
+}
+
+// Camera is one stream's calibration. Prepare it before use.
+type Camera struct {
+	Homography *Homography `json:"homography,omitempty"`
+	Position   *[2]float64 `json:"position,omitempty"` // with Homography
+	Intrinsics *Intrinsics `json:"intrinsics,omitempty"`
+	Pose       *Pose       `json:"pose,omitempty"`
+	Scale      float64     `json:"pixels_per_metre,omitempty"`
+
+	toGround Homography
+	forward  [3]float64 // optical axis in plane coordinates; zero without a pose
+}
+
+// Prepare checks c and works out its image-to-ground mapping.
+func (c *Camera) Prepare() error {
+	switch {
+	case c.Scale != 0 && (c.Homography != nil || c.Position != nil || c.Intrinsics != nil || c.Pose != nil):
+		return fmt.Errorf("want pixels_per_metre alone")
+	case c.Scale < 0:
+		return fmt.Errorf("pixels_per_metre: want a positive number")
+	case c.Scale > 0:
+		return nil
+	case c.Homography != nil && (c.Intrinsics != nil || c.Pose != nil):
+		return fmt.Errorf("want a homography or intrinsics and pose, not both")
+	case c.Homography != nil:
+		if _, ok := c.Homography.inverse(); !ok {
+			return fmt.Errorf("homography is singular")
+		}
+		c.toGround = *c.Homography
+		return nil
+	case c.Intrinsics == nil || c.Pose == nil:
+		return fmt.Errorf("want a homography, intrinsics and a pose, or pixels_per_metre")
+	case c.Intrinsics.FX <= 0 || c.Intrinsics.FY <= 0:
+		return fmt.Errorf("intrinsics: want positive fx and fy")
+	case c.Pose.Height <= 0:
+		return fmt.Errorf("pose: want a positive height")
+	case c.Pose.Pitch <= 0 || c.Pose.Pitch >= 180:
+		return fmt.Errorf("pose: want a pitch in (0, 180), looking down at the ground")
+	}
+	p, k := c.Pose, c.Intrinsics
+	rad := math.Pi / 180
+	yaw, pitch, roll := p.Yaw*rad, p.Pitch*rad, p.Roll*rad
+	// Camera axes in plane coordinates, Z up: x right, y down, z forward.
+	f := [3]float64{math.Cos(pitch) * math.Cos(yaw), math.Cos(pitch) * math.Sin(yaw), -math.Sin(pitch)}
+	r0 := [3]float64{math.Sin(yaw), -math.Cos(yaw), 0}
+	d0 := cross(f, r0)
+	var r, d [3]float64
+	for i := range r {
+		r[i] = r0[i]*math.Cos(roll) + d0[i]*math.Sin(roll)
+		d[i] = -r0[i]*math.Sin(roll) + d0[i]*math.Cos(roll)
+	}
+	// A ground point (X, Y, 0) is at R·(P - C) in camera coordinates, so
+	// ground to image is K·[R₀ R₁ -R·C].
+	cam := [3]float64{p.X, p.Y, p.Height}
+	rows := [3][3]float64{r, d, f}
+	var rt Homography
+	for i, row := range rows {
+		rt[i] = [3]float64{row[0], row[1], -(row[0]*cam[0] + row[1]*cam[1] + row[2]*cam[2])}
+	}
+	var h Homography
+	for j := range 3 {
+		h[0][j] = k.FX*rt[0][j] + k.CX*rt[2][j]
+		h[1][j] = k.FY*rt[1][j] + k.CY*rt[2][j]
+		h[2][j] = rt[2][j]
+	}
+	inv, ok := h.inverse()
+	if !ok {
+		return fmt.Errorf("pose: the camera does not see the ground")
+	}
+	c.toGround, c.forward = inv, f
+	return nil
+}
+
+func cross(a, b [3]float64) [3]float64 {
+	return [3]float64{a[1]*b[2] - a[2]*b[1], a[2]*b[0] - a[0]*b[2], a[0]*b[1] - a[1]*b[0]}
+}
+
+// Ground is where the image point (x, y) lies on the plane; ok is false
+// for points at or, with a pose, above the horizon, and for a scale.
+func (c *Camera) Ground(x, y float64) (gx, gy float64, ok bool) {
+	if c.Scale > 0 {
+		return 0, 0, false
+	}
+	if gx, gy, ok = c.toGround.apply(x, y); !ok || c.Pose == nil {
+		return gx, gy, ok
+	}
+	// Past the horizon the mapping wraps round to behind the camera.
+	p := c.Pose
+	ahead := c.forward[0]*(gx-p.X) + c.forward[1]*(gy-p.Y) + c.forward[2]*-p.Height
+	return gx, gy, ahead > 0
+}
+
+// Distance is how far the ground point (gx, gy) is from the foot of the
+// camera; ok is false when the camera's position is not known.
+func (c *Camera) Distance(gx, gy float64) (float64, bool) {
+	switch {
+	case c.Pose != nil:
+		return math.Hypot(gx-c.Pose.X, gy-c.Pose.Y), true
+	case c.Position != nil:
+		return math.Hypot(gx-c.Position[0], gy-c.Position[1]), true
+	}
+	return 0, false
+}
+
+// speedStep is the time over which Speed follows a velocity; short enough
+// that the mapping is nearly straight along it.
+const speedStep = 0.1
+
+// Speed is how fast, in m/s, a point at image (x, y) moving (vx, vy) px/s
+// goes across the plane; ok is false where Ground is.
+func (c *Camera) Speed(x, y, vx, vy float64) (float64, bool) {
+	if c.Scale > 0 {
+		return math.Hypot(vx, vy) / c.Scale, true
+	}
+	gx1, gy1, ok1 := c.Ground(x, y)
+	gx0, gy0, ok0 := c.Ground(x-vx*speedStep, y-vy*speedStep)
+	if !ok0 || !ok1 {
+		return 0, false
+	}
+	return math.Hypot(gx1-gx0, gy1-gy0) / speedStep, true
+}
+
+// Cameras are the calibrated streams by id.
+type Cameras map[string]*Camera
+
+// Load reads a calibration file.
+func Load(path string) (Cameras, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cams Cameras
+	if err := json.Unmarshal(b, &cams); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for id, c := range cams {
+		if c == nil {
+			return nil, fmt.Errorf("%s: camera %q: want a calibration", path, id)
+		}
+		if err := c.Prepare(); err != nil {
+			return nil, fmt.Errorf("%s: camera %q: %w", path, id, err)
+		}
+	}
+	return cams, nil
+}
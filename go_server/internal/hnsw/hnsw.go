@@ -0,0 +1,269 @@
+// Package hnsw is an in-process approximate nearest neighbour index over
+// unit vectors: a Hierarchical Navigable Small World graph (Malkov and
+// Yashunin, 2016) under cosine distance.
+package hnsw
+
+import (
+	"container/heap"
+	"math"
+	"math/rand/v2"
+	"sort"
+)
+
+// ── 색인 ─────────────────────────────────────────────────────────────────────
+// Every vector is a node on layer 0 and, with geometrically falling odds,
+// on the layers above, each linked to at most M neighbours (2M on layer 0).
+// A search descends greedily from the top layer's entry point and widens
+// to the ef nearest candidates on layer 0. Deleted nodes stay in the graph
+// for navigation until they outnumber the live ones, when it is rebuilt.
+// An Index is not safe for concurrent use.
+
+// Result is a found vector and its cosine distance, 1 - similarity.
+type Result struct {
+	ID       uint64
+	Distance float32
+}
+
+type node struct {
+	id      uint64
+	vec     []float32
+	links   [][]int32 // by layer
+	deleted bool
+}
+
+// Index is an HNSW graph of vectors by ID.
+type Index struct {
+	m, efConstruction int
+	ml                float64 // level multiplier, 1/ln(M)
+	nodes             []*node
+	slots             map[uint64]int32 // live nodes by ID
+	entry             int32            // -1 when empty
+	top               int              // entry's layer
+	rng               *rand.Rand
+}
+
+// New returns an empty index linking each node to m neighbours, built with
+// efConstruction candidates per insert.
+func New(m, efConstruction int) *Index {
+	m = max(m, 2)
+	return &Index{
+		m: m, efConstruction: max(efConstruction, m),
+		ml:    1 / math.Log(float64(m)),
+		slots: map[uint64]int32{},
+		entry: -1,
+		rng:   rand.New(rand.NewPCG(1, 2)),
+	}
+}
+
+// Len is the number of live vectors.
+func (x *Index) Len() int { return len(x.slots) }
+
+// Add inserts vec, a unit vector, as id, replacing id's vector if it is
+// already there. x keeps vec.
+func (x *Index) Add(id uint64, vec []float32) {
+	x.Delete(id)
+	level := int(-math.Log(1-x.rng.Float64()) * x.ml)
+	n := &node{id: id, vec: vec, links: make([][]int32, level+1)}
+	slot := int32(len(x.nodes))
+	x.nodes = append(x.nodes, n)
+	x.slots[id] = slot
+	if x.entry < 0 {
+		x.entry, x.top = slot, level
+		return
+	}
+	ep := x.entry
+	for l := x.top; l > level; l-- {
+		ep = x.greedy(vec, ep, l)
+	}
+	for l := min(level, x.top); l >= 0; l-- {
+		cands := x.searchLayer(vec, ep, x.efConstruction, l)
+		n.links[l] = x.selectNeighbours(cands, x.maxLinks(l))
+		for _, nb := range n.links[l] {
+			x.link(nb, slot, l)
+		}
+		ep = cands[0].slot
+	}
+	if level > x.top {
+		x.entry, x.top = slot, level
+	}
+}
+
+// Delete removes id, if it is there.
+func (x *Index) Delete(id uint64) {
+	slot, ok := x.slots[id]
+	if !ok {
+		return
+	}
+	delete(x.slots, id)
+	x.nodes[slot].deleted = true
+	switch {
+	case len(x.slots) == 0:
+		x.nodes, x.entry, x.top = nil, -1, 0
+	case len(x.nodes) > 2*len(x.slots)+64:
+		x.rebuild()
+	}
+}
+
+// rebuild inserts the live nodes into a fresh graph, in their old order.
+func (x *Index) rebuild() {
+	old := x.nodes
+	x.nodes, x.slots, x.entry, x.top = nil, map[uint64]int32{}, -1, 0
+	for _, n := range old {
+		if !n.deleted {
+			x.Add(n.id, n.vec)
+		}
+	}
+}
+
+// Search returns up to k live vectors nearest q, nearest first, looking at
+// ef candidates; a larger ef finds more of the true nearest, more slowly.
+func (x *Index) Search(q []float32, k, ef int) []Result {
+	if x.entry < 0 || k <= 0 {
+		return nil
+	}
+	ep := x.entry
+	for l := x.top; l > 0; l-- {
+		ep = x.greedy(q, ep, l)
+	}
+	var res []Result
+	for _, c := range x.searchLayer(q, ep, max(ef, k), 0) {
+		if n := x.nodes[c.slot]; !n.deleted {
+			res = append(res, Result{ID: n.id, Distance: c.dist})
+			if len(res) == k {
+				break
+			}
+		}
+	}
+	return res
+}
+
+func (x *Index) maxLinks(layer int) int {
+	if layer == 0 {
+		return 2 * x.m
+	}
+	return x.m
+}
+
+// greedy walks layer from ep to the node nearest q it can reach.
+func (x *Index) greedy(q []float32, ep int32, layer int) int32 {
+	best := distance(q, x.nodes[ep].vec)
+	for changed := true; changed; {
+		changed = false
+		for _, nb := range x.nodes[ep].links[layer] {
+			if d := distance(q, x.nodes[nb].vec); d < best {
+				ep, best, changed = nb, d, true
+			}
+		}
+	}
+	return ep
+}
+
+type candidate struct {
+	slot int32
+	dist float32
+}
+
+// searchLayer is the ef nodes of layer nearest q found from ep, nearest
+// first, deleted ones included.
+func (x *Index) searchLayer(q []float32, ep int32, ef int, layer int) []candidate {
+	visited := map[int32]bool{ep: true}
+	start := candidate{ep, distance(q, x.nodes[ep].vec)}
+	cands := &minHeap{start}
+	found := &maxHeap{start}
+	for cands.Len() > 0 {
+		c := heap.Pop(cands).(candidate)
+		if c.dist > (*found)[0].dist && found.Len() >= ef {
+			break
+		}
+		for _, nb := range x.nodes[c.slot].links[layer] {
+			if visited[nb] {
+				continue
+			}
+			visited[nb] = true
+			d := distance(q, x.nodes[nb].vec)
+			if found.Len() < ef || d < (*found)[0].dist {
+				heap.Push(cands, candidate{nb, d})
+				heap.Push(found, candidate{nb, d})
+				if found.Len() > ef {
+					heap.Pop(found)
+				}
+			}
+		}
+	}
+	out := []candidate(*found)
+	sort.Slice(out, func(i, j int) bool { return out[i].dist < out[j].dist })
+	return out
+}
+
+// selectNeighbours keeps up to m of cands, nearest first, skipping those
+// nearer to a kept one than to the new node so links spread out.
+func (x *Index) selectNeighbours(cands []candidate, m int) []int32 {
+	var kept []int32
+	for _, c := range cands {
+		if len(kept) == m {
+			break
+		}
+		diverse := true
+		for _, k := range kept {
+			if distance(x.nodes[c.slot].vec, x.nodes[k].vec) < c.dist {
+				diverse = false
+				break
+			}
+		}
+		if diverse {
+			kept = append(kept, c.slot)
+		}
+	}
+	return kept
+}
+
+// link adds to to from's neighbours on layer, pruning them back to the
+// layer's limit.
+func (x *Index) link(from, to int32, layer int) {
+	n := x.nodes[from]
+	n.links[layer] = append(n.links[layer], to)
+	if len(n.links[layer]) <= x.maxLinks(layer) {
+		return
+	}
+	cands := make([]candidate, len(n.links[layer]))
+	for i, nb := range n.links[layer] {
+		cands[i] = candidate{nb, distance(n.vec, x.nodes[nb].vec)}
+	}
+	sort.Slice(cands, func(i, j int) bool { return cands[i].dist < cands[j].dist })
+	n.links[layer] = x.selectNeighbours(cands, x.maxLinks(layer))
+}
+
+// distance is the cosine distance of unit vectors a and b.
+func distance(a, b []float32) float32 {
+	var dot float32
+	for i := range min(len(a), len(b)) {
+		dot += a[i] * b[i]
+	}
+	return 1 - dot
+}
+
+type minHeap []candidate
+
+func (h minHeap) Len() int           { return len(h) }
+func (h minHeap) Less(i, j int) bool { return h[i].dist < h[j].dist }
+func (h minHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *minHeap) Push(v any)        { *h = append(*h, v.(candidate)) }
+func (h *minHeap) Pop() any {
+	old := *h
+	v := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return v
+}
+
+type maxHeap []candidate
+
+func (h maxHeap) Len() int           { return len(h) }
+func (h maxHeap) Less(i, j int) bool { return h[i].dist > h[j].dist }
+func (h maxHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *maxHeap) Push(v any)        { *h = append(*h, v.(candidate)) }
+func (h *maxHeap) Pop() any {
+	old := *h
+	v := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return v
+}
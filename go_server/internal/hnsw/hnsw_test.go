@@ -0,0 +1,141 @@
+package hnsw
+
+import (
+	"math"
+	"math/rand/v2"
+	"sort"
+	"testing"
+)
+
+func unitVectors(n, dim int, seed uint64) [][]float32 {
+	rng := rand.New(rand.NewPCG(seed, seed))
+	out := make([][]float32, n)
+	for i := range out {
+		v := make([]float32, dim)
+		var norm float64
+		for j := range v {
+			v[j] = float32(rng.NormFloat64())
+			norm += float64(v[j] * v[j])
+		}
+		for j := range v {
+			v[j] /= float32(math.Sqrt(norm))
+		}
+		out[i] = v
+	}
+	return out
+}
+
+// bruteForce returns the IDs of the k vectors nearest q.
+func bruteForce(vecs [][]float32, q []float32, k int) []uint64 {
+	all := make([]Result, len(vecs))
+	for i, v := range vecs {
+		all[i] = Result{ID: uint64(i), Distance: distance(q, v)}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Distance < all[j].Distance })
+	ids := make([]uint64, 0, k)
+	for _, r := range all[:min(k, len(all))] {
+		ids = append(ids, r.ID)
+	}
+	return ids
+}
+
+func TestSearchRecall(t *testing.T) {
+	vecs := unitVectors(1000, 16, 1)
+	x := New(16, 100)
+	for i, v := range vecs {
+		x.Add(uint64(i), v)
+	}
+	if x.Len() != len(vecs) {
+		t.Fatalf("Len = %d, want %d", x.Len(), len(vecs))
+	}
+	const k = 10
+	found, total := 0, 0
+	for _, q := range unitVectors(50, 16, 2) {
+		res := x.Search(q, k, 100)
+		if len(res) != k {
+			t.Fatalf("Search returned %d results, want %d", len(res), k)
+		}
+		for i := 1; i < len(res); i++ {
+			if res[i].Distance < res[i-1].Distance {
+				t.Fatalf("results not nearest first: %v", res)
+			}
+		}
+		want := map[uint64]bool{}
+		for _, id := range bruteForce(vecs, q, k) {
+			want[id] = true
+		}
+		for _, r := range res {
+			if want[r.ID] {
+				found++
+			}
+		}
+		total += k
+	}
+	if recall := float64(found) / float64(total); recall < 0.9 {
+		t.Errorf("recall@%d = %.2f, want at least 0.9", k, recall)
+	}
+}
+
+func TestSearchFindsItself(t *testing.T) {
+	vecs := unitVectors(200, 8, 3)
+	x := New(8, 50)
+	for i, v := range vecs {
+		x.Add(uint64(i), v)
+	}
+	for i, v := range vecs {
+		res := x.Search(v, 1, 50)
+		if len(res) != 1 || res[0].ID != uint64(i) || res[0].Distance > 1e-5 {
+			t.Fatalf("Search(vector %d) = %v, want itself at distance 0", i, res)
+		}
+	}
+}
+
+func TestDelete(t *testing.T) {
+	vecs := unitVectors(300, 8, 4)
+	x := New(8, 50)
+	for i, v := range vecs {
+		x.Add(uint64(i), v)
+	}
+	deleted := func(id uint64) bool { return id%3 != 0 }
+	for i := range vecs {
+		if deleted(uint64(i)) {
+			x.Delete(uint64(i)) // enough to force a rebuild
+		}
+	}
+	x.Delete(9999) // unknown IDs are ignored
+	if want := 100; x.Len() != want {
+		t.Fatalf("Len = %d, want %d", x.Len(), want)
+	}
+	for _, q := range unitVectors(20, 8, 5) {
+		for _, r := range x.Search(q, 10, 50) {
+			if deleted(r.ID) {
+				t.Fatalf("Search returned deleted vector %d", r.ID)
+			}
+		}
+	}
+
+	for i := range vecs {
+		x.Delete(uint64(i))
+	}
+	if x.Len() != 0 || x.Search(vecs[0], 5, 10) != nil {
+		t.Error("an emptied index still finds vectors")
+	}
+	x.Add(7, vecs[7])
+	if res := x.Search(vecs[7], 5, 10); len(res) != 1 || res[0].ID != 7 {
+		t.Errorf("Search after re-adding = %v, want only 7", res)
+	}
+}
+
+func TestAddReplaces(t *testing.T) {
+	vecs := unitVectors(2, 4, 6)
+	x := New(4, 10)
+	x.Add(1, vecs[0])
+	x.Add(1, vecs[1])
+	if x.Len() != 1 {
+		t.Fatalf("Len = %d, want 1", x.Len())
+	}
+	res := x.Search(vecs[1], 2, 10)
+	if len(res) != 1 || res[0].ID != 1 || res[0].Distance > 1e-5 {
+		t.Errorf("Search = %v, want 1 holding its new vector", res)
+	}
+}
@@ -0,0 +1,28 @@
+package inference
+
+// ── 백엔드 ───────────────────────────────────────────────────────────────────
+// A Backend executes the model; Engine does everything around it (decode,
+// resize, tiling, TTA, postprocess). Each Binding owns one input buffer
+// and whatever native state the backend keeps per in-flight frame, and is
+// pooled by the Engine.
+
+type Backend interface {
+	// NewBinding allocates buffers for a size×size input.
+	NewBinding(size int) (Binding, error)
+	// InputSize is the model's fixed square input edge, or 0 when its
+	// height and width are dynamic.
+	InputSize() int
+	// OutputShape is the declared shape of the detection output, with -1
+	// for dynamic dims, or nil when the backend cannot tell before running.
+	OutputShape() []int64
+	Close() error
+}
+
+type Binding interface {
+	// Input is the 1×3×size×size CHW float32 buffer the caller fills.
+	Input() []float32
+	// Run executes the model on Input. The returned slice is only valid
+	// until the next Run or Close.
+	Run() (output []float32, shape []int64, err error)
+	Close()
+}
@@ -0,0 +1,113 @@
+//go:build !nocv
+
+package inference
+
+import (
+	"image"
+	"math"
+	"slices"
+
+	"gocv.io/x/gocv"
+
+	"yolo-server/internal/postprocess"
+)
+
+// ── 색상 ─────────────────────────────────────────────────────────────────────
+// With Config.ColorClasses set, every detection of those classes gets the
+// dominant colour of its box as Attributes.Color. The middle half of the
+// box, which is mostly the object rather than what is behind it, is
+// averaged down to colorGrid×colorGrid cells, each cell is named, and the
+// most common name wins.
+
+const colorGrid = 12
+
+// annotateColors names the colour of every detection in dets of the
+// configured classes. img is the frame the boxes are in.
+func (e *Engine) annotateColors(img gocv.Mat, dets []postprocess.Detection) {
+	if len(e.cfg.ColorClasses) == 0 {
+		return
+	}
+	bounds := image.Rect(0, 0, img.Cols(), img.Rows())
+	small := gocv.NewMat()
+	defer small.Close()
+	for i := range dets {
+		d := &dets[i]
+		if !slices.Contains(e.cfg.ColorClasses, d.Name) {
+			continue
+		}
+		w, h := d.Box[2]-d.Box[0], d.Box[3]-d.Box[1]
+		r := image.Rect(d.Box[0]+w/4, d.Box[1]+h/4, d.Box[2]-w/4, d.Box[3]-h/4).Intersect(bounds)
+		if r.Empty() {
+			continue
+		}
+		crop := img.Region(r)
+		gocv.Resize(crop, &small, image.Pt(colorGrid, colorGrid), 0, 0, gocv.InterpolationArea)
+		crop.Close()
+		pix, err := small.DataPtrUint8()
+		if err != nil {
+			continue
+		}
+		if name := dominantColor(pix); name != "" {
+			d.SetAttributes(func(a *postprocess.Attributes) { a.Color = name })
+		}
+	}
+}
+
+// dominantColor is the most common colorName of the BGR pixels in pix.
+func dominantColor(pix []byte) string {
+	votes := map[string]int{}
+	best := ""
+	for i := 0; i+2 < len(pix); i += 3 {
+		name := colorName(pix[i+2], pix[i+1], pix[i])
+		if votes[name]++; votes[name] > votes[best] {
+			best = name
+		}
+	}
+	return best
+}
+
+// colorName sorts a pixel into one of eleven colours by hue, saturation and
+// value, the way people would name it.
+func colorName(r, g, b uint8) string {
+	rf, gf, bf := float64(r)/255, float64(g)/255, float64(b)/255
+	v := max(rf, gf, bf)
+	c := v - min(rf, gf, bf)
+	var s, h float64
+	if v > 0 {
+		s = c / v
+	}
+	switch {
+	case c == 0:
+	case v == rf:
+		h = math.Mod((gf-bf)/c+6, 6)
+	case v == gf:
+		h = (bf-rf)/c + 2
+	default:
+		h = (rf-gf)/c + 4
+	}
+	h *= 60
+	switch {
+	case v < 0.2:
+		return "black"
+	case s < 0.2 && v > 0.8:
+		return "white"
+	case s < 0.2:
+		return "gray"
+	case h < 15 || h >= 340:
+		return "red"
+	case h < 40 && v < 0.6:
+		return "brown"
+	case h < 40:
+		return "orange"
+	case h < 70:
+		return "yellow"
+	case h < 165:
+		return "green"
+	case h < 260:
+		return "blue"
+	case h < 300:
+		return "purple"
+	default:
+		return "pink"
+	}
+}
@@ -0,0 +1,64 @@
+package inference
+
+import "yolo-server/internal/postprocess"
+
+// Config holds the pipeline settings that are fixed for an Engine's life.
+type Config struct {
+	Task        string  // ultralytics task from the model metadata; selects the output decoder
+	TileSize    int     // tile edge in source pixels for Options.Tile
+	TileOverlap float64 // fraction of a tile shared with its neighbours
+	TTAScales   []float64
+	TTAFlip     bool
+	// InputSizes are the Options.InputSize values accepted, each with its
+	// own binding pool. Sizes other than preprocess.InputSize need a model
+	// with dynamic spatial dims.
+	InputSizes []int
+	Watchdog   WatchdogConfig
+	// ColorClasses are the detection names given a dominant colour.
+	ColorClasses []string
+	// Calibration maps raw scores before Options.ConfThreshold applies;
+	// nil leaves them raw.
+	Calibration *postprocess.ScoreCalibration
+	// Exclusive keeps one box of overlapping mutually exclusive classes;
+	// nil keeps them all.
+	Exclusive *postprocess.ExclusiveClasses
+}
+
+// SessionOptions are the ORT session knobs exposed through configuration.
+type SessionOptions struct {
+	IntraOpThreads int // 0 = ORT default
+	InterOpThreads int // 0 = ORT default
+	CPUMemArena    bool
+	MemPattern     bool
+	Provider       string // "" or "cpu" = ORT's CPU provider; "cuda" = CUDA with CPU fallback
+	DeviceID       int    // GPU ordinal for the CUDA provider
+}
+
+// PlateConfig configures a PlateReader.
+type PlateConfig struct {
+	Path     string
+	Classes  []string // detection names read
+	Alphabet string
+	Decode   string // "ctc" or "slots"
+	MinScore float64
+}
+
+// DensityConfig configures a DensityModel.
+type DensityConfig struct {
+	Path      string
+	Normalize string // "imagenet" or "none"
+}
+
+// EmbedConfig configures an EmbedModel.
+type EmbedConfig struct {
+	Path      string
+	Normalize string // "imagenet" or "none"
+}
+
+// TritonConfig names the remote model and its tensors.
+type TritonConfig struct {
+	URL    string // e.g. http://triton:8000
+	Model  string
+	Input  string // input tensor name
+	Output string // output tensor name
+}
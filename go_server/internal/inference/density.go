@@ -0,0 +1,169 @@
+//go:build !nocv
+
+package inference
+
+import (
+	"fmt"
+	"image"
+
+	ort "github.com/yalue/onnxruntime_go"
+	"gocv.io/x/gocv"
+
+	"yolo-server/internal/preprocess"
+)
+
+// ── 군중 밀도 ────────────────────────────────────────────────────────────────
+// A DensityModel is an optional crowd counting model of the Engine, such as
+// CSRNet: it takes a fixed 1×3×H×W float32 RGB input in [0, 1], normalized
+// with the ImageNet mean and deviation unless Normalize is "none", and puts
+// out a 1×1×h×w density map whose sum is the number of people. It runs on
+// the whole frame, apart from the detector, when a stream asks for it.
+
+var (
+	imagenetMean = [3]float32{0.485, 0.456, 0.406}
+	imagenetStd  = [3]float32{0.229, 0.224, 0.225}
+)
+
+type DensityModel struct {
+	cfg     DensityConfig
+	session *ort.DynamicAdvancedSession
+	h, w    int
+}
+
+// NewDensityModel opens the density model. Init must have been called
+// first.
+func NewDensityModel(cfg DensityConfig, so SessionOptions) (*DensityModel, error) {
+	inputs, outputs, err := ort.GetInputOutputInfo(cfg.Path)
+	if err != nil {
+		return nil, fmt.Errorf("density model info query: %w", err)
+	}
+	if len(inputs) != 1 || len(outputs) == 0 {
+		return nil, fmt.Errorf("density model: want one input and an output, got %d and %d", len(inputs), len(outputs))
+	}
+	dims := inputs[0].Dimensions
+	if len(dims) != 4 || dims[1] != 3 || dims[2] <= 0 || dims[3] <= 0 {
+		return nil, fmt.Errorf("density model: want a fixed 1×3×H×W input, got %v", dims)
+	}
+	opts, err := so.build()
+	if err != nil {
+		return nil, fmt.Errorf("session options: %w", err)
+	}
+	session, err := ort.NewDynamicAdvancedSession(cfg.Path, []string{inputs[0].Name}, []string{outputs[0].Name}, opts)
+	opts.Destroy()
+	if err != nil {
+		return nil, fmt.Errorf("density session create: %w", err)
+	}
+	return &DensityModel{cfg: cfg, session: session, h: int(dims[2]), w: int(dims[3])}, nil
+}
+
+func (m *DensityModel) Close() error {
+	if m == nil {
+		return nil
+	}
+	return m.session.Destroy()
+}
+
+// SetDensityModel adds the crowd density model; the Engine closes it. Call
+// it before the first Detect.
+func (e *Engine) SetDensityModel(m *DensityModel) { e.density = m }
+
+// Density decodes frame as Detect does and estimates its crowd density.
+func (e *Engine) Density(frame []byte, opts Options) (*DensityMap, error) {
+	if e.density == nil {
+		return nil, fmt.Errorf("no density model")
+	}
+	img := gocv.NewMat()
+	defer img.Close()
+	flags := gocv.IMReadColor
+	if opts.Upright {
+		flags |= gocv.IMReadIgnoreOrientation
+	}
+	if err := preprocess.Decode(frame, &img, flags); err != nil {
+		return nil, err
+	}
+	if opts.Upright {
+		upright := gocv.NewMat()
+		defer upright.Close()
+		preprocess.ApplyOrientation(img, &upright, preprocess.ExifOrientation(frame))
+		return e.density.estimate(upright, opts)
+	}
+	return e.density.estimate(img, opts)
+}
+
+func (m *DensityModel) estimate(img gocv.Mat, opts Options) (*DensityMap, error) {
+	resized := gocv.NewMat()
+	defer resized.Close()
+	gocv.Resize(img, &resized, image.Pt(m.w, m.h), 0, 0, gocv.InterpolationLinear)
+	gocv.CvtColor(resized, &resized, gocv.ColorBGRToRGB)
+	pix, err := resized.DataPtrUint8()
+	if err != nil {
+		return nil, err
+	}
+	plane := m.h * m.w
+	data := make([]float32, 3*plane)
+	for i := 0; i < plane; i++ {
+		for ch := 0; ch < 3; ch++ {
+			v := float32(pix[i*3+ch]) / 255
+			if m.cfg.Normalize != "none" {
+				v = (v - imagenetMean[ch]) / imagenetStd[ch]
+			}
+			data[ch*plane+i] = v
+		}
+	}
+	input, err := ort.NewTensor(ort.NewShape(1, 3, int64(m.h), int64(m.w)), data)
+	if err != nil {
+		return nil, err
+	}
+	defer input.Destroy()
+	outputs := []ort.Value{nil}
+	if err := m.session.Run([]ort.Value{input}, outputs); err != nil {
+		return nil, fmt.Errorf("density inference: %w", err)
+	}
+	defer outputs[0].Destroy()
+	out, ok := outputs[0].(*ort.Tensor[float32])
+	if !ok {
+		return nil, fmt.Errorf("density model: unexpected output tensor type")
+	}
+	shape := out.GetShape()
+	if len(shape) < 2 || shape[len(shape)-1] <= 0 || shape[len(shape)-2] <= 0 {
+		return nil, fmt.Errorf("density model: want a 1×1×h×w output, got %v", shape)
+	}
+	h, w := int(shape[len(shape)-2]), int(shape[len(shape)-1])
+	if len(out.GetData()) != h*w {
+		return nil, fmt.Errorf("density model: want a 1×1×h×w output, got %v", shape)
+	}
+	dm := &DensityMap{
+		Cells: append([]float32(nil), out.GetData()...),
+		W:     w, H: h,
+		CellW: float64(img.Cols()) / float64(w),
+		CellH: float64(img.Rows()) / float64(h),
+	}
+	dm.clip(image.Rect(0, 0, img.Cols(), img.Rows()), opts)
+	return dm, nil
+}
+
+// clip zeroes the cells centred outside opts.ROI or in opts.Mask, as the
+// detector does not see them either.
+func (m *DensityMap) clip(frame image.Rectangle, opts Options) {
+	area := frame
+	if !opts.ROI.Empty() {
+		area = opts.ROI.Intersect(frame)
+	}
+	for y := 0; y < m.H; y++ {
+		for x := 0; x < m.W; x++ {
+			c := image.Pt(int((float64(x)+0.5)*m.CellW), int((float64(y)+0.5)*m.CellH))
+			if !c.In(area) || inAnyRect(c, opts.Mask) {
+				m.Cells[y*m.W+x] = 0
+			}
+		}
+	}
+}
+
+func inAnyRect(p image.Point, rs []image.Rectangle) bool {
+	for _, r := range rs {
+		if p.In(r) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+// Package inference runs the detection model on encoded frames. The
+// Detector interface is what the server depends on; Engine implements it
+// on top of a Backend (ONNX Runtime in-process, or a remote Triton server)
+// and can be embedded in other Go programs.
+package inference
+
+import (
+	"image"
+
+	"yolo-server/internal/postprocess"
+)
+
+// Detector turns one encoded image (JPEG, PNG, WebP) into detections in
+// the image's pixel coordinates. Implementations are safe for concurrent use.
+type Detector interface {
+	Detect(frame []byte, opts Options) ([]postprocess.Detection, error)
+	// Warmup runs once before the server reports ready.
+	Warmup() error
+}
+
+// A DensityEstimator is a Detector that can also estimate how many people
+// a frame holds: an Engine with a density model (SetDensityModel).
+type DensityEstimator interface {
+	Density(frame []byte, opts Options) (*DensityMap, error)
+}
+
+// An Embedder is a Detector that can also describe objects for search: an
+// Engine with an embedding model (SetEmbedModel). Embed turns each encoded
+// image, an object's crop, into a unit vector; similar objects get
+// vectors with a high dot product.
+type Embedder interface {
+	Embed(crops [][]byte) ([][]float32, error)
+}
+
+// DensityMap is a crowd density model's output: people per cell, row-major,
+// each cell CellW×CellH source-frame pixels. Cells outside opts.ROI or in
+// opts.Mask are zero.
+type DensityMap struct {
+	Cells        []float32
+	W, H         int
+	CellW, CellH float64
+}
+
+// Sum is the number of people in the cells centred in r, in source-frame
+// pixels.
+func (m *DensityMap) Sum(r image.Rectangle) float64 {
+	var sum float64
+	for y := 0; y < m.H; y++ {
+		cy := int((float64(y) + 0.5) * m.CellH)
+		if cy < r.Min.Y || cy >= r.Max.Y {
+			continue
+		}
+		for x := 0; x < m.W; x++ {
+			if cx := int((float64(x) + 0.5) * m.CellW); cx >= r.Min.X && cx < r.Max.X {
+				sum += float64(m.Cells[y*m.W+x])
+			}
+		}
+	}
+	return sum
+}
+
+// Options are the per-request inference settings.
+type Options struct {
+	ConfThreshold float64
+	ConfMargin    float64           // > 0 keeps only boxes this close to their class's top score
+	NMSIoU        float64           // for merging tile and TTA passes
+	ROI           image.Rectangle   // source-frame pixels; empty = whole frame
+	Mask          []image.Rectangle // privacy zones, source-frame pixels; blacked out
+	Tile          bool              // SAHI-style tiled inference
+	TTA           bool              // test-time augmentation, see tta.go
+	Upright       bool              // apply EXIF orientation (uploaded photos)
+	InputSize     int               // model input edge in pixels; 0 = preprocess.InputSize
+}
@@ -0,0 +1,306 @@
+package inference
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"yolo-server/internal/postprocess"
+	"yolo-server/internal/preprocess"
+)
+
+// ── 분산 워커 ────────────────────────────────────────────────────────────────
+// Dispatcher is a Detector that runs no model: a front node terminates the
+// streams and forwards each encoded frame to one of several inference-only
+// nodes, which are ordinary servers, through their POST /detect. Every
+// worker's /readyz is polled each dispatchHealthInterval, and a frame goes
+// to the ready worker with the fewest frames in flight. A worker that fails
+// a frame at the transport level, or answers 503, is marked down until its
+// next good check and the frame is retried once on another.
+//
+// Workers apply their own NMS_IOU, and the front drops detections under its
+// own CONF_THRESHOLD, so workers should run with a CONF_THRESHOLD no higher
+// than the front's.
+
+const (
+	dispatchHealthInterval = 2 * time.Second
+	dispatchHealthTimeout  = 2 * time.Second
+	dispatchTimeout        = 30 * time.Second // one frame, TTA included
+)
+
+// ErrNoWorkers is returned when no worker is ready to take a frame.
+var ErrNoWorkers = errors.New("no inference worker available")
+
+// DispatchConfig lists the workers of BACKEND=workers.
+type DispatchConfig struct {
+	URLs []string // base URLs, e.g. http://worker-1:8080
+	Key  string   // API key presented to the workers; "" = none
+}
+
+// WorkerStatus is one worker as reported by Dispatcher.Workers.
+type WorkerStatus struct {
+	URL       string    `json:"url"`
+	Up        bool      `json:"up"`
+	InFlight  int64     `json:"in_flight"`
+	Frames    uint64    `json:"frames"`
+	Failures  uint64    `json:"failures"`
+	Error     string    `json:"error,omitempty"` // last failure while down
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+type worker struct {
+	url      string
+	up       atomic.Bool
+	inflight atomic.Int64
+	frames   atomic.Uint64
+	failures atomic.Uint64
+	lastErr  atomic.Pointer[string]
+	checked  atomic.Pointer[time.Time]
+}
+
+func (w *worker) markDown(err error) {
+	msg := err.Error()
+	w.lastErr.Store(&msg)
+	w.failures.Add(1)
+	w.up.Store(false)
+}
+
+type Dispatcher struct {
+	cfg     DispatchConfig
+	client  *http.Client
+	workers []*worker
+	next    atomic.Uint64 // where the least-loaded scan starts, so ties rotate
+	stop    context.CancelFunc
+}
+
+var _ Detector = (*Dispatcher)(nil)
+
+// NewDispatcher starts health checking cfg.URLs; Close stops it.
+func NewDispatcher(cfg DispatchConfig) (*Dispatcher, error) {
+	if len(cfg.URLs) == 0 {
+		return nil, fmt.Errorf("dispatch: no worker URLs")
+	}
+	d := &Dispatcher{cfg: cfg, client: &http.Client{Timeout: dispatchTimeout}}
+	for _, u := range cfg.URLs {
+		d.workers = append(d.workers, &worker{url: strings.TrimSuffix(u, "/")})
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	d.stop = cancel
+	d.checkAll(ctx)
+	go d.monitor(ctx)
+	return d, nil
+}
+
+func (d *Dispatcher) Close() error {
+	d.stop()
+	return nil
+}
+
+// Warmup waits until any worker is ready, so a front started before its
+// workers becomes ready with them.
+func (d *Dispatcher) Warmup() error {
+	for {
+		for _, w := range d.workers {
+			if w.up.Load() {
+				return nil
+			}
+		}
+		time.Sleep(dispatchHealthInterval)
+	}
+}
+
+// Workers reports every worker, in configuration order.
+func (d *Dispatcher) Workers() []WorkerStatus {
+	out := make([]WorkerStatus, len(d.workers))
+	for i, w := range d.workers {
+		st := WorkerStatus{
+			URL: w.url, Up: w.up.Load(), InFlight: w.inflight.Load(),
+			Frames: w.frames.Load(), Failures: w.failures.Load(),
+		}
+		if t := w.checked.Load(); t != nil {
+			st.CheckedAt = *t
+		}
+		if msg := w.lastErr.Load(); msg != nil && !st.Up {
+			st.Error = *msg
+		}
+		out[i] = st
+	}
+	return out
+}
+
+func (d *Dispatcher) monitor(ctx context.Context) {
+	t := time.NewTicker(dispatchHealthInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			d.checkAll(ctx)
+		}
+	}
+}
+
+func (d *Dispatcher) checkAll(ctx context.Context) {
+	done := make(chan struct{})
+	for _, w := range d.workers {
+		go func(w *worker) {
+			defer func() { done <- struct{}{} }()
+			if err := d.check(ctx, w); err != nil {
+				w.markDown(err)
+			} else {
+				w.up.Store(true)
+			}
+			now := time.Now()
+			w.checked.Store(&now)
+		}(w)
+	}
+	for range d.workers {
+		<-done
+	}
+}
+
+func (d *Dispatcher) check(ctx context.Context, w *worker) error {
+	ctx, cancel := context.WithTimeout(ctx, dispatchHealthTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, w.url+"/readyz", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("readyz: %s", resp.Status)
+	}
+	return nil
+}
+
+// pick is the ready worker with the fewest frames in flight, skipping not.
+func (d *Dispatcher) pick(not *worker) *worker {
+	start := int(d.next.Add(1) % uint64(len(d.workers)))
+	var best *worker
+	for i := range d.workers {
+		w := d.workers[(start+i)%len(d.workers)]
+		if w == not || !w.up.Load() {
+			continue
+		}
+		if best == nil || w.inflight.Load() < best.inflight.Load() {
+			best = w
+		}
+	}
+	return best
+}
+
+func (d *Dispatcher) Detect(frame []byte, opts Options) ([]postprocess.Detection, error) {
+	var failed *worker
+	for attempt := 0; attempt < 2; attempt++ {
+		w := d.pick(failed)
+		if w == nil {
+			break
+		}
+		dets, err := d.send(w, frame, opts)
+		var down *workerDownError
+		if errors.As(err, &down) {
+			w.markDown(err)
+			failed = w
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		w.frames.Add(1)
+		kept := dets[:0]
+		for _, det := range dets {
+			if det.Score >= opts.ConfThreshold {
+				kept = append(kept, det)
+			}
+		}
+		return postprocess.TopScore(kept, opts.ConfMargin), nil
+	}
+	return nil, ErrNoWorkers
+}
+
+// remoteError is a worker's error message for a failure it classified as
+// is, so callers can still match it with errors.Is.
+type remoteError struct {
+	msg string
+	is  error
+}
+
+func (e *remoteError) Error() string        { return e.msg }
+func (e *remoteError) Is(target error) bool { return target == e.is }
+
+// workerDownError is a failure of the worker rather than of the frame.
+type workerDownError struct{ err error }
+
+func (e *workerDownError) Error() string { return e.err.Error() }
+func (e *workerDownError) Unwrap() error { return e.err }
+
+func (d *Dispatcher) send(w *worker, frame []byte, opts Options) ([]postprocess.Detection, error) {
+	w.inflight.Add(1)
+	defer w.inflight.Add(-1)
+
+	q := url.Values{}
+	if !opts.ROI.Empty() {
+		r := opts.ROI
+		q.Set("roi", fmt.Sprintf("%d,%d,%d,%d", r.Min.X, r.Min.Y, r.Max.X, r.Max.Y))
+	}
+	for _, r := range opts.Mask {
+		q.Add("mask", fmt.Sprintf("%d,%d,%d,%d", r.Min.X, r.Min.Y, r.Max.X, r.Max.Y))
+	}
+	if opts.Tile {
+		q.Set("tile", "1")
+	}
+	if opts.TTA {
+		q.Set("tta", "1")
+	}
+	if opts.InputSize > 0 {
+		q.Set("imgsz", strconv.Itoa(opts.InputSize))
+	}
+	if !opts.Upright {
+		q.Set("exif", "0")
+	}
+	req, err := http.NewRequest(http.MethodPost, w.url+"/detect?"+q.Encode(), bytes.NewReader(frame))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if d.cfg.Key != "" {
+		req.Header.Set("X-API-Key", d.cfg.Key)
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, &workerDownError{fmt.Errorf("worker %s: %w", w.url, err)}
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Detections []postprocess.Detection `json:"detections"`
+		Error      string                  `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, &workerDownError{fmt.Errorf("worker %s: %s: %w", w.url, resp.Status, err)}
+	}
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return body.Detections, nil
+	case resp.StatusCode == http.StatusBadRequest:
+		return nil, &remoteError{msg: body.Error, is: preprocess.ErrDecode}
+	case resp.StatusCode == http.StatusServiceUnavailable:
+		return nil, &workerDownError{fmt.Errorf("worker %s: %s", w.url, body.Error)}
+	default:
+		return nil, fmt.Errorf("worker %s: %s: %s", w.url, resp.Status, body.Error)
+	}
+}
@@ -0,0 +1,135 @@
+//go:build !nocv
+
+package inference
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	ort "github.com/yalue/onnxruntime_go"
+	"gocv.io/x/gocv"
+
+	"yolo-server/internal/preprocess"
+)
+
+// ── 객체 임베딩 ──────────────────────────────────────────────────────────────
+// An EmbedModel is an optional re-identification model of the Engine, such
+// as OSNet or a CLIP image tower: it takes a fixed 1×3×H×W float32 RGB
+// input in [0, 1], normalized with the ImageNet mean and deviation unless
+// Normalize is "none", and puts out a 1×D feature vector, which is scaled
+// to unit length. It runs on object crops, apart from the detector, for
+// the search gallery.
+
+type EmbedModel struct {
+	cfg     EmbedConfig
+	session *ort.DynamicAdvancedSession
+	h, w    int
+}
+
+// NewEmbedModel opens the embedding model. Init must have been called
+// first.
+func NewEmbedModel(cfg EmbedConfig, so SessionOptions) (*EmbedModel, error) {
+	inputs, outputs, err := ort.GetInputOutputInfo(cfg.Path)
+	if err != nil {
+		return nil, fmt.Errorf("embedding model info query: %w", err)
+	}
+	if len(inputs) != 1 || len(outputs) == 0 {
+		return nil, fmt.Errorf("embedding model: want one input and an output, got %d and %d", len(inputs), len(outputs))
+	}
+	dims := inputs[0].Dimensions
+	if len(dims) != 4 || dims[1] != 3 || dims[2] <= 0 || dims[3] <= 0 {
+		return nil, fmt.Errorf("embedding model: want a fixed 1×3×H×W input, got %v", dims)
+	}
+	opts, err := so.build()
+	if err != nil {
+		return nil, fmt.Errorf("session options: %w", err)
+	}
+	session, err := ort.NewDynamicAdvancedSession(cfg.Path, []string{inputs[0].Name}, []string{outputs[0].Name}, opts)
+	opts.Destroy()
+	if err != nil {
+		return nil, fmt.Errorf("embedding session create: %w", err)
+	}
+	return &EmbedModel{cfg: cfg, session: session, h: int(dims[2]), w: int(dims[3])}, nil
+}
+
+func (m *EmbedModel) Close() error {
+	if m == nil {
+		return nil
+	}
+	return m.session.Destroy()
+}
+
+// SetEmbedModel adds the embedding model; the Engine closes it. Call it
+// before the first Detect.
+func (e *Engine) SetEmbedModel(m *EmbedModel) { e.embed = m }
+
+// Embed describes each crop with the embedding model.
+func (e *Engine) Embed(crops [][]byte) ([][]float32, error) {
+	if e.embed == nil {
+		return nil, fmt.Errorf("no embedding model")
+	}
+	img := gocv.NewMat()
+	defer img.Close()
+	out := make([][]float32, len(crops))
+	for i, b := range crops {
+		if err := preprocess.Decode(b, &img, gocv.IMReadColor); err != nil {
+			return nil, err
+		}
+		v, err := e.embed.vector(img)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+func (m *EmbedModel) vector(img gocv.Mat) ([]float32, error) {
+	resized := gocv.NewMat()
+	defer resized.Close()
+	gocv.Resize(img, &resized, image.Pt(m.w, m.h), 0, 0, gocv.InterpolationLinear)
+	gocv.CvtColor(resized, &resized, gocv.ColorBGRToRGB)
+	pix, err := resized.DataPtrUint8()
+	if err != nil {
+		return nil, err
+	}
+	plane := m.h * m.w
+	data := make([]float32, 3*plane)
+	for i := 0; i < plane; i++ {
+		for ch := 0; ch < 3; ch++ {
+			v := float32(pix[i*3+ch]) / 255
+			if m.cfg.Normalize != "none" {
+				v = (v - imagenetMean[ch]) / imagenetStd[ch]
+			}
+			data[ch*plane+i] = v
+		}
+	}
+	input, err := ort.NewTensor(ort.NewShape(1, 3, int64(m.h), int64(m.w)), data)
+	if err != nil {
+		return nil, err
+	}
+	defer input.Destroy()
+	outputs := []ort.Value{nil}
+	if err := m.session.Run([]ort.Value{input}, outputs); err != nil {
+		return nil, fmt.Errorf("embedding inference: %w", err)
+	}
+	defer outputs[0].Destroy()
+	out, ok := outputs[0].(*ort.Tensor[float32])
+	if !ok {
+		return nil, fmt.Errorf("embedding model: unexpected output tensor type")
+	}
+	v := append([]float32(nil), out.GetData()...)
+	var sum float64
+	for _, f := range v {
+		sum += float64(f) * float64(f)
+	}
+	if len(v) == 0 || sum == 0 {
+		return nil, fmt.Errorf("embedding model: empty or zero output %v", out.GetShape())
+	}
+	k := float32(1 / math.Sqrt(sum))
+	for i := range v {
+		v[i] *= k
+	}
+	return v, nil
+}
@@ -0,0 +1,351 @@
+//go:build !nocv
+
+package inference
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"log/slog"
+	"sync/atomic"
+
+	"gocv.io/x/gocv"
+
+	"yolo-server/internal/postprocess"
+	"yolo-server/internal/preprocess"
+)
+
+const poolSize = 16 // idle Mat and tensor sets kept around
+
+// ── Engine ───────────────────────────────────────────────────────────────────
+// Engine is the Detector built on a Backend. Native Mats and backend
+// bindings are pooled in channels, not sync.Pool, so none are dropped
+// unclosed.
+
+type Engine struct {
+	cfg     Config
+	backend Backend
+	labels  postprocess.Labels
+	decoder postprocess.Decoder
+	mats    *sizedPool[*preprocess.Mats]
+	binds   *sizedPool[Binding]
+	plates  *PlateReader  // nil without a second stage
+	density *DensityModel // nil without a crowd density model
+	embed   *EmbedModel   // nil without an embedding model
+
+	wd        *watchdog    // nil when off
+	gen       atomic.Int64 // bumped when the backend session is recreated
+	resetting atomic.Bool
+}
+
+// sizedPool keeps up to poolSize idle values per model input size. A value
+// is only ever reused at the size it was made for, so a Mats set keeps its
+// resize and band geometry and a Binding's buffer always fits. The map is
+// filled by newSizedPool and only read afterwards, so lookups need no lock.
+type sizedPool[T any] struct {
+	pools   map[int]chan T
+	newFn   func(size int) (T, error)
+	closeFn func(T)
+}
+
+func newSizedPool[T any](sizes []int, newFn func(int) (T, error), closeFn func(T)) *sizedPool[T] {
+	p := &sizedPool[T]{pools: map[int]chan T{}, newFn: newFn, closeFn: closeFn}
+	for _, size := range sizes {
+		if _, ok := p.pools[size]; !ok {
+			p.pools[size] = make(chan T, poolSize)
+		}
+	}
+	return p
+}
+
+func (p *sizedPool[T]) get(size int) (T, error) {
+	pool, ok := p.pools[size]
+	if !ok {
+		var zero T
+		return zero, fmt.Errorf("input size %d is not enabled", size)
+	}
+	select {
+	case v := <-pool:
+		return v, nil
+	default:
+		return p.newFn(size)
+	}
+}
+
+func (p *sizedPool[T]) put(size int, v T) {
+	select {
+	case p.pools[size] <- v:
+	default:
+		p.closeFn(v)
+	}
+}
+
+func (p *sizedPool[T]) drain() {
+	for _, pool := range p.pools {
+		for len(pool) > 0 {
+			p.closeFn(<-pool)
+		}
+	}
+}
+
+var _ Detector = (*Engine)(nil)
+
+// New wraps backend. labels may be nil, in which case boxes are named
+// "cls<N>". It fails when cfg.Task has no output decoder or the backend's
+// declared output shape does not fit it.
+func New(backend Backend, labels postprocess.Labels, cfg Config) (*Engine, error) {
+	decoder, err := postprocess.DecoderFor(cfg.Task)
+	if err != nil {
+		return nil, err
+	}
+	if shape := backend.OutputShape(); shape != nil {
+		if err := decoder.Check(shape); err != nil {
+			return nil, fmt.Errorf("model output: %w", err)
+		}
+	}
+	sizes := append([]int{preprocess.InputSize}, cfg.InputSizes...)
+	if fixed := backend.InputSize(); fixed != 0 {
+		for _, size := range sizes {
+			if size != fixed {
+				return nil, fmt.Errorf("input size %d: the model input is fixed at %d×%d; export it with dynamic=True", size, fixed, fixed)
+			}
+		}
+	}
+	e := &Engine{
+		cfg:     cfg,
+		backend: backend,
+		labels:  labels,
+		decoder: decoder,
+		mats: newSizedPool(sizes,
+			func(int) (*preprocess.Mats, error) { return preprocess.NewMats(), nil },
+			(*preprocess.Mats).Close),
+		binds: newSizedPool(sizes, backend.NewBinding, Binding.Close),
+	}
+	if cfg.Watchdog.Factor > 0 {
+		e.wd = &watchdog{cfg: cfg.Watchdog}
+	}
+	return e, nil
+}
+
+func (e *Engine) Labels() postprocess.Labels { return e.labels }
+
+// SetPlateReader adds the licence plate stage; the Engine closes it. Call
+// it before the first Detect.
+func (e *Engine) SetPlateReader(p *PlateReader) { e.plates = p }
+
+// Hangs counts model runs abandoned by the watchdog.
+func (e *Engine) Hangs() int64 {
+	if e.wd == nil {
+		return 0
+	}
+	return e.wd.hangs.Load()
+}
+
+// Close releases the backend and every pooled native resource.
+func (e *Engine) Close() error {
+	e.mats.drain()
+	e.binds.drain()
+	_ = e.plates.Close()
+	_ = e.density.Close()
+	_ = e.embed.Close()
+	return e.backend.Close()
+}
+
+// inputSize is opts.InputSize with the default applied.
+func inputSize(opts Options) int {
+	if opts.InputSize == 0 {
+		return preprocess.InputSize
+	}
+	return opts.InputSize
+}
+
+// ── 추론 ─────────────────────────────────────────────────────────────────────
+
+// Detect decodes frame and runs DetectImage on it. With opts.Upright the
+// EXIF orientation is applied explicitly, so boxes are in the coordinates
+// of the upright image the user sees.
+func (e *Engine) Detect(frame []byte, opts Options) ([]postprocess.Detection, error) {
+	size := inputSize(opts)
+	fm, err := e.mats.get(size)
+	if err != nil {
+		return nil, err
+	}
+	defer e.mats.put(size, fm)
+	if !opts.Upright {
+		if err := preprocess.Decode(frame, &fm.Decoded, gocv.IMReadColor); err != nil {
+			return nil, err
+		}
+		return e.detectImage(fm.Decoded, opts, fm)
+	}
+	raw := gocv.NewMat()
+	defer raw.Close()
+	if err := preprocess.Decode(frame, &raw, gocv.IMReadColor|gocv.IMReadIgnoreOrientation); err != nil {
+		return nil, err
+	}
+	preprocess.ApplyOrientation(raw, &fm.Decoded, preprocess.ExifOrientation(frame))
+	return e.detectImage(fm.Decoded, opts, fm)
+}
+
+// DetectImage applies the privacy mask, region of interest and tiling mode
+// to a decoded BGR image and returns boxes in img's full-frame coordinates.
+// img itself is left unmasked.
+func (e *Engine) DetectImage(img gocv.Mat, opts Options) ([]postprocess.Detection, error) {
+	size := inputSize(opts)
+	fm, err := e.mats.get(size)
+	if err != nil {
+		return nil, err
+	}
+	defer e.mats.put(size, fm)
+	return e.detectImage(img, opts, fm)
+}
+
+func (e *Engine) detectImage(img gocv.Mat, opts Options, fm *preprocess.Mats) (_ []postprocess.Detection, err error) {
+	size := inputSize(opts)
+	conf := opts.ConfThreshold
+	opts.ConfThreshold = e.cfg.Calibration.RawThreshold(conf)
+	gen := e.gen.Load()
+	t, err := e.binds.get(size)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { e.putBinding(size, t, gen, err) }()
+
+	if len(opts.Mask) > 0 {
+		masked := img.Clone()
+		defer masked.Close()
+		for _, z := range opts.Mask {
+			gocv.Rectangle(&masked, z, color.RGBA{}, -1)
+		}
+		img = masked
+	}
+	area := image.Rect(0, 0, img.Cols(), img.Rows())
+	if !opts.ROI.Empty() {
+		area = opts.ROI.Intersect(area)
+		if area.Empty() {
+			return []postprocess.Detection{}, nil
+		}
+	}
+	rects := []image.Rectangle{area}
+	if opts.Tile {
+		rects = append(rects, preprocess.TileRects(area, e.cfg.TileSize, e.cfg.TileOverlap)...)
+	}
+
+	var out []postprocess.Detection
+	for _, r := range rects {
+		dets, err := e.detectRect(img, r, opts, fm, t)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, dets...)
+	}
+	if len(rects) > 1 {
+		out = postprocess.NMS(out, opts.NMSIoU)
+	}
+	out = postprocess.Unmasked(out, opts.Mask)
+	out = e.cfg.Calibration.Apply(out, conf)
+	out = e.cfg.Exclusive.Apply(out)
+	out = postprocess.TopScore(out, opts.ConfMargin)
+	e.plates.annotate(img, out)
+	e.annotateColors(img, out)
+	return out, nil
+}
+
+// Warmup runs one inference on a blank frame so the first client does not
+// pay for ORT's lazy allocations.
+func (e *Engine) Warmup() error {
+	gray := gocv.NewScalar(ttaPadValue, ttaPadValue, ttaPadValue, 0)
+	img := gocv.NewMatWithSizeFromScalar(gray, preprocess.InputSize, preprocess.InputSize, gocv.MatTypeCV8UC3)
+	defer img.Close()
+	_, err := e.DetectImage(img, Options{ConfThreshold: 1})
+	return err
+}
+
+// detectRect runs detect (or detectTTA) on the part of img inside r only,
+// so the model sees that region at its full input resolution. Boxes are
+// shifted back into full-frame coordinates.
+func (e *Engine) detectRect(img gocv.Mat, r image.Rectangle, opts Options, fm *preprocess.Mats, t Binding) ([]postprocess.Detection, error) {
+	run := e.detect
+	if opts.TTA {
+		run = e.detectTTA
+	}
+	if r == image.Rect(0, 0, img.Cols(), img.Rows()) {
+		return run(img, opts, fm, t)
+	}
+	sub := img.Region(r)
+	defer sub.Close()
+	dets, err := run(sub, opts, fm, t)
+	if err != nil {
+		return nil, err
+	}
+	for i := range dets {
+		b := &dets[i].Box
+		b[0] += r.Min.X
+		b[1] += r.Min.Y
+		b[2] += r.Min.X
+		b[3] += r.Min.Y
+	}
+	return dets, nil
+}
+
+// detect runs preprocessing, the model and postprocessing on a decoded BGR
+// image. Boxes are returned in img's pixel coordinates.
+func (e *Engine) detect(img gocv.Mat, opts Options, fm *preprocess.Mats, t Binding) ([]postprocess.Detection, error) {
+	// HWC (BGR interleaved) → CHW float32/255 straight into the bound
+	// input buffer, converted by OpenCV in parallel row bands.
+	scaleX, scaleY, err := fm.Input(img, t.Input(), inputSize(opts))
+	if err != nil {
+		return nil, fmt.Errorf("preprocess: %w", err)
+	}
+	out, shape, err := e.run(t)
+	if err != nil {
+		return nil, err
+	}
+	return e.decoder.Decode(out, shape, scaleX, scaleY, opts.ConfThreshold, e.labels)
+}
+
+// run executes the model on t, under the watchdog when it is on.
+func (e *Engine) run(t Binding) ([]float32, []int64, error) {
+	if e.wd == nil {
+		return t.Run()
+	}
+	out, shape, err := e.wd.run(t)
+	if errors.Is(err, ErrHung) && e.cfg.Watchdog.Reset {
+		e.resetSession()
+	}
+	return out, shape, err
+}
+
+// putBinding pools t again unless the watchdog abandoned it or its session
+// has been replaced since it was taken.
+func (e *Engine) putBinding(size int, t Binding, gen int64, err error) {
+	switch {
+	case errors.Is(err, ErrHung):
+		// Still owned by the hung call, which closes it if it returns.
+	case e.gen.Load() != gen:
+		t.Close()
+	default:
+		e.binds.put(size, t)
+	}
+}
+
+// resetSession recreates the backend session after a hang. Concurrent
+// hangs share one reset.
+func (e *Engine) resetSession() {
+	r, ok := e.backend.(Resetter)
+	if !ok {
+		slog.Warn("backend cannot recreate its session after a hang")
+		return
+	}
+	if !e.resetting.CompareAndSwap(false, true) {
+		return
+	}
+	defer e.resetting.Store(false)
+	if err := r.Reset(); err != nil {
+		slog.Error("session reset failed", "err", err)
+		return
+	}
+	e.gen.Add(1)
+	e.binds.drain()
+	slog.Warn("inference session recreated after a hang")
+}
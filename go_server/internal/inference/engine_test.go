@@ -0,0 +1,133 @@
+//go:build !nocv
+
+package inference
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"reflect"
+	"testing"
+
+	"yolo-server/internal/postprocess"
+)
+
+// fakeBackend answers every run with the same rows, given in model input
+// pixels, and keeps the last input it was run on.
+type fakeBackend struct {
+	rows  []float32
+	shape []int64
+	input []float32
+}
+
+func (b *fakeBackend) NewBinding(size int) (Binding, error) {
+	return &fakeBinding{b: b, in: make([]float32, 3*size*size)}, nil
+}
+func (b *fakeBackend) InputSize() int       { return 0 }
+func (b *fakeBackend) OutputShape() []int64 { return b.shape }
+func (b *fakeBackend) Close() error         { return nil }
+
+type fakeBinding struct {
+	b  *fakeBackend
+	in []float32
+}
+
+func (t *fakeBinding) Input() []float32 { return t.in }
+func (t *fakeBinding) Close()           {}
+func (t *fakeBinding) Run() ([]float32, []int64, error) {
+	t.b.input = append(t.b.input[:0], t.in...)
+	return t.b.rows, t.b.shape, nil
+}
+
+func solidPNG(t *testing.T, w, h int, c color.Color) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestEngineDetect(t *testing.T) {
+	backend := &fakeBackend{
+		rows: []float32{
+			64, 64, 320, 320, 0.9, 1,
+			0, 0, 10, 10, 0.1, 0,
+		},
+		shape: []int64{1, 2, 6},
+	}
+	e, err := New(backend, postprocess.Labels{1: "car"}, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	// Pure red: after the BGR CHW conversion only the third plane is lit.
+	frame := solidPNG(t, 1280, 640, color.RGBA{R: 255, A: 255})
+
+	tests := []struct {
+		name string
+		opts Options
+		want []postprocess.Detection
+	}{
+		{
+			name: "full frame scales boxes to source pixels",
+			opts: Options{ConfThreshold: 0.25},
+			want: []postprocess.Detection{{Box: [4]int{128, 64, 640, 320}, Score: 0.9, Label: 1, Name: "car"}},
+		},
+		{
+			name: "ROI boxes are shifted into frame coordinates",
+			opts: Options{ConfThreshold: 0.25, ROI: image.Rect(640, 0, 1280, 640)},
+			want: []postprocess.Detection{{Box: [4]int{704, 64, 960, 320}, Score: 0.9, Label: 1, Name: "car"}},
+		},
+		{
+			name: "low threshold keeps both rows",
+			opts: Options{ConfThreshold: 0.05},
+			want: []postprocess.Detection{
+				{Box: [4]int{128, 64, 640, 320}, Score: 0.9, Label: 1, Name: "car"},
+				{Box: [4]int{0, 0, 20, 10}, Score: 0.1, Label: 0, Name: "cls0"},
+			},
+		},
+		{
+			name: "ROI outside the frame finds nothing",
+			opts: Options{ROI: image.Rect(2000, 2000, 2100, 2100)},
+			want: []postprocess.Detection{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := e.Detect(frame, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Detect = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	plane := len(backend.input) / 3
+	for c, want := range []float32{0, 0, 1} {
+		if got := backend.input[c*plane]; got != want {
+			t.Errorf("input plane %d = %v, want %v", c, got, want)
+		}
+	}
+}
+
+func TestEngineNew(t *testing.T) {
+	if _, err := New(&fakeBackend{shape: []int64{1, 84, 8400}}, nil, Config{}); err == nil {
+		t.Error("New accepted a raw YOLOv8 head for a detect model")
+	}
+	if _, err := New(&fakeBackend{shape: []int64{1, 300, 6}}, nil, Config{Task: "classify"}); err == nil {
+		t.Error("New accepted an unsupported task")
+	}
+	if _, err := New(&fakeBackend{shape: []int64{1, -1, 7}}, nil, Config{Task: "obb"}); err != nil {
+		t.Errorf("New(obb, dynamic rows) = %v, want nil", err)
+	}
+}
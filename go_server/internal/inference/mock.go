@@ -0,0 +1,120 @@
+package inference
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/jpeg" // image.DecodeConfig formats
+	_ "image/png"
+	"math"
+	"os"
+	"time"
+
+	_ "golang.org/x/image/webp"
+
+	"yolo-server/internal/postprocess"
+	"yolo-server/internal/preprocess"
+)
+
+// ── Mock ─────────────────────────────────────────────────────────────────────
+// Mock is a deterministic Detector for frontend development and CI. It
+// needs neither ONNX Runtime nor OpenCV: only the image header is parsed
+// (for its size), and the detections come from a fixtures file keyed by
+// the frame's SHA-256, or are synthesized from the hash when none match.
+//
+// Fixtures file:
+//
+//	{"<sha256 hex>": [{"box": [x1, y1, x2, y2], "score": 0.9, "label": 0}],
+//	 "default": [...]}
+
+type Mock struct {
+	labels    postprocess.Labels
+	fixtures  map[string][]postprocess.Detection
+	latency   time.Duration // simulated inference time per frame
+	cal       *postprocess.ScoreCalibration
+	exclusive *postprocess.ExclusiveClasses
+}
+
+var _ Detector = (*Mock)(nil)
+
+// NewMock loads fixturesPath when non-empty.
+func NewMock(labels postprocess.Labels, fixturesPath string, latency time.Duration, cal *postprocess.ScoreCalibration, exclusive *postprocess.ExclusiveClasses) (*Mock, error) {
+	m := &Mock{labels: labels, latency: latency, cal: cal, exclusive: exclusive}
+	if fixturesPath == "" {
+		return m, nil
+	}
+	raw, err := os.ReadFile(fixturesPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &m.fixtures); err != nil {
+		return nil, fmt.Errorf("%s: %w", fixturesPath, err)
+	}
+	for _, dets := range m.fixtures {
+		for i := range dets {
+			if dets[i].Name == "" {
+				dets[i].Name = labels.Name(dets[i].Label)
+			}
+		}
+	}
+	return m, nil
+}
+
+func (m *Mock) Warmup() error { return nil }
+
+func (m *Mock) Detect(frame []byte, opts Options) ([]postprocess.Detection, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(frame))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", preprocess.ErrDecode, err)
+	}
+	if m.latency > 0 {
+		time.Sleep(m.latency)
+	}
+	sum := sha256.Sum256(frame)
+	dets, ok := m.fixtures[hex.EncodeToString(sum[:])]
+	if !ok {
+		dets, ok = m.fixtures["default"]
+	}
+	if !ok {
+		dets = m.synthesize(sum, cfg.Width, cfg.Height, opts.ROI)
+	}
+
+	out := make([]postprocess.Detection, 0, len(dets))
+	raw := m.cal.RawThreshold(opts.ConfThreshold)
+	for _, d := range dets {
+		if d.Score >= raw {
+			out = append(out, d)
+		}
+	}
+	out = postprocess.Unmasked(out, opts.Mask)
+	out = m.cal.Apply(out, opts.ConfThreshold)
+	out = m.exclusive.Apply(out)
+	return postprocess.TopScore(out, opts.ConfMargin), nil
+}
+
+// synthesize places one box in the middle half of the frame (or of the
+// region of interest) with a label and score derived from the hash, so
+// the same frame always yields the same answer.
+func (m *Mock) synthesize(sum [sha256.Size]byte, w, h int, roi image.Rectangle) []postprocess.Detection {
+	area := image.Rect(0, 0, w, h)
+	if !roi.Empty() {
+		area = roi.Intersect(area)
+	}
+	if area.Empty() {
+		return nil
+	}
+	label := 0
+	if n := len(m.labels); n > 0 {
+		label = int(sum[0]) % n
+	}
+	dx, dy := area.Dx()/4, area.Dy()/4
+	return []postprocess.Detection{{
+		Box:   [4]int{area.Min.X + dx, area.Min.Y + dy, area.Max.X - dx, area.Max.Y - dy},
+		Score: math.Round((0.5+float64(sum[1])/512)*10000) / 10000, // [0.5, 1)
+		Label: label,
+		Name:  m.labels.Name(label),
+	}}
+}
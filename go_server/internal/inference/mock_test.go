@@ -0,0 +1,118 @@
+package inference
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"yolo-server/internal/postprocess"
+	"yolo-server/internal/preprocess"
+)
+
+func pngFrame(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestMockSynthesizes(t *testing.T) {
+	labels := postprocess.Labels{0: "person", 1: "car"}
+	m, err := NewMock(labels, "", 0, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := pngFrame(t, 400, 200)
+	first, err := m.Detect(frame, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 1 {
+		t.Fatalf("got %d detections, want 1", len(first))
+	}
+	d := first[0]
+	if d.Box != [4]int{100, 50, 300, 150} {
+		t.Errorf("box = %v, want the middle half of the frame", d.Box)
+	}
+	if d.Score < 0.5 || d.Score >= 1 || d.Name != labels.Name(d.Label) {
+		t.Errorf("detection = %+v, want a score in [0.5, 1) and a named label", d)
+	}
+	again, _ := m.Detect(frame, Options{})
+	if !reflect.DeepEqual(first, again) {
+		t.Errorf("same frame answered %v, then %v", first, again)
+	}
+
+	roi, _ := m.Detect(frame, Options{ROI: image.Rect(200, 0, 400, 100)})
+	if len(roi) != 1 || roi[0].Box != [4]int{250, 25, 350, 75} {
+		t.Errorf("ROI detections = %v, want one box in the middle of the ROI", roi)
+	}
+	if none, _ := m.Detect(frame, Options{ConfThreshold: 1}); len(none) != 0 {
+		t.Errorf("threshold 1 kept %v", none)
+	}
+	if masked, _ := m.Detect(frame, Options{Mask: []image.Rectangle{image.Rect(0, 0, 400, 200)}}); len(masked) != 0 {
+		t.Errorf("fully masked frame kept %v", masked)
+	}
+}
+
+func TestMockFixtures(t *testing.T) {
+	frame := pngFrame(t, 64, 64)
+	other := pngFrame(t, 32, 32)
+	sum := sha256.Sum256(frame)
+	path := filepath.Join(t.TempDir(), "fixtures.json")
+	fixtures := `{
+		"` + hex.EncodeToString(sum[:]) + `": [
+			{"box": [1, 2, 3, 4], "score": 0.9, "label": 1},
+			{"box": [5, 6, 7, 8], "score": 0.3, "label": 0, "name": "custom"}
+		],
+		"default": [{"box": [0, 0, 10, 10], "score": 0.8, "label": 7}]
+	}`
+	if err := os.WriteFile(path, []byte(fixtures), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewMock(postprocess.Labels{1: "car"}, path, 0, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := m.Detect(frame, Options{ConfThreshold: 0.25})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []postprocess.Detection{
+		{Box: [4]int{1, 2, 3, 4}, Score: 0.9, Label: 1, Name: "car"},
+		{Box: [4]int{5, 6, 7, 8}, Score: 0.3, Label: 0, Name: "custom"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("keyed fixture = %+v, want %+v", got, want)
+	}
+	if got, _ := m.Detect(frame, Options{ConfThreshold: 0.5}); len(got) != 1 {
+		t.Errorf("threshold 0.5 kept %v, want the 0.9 box only", got)
+	}
+	if got, _ := m.Detect(other, Options{}); len(got) != 1 || got[0].Name != "cls7" {
+		t.Errorf("unkeyed frame = %v, want the default fixture", got)
+	}
+}
+
+func TestMockErrors(t *testing.T) {
+	m, _ := NewMock(nil, "", 0, nil, nil)
+	if _, err := m.Detect([]byte("not an image"), Options{}); !errors.Is(err, preprocess.ErrDecode) {
+		t.Errorf("Detect(garbage) = %v, want ErrDecode", err)
+	}
+	if _, err := NewMock(nil, filepath.Join(t.TempDir(), "missing.json"), 0, nil, nil); err == nil {
+		t.Error("NewMock with a missing fixtures file succeeded")
+	}
+	bad := filepath.Join(t.TempDir(), "bad.json")
+	_ = os.WriteFile(bad, []byte("{"), 0o644)
+	if _, err := NewMock(nil, bad, 0, nil, nil); err == nil {
+		t.Error("NewMock with a malformed fixtures file succeeded")
+	}
+}
@@ -0,0 +1,6 @@
+//go:build nocv
+
+package inference
+
+// RuntimeVersions reports no native libraries in a nocv build.
+func RuntimeVersions() (onnxruntime, gocvVersion, opencv string) { return "", "", "" }
@@ -0,0 +1,381 @@
+package inference
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"yolo-server/internal/postprocess"
+)
+
+// ── ONNX 메타데이터 파서 ──────────────────────────────────────────────────────
+// ultralytics ONNX export는 ModelProto.metadata_props (field 14)에
+// 클래스 이름을 저장한다. 외부 proto 라이브러리 없이 최소 파서로 읽는다.
+// ir_version, producer, model_version and opset_import are read as well.
+//
+// The file is streamed: length-delimited fields other than metadata_props
+// (the graph and its initializers, potentially gigabytes) are skipped with
+// a seek instead of being read. Models exported with external data keep
+// their weights in separate files, which are never opened here. When the
+// model has no metadata_props, <model>.json next to it is used instead.
+
+// ModelProto field numbers (onnx.proto).
+const (
+	fieldIRVersion       = 1
+	fieldProducerName    = 2
+	fieldProducerVersion = 3
+	fieldModelVersion    = 5
+	fieldOpsetImport     = 8
+	fieldMetadataProps   = 14
+)
+
+const maxMetadataEntry = 16 << 20 // a names table is a few KB; anything larger is corrupt
+
+// ModelInfo describes a model file, as served by /model/info.
+type ModelInfo struct {
+	IRVersion       int64             `json:"ir_version,omitempty"`
+	ProducerName    string            `json:"producer_name,omitempty"`
+	ProducerVersion string            `json:"producer_version,omitempty"`
+	ModelVersion    int64             `json:"model_version,omitempty"`
+	Opsets          map[string]int64  `json:"opsets,omitempty"` // domain → version; "ai.onnx" is the default domain
+	Metadata        map[string]string `json:"metadata"`         // metadata_props, or the sidecar JSON
+}
+
+// Task is the ultralytics task ("detect", "segment", "pose", "obb"), or
+// "detect" when the metadata does not say.
+func (m ModelInfo) Task() string {
+	if t := strings.TrimSpace(m.Metadata["task"]); t != "" {
+		return t
+	}
+	return "detect"
+}
+
+// Labels returns the class names, or nil when the metadata has none.
+func (m ModelInfo) Labels() postprocess.Labels {
+	if names, ok := m.Metadata["names"]; ok {
+		return parseNames(names)
+	}
+	return nil
+}
+
+// Stride is the model's largest stride, 0 if unknown.
+func (m ModelInfo) Stride() int {
+	n, _ := strconv.Atoi(strings.TrimSpace(m.Metadata["stride"]))
+	return n
+}
+
+// ImgSz is the export input size as [h, w] ("[640, 640]" in the metadata),
+// nil if unknown.
+func (m ModelInfo) ImgSz() []int {
+	var sz []int
+	if json.Unmarshal([]byte(m.Metadata["imgsz"]), &sz) != nil {
+		return nil
+	}
+	return sz
+}
+
+var errVarint = errors.New("onnx: malformed varint")
+
+// protoReader reads protobuf wire format from a file, tracking the offset
+// so large fields can be skipped by seeking.
+type protoReader struct {
+	f    io.ReadSeeker
+	r    *bufio.Reader
+	pos  int64
+	size int64
+}
+
+func (p *protoReader) varint() (uint64, error) {
+	var v uint64
+	for shift := uint(0); shift < 64; shift += 7 {
+		b, err := p.r.ReadByte()
+		if err != nil {
+			if shift > 0 && errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		p.pos++
+		v |= uint64(b&0x7F) << shift
+		if b&0x80 == 0 {
+			return v, nil
+		}
+	}
+	return 0, errVarint
+}
+
+func (p *protoReader) skip(n uint64) error {
+	if n <= uint64(p.r.Buffered()) {
+		_, err := p.r.Discard(int(n))
+		p.pos += int64(n)
+		return err
+	}
+	if n > uint64(p.size-p.pos) {
+		return io.ErrUnexpectedEOF
+	}
+	p.pos += int64(n)
+	if _, err := p.f.Seek(p.pos, io.SeekStart); err != nil {
+		return err
+	}
+	p.r.Reset(p.f)
+	return nil
+}
+
+func (p *protoReader) bytes(n uint64) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(p.r, b); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	p.pos += int64(n)
+	return b, nil
+}
+
+// skipField skips the value of a field with the given wire type.
+func (p *protoReader) skipField(wireType uint64) error {
+	switch wireType {
+	case 0:
+		_, err := p.varint()
+		return err
+	case 1:
+		return p.skip(8)
+	case 2:
+		n, err := p.varint()
+		if err != nil {
+			return err
+		}
+		return p.skip(n)
+	case 5:
+		return p.skip(4)
+	default: // groups (3, 4) are not used by onnx.proto
+		return fmt.Errorf("onnx: unsupported wire type %d", wireType)
+	}
+}
+
+// walkMessage calls fn for each varint and length-delimited field of a
+// small embedded message; fixed-size fields are skipped.
+func walkMessage(data []byte, fn func(field uint64, v uint64, b []byte)) error {
+	for pos := 0; pos < len(data); {
+		tag, n := binary.Uvarint(data[pos:])
+		if n <= 0 {
+			return errVarint
+		}
+		pos += n
+		switch tag & 0x7 {
+		case 0:
+			v, n := binary.Uvarint(data[pos:])
+			if n <= 0 {
+				return errVarint
+			}
+			pos += n
+			fn(tag>>3, v, nil)
+		case 1:
+			pos += 8
+		case 5:
+			pos += 4
+		case 2:
+			length, n := binary.Uvarint(data[pos:])
+			if n <= 0 || length > uint64(len(data)-pos-n) {
+				return io.ErrUnexpectedEOF
+			}
+			pos += n
+			fn(tag>>3, 0, data[pos:pos+int(length)])
+			pos += int(length)
+		default:
+			return fmt.Errorf("onnx: unsupported wire type %d", tag&0x7)
+		}
+		if pos > len(data) {
+			return io.ErrUnexpectedEOF
+		}
+	}
+	return nil
+}
+
+// parseModelProto reads the top-level ModelProto fields of the file at
+// path. A file cut off or corrupted part way yields what was read so far
+// and the error.
+func parseModelProto(path string) (ModelInfo, error) {
+	info := ModelInfo{Metadata: make(map[string]string)}
+	f, err := os.Open(path)
+	if err != nil {
+		return info, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return info, err
+	}
+	return parseModelProtoFrom(f, fi.Size())
+}
+
+// parseModelProtoFrom is parseModelProto for size bytes read from f.
+func parseModelProtoFrom(f io.ReadSeeker, size int64) (ModelInfo, error) {
+	info := ModelInfo{Metadata: make(map[string]string)}
+	p := &protoReader{f: f, r: bufio.NewReaderSize(f, 64<<10), size: size}
+	for {
+		tag, err := p.varint()
+		if errors.Is(err, io.EOF) {
+			return info, nil
+		}
+		if err != nil {
+			return info, err
+		}
+		field, wireType := tag>>3, tag&0x7
+		switch {
+		case wireType == 0 && (field == fieldIRVersion || field == fieldModelVersion):
+			v, err := p.varint()
+			if err != nil {
+				return info, err
+			}
+			if field == fieldIRVersion {
+				info.IRVersion = int64(v)
+			} else {
+				info.ModelVersion = int64(v)
+			}
+			continue
+		case wireType == 2 && (field == fieldProducerName || field == fieldProducerVersion ||
+			field == fieldOpsetImport || field == fieldMetadataProps):
+		default:
+			if err := p.skipField(wireType); err != nil {
+				return info, err
+			}
+			continue
+		}
+
+		n, err := p.varint()
+		if err != nil {
+			return info, err
+		}
+		if n > maxMetadataEntry {
+			return info, fmt.Errorf("onnx: field %d of %d bytes", field, n)
+		}
+		b, err := p.bytes(n)
+		if err != nil {
+			return info, err
+		}
+		switch field {
+		case fieldProducerName:
+			info.ProducerName = string(b)
+		case fieldProducerVersion:
+			info.ProducerVersion = string(b)
+		case fieldOpsetImport: // OperatorSetIdProto {domain=1, version=2}
+			domain, version := "", int64(0)
+			err = walkMessage(b, func(f, v uint64, s []byte) {
+				switch f {
+				case 1:
+					domain = string(s)
+				case 2:
+					version = int64(v)
+				}
+			})
+			if domain == "" {
+				domain = "ai.onnx"
+			}
+			if info.Opsets == nil {
+				info.Opsets = make(map[string]int64)
+			}
+			info.Opsets[domain] = version
+		case fieldMetadataProps: // StringStringEntryProto {key=1, value=2}
+			var k, v string
+			err = walkMessage(b, func(f, _ uint64, s []byte) {
+				switch f {
+				case 1:
+					k = string(s)
+				case 2:
+					v = string(s)
+				}
+			})
+			if k != "" {
+				info.Metadata[k] = v
+			}
+		}
+		if err != nil {
+			return info, err
+		}
+	}
+}
+
+// sidecarPath is model/yolo26n.onnx → model/yolo26n.json.
+func sidecarPath(modelPath string) string {
+	return strings.TrimSuffix(modelPath, filepath.Ext(modelPath)) + ".json"
+}
+
+// readSidecar loads metadata from a JSON object. String values are taken
+// as is; others (e.g. "names" as a JSON object or array) are kept as their
+// JSON text.
+func readSidecar(path string) (map[string]string, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	result := make(map[string]string, len(obj))
+	for k, v := range obj {
+		var s string
+		if json.Unmarshal(v, &s) == nil {
+			result[k] = s
+		} else {
+			result[k] = string(v)
+		}
+	}
+	return result, nil
+}
+
+// ReadModelInfo parses the model file. When it has no metadata_props or
+// cannot be parsed, the metadata comes from the sidecar JSON if present.
+func ReadModelInfo(modelPath string) (ModelInfo, error) {
+	info, err := parseModelProto(modelPath)
+	return withSidecar(modelPath, info, err)
+}
+
+// ReadModelInfoData is ReadModelInfo for the model's bytes, already read
+// from modelPath.
+func ReadModelInfoData(modelPath string, data []byte) (ModelInfo, error) {
+	info, err := parseModelProtoFrom(bytes.NewReader(data), int64(len(data)))
+	return withSidecar(modelPath, info, err)
+}
+
+func withSidecar(modelPath string, info ModelInfo, err error) (ModelInfo, error) {
+	if err == nil && len(info.Metadata) > 0 {
+		return info, nil
+	}
+	side, serr := readSidecar(sidecarPath(modelPath))
+	if serr == nil {
+		info.Metadata = side
+		return info, nil
+	}
+	if err == nil && errors.Is(serr, os.ErrNotExist) {
+		return info, nil // a model without metadata is not an error
+	}
+	if err != nil {
+		return info, err
+	}
+	return info, serr
+}
+
+// parseNames accepts the ultralytics dict string "{0: 'person', ...}",
+// its JSON equivalent, or a JSON array of names.
+func parseNames(raw string) postprocess.Labels {
+	var list []string
+	if strings.HasPrefix(strings.TrimSpace(raw), "[") && json.Unmarshal([]byte(raw), &list) == nil {
+		labels := make(postprocess.Labels, len(list))
+		for i, name := range list {
+			labels[i] = name
+		}
+		return labels
+	}
+	return postprocess.ParseLabels(raw)
+}
@@ -0,0 +1,115 @@
+package inference
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"yolo-server/internal/postprocess"
+)
+
+const tinyModel = "../../testdata/tiny.onnx" // see testdata/gen.go
+
+func TestReadModelInfo(t *testing.T) {
+	info, err := ReadModelInfo(tinyModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.IRVersion != 8 || info.ModelVersion != 1 {
+		t.Errorf("ir_version, model_version = %d, %d, want 8, 1", info.IRVersion, info.ModelVersion)
+	}
+	if info.ProducerName != "stream-yolo testdata" || info.ProducerVersion != "1" {
+		t.Errorf("producer = %q %q", info.ProducerName, info.ProducerVersion)
+	}
+	if want := map[string]int64{"ai.onnx": 13}; !reflect.DeepEqual(info.Opsets, want) {
+		t.Errorf("opsets = %v, want %v", info.Opsets, want)
+	}
+	if got := info.Task(); got != "detect" {
+		t.Errorf("Task = %q, want detect", got)
+	}
+	if want := (postprocess.Labels{0: "blue", 1: "green", 2: "red"}); !reflect.DeepEqual(info.Labels(), want) {
+		t.Errorf("Labels = %v, want %v", info.Labels(), want)
+	}
+	if got := info.ImgSz(); !reflect.DeepEqual(got, []int{640, 640}) {
+		t.Errorf("ImgSz = %v, want [640 640]", got)
+	}
+	if got := info.Stride(); got != 32 {
+		t.Errorf("Stride = %d, want 32", got)
+	}
+
+	data, err := os.ReadFile(tinyModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromData, err := ReadModelInfoData(tinyModel, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fromData, info) {
+		t.Errorf("ReadModelInfoData = %+v, want %+v", fromData, info)
+	}
+}
+
+func TestReadModelInfoSidecar(t *testing.T) {
+	dir := t.TempDir()
+	bare := filepath.Join(dir, "bare.onnx")
+	// ModelProto{ir_version: 9} and nothing else.
+	if err := os.WriteFile(bare, []byte{0x08, 0x09}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := ReadModelInfo(bare)
+	if err != nil {
+		t.Fatalf("model without metadata or sidecar: %v", err)
+	}
+	if info.IRVersion != 9 || len(info.Metadata) != 0 || info.Task() != "detect" || info.Labels() != nil {
+		t.Errorf("bare model = %+v", info)
+	}
+
+	sidecar := `{"task": "obb", "names": {"0": "ship"}, "stride": 32}`
+	if err := os.WriteFile(filepath.Join(dir, "bare.json"), []byte(sidecar), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info, err = ReadModelInfo(bare)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Task() != "obb" || info.Stride() != 32 || info.Labels().Name(0) != "ship" {
+		t.Errorf("with sidecar = %+v", info)
+	}
+
+	// A cut-off file still reports what the sidecar says.
+	cut := filepath.Join(dir, "cut.onnx")
+	data, _ := os.ReadFile(tinyModel)
+	if err := os.WriteFile(cut, data[:len(data)/2], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadModelInfo(cut); err == nil {
+		t.Error("truncated model without a sidecar parsed cleanly")
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cut.json"), []byte(sidecar), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := ReadModelInfo(cut); err != nil || info.Task() != "obb" {
+		t.Errorf("truncated model with sidecar = %+v, %v", info, err)
+	}
+}
+
+func TestParseNames(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want postprocess.Labels
+	}{
+		{"{0: 'person', 1: 'bicycle'}", postprocess.Labels{0: "person", 1: "bicycle"}},
+		{`{"0": "person", "1": "bicycle"}`, postprocess.Labels{0: "person", 1: "bicycle"}},
+		{`["person", "bicycle"]`, postprocess.Labels{0: "person", 1: "bicycle"}},
+		{"{0: 'traffic, light'}", postprocess.Labels{0: "traffic, light"}},
+		{"{}", postprocess.Labels{}},
+	}
+	for _, tt := range tests {
+		if got := parseNames(tt.raw); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseNames(%q) = %v, want %v", tt.raw, got, tt.want)
+		}
+	}
+}
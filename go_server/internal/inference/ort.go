@@ -0,0 +1,177 @@
+//go:build !nocv
+
+package inference
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// ── ONNX Runtime 백엔드 ──────────────────────────────────────────────────────
+
+type ortBackend struct {
+	session     atomic.Pointer[ort.DynamicAdvancedSession] // replaced by Reset
+	path        string
+	data        []byte // the model itself when opened from memory
+	inputNames  []string
+	outputNames []string
+	so          SessionOptions
+	inputSize   int       // 0 when H and W are dynamic
+	declared    ort.Shape // as in the model, -1 for dynamic dims
+	outputShape ort.Shape // nil when the model output has dynamic dims
+}
+
+// NewORTBackend opens the model at path in ONNX Runtime. Init must have
+// been called first.
+func NewORTBackend(path string, so SessionOptions) (Backend, error) {
+	inputInfo, outputInfo, err := ort.GetInputOutputInfo(path)
+	if err != nil {
+		return nil, fmt.Errorf("model info query: %w", err)
+	}
+	return newORTBackend(path, nil, inputInfo, outputInfo, so)
+}
+
+// NewORTBackendData is NewORTBackend for a model already read into data,
+// so the bytes that were verified are the bytes that run. data is kept for
+// Reset.
+func NewORTBackendData(data []byte, so SessionOptions) (Backend, error) {
+	inputInfo, outputInfo, err := ort.GetInputOutputInfoWithONNXData(data)
+	if err != nil {
+		return nil, fmt.Errorf("model info query: %w", err)
+	}
+	return newORTBackend("", data, inputInfo, outputInfo, so)
+}
+
+func newORTBackend(path string, data []byte, inputInfo, outputInfo []ort.InputOutputInfo, so SessionOptions) (Backend, error) {
+	if len(outputInfo) == 0 {
+		return nil, fmt.Errorf("model has no outputs")
+	}
+	inputNames := make([]string, len(inputInfo))
+	for i, info := range inputInfo {
+		inputNames[i] = info.Name
+	}
+	// Only the first output (the detection rows) is fetched; segmentation
+	// models also have a mask prototype output, which is not decoded.
+	outputNames := []string{outputInfo[0].Name}
+
+	b := &ortBackend{
+		path:        path,
+		data:        data,
+		inputNames:  inputNames,
+		outputNames: outputNames,
+		so:          so,
+		declared:    outputInfo[0].Dimensions.Clone(),
+	}
+	session, err := b.newSession()
+	if err != nil {
+		return nil, err
+	}
+	b.session.Store(session)
+	if dims := inputInfo[0].Dimensions; len(dims) == 4 && dims[2] > 0 && dims[2] == dims[3] {
+		b.inputSize = int(dims[2])
+	}
+	// Bind a fixed-size output tensor only when every dim is known;
+	// otherwise let ORT allocate the output on each Run.
+	if dims := outputInfo[0].Dimensions; dims.Validate() == nil {
+		b.outputShape = dims.Clone()
+	}
+	return b, nil
+}
+
+func (b *ortBackend) newSession() (*ort.DynamicAdvancedSession, error) {
+	opts, err := b.so.build()
+	if err != nil {
+		return nil, fmt.Errorf("session options: %w", err)
+	}
+	var session *ort.DynamicAdvancedSession
+	if b.data != nil {
+		session, err = ort.NewDynamicAdvancedSessionWithONNXData(b.data, b.inputNames, b.outputNames, opts)
+	} else {
+		session, err = ort.NewDynamicAdvancedSession(b.path, b.inputNames, b.outputNames, opts)
+	}
+	opts.Destroy()
+	if err != nil {
+		return nil, fmt.Errorf("session create: %w", err)
+	}
+	return session, nil
+}
+
+// Reset opens a fresh session for new bindings. The old one is left to the
+// call wedged in it; destroying it under a running Run is not safe.
+func (b *ortBackend) Reset() error {
+	session, err := b.newSession()
+	if err != nil {
+		return err
+	}
+	b.session.Store(session)
+	return nil
+}
+
+func (b *ortBackend) Close() error { return b.session.Load().Destroy() }
+
+func (b *ortBackend) OutputShape() []int64 { return b.declared }
+
+func (b *ortBackend) InputSize() int { return b.inputSize }
+
+func (b *ortBackend) NewBinding(size int) (Binding, error) {
+	input, err := ort.NewEmptyTensor[float32](ort.NewShape(1, 3, int64(size), int64(size)))
+	if err != nil {
+		return nil, fmt.Errorf("input tensor: %w", err)
+	}
+	t := &ortBinding{session: b.session.Load(), input: input}
+	if b.outputShape != nil {
+		if t.output, err = ort.NewEmptyTensor[float32](b.outputShape); err != nil {
+			input.Destroy()
+			return nil, fmt.Errorf("output tensor: %w", err)
+		}
+	}
+	return t, nil
+}
+
+// ortBinding is an input/output tensor pair. The input tensor's backing
+// slice is written in place every frame, and the output tensor is handed
+// to Run so ORT fills it instead of allocating a new one.
+type ortBinding struct {
+	session *ort.DynamicAdvancedSession
+	input   *ort.Tensor[float32]
+	output  *ort.Tensor[float32] // nil → ORT allocates the output per frame
+	dynamic ort.Value            // last ORT-allocated output, freed on next Run
+}
+
+func (t *ortBinding) Input() []float32 { return t.input.GetData() }
+
+func (t *ortBinding) Run() ([]float32, []int64, error) {
+	t.releaseDynamic()
+	outputs := []ort.Value{nil}
+	if t.output != nil {
+		outputs[0] = t.output
+	}
+	if err := t.session.Run([]ort.Value{t.input}, outputs); err != nil {
+		return nil, nil, fmt.Errorf("inference: %w", err)
+	}
+	if t.output == nil {
+		t.dynamic = outputs[0]
+	}
+	out, ok := outputs[0].(*ort.Tensor[float32])
+	if !ok {
+		return nil, nil, fmt.Errorf("unexpected output tensor type")
+	}
+	return out.GetData(), out.GetShape(), nil
+}
+
+func (t *ortBinding) releaseDynamic() {
+	if t.dynamic != nil {
+		t.dynamic.Destroy()
+		t.dynamic = nil
+	}
+}
+
+func (t *ortBinding) Close() {
+	t.releaseDynamic()
+	t.input.Destroy()
+	if t.output != nil {
+		t.output.Destroy()
+	}
+}
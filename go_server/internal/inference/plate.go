@@ -0,0 +1,192 @@
+//go:build !nocv
+
+package inference
+
+import (
+	"fmt"
+	"image"
+	"log/slog"
+	"math"
+	"slices"
+
+	ort "github.com/yalue/onnxruntime_go"
+	"gocv.io/x/gocv"
+
+	"yolo-server/internal/postprocess"
+)
+
+// ── 번호판 인식 ──────────────────────────────────────────────────────────────
+// A PlateReader is an optional second stage of the Engine: every detection
+// of one of its classes (vehicles, or a plate detector's plates) is cut out
+// of the frame and read by an OCR model, and text read with at least
+// MinScore becomes the detection's Attributes.Plate. The model takes a
+// fixed 1×C×H×W float32 input in [0, 1], RGB, or gray when C is 1, and puts
+// out per-step scores, 1×T×K or 1×K×T. With "ctc" decoding, class 0 is the
+// blank and 1..K-1 the alphabet, and repeats collapse; with "slots", each
+// step is one character of the alphabet, '_' padding. Scores are softmaxed
+// unless they already are probabilities.
+
+type PlateReader struct {
+	cfg     PlateConfig
+	session *ort.DynamicAdvancedSession
+	c, h, w int
+}
+
+// NewPlateReader opens the OCR model. Init must have been called first.
+func NewPlateReader(cfg PlateConfig, so SessionOptions) (*PlateReader, error) {
+	inputs, outputs, err := ort.GetInputOutputInfo(cfg.Path)
+	if err != nil {
+		return nil, fmt.Errorf("plate model info query: %w", err)
+	}
+	if len(inputs) != 1 || len(outputs) == 0 {
+		return nil, fmt.Errorf("plate model: want one input and an output, got %d and %d", len(inputs), len(outputs))
+	}
+	dims := inputs[0].Dimensions
+	if len(dims) != 4 || (dims[1] != 1 && dims[1] != 3) || dims[2] <= 0 || dims[3] <= 0 {
+		return nil, fmt.Errorf("plate model: want a fixed 1×C×H×W input with C 1 or 3, got %v", dims)
+	}
+	opts, err := so.build()
+	if err != nil {
+		return nil, fmt.Errorf("session options: %w", err)
+	}
+	session, err := ort.NewDynamicAdvancedSession(cfg.Path, []string{inputs[0].Name}, []string{outputs[0].Name}, opts)
+	opts.Destroy()
+	if err != nil {
+		return nil, fmt.Errorf("plate session create: %w", err)
+	}
+	return &PlateReader{cfg: cfg, session: session, c: int(dims[1]), h: int(dims[2]), w: int(dims[3])}, nil
+}
+
+func (p *PlateReader) Close() error {
+	if p == nil {
+		return nil
+	}
+	return p.session.Destroy()
+}
+
+// annotate reads the plate of every detection in dets of p's classes. img
+// is the frame the boxes are in.
+func (p *PlateReader) annotate(img gocv.Mat, dets []postprocess.Detection) {
+	if p == nil {
+		return
+	}
+	bounds := image.Rect(0, 0, img.Cols(), img.Rows())
+	for i := range dets {
+		d := &dets[i]
+		r := image.Rect(d.Box[0], d.Box[1], d.Box[2], d.Box[3]).Intersect(bounds)
+		if r.Empty() || !slices.Contains(p.cfg.Classes, d.Name) {
+			continue
+		}
+		crop := img.Region(r)
+		text, score, err := p.read(crop)
+		crop.Close()
+		if err != nil {
+			slog.Warn("plate read", "err", err)
+			continue
+		}
+		if text != "" && score >= p.cfg.MinScore {
+			d.SetAttributes(func(a *postprocess.Attributes) { a.Plate, a.PlateScore = text, score })
+		}
+	}
+}
+
+func (p *PlateReader) read(crop gocv.Mat) (string, float64, error) {
+	resized := gocv.NewMat()
+	defer resized.Close()
+	gocv.Resize(crop, &resized, image.Pt(p.w, p.h), 0, 0, gocv.InterpolationLinear)
+	code := gocv.ColorBGRToRGB
+	if p.c == 1 {
+		code = gocv.ColorBGRToGray
+	}
+	gocv.CvtColor(resized, &resized, code)
+	pix, err := resized.DataPtrUint8()
+	if err != nil {
+		return "", 0, err
+	}
+	plane := p.h * p.w
+	data := make([]float32, p.c*plane)
+	for i := 0; i < plane; i++ {
+		for ch := 0; ch < p.c; ch++ {
+			data[ch*plane+i] = float32(pix[i*p.c+ch]) / 255
+		}
+	}
+	input, err := ort.NewTensor(ort.NewShape(1, int64(p.c), int64(p.h), int64(p.w)), data)
+	if err != nil {
+		return "", 0, err
+	}
+	defer input.Destroy()
+	outputs := []ort.Value{nil}
+	if err := p.session.Run([]ort.Value{input}, outputs); err != nil {
+		return "", 0, fmt.Errorf("plate inference: %w", err)
+	}
+	defer outputs[0].Destroy()
+	out, ok := outputs[0].(*ort.Tensor[float32])
+	if !ok {
+		return "", 0, fmt.Errorf("plate model: unexpected output tensor type")
+	}
+	return decodePlate(out.GetData(), out.GetShape(), p.cfg.Alphabet, p.cfg.Decode)
+}
+
+// decodePlate turns the OCR output into text and its confidence, the mean
+// score of the characters read.
+func decodePlate(out []float32, shape []int64, alphabet, mode string) (string, float64, error) {
+	k := len(alphabet)
+	if mode == "ctc" {
+		k++ // the blank
+	}
+	if len(shape) == 2 {
+		shape = append([]int64{1}, shape...)
+	}
+	if len(shape) != 3 || shape[0] != 1 || (shape[1] != int64(k) && shape[2] != int64(k)) {
+		return "", 0, fmt.Errorf("plate model: want a 1×T×%d output, got %v", k, shape)
+	}
+	steps := int(shape[1])
+	at := func(t, c int) float32 { return out[t*k+c] }
+	if shape[2] != int64(k) { // 1×K×T
+		steps = int(shape[2])
+		at = func(t, c int) float32 { return out[c*steps+t] }
+	}
+	var text []byte
+	var sum float64
+	prev := -1
+	row := make([]float64, k)
+	for t := 0; t < steps; t++ {
+		for c := range row {
+			row[c] = float64(at(t, c))
+		}
+		best, p := argmaxProb(row)
+		switch {
+		case mode == "ctc" && (best == 0 || best == prev):
+		case mode == "ctc":
+			text, sum = append(text, alphabet[best-1]), sum+p
+		case alphabet[best] != '_':
+			text, sum = append(text, alphabet[best]), sum+p
+		}
+		prev = best
+	}
+	if len(text) == 0 {
+		return "", 0, nil
+	}
+	return string(text), sum / float64(len(text)), nil
+}
+
+// argmaxProb is the best class of row and its probability, softmaxing row
+// unless it already sums to one.
+func argmaxProb(row []float64) (int, float64) {
+	best, total, probs := 0, 0.0, true
+	for c, v := range row {
+		if v > row[best] {
+			best = c
+		}
+		probs = probs && v >= 0 && v <= 1
+		total += v
+	}
+	if probs && math.Abs(total-1) < 1e-3 {
+		return best, row[best]
+	}
+	total = 0
+	for _, v := range row {
+		total += math.Exp(v - row[best])
+	}
+	return best, 1 / total
+}
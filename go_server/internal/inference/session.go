@@ -0,0 +1,108 @@
+//go:build !nocv
+
+package inference
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	ort "github.com/yalue/onnxruntime_go"
+	"gocv.io/x/gocv"
+)
+
+// ── ORT 세션 ─────────────────────────────────────────────────────────────────
+
+var (
+	envMu   sync.Mutex
+	envRefs int // Inits not yet Destroyed
+)
+
+// Init loads the ONNX Runtime shared library; each Init needs a Destroy.
+// Several models share the one environment.
+func Init(sharedLibPath string) error {
+	envMu.Lock()
+	defer envMu.Unlock()
+	if envRefs == 0 {
+		ort.SetSharedLibraryPath(sharedLibPath)
+		if err := ort.InitializeEnvironment(); err != nil {
+			return err
+		}
+	}
+	envRefs++
+	return nil
+}
+
+// Destroy releases one Init; the environment goes with the last.
+func Destroy() {
+	envMu.Lock()
+	defer envMu.Unlock()
+	if envRefs == 0 {
+		return
+	}
+	if envRefs--; envRefs == 0 {
+		_ = ort.DestroyEnvironment()
+	}
+}
+
+// build creates ORT session options. The caller owns the returned options
+// and must Destroy them once the session is created.
+func (so SessionOptions) build() (*ort.SessionOptions, error) {
+	opts, err := ort.NewSessionOptions()
+	if err != nil {
+		return nil, err
+	}
+	if err := so.apply(opts); err != nil {
+		opts.Destroy()
+		return nil, err
+	}
+	return opts, nil
+}
+
+func (so SessionOptions) apply(opts *ort.SessionOptions) error {
+	if so.IntraOpThreads > 0 {
+		if err := opts.SetIntraOpNumThreads(so.IntraOpThreads); err != nil {
+			return fmt.Errorf("intra-op threads: %w", err)
+		}
+	}
+	if so.InterOpThreads > 0 {
+		if err := opts.SetInterOpNumThreads(so.InterOpThreads); err != nil {
+			return fmt.Errorf("inter-op threads: %w", err)
+		}
+	}
+	if err := opts.SetCpuMemArena(so.CPUMemArena); err != nil {
+		return fmt.Errorf("cpu mem arena: %w", err)
+	}
+	if err := opts.SetMemPattern(so.MemPattern); err != nil {
+		return fmt.Errorf("mem pattern: %w", err)
+	}
+	if so.Provider == "cuda" {
+		if err := appendCUDA(opts, so.DeviceID); err != nil {
+			return fmt.Errorf("cuda provider: %w", err)
+		}
+	}
+	return nil
+}
+
+// appendCUDA adds the CUDA execution provider on device id. Nodes CUDA
+// cannot run stay on the CPU provider.
+func appendCUDA(opts *ort.SessionOptions, id int) error {
+	cuda, err := ort.NewCUDAProviderOptions()
+	if err != nil {
+		return err
+	}
+	defer cuda.Destroy()
+	if err := cuda.Update(map[string]string{"device_id": strconv.Itoa(id)}); err != nil {
+		return err
+	}
+	return opts.AppendExecutionProviderCUDA(cuda)
+}
+
+// RuntimeVersions reports the native library versions for /version. The
+// ONNX Runtime version is empty when Init was not called.
+func RuntimeVersions() (onnxruntime, gocvVersion, opencv string) {
+	if ort.IsInitialized() {
+		onnxruntime = ort.GetVersion()
+	}
+	return onnxruntime, gocv.Version(), gocv.OpenCVVersion()
+}
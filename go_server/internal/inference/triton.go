@@ -0,0 +1,164 @@
+package inference
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"yolo-server/internal/preprocess"
+)
+
+// ── Triton 백엔드 ────────────────────────────────────────────────────────────
+// Remote inference over the KServe v2 HTTP protocol (Triton, OpenVINO Model
+// Server, KServe). Tensors travel with Triton's binary-data extension: the
+// JSON header is followed by raw little-endian floats, which avoids turning
+// 1.2M input values into text on every frame. Servers that answer without
+// the extension are read from the JSON "data" array instead.
+
+const tritonTimeout = 10 * time.Second
+
+type tritonBackend struct {
+	cfg    TritonConfig
+	url    string // full infer endpoint
+	client *http.Client
+}
+
+func NewTritonBackend(cfg TritonConfig) (Backend, error) {
+	if cfg.URL == "" || cfg.Model == "" {
+		return nil, fmt.Errorf("triton: URL and model are required")
+	}
+	return &tritonBackend{
+		cfg:    cfg,
+		url:    strings.TrimSuffix(cfg.URL, "/") + "/v2/models/" + cfg.Model + "/infer",
+		client: &http.Client{Timeout: tritonTimeout},
+	}, nil
+}
+
+func (b *tritonBackend) Close() error { return nil }
+
+// OutputShape is unknown until the first response; warmup checks it.
+func (b *tritonBackend) OutputShape() []int64 { return nil }
+
+func (b *tritonBackend) NewBinding(size int) (Binding, error) {
+	return &tritonBinding{b: b, size: size, input: make([]float32, 3*size*size)}, nil
+}
+
+// InputSize assumes the default: the model repository config is not
+// queried, so other sizes are not offered for Triton.
+func (b *tritonBackend) InputSize() int { return preprocess.InputSize }
+
+type tritonBinding struct {
+	b      *tritonBackend
+	size   int
+	input  []float32
+	body   bytes.Buffer // request, reused
+	output []float32    // reused across Runs
+}
+
+type tritonTensor struct {
+	Name       string         `json:"name"`
+	Shape      []int64        `json:"shape,omitempty"`
+	Datatype   string         `json:"datatype,omitempty"`
+	Parameters map[string]any `json:"parameters,omitempty"`
+	Data       []float32      `json:"data,omitempty"`
+}
+
+type tritonRequest struct {
+	Inputs  []tritonTensor `json:"inputs"`
+	Outputs []tritonTensor `json:"outputs"`
+}
+
+type tritonResponse struct {
+	Outputs []tritonTensor `json:"outputs"`
+	Error   string         `json:"error"`
+}
+
+func (t *tritonBinding) Input() []float32 { return t.input }
+
+func (t *tritonBinding) Close() {}
+
+func (t *tritonBinding) Run() ([]float32, []int64, error) {
+	header, err := json.Marshal(tritonRequest{
+		Inputs: []tritonTensor{{
+			Name:       t.b.cfg.Input,
+			Shape:      []int64{1, 3, int64(t.size), int64(t.size)},
+			Datatype:   "FP32",
+			Parameters: map[string]any{"binary_data_size": 4 * len(t.input)},
+		}},
+		Outputs: []tritonTensor{{
+			Name:       t.b.cfg.Output,
+			Parameters: map[string]any{"binary_data": true},
+		}},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	t.body.Reset()
+	t.body.Write(header)
+	_ = binary.Write(&t.body, binary.LittleEndian, t.input)
+
+	req, err := http.NewRequest(http.MethodPost, t.b.url, bytes.NewReader(t.body.Bytes()))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Inference-Header-Content-Length", strconv.Itoa(len(header)))
+	resp, err := t.b.client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("triton: %w", err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("triton: %w", err)
+	}
+	return t.decode(resp, raw)
+}
+
+// decode splits a response into its JSON header and optional binary
+// section and returns the output tensor as float32.
+func (t *tritonBinding) decode(resp *http.Response, raw []byte) ([]float32, []int64, error) {
+	jsonLen := len(raw)
+	if v := resp.Header.Get("Inference-Header-Content-Length"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > len(raw) {
+			return nil, nil, fmt.Errorf("triton: bad Inference-Header-Content-Length %q", v)
+		}
+		jsonLen = n
+	}
+	var r tritonResponse
+	if err := json.Unmarshal(raw[:jsonLen], &r); err != nil {
+		return nil, nil, fmt.Errorf("triton: %s: %w", resp.Status, err)
+	}
+	if resp.StatusCode != http.StatusOK || r.Error != "" {
+		return nil, nil, fmt.Errorf("triton: %s: %s", resp.Status, r.Error)
+	}
+	for _, o := range r.Outputs {
+		if o.Name != t.b.cfg.Output {
+			continue
+		}
+		if o.Datatype != "FP32" {
+			return nil, nil, fmt.Errorf("triton: output %s is %s, want FP32", o.Name, o.Datatype)
+		}
+		if o.Data != nil {
+			return o.Data, o.Shape, nil
+		}
+		bin := raw[jsonLen:]
+		if size, ok := o.Parameters["binary_data_size"].(float64); !ok || int(size) != len(bin) || len(bin)%4 != 0 {
+			return nil, nil, fmt.Errorf("triton: output %s: unexpected binary size", o.Name)
+		}
+		t.output = t.output[:0]
+		for i := 0; i < len(bin); i += 4 {
+			t.output = append(t.output, math.Float32frombits(binary.LittleEndian.Uint32(bin[i:])))
+		}
+		return t.output, o.Shape, nil
+	}
+	return nil, nil, fmt.Errorf("triton: response has no output %q", t.b.cfg.Output)
+}
@@ -0,0 +1,72 @@
+//go:build !nocv
+
+package inference
+
+import (
+	"image"
+
+	"gocv.io/x/gocv"
+
+	"yolo-server/internal/postprocess"
+	"yolo-server/internal/preprocess"
+)
+
+// ── TTA ──────────────────────────────────────────────────────────────────────
+// Test-time augmentation trades speed for accuracy: the same image is run
+// at several scales and mirrored, and the union of boxes is fused with NMS.
+// The model input size is fixed per request, so a scale below 1 is emulated by
+// padding the image onto a larger grey canvas, which makes objects appear
+// smaller to the model without moving their top-left based coordinates.
+
+const ttaPadValue = 114 // ultralytics letterbox grey
+
+// detectTTA runs every configured augmentation on img and fuses the boxes.
+func (e *Engine) detectTTA(img gocv.Mat, opts Options, fm *preprocess.Mats, t Binding) ([]postprocess.Detection, error) {
+	var out []postprocess.Detection
+	for _, scale := range e.cfg.TTAScales {
+		dets, err := e.detectScaled(img, scale, opts, fm, t)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, dets...)
+	}
+	if e.cfg.TTAFlip {
+		dets, err := e.detectFlipped(img, opts, fm, t)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, dets...)
+	}
+	return postprocess.NMS(out, opts.NMSIoU), nil
+}
+
+func (e *Engine) detectScaled(img gocv.Mat, scale float64, opts Options, fm *preprocess.Mats, t Binding) ([]postprocess.Detection, error) {
+	if scale >= 1 {
+		return e.detect(img, opts, fm, t)
+	}
+	rows := int(float64(img.Rows()) / scale)
+	cols := int(float64(img.Cols()) / scale)
+	pad := gocv.NewScalar(ttaPadValue, ttaPadValue, ttaPadValue, 0)
+	canvas := gocv.NewMatWithSizeFromScalar(pad, rows, cols, gocv.MatTypeCV8UC3)
+	defer canvas.Close()
+	dst := canvas.Region(image.Rect(0, 0, img.Cols(), img.Rows()))
+	img.CopyTo(&dst)
+	dst.Close()
+	return e.detect(canvas, opts, fm, t)
+}
+
+func (e *Engine) detectFlipped(img gocv.Mat, opts Options, fm *preprocess.Mats, t Binding) ([]postprocess.Detection, error) {
+	flipped := gocv.NewMat()
+	defer flipped.Close()
+	gocv.Flip(img, &flipped, 1)
+	dets, err := e.detect(flipped, opts, fm, t)
+	if err != nil {
+		return nil, err
+	}
+	w := img.Cols()
+	for i := range dets {
+		b := &dets[i].Box
+		b[0], b[2] = w-b[2], w-b[0]
+	}
+	return dets, nil
+}
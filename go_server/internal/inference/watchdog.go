@@ -0,0 +1,130 @@
+package inference
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"runtime/pprof"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ── 워치독 ───────────────────────────────────────────────────────────────────
+// A native Run can wedge inside the C library and never return. With the
+// watchdog on, each Run gets a ceiling of Factor times the median of the
+// last watchdogWindow runs, and never less than Min. A Run past it is
+// abandoned: the caller gets ErrHung, the goroutines are dumped to the log,
+// and the binding is closed if the call ever comes back instead of being
+// pooled again. With Reset the backend then recreates its session, so later
+// frames do not queue behind whatever wedged the old one.
+
+const watchdogWindow = 64
+
+// ErrHung is returned for a Run abandoned by the watchdog.
+var ErrHung = errors.New("inference hung and was abandoned")
+
+// WatchdogConfig enables the hung-call watchdog when Factor > 0.
+type WatchdogConfig struct {
+	Factor float64       // ceiling as a multiple of the rolling median Run time
+	Min    time.Duration // lower bound of the ceiling
+	Reset  bool          // recreate the backend session after a hang
+}
+
+// Resetter is implemented by backends that can replace a wedged session.
+// Bindings made before Reset keep the old session.
+type Resetter interface {
+	Reset() error
+}
+
+type watchdog struct {
+	cfg   WatchdogConfig
+	hangs atomic.Int64
+
+	mu   sync.Mutex
+	runs [watchdogWindow]time.Duration
+	n    int // runs recorded, capped at watchdogWindow
+	next int
+}
+
+// ceiling is the current limit for one Run, or 0 before the first Run has
+// finished: the first Run pays for lazy initialization (CUDA especially)
+// and says nothing about steady-state latency.
+func (w *watchdog) ceiling() time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.n == 0 {
+		return 0
+	}
+	sorted := slices.Clone(w.runs[:w.n])
+	slices.Sort(sorted)
+	return max(time.Duration(w.cfg.Factor*float64(sorted[w.n/2])), w.cfg.Min)
+}
+
+func (w *watchdog) observe(d time.Duration) {
+	w.mu.Lock()
+	w.runs[w.next] = d
+	w.next = (w.next + 1) % watchdogWindow
+	w.n = min(w.n+1, watchdogWindow)
+	w.mu.Unlock()
+}
+
+type runResult struct {
+	out   []float32
+	shape []int64
+	err   error
+}
+
+// run executes t.Run under the watchdog. On ErrHung t belongs to the
+// abandoned call and must not be used or pooled by the caller.
+func (w *watchdog) run(t Binding) ([]float32, []int64, error) {
+	limit := w.ceiling()
+	start := time.Now()
+	if limit == 0 {
+		out, shape, err := t.Run()
+		w.observe(time.Since(start))
+		return out, shape, err
+	}
+
+	var (
+		mu        sync.Mutex
+		abandoned bool
+		done      = make(chan runResult, 1)
+	)
+	go func() {
+		out, shape, err := t.Run()
+		mu.Lock()
+		defer mu.Unlock()
+		if abandoned {
+			slog.Warn("hung inference returned", "elapsed", time.Since(start))
+			t.Close()
+			return
+		}
+		done <- runResult{out, shape, err}
+	}()
+
+	timer := time.NewTimer(limit)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		w.observe(time.Since(start))
+		return r.out, r.shape, r.err
+	case <-timer.C:
+	}
+	mu.Lock()
+	select {
+	case r := <-done: // finished while the timer fired
+		mu.Unlock()
+		w.observe(time.Since(start))
+		return r.out, r.shape, r.err
+	default:
+		abandoned = true
+		mu.Unlock()
+	}
+	w.hangs.Add(1)
+	var dump bytes.Buffer
+	_ = pprof.Lookup("goroutine").WriteTo(&dump, 2)
+	slog.Error("inference hung", "ceiling", limit, "goroutines", dump.String())
+	return nil, nil, ErrHung
+}
@@ -0,0 +1,71 @@
+// Package latency collects request latencies for the command-line tools
+// and the server's adaptive quality control, and summarizes them as
+// percentiles.
+package latency
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Recorder keeps every sample; the tools run for minutes, not days, so
+// exact percentiles are cheaper to get right than a sketch. Safe for
+// concurrent use.
+type Recorder struct {
+	mu      sync.Mutex
+	samples []time.Duration
+}
+
+func (r *Recorder) Add(d time.Duration) {
+	r.mu.Lock()
+	r.samples = append(r.samples, d)
+	r.mu.Unlock()
+}
+
+const precision = 100 * time.Microsecond // display rounding
+
+// Summary is a point-in-time view of a Recorder.
+type Summary struct {
+	Count              int
+	P50, P95, P99, Max time.Duration
+}
+
+func (s Summary) String() string {
+	if s.Count == 0 {
+		return "n=0"
+	}
+	return fmt.Sprintf("n=%d p50=%s p95=%s p99=%s max=%s", s.Count,
+		s.P50.Round(precision), s.P95.Round(precision),
+		s.P99.Round(precision), s.Max.Round(precision))
+}
+
+// Summary computes the percentiles over all samples so far. With reset,
+// the samples are dropped afterwards so the next Summary covers only the
+// following interval.
+func (r *Recorder) Summary(reset bool) Summary {
+	r.mu.Lock()
+	samples := r.samples
+	if reset {
+		r.samples = nil
+	} else {
+		samples = append([]time.Duration(nil), samples...)
+	}
+	r.mu.Unlock()
+
+	if len(samples) == 0 {
+		return Summary{}
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	at := func(p float64) time.Duration {
+		return samples[int(p*float64(len(samples)-1)+0.5)]
+	}
+	return Summary{
+		Count: len(samples),
+		P50:   at(0.50),
+		P95:   at(0.95),
+		P99:   at(0.99),
+		Max:   samples[len(samples)-1],
+	}
+}
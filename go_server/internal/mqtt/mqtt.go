@@ -0,0 +1,366 @@
+// Package mqtt is a minimal MQTT 3.1.1 client: the server announces state
+// and takes a few commands, all at QoS 0, which does not justify pulling in
+// a full client.
+package mqtt
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ── 연결 ─────────────────────────────────────────────────────────────────────
+// A Client keeps one connection to the broker and redials it with backoff
+// when it drops. Publish only queues; messages wait in the queue across a
+// redial and are dropped when it is full. The will is published by the
+// broker if the connection is lost without a DISCONNECT, and OnConnect runs
+// on every (re)connect, so whatever the will overwrote can be restored.
+// Subscriptions are made again on every connect too.
+
+const (
+	queueLen    = 256
+	keepAlive   = 30 * time.Second
+	dialTimeout = 5 * time.Second
+	maxBackoff  = 30 * time.Second
+)
+
+// Message is one publish.
+type Message struct {
+	Topic   string
+	Payload []byte
+	Retain  bool
+}
+
+// Options configures a Client.
+type Options struct {
+	ClientID  string
+	Will      *Message // may be nil
+	OnConnect func()   // runs after each CONNACK; may be nil
+
+	Subscribe []string                           // topic filters, at QoS 0
+	OnMessage func(topic string, payload []byte) // runs on the reader; may be nil
+}
+
+// Client is safe for concurrent use.
+type Client struct {
+	addr     string
+	tls      bool
+	user     string
+	password string
+	opts     Options
+	queue    chan Message
+	stop     chan struct{}
+	done     chan struct{}
+
+	mu        sync.Mutex
+	closed    bool
+	connected bool
+}
+
+// New parses mqtt[s]://[user:password@]host[:port] and starts connecting
+// in the background.
+func New(rawURL string, opts Options) (*Client, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "mqtt" && u.Scheme != "mqtts") || u.Host == "" {
+		return nil, fmt.Errorf("want mqtt[s]://host:port, got %q", rawURL)
+	}
+	c := &Client{
+		addr: u.Host, tls: u.Scheme == "mqtts", opts: opts,
+		queue: make(chan Message, queueLen), stop: make(chan struct{}), done: make(chan struct{}),
+	}
+	if u.Port() == "" {
+		port := "1883"
+		if c.tls {
+			port = "8883"
+		}
+		c.addr = net.JoinHostPort(u.Hostname(), port)
+	}
+	if u.User != nil {
+		c.user = u.User.Username()
+		c.password, _ = u.User.Password()
+	}
+	go c.run()
+	return c, nil
+}
+
+// Publish queues m, or drops it and returns false when the queue is full
+// or the client is closed.
+func (c *Client) Publish(m Message) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return false
+	}
+	select {
+	case c.queue <- m:
+		return true
+	default:
+		return false
+	}
+}
+
+// Connected reports whether the broker connection is up.
+func (c *Client) Connected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connected
+}
+
+// Close sends what is queued, if connected, and disconnects cleanly, so the
+// will is not published.
+func (c *Client) Close() {
+	c.mu.Lock()
+	if !c.closed {
+		c.closed = true
+		close(c.stop)
+	}
+	c.mu.Unlock()
+	<-c.done
+}
+
+func (c *Client) run() {
+	defer close(c.done)
+	backoff := time.Second
+	for {
+		err := c.session()
+		if err == nil {
+			return // closed
+		}
+		if c.Connected() {
+			backoff = time.Second // it was up; start over
+			c.setConnected(false)
+		}
+		slog.Warn("mqtt", "broker", c.addr, "err", err)
+		select {
+		case <-c.stop:
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+func (c *Client) setConnected(v bool) {
+	c.mu.Lock()
+	c.connected = v
+	c.mu.Unlock()
+}
+
+// session runs one connection until it fails, or until Close, when it
+// returns nil.
+func (c *Client) session() error {
+	d := net.Dialer{Timeout: dialTimeout}
+	var conn net.Conn
+	var err error
+	if c.tls {
+		host, _, _ := net.SplitHostPort(c.addr)
+		conn, err = tls.DialWithDialer(&d, "tcp", c.addr, &tls.Config{ServerName: host})
+	} else {
+		conn, err = d.Dial("tcp", c.addr)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(dialTimeout))
+	if _, err := conn.Write(c.connectPacket()); err != nil {
+		return err
+	}
+	br := bufio.NewReader(conn)
+	typ, body, err := readPacket(br)
+	if err != nil {
+		return err
+	}
+	if typ&0xf0 != 0x20 || len(body) != 2 {
+		return fmt.Errorf("want CONNACK, got packet type %#x", typ)
+	}
+	if body[1] != 0 {
+		return fmt.Errorf("connection refused, code %d", body[1])
+	}
+	if len(c.opts.Subscribe) > 0 {
+		if _, err := conn.Write(subscribePacket(c.opts.Subscribe)); err != nil {
+			return err
+		}
+	}
+	_ = conn.SetDeadline(time.Time{})
+	c.setConnected(true)
+	if c.opts.OnConnect != nil {
+		c.opts.OnConnect()
+	}
+
+	// Reading detects a dead connection and delivers what was subscribed
+	// to; SUBACK and PINGRESP need nothing.
+	readErr := make(chan error, 1)
+	go func() {
+		for {
+			_ = conn.SetReadDeadline(time.Now().Add(keepAlive * 3 / 2))
+			typ, body, err := readPacket(br)
+			if err != nil {
+				readErr <- err
+				return
+			}
+			if typ&0xf0 == 0x30 && c.opts.OnMessage != nil {
+				if topic, payload, ok := parsePublish(typ, body); ok {
+					c.opts.OnMessage(topic, payload)
+				}
+			}
+		}
+	}()
+	ping := time.NewTicker(keepAlive / 2)
+	defer ping.Stop()
+	for {
+		var pkt []byte
+		select {
+		case m := <-c.queue:
+			pkt = publishPacket(m)
+		case <-ping.C:
+			pkt = []byte{0xc0, 0}
+		case err := <-readErr:
+			return err
+		case <-c.stop:
+			c.drain(conn)
+			_, _ = conn.Write([]byte{0xe0, 0})
+			return nil
+		}
+		_ = conn.SetWriteDeadline(time.Now().Add(dialTimeout))
+		if _, err := conn.Write(pkt); err != nil {
+			return err
+		}
+	}
+}
+
+// drain writes the queued messages before a clean disconnect.
+func (c *Client) drain(conn net.Conn) {
+	_ = conn.SetWriteDeadline(time.Now().Add(dialTimeout))
+	for {
+		select {
+		case m := <-c.queue:
+			if _, err := conn.Write(publishPacket(m)); err != nil {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// ── 패킷 ─────────────────────────────────────────────────────────────────────
+
+func (c *Client) connectPacket() []byte {
+	var flags byte = 0x02 // clean session
+	var payload []byte
+	payload = appendString(payload, c.opts.ClientID)
+	if w := c.opts.Will; w != nil {
+		flags |= 0x04
+		if w.Retain {
+			flags |= 0x20
+		}
+		payload = appendString(payload, w.Topic)
+		payload = appendBytes(payload, w.Payload)
+	}
+	if c.user != "" {
+		flags |= 0x80
+		payload = appendString(payload, c.user)
+		if c.password != "" {
+			flags |= 0x40
+			payload = appendString(payload, c.password)
+		}
+	}
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(keepAlive/time.Second))
+	return packet(0x10, append(body, payload...))
+}
+
+func publishPacket(m Message) []byte {
+	var typ byte = 0x30
+	if m.Retain {
+		typ |= 0x01
+	}
+	return packet(typ, append(appendString(nil, m.Topic), m.Payload...))
+}
+
+func subscribePacket(filters []string) []byte {
+	body := []byte{0, 1} // packet ID
+	for _, f := range filters {
+		body = append(appendString(body, f), 0)
+	}
+	return packet(0x82, body)
+}
+
+// parsePublish splits a PUBLISH body. Subscriptions are QoS 0, so the
+// broker sends no packet ID; anything else is refused.
+func parsePublish(typ byte, body []byte) (string, []byte, bool) {
+	if typ&0x06 != 0 || len(body) < 2 {
+		return "", nil, false
+	}
+	n := int(binary.BigEndian.Uint16(body))
+	if len(body) < 2+n {
+		return "", nil, false
+	}
+	return string(body[2 : 2+n]), body[2+n:], true
+}
+
+func packet(typ byte, body []byte) []byte {
+	out := []byte{typ}
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		if n /= 128; n > 0 {
+			b |= 0x80
+		}
+		out = append(out, b)
+		if n == 0 {
+			break
+		}
+	}
+	return append(out, body...)
+}
+
+func appendString(b []byte, s string) []byte {
+	return appendBytes(b, []byte(s))
+}
+
+func appendBytes(b, s []byte) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// readPacket returns the first byte of the next packet, its type and
+// flags, and its body.
+func readPacket(br *bufio.Reader) (byte, []byte, error) {
+	typ, err := br.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n, shift := 0, 0
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		if shift += 7; shift > 21 {
+			return 0, nil, errors.New("mqtt: bad remaining length")
+		}
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(br, body); err != nil {
+		return 0, nil, err
+	}
+	return typ, body, nil
+}
@@ -0,0 +1,95 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// Email sends through an SMTP server, with the image attached. The
+// connection is upgraded with STARTTLS when the server offers it, which
+// suits port 587; implicit TLS on 465 is not supported.
+type Email struct {
+	addr string // host:port
+	auth smtp.Auth
+	from string
+	to   []string
+}
+
+// NewEmail sends from from to to through addr, logging in when user is set.
+func NewEmail(addr, user, password, from string, to []string) *Email {
+	e := &Email{addr: addr, from: from, to: to}
+	if user != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		e.auth = smtp.PlainAuth("", user, password, host)
+	}
+	return e
+}
+
+func (e *Email) Send(ctx context.Context, m Message) error {
+	msg, err := e.compose(m)
+	if err != nil {
+		return err
+	}
+	// smtp.SendMail takes no context; it runs until done or httpTimeout.
+	done := make(chan error, 1)
+	go func() { done <- smtp.SendMail(e.addr, e.auth, e.from, e.to, msg) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(httpTimeout):
+		return fmt.Errorf("email: %s timed out", e.addr)
+	}
+}
+
+func (e *Email) compose(m Message) ([]byte, error) {
+	var b bytes.Buffer
+	mw := multipart.NewWriter(&b)
+	fmt.Fprintf(&b, "From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=%s\r\n\r\n",
+		e.from, strings.Join(e.to, ", "), mime.QEncoding.Encode("utf-8", m.Subject), time.Now().Format(time.RFC1123Z), mw.Boundary())
+	pw, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	writeBase64(pw, []byte(m.Text))
+	if m.Image != nil {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {http.DetectContentType(m.Image)},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": m.Name})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		writeBase64(pw, m.Image)
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// writeBase64 writes data in base64 lines of 76 characters.
+func writeBase64(w io.Writer, data []byte) {
+	s := base64.StdEncoding.EncodeToString(data)
+	for len(s) > 76 {
+		_, _ = w.Write([]byte(s[:76] + "\r\n"))
+		s = s[76:]
+	}
+	_, _ = w.Write([]byte(s + "\r\n"))
+}
@@ -0,0 +1,24 @@
+// Package notify sends short alerts, with an optional image, to chat and
+// mail services. Each sink is a few lines of HTTP or SMTP, which does not
+// justify their SDKs.
+package notify
+
+import (
+	"context"
+	"time"
+)
+
+// Message is one alert.
+type Message struct {
+	Subject string // mail subject; chat sinks send only Text
+	Text    string
+	Image   []byte // encoded image, or nil
+	Name    string // file name of Image, e.g. "snapshot.jpg"
+}
+
+// Sink delivers messages to one destination.
+type Sink interface {
+	Send(ctx context.Context, m Message) error
+}
+
+const httpTimeout = 10 * time.Second
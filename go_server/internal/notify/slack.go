@@ -0,0 +1,49 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Slack posts to an incoming webhook. Webhooks cannot upload files, so the
+// image is left out.
+type Slack struct {
+	url    string
+	client *http.Client
+}
+
+func NewSlack(webhookURL string) *Slack {
+	return &Slack{url: webhookURL, client: &http.Client{Timeout: httpTimeout}}
+}
+
+func (s *Slack) Send(ctx context.Context, m Message) error {
+	body, err := json.Marshal(map[string]string{"text": m.Text})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return do(s.client, req, "slack")
+}
+
+// do sends req and turns a non-2xx answer into an error.
+func do(client *http.Client, req *http.Request, sink string) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s: %s", sink, resp.Status, bytes.TrimSpace(msg))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
@@ -0,0 +1,60 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+)
+
+// Telegram sends through a bot to one chat: the image as a photo with the
+// text as its caption, or the text alone.
+type Telegram struct {
+	api    string // https://api.telegram.org/bot<token>
+	chat   string
+	client *http.Client
+}
+
+// maxCaption is Telegram's caption limit, in characters.
+const maxCaption = 1024
+
+func NewTelegram(token, chat string) *Telegram {
+	return &Telegram{api: "https://api.telegram.org/bot" + token, chat: chat, client: &http.Client{Timeout: httpTimeout}}
+}
+
+func (t *Telegram) Send(ctx context.Context, m Message) error {
+	if m.Image == nil {
+		body, err := json.Marshal(map[string]string{"chat_id": t.chat, "text": m.Text})
+		if err != nil {
+			return err
+		}
+		return t.post(ctx, "sendMessage", "application/json", body)
+	}
+	var b bytes.Buffer
+	mw := multipart.NewWriter(&b)
+	caption := []rune(m.Text)
+	if len(caption) > maxCaption {
+		caption = caption[:maxCaption]
+	}
+	_ = mw.WriteField("chat_id", t.chat)
+	_ = mw.WriteField("caption", string(caption))
+	fw, err := mw.CreateFormFile("photo", m.Name)
+	if err != nil {
+		return err
+	}
+	_, _ = fw.Write(m.Image)
+	if err := mw.Close(); err != nil {
+		return err
+	}
+	return t.post(ctx, "sendPhoto", mw.FormDataContentType(), b.Bytes())
+}
+
+func (t *Telegram) post(ctx context.Context, method, contentType string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.api+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return do(t.client, req, "telegram")
+}
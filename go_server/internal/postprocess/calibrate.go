@@ -0,0 +1,306 @@
+package postprocess
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ── 점수 보정 ────────────────────────────────────────────────────────────────
+// A model's raw scores are seldom probabilities: a 0.6 box may be right far
+// more or less often than 60% of the time. A ScoreCalibration, read from
+// <model>.calibration.json next to the model, maps each raw score s to
+//
+//	p = σ(a·logit(s) + b)
+//
+// which is temperature scaling with a = 1/T and b = 0, or Platt scaling
+// with a and b fitted; classes may have their own. The map rises with s,
+// so the detector can threshold raw scores at the calibrated threshold's
+// preimage and leave everything it does not return untouched:
+//
+//	{"method": "platt", "a": 0.83, "b": -0.41,
+//	 "classes": {"person": {"method": "temperature", "temperature": 1.4}}}
+
+// ScoreCalibration maps raw detection scores to calibrated ones.
+type ScoreCalibration struct {
+	Method      string                       `json:"method"`                // "temperature" or "platt"
+	Temperature float64                      `json:"temperature,omitempty"` // temperature: a = 1/T
+	A           float64                      `json:"a,omitempty"`           // platt
+	B           float64                      `json:"b,omitempty"`           // platt
+	Classes     map[string]*ScoreCalibration `json:"classes,omitempty"`     // by name; others use the above
+}
+
+// CalibrationPath is model/yolo26n.onnx → model/yolo26n.calibration.json.
+func CalibrationPath(modelPath string) string {
+	return strings.TrimSuffix(modelPath, filepath.Ext(modelPath)) + ".calibration.json"
+}
+
+// LoadScoreCalibration reads the calibration next to modelPath; nil when
+// there is none.
+func LoadScoreCalibration(modelPath string) (*ScoreCalibration, error) {
+	path := CalibrationPath(modelPath)
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var c ScoreCalibration
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := c.check(true); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &c, nil
+}
+
+func (c *ScoreCalibration) check(top bool) error {
+	switch c.Method {
+	case "temperature":
+		if !(c.Temperature > 0) {
+			return fmt.Errorf("temperature: want a positive temperature")
+		}
+	case "platt":
+		if !(c.A > 0) || math.IsInf(c.A, 0) || math.IsNaN(c.B) || math.IsInf(c.B, 0) {
+			return fmt.Errorf("platt: want a > 0 and a finite b")
+		}
+	default:
+		return fmt.Errorf("method: want temperature or platt, got %q", c.Method)
+	}
+	if !top && len(c.Classes) > 0 {
+		return fmt.Errorf("classes: not inside a class")
+	}
+	for name, cc := range c.Classes {
+		if cc == nil {
+			return fmt.Errorf("classes: %s: empty", name)
+		}
+		if err := cc.check(false); err != nil {
+			return fmt.Errorf("classes: %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (c *ScoreCalibration) slope() (a, b float64) {
+	if c.Method == "temperature" {
+		return 1 / c.Temperature, 0
+	}
+	return c.A, c.B
+}
+
+func (c *ScoreCalibration) forName(name string) *ScoreCalibration {
+	if cc, ok := c.Classes[name]; ok {
+		return cc
+	}
+	return c
+}
+
+// Score is the calibrated score of a raw score s of class name.
+func (c *ScoreCalibration) Score(name string, s float64) float64 {
+	if c == nil {
+		return s
+	}
+	a, b := c.forName(name).slope()
+	return sigmoid(a*logit(s) + b)
+}
+
+// RawThreshold is the lowest raw score any class needs to reach the
+// calibrated score p.
+func (c *ScoreCalibration) RawThreshold(p float64) float64 {
+	if c == nil || p <= 0 || p >= 1 {
+		return p
+	}
+	raw := c.raw(p)
+	for _, cc := range c.Classes {
+		raw = min(raw, cc.raw(p))
+	}
+	return raw
+}
+
+func (c *ScoreCalibration) raw(p float64) float64 {
+	a, b := c.slope()
+	return sigmoid((logit(p) - b) / a)
+}
+
+// Apply calibrates the scores of dets, keeping those still at least
+// threshold.
+func (c *ScoreCalibration) Apply(dets []Detection, threshold float64) []Detection {
+	if c == nil {
+		return dets
+	}
+	out := dets[:0]
+	for _, d := range dets {
+		if d.Score = c.Score(d.Name, d.Score); d.Score >= threshold {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+const scoreEps = 1e-7
+
+func logit(s float64) float64 {
+	s = min(max(s, scoreEps), 1-scoreEps)
+	return math.Log(s / (1 - s))
+}
+
+func sigmoid(z float64) float64 { return 1 / (1 + math.Exp(-z)) }
+
+// ScoreSample is one labelled detection: its raw score and whether it was
+// a true positive.
+type ScoreSample struct {
+	Score   float64 `json:"score"`
+	Name    string  `json:"name,omitempty"`
+	Correct bool    `json:"correct"`
+}
+
+// CalibrationFit is a fitted calibration and how well the scores match
+// the labels before and after it: the mean negative log-likelihood and
+// the expected calibration error over ten score bins.
+type CalibrationFit struct {
+	Calibration *ScoreCalibration `json:"calibration"`
+	Samples     int               `json:"samples"`
+	NLLBefore   float64           `json:"nll_before"`
+	NLLAfter    float64           `json:"nll_after"`
+	ECEBefore   float64           `json:"ece_before"`
+	ECEAfter    float64           `json:"ece_after"`
+}
+
+// MinClassSamples is how many true and false positives a class needs to be
+// fitted on its own.
+const MinClassSamples = 20
+
+// FitScoreCalibration fits method to samples. With perClass, every class
+// with MinClassSamples of each outcome gets its own fit.
+func FitScoreCalibration(method string, samples []ScoreSample, perClass bool) (*CalibrationFit, error) {
+	c, err := fitOne(method, samples)
+	if err != nil {
+		return nil, err
+	}
+	if perClass {
+		byName := map[string][]ScoreSample{}
+		for _, s := range samples {
+			byName[s.Name] = append(byName[s.Name], s)
+		}
+		for name, ss := range byName {
+			if name == "" || !enoughOutcomes(ss, MinClassSamples) {
+				continue
+			}
+			cc, err := fitOne(method, ss)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			if c.Classes == nil {
+				c.Classes = map[string]*ScoreCalibration{}
+			}
+			c.Classes[name] = cc
+		}
+	}
+	fit := &CalibrationFit{Calibration: c, Samples: len(samples)}
+	var none *ScoreCalibration
+	fit.NLLBefore, fit.ECEBefore = calibrationError(none, samples)
+	fit.NLLAfter, fit.ECEAfter = calibrationError(c, samples)
+	return fit, nil
+}
+
+func enoughOutcomes(samples []ScoreSample, n int) bool {
+	pos := 0
+	for _, s := range samples {
+		if s.Correct {
+			pos++
+		}
+	}
+	return pos >= n && len(samples)-pos >= n
+}
+
+// fitOne minimizes the negative log-likelihood of samples by Newton's
+// method, with Platt's smoothed targets so separable data stays finite.
+func fitOne(method string, samples []ScoreSample) (*ScoreCalibration, error) {
+	if method != "temperature" && method != "platt" {
+		return nil, fmt.Errorf("method: want temperature or platt, got %q", method)
+	}
+	if !enoughOutcomes(samples, 1) {
+		return nil, fmt.Errorf("want both true and false positives")
+	}
+	pos := 0
+	for _, s := range samples {
+		if s.Correct {
+			pos++
+		}
+	}
+	hi := (float64(pos) + 1) / (float64(pos) + 2)
+	lo := 1 / (float64(len(samples)-pos) + 2)
+	z := make([]float64, len(samples))
+	y := make([]float64, len(samples))
+	for i, s := range samples {
+		z[i], y[i] = logit(s.Score), lo
+		if s.Correct {
+			y[i] = hi
+		}
+	}
+	a, b := 1.0, 0.0
+	for range 100 {
+		// Gradient and Hessian of the NLL in (a, b).
+		var ga, gb, haa, hab, hbb float64
+		for i := range z {
+			p := sigmoid(a*z[i] + b)
+			d, w := p-y[i], max(p*(1-p), 1e-12)
+			ga += d * z[i]
+			gb += d
+			haa += w * z[i] * z[i]
+			hab += w * z[i]
+			hbb += w
+		}
+		var da, db float64
+		if method == "temperature" {
+			da = ga / (haa + 1e-12)
+		} else {
+			haa, hbb = haa+1e-9, hbb+1e-9
+			det := haa*hbb - hab*hab
+			da = (hbb*ga - hab*gb) / det
+			db = (haa*gb - hab*ga) / det
+		}
+		a, b = a-da, b-db
+		if math.Abs(da) < 1e-9 && math.Abs(db) < 1e-9 {
+			break
+		}
+	}
+	if !(a > 0) || math.IsInf(a, 0) || math.IsNaN(b) || math.IsInf(b, 0) {
+		return nil, fmt.Errorf("scores do not rank true positives above false ones")
+	}
+	if method == "temperature" {
+		return &ScoreCalibration{Method: method, Temperature: 1 / a}, nil
+	}
+	return &ScoreCalibration{Method: method, A: a, B: b}, nil
+}
+
+// calibrationError is the mean NLL and the ECE of samples under c.
+func calibrationError(c *ScoreCalibration, samples []ScoreSample) (nll, ece float64) {
+	var bins [10]struct{ n, conf, hits float64 }
+	for _, s := range samples {
+		p := min(max(c.Score(s.Name, s.Score), scoreEps), 1-scoreEps)
+		y := 0.0
+		if s.Correct {
+			y = 1
+		}
+		nll -= y*math.Log(p) + (1-y)*math.Log(1-p)
+		bin := &bins[min(int(p*10), 9)]
+		bin.n++
+		bin.conf += p
+		bin.hits += y
+	}
+	n := float64(len(samples))
+	for _, bin := range bins {
+		if bin.n > 0 {
+			ece += math.Abs(bin.hits-bin.conf) / n
+		}
+	}
+	return nll / n, ece
+}
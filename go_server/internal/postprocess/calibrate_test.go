@@ -0,0 +1,153 @@
+package postprocess
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScoreCalibrationScore(t *testing.T) {
+	tests := []struct {
+		name string
+		c    *ScoreCalibration
+		s    float64
+		want float64
+	}{
+		{"nil is identity", nil, 0.3, 0.3},
+		{"temperature 1 is identity", &ScoreCalibration{Method: "temperature", Temperature: 1}, 0.3, 0.3},
+		{"temperature 2 halves the logit", &ScoreCalibration{Method: "temperature", Temperature: 2}, 0.9, 0.75},
+		{"temperature 2 keeps 0.5", &ScoreCalibration{Method: "temperature", Temperature: 2}, 0.5, 0.5},
+		{"platt shift", &ScoreCalibration{Method: "platt", A: 1, B: math.Log(3)}, 0.5, 0.75},
+		{"platt slope", &ScoreCalibration{Method: "platt", A: 2}, 0.75, 0.9},
+		{"score 1 stays finite", &ScoreCalibration{Method: "temperature", Temperature: 2}, 1, 1 / (1 + math.Sqrt(scoreEps/(1-scoreEps)))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.c.Score("person", tt.s); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Score(%v) = %v, want %v", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScoreCalibrationRawThreshold(t *testing.T) {
+	c := &ScoreCalibration{
+		Method: "platt", A: 0.8, B: -0.4,
+		Classes: map[string]*ScoreCalibration{"person": {Method: "temperature", Temperature: 1.5}},
+	}
+	for _, p := range []float64{0.1, 0.25, 0.5, 0.9} {
+		raw := c.RawThreshold(p)
+		// Every class reaches p at or above raw, and one exactly at it.
+		global, person := c.Score("car", raw), c.Score("person", raw)
+		if global > p+1e-9 || person > p+1e-9 {
+			t.Errorf("RawThreshold(%v) = %v scores %v and %v, want at most %v", p, raw, global, person, p)
+		}
+		if math.Abs(max(global, person)-p) > 1e-9 {
+			t.Errorf("RawThreshold(%v) = %v is not the lowest raw score reaching it", p, raw)
+		}
+	}
+	for _, p := range []float64{0, 1} {
+		if got := c.RawThreshold(p); got != p {
+			t.Errorf("RawThreshold(%v) = %v, want it unchanged", p, got)
+		}
+	}
+}
+
+func TestScoreCalibrationApply(t *testing.T) {
+	c := &ScoreCalibration{
+		Method:      "temperature",
+		Temperature: 2,
+		Classes:     map[string]*ScoreCalibration{"car": {Method: "temperature", Temperature: 1}},
+	}
+	dets := []Detection{
+		{Name: "person", Score: 0.9}, // → 0.75
+		{Name: "person", Score: 0.6}, // → about 0.55
+		{Name: "car", Score: 0.6},    // unchanged
+	}
+	got := c.Apply(dets, 0.58)
+	if len(got) != 2 || got[0].Name != "person" || got[1].Name != "car" {
+		t.Fatalf("Apply = %+v, want the first person and the car", got)
+	}
+	if math.Abs(got[0].Score-0.75) > 1e-9 || math.Abs(got[1].Score-0.6) > 1e-9 {
+		t.Errorf("scores = %v, %v, want 0.75, 0.6", got[0].Score, got[1].Score)
+	}
+}
+
+func TestLoadScoreCalibration(t *testing.T) {
+	dir := t.TempDir()
+	model := filepath.Join(dir, "m.onnx")
+	if c, err := LoadScoreCalibration(model); c != nil || err != nil {
+		t.Errorf("without a file = %v, %v, want nil, nil", c, err)
+	}
+
+	tests := []struct {
+		name, json string
+		ok         bool
+	}{
+		{"temperature", `{"method": "temperature", "temperature": 1.4}`, true},
+		{"platt with classes", `{"method": "platt", "a": 0.8, "b": -0.4, "classes": {"person": {"method": "temperature", "temperature": 2}}}`, true},
+		{"unknown method", `{"method": "isotonic"}`, false},
+		{"zero temperature", `{"method": "temperature"}`, false},
+		{"negative slope", `{"method": "platt", "a": -1}`, false},
+		{"nested classes", `{"method": "platt", "a": 1, "classes": {"person": {"method": "platt", "a": 1, "classes": {"x": {"method": "platt", "a": 1}}}}}`, false},
+		{"bad class", `{"method": "platt", "a": 1, "classes": {"person": {"method": "temperature"}}}`, false},
+		{"not JSON", `{`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(CalibrationPath(model), []byte(tt.json), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			c, err := LoadScoreCalibration(model)
+			if tt.ok && (err != nil || c == nil) {
+				t.Errorf("LoadScoreCalibration = %v, %v, want a calibration", c, err)
+			}
+			if !tt.ok && err == nil {
+				t.Errorf("LoadScoreCalibration = %+v, want an error", c)
+			}
+		})
+	}
+}
+
+func TestFitScoreCalibration(t *testing.T) {
+	// Scores twice as confident as they should be: a raw s is right with
+	// probability σ(logit(s)/2), i.e. temperature 2.
+	var samples []ScoreSample
+	for s := 0.05; s < 1; s += 0.05 {
+		right := int(math.Round(1000 * sigmoid(logit(s)/2)))
+		for i := 0; i < 1000; i++ {
+			samples = append(samples, ScoreSample{Score: s, Name: "person", Correct: i < right})
+		}
+	}
+
+	fit, err := FitScoreCalibration("temperature", samples, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fit.Calibration.Temperature; math.Abs(got-2) > 0.05 {
+		t.Errorf("temperature = %v, want about 2", got)
+	}
+	if fit.NLLAfter >= fit.NLLBefore || fit.ECEAfter >= fit.ECEBefore {
+		t.Errorf("fit did not help: NLL %v → %v, ECE %v → %v", fit.NLLBefore, fit.NLLAfter, fit.ECEBefore, fit.ECEAfter)
+	}
+
+	platt, err := FitScoreCalibration("platt", samples, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := platt.Calibration
+	if math.Abs(c.A-0.5) > 0.03 || math.Abs(c.B) > 0.03 {
+		t.Errorf("platt = a %v, b %v, want about 0.5, 0", c.A, c.B)
+	}
+	if c.Classes["person"] == nil {
+		t.Error("per-class fit skipped a class with enough samples")
+	}
+
+	if _, err := FitScoreCalibration("temperature", samples[:10], false); err == nil {
+		t.Error("fit with only true positives succeeded")
+	}
+	if _, err := FitScoreCalibration("isotonic", samples, false); err == nil {
+		t.Error("fit with an unknown method succeeded")
+	}
+}
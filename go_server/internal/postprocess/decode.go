@@ -0,0 +1,149 @@
+package postprocess
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ── 후처리 ──────────────────────────────────────────────────────────────────
+// YOLO26 end-to-end 출력 형태: (1, N, W) 또는 (N, W), 행마다
+// [box..., score, label, extra...]. W와 box 형식은 task에 따라 다르다:
+//
+//	detect   W = 6         [x1, y1, x2, y2, score, label]
+//	segment  W = 6 + 32    mask coefficients follow; masks are not decoded
+//	pose     W = 6 + 3K    K keypoints (x, y, visibility) follow; not decoded
+//	obb      W = 7         [cx, cy, w, h, score, label, angle (rad)]
+//
+// Only boxes are reported; an oriented box becomes its axis-aligned
+// bounding rectangle.
+
+// Decoder turns one task's output rows into detections.
+type Decoder struct {
+	Task string
+	// RowWidth is the exact row width the task produces, or 0 when it
+	// depends on the model (mask coefficients, keypoint count) and only the
+	// leading six columns are required.
+	RowWidth int
+	box      func(row []float32) (x1, y1, x2, y2 float32)
+}
+
+var decoders = map[string]Decoder{
+	"detect":  {Task: "detect", RowWidth: 6, box: xyxyBox},
+	"segment": {Task: "segment", box: xyxyBox},
+	"pose":    {Task: "pose", box: xyxyBox},
+	"obb":     {Task: "obb", RowWidth: 7, box: rotatedBox},
+}
+
+// DecoderFor returns the decoder for an ultralytics task name as stored in
+// the model metadata; "" means detect.
+func DecoderFor(task string) (Decoder, error) {
+	if task == "" {
+		task = "detect"
+	}
+	d, ok := decoders[task]
+	if !ok {
+		return Decoder{}, fmt.Errorf("unsupported model task %q (want detect, segment, pose or obb)", task)
+	}
+	return d, nil
+}
+
+func xyxyBox(row []float32) (x1, y1, x2, y2 float32) {
+	return row[0], row[1], row[2], row[3]
+}
+
+// rotatedBox bounds the rectangle [cx, cy, w, h] rotated by row[6].
+func rotatedBox(row []float32) (x1, y1, x2, y2 float32) {
+	cx, cy, w, h := float64(row[0]), float64(row[1]), float64(row[2]), float64(row[3])
+	sin, cos := math.Sincos(float64(row[6]))
+	hw := (math.Abs(w*cos) + math.Abs(h*sin)) / 2
+	hh := (math.Abs(w*sin) + math.Abs(h*cos)) / 2
+	return float32(cx - hw), float32(cy - hh), float32(cx + hw), float32(cy + hh)
+}
+
+// Check reports whether an output of the given shape can be decoded, with
+// a hint at the likely cause when not. Negative (dynamic) dims pass; the
+// actual shape is checked again on every Decode.
+func (d Decoder) Check(shape []int64) error {
+	if len(shape) != 2 && len(shape) != 3 {
+		return fmt.Errorf("output shape %s: expected %s", formatShape(shape), d.expected())
+	}
+	width := shape[len(shape)-1]
+	switch {
+	case width < 0:
+		return nil
+	case d.RowWidth > 0 && width == int64(d.RowWidth), d.RowWidth == 0 && width >= 6:
+		return nil
+	}
+
+	hint := fmt.Sprintf("is the model's task really %q?", d.Task)
+	if len(shape) == 3 && shape[1] > 4 && shape[2] > shape[1] {
+		hint = fmt.Sprintf("this looks like a raw YOLOv8/11 head (4 box + %d class channels × %d anchors) "+
+			"without end-to-end NMS, which is not decoded; export with nms=True or use an end-to-end YOLO26 model",
+			shape[1]-4, shape[2])
+	} else if other := taskForWidth(width); other != "" && other != d.Task {
+		hint = fmt.Sprintf("this looks like a model with task %q; set \"task\": %q in the metadata sidecar", other, other)
+	}
+	return fmt.Errorf("output shape %s: expected %s for task %q — %s", formatShape(shape), d.expected(), d.Task, hint)
+}
+
+// expected renders the shape this decoder accepts, e.g. (1,N,6).
+func (d Decoder) expected() string {
+	if d.RowWidth > 0 {
+		return fmt.Sprintf("(1,N,%d)", d.RowWidth)
+	}
+	return "(1,N,6+)"
+}
+
+// taskForWidth guesses the task from an unambiguous row width.
+func taskForWidth(width int64) string {
+	for _, d := range decoders {
+		if d.RowWidth > 0 && int64(d.RowWidth) == width {
+			return d.Task
+		}
+	}
+	return ""
+}
+
+func formatShape(shape []int64) string {
+	parts := make([]string, len(shape))
+	for i, v := range shape {
+		if v < 0 {
+			parts[i] = "?"
+		} else {
+			parts[i] = strconv.FormatInt(v, 10)
+		}
+	}
+	return "(" + strings.Join(parts, ",") + ")"
+}
+
+// Decode converts output rows scoring at least conf into detections,
+// scaling boxes from model input to source pixels.
+func (d Decoder) Decode(data []float32, shape []int64, scaleX, scaleY float32, conf float64, labels Labels) ([]Detection, error) {
+	if err := d.Check(shape); err != nil {
+		return nil, err
+	}
+	n, width := shape[len(shape)-2], shape[len(shape)-1]
+	if int64(len(data)) < n*width {
+		return nil, fmt.Errorf("output has %d values, shape %s needs %d", len(data), formatShape(shape), n*width)
+	}
+
+	out := make([]Detection, 0, n) // capacity hint avoids repeated reallocation
+	for i := int64(0); i < n; i++ {
+		row := data[i*width : (i+1)*width]
+		score := row[4]
+		if float64(score) < conf {
+			continue
+		}
+		label := int(row[5])
+		x1, y1, x2, y2 := d.box(row)
+		out = append(out, Detection{
+			Box:   [4]int{int(x1 * scaleX), int(y1 * scaleY), int(x2 * scaleX), int(y2 * scaleY)},
+			Score: float64(int64(score*10000+0.5)) / 10000, // round to 4 dp
+			Label: label,
+			Name:  labels.Name(label),
+		})
+	}
+	return out, nil
+}
@@ -0,0 +1,95 @@
+package postprocess
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecoderFor(t *testing.T) {
+	for _, task := range []string{"", "detect", "segment", "pose", "obb"} {
+		if _, err := DecoderFor(task); err != nil {
+			t.Errorf("DecoderFor(%q): %v", task, err)
+		}
+	}
+	if _, err := DecoderFor("classify"); err == nil {
+		t.Error("DecoderFor(classify) succeeded, want an error")
+	}
+}
+
+func TestDecoderCheck(t *testing.T) {
+	detect, _ := DecoderFor("detect")
+	pose, _ := DecoderFor("pose")
+	tests := []struct {
+		name    string
+		d       Decoder
+		shape   []int64
+		wantErr string // "" = ok
+	}{
+		{"detect 3d", detect, []int64{1, 300, 6}, ""},
+		{"detect 2d", detect, []int64{300, 6}, ""},
+		{"dynamic width", detect, []int64{1, -1, -1}, ""},
+		{"pose wide rows", pose, []int64{1, 300, 57}, ""},
+		{"pose narrow rows", pose, []int64{1, 300, 5}, "expected (1,N,6+)"},
+		{"obb rows for detect", detect, []int64{1, 300, 7}, `task "obb"`},
+		{"raw head", detect, []int64{1, 84, 8400}, "raw YOLOv8/11 head"},
+		{"rank 4", detect, []int64{1, 1, 300, 6}, "expected (1,N,6)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.d.Check(tt.shape)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("Check(%v): %v", tt.shape, err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("Check(%v) = %v, want an error containing %q", tt.shape, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDecode(t *testing.T) {
+	labels := Labels{0: "person", 2: "car"}
+	detect, _ := DecoderFor("detect")
+	data := []float32{
+		10, 20, 110, 220, 0.91234, 0, // kept, scaled by 2 and 0.5
+		0, 0, 5, 5, 0.1, 2, // below conf
+		30, 40, 50, 60, 0.5, 7, // unknown label
+	}
+	got, err := detect.Decode(data, []int64{1, 3, 6}, 2, 0.5, 0.25, labels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Detection{
+		{Box: [4]int{20, 10, 220, 110}, Score: 0.9123, Label: 0, Name: "person"},
+		{Box: [4]int{60, 20, 100, 30}, Score: 0.5, Label: 7, Name: "cls7"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Decode = %+v, want %+v", got, want)
+	}
+
+	if _, err := detect.Decode(data[:12], []int64{1, 3, 6}, 1, 1, 0, labels); err == nil {
+		t.Error("Decode of a short output succeeded, want an error")
+	}
+}
+
+func TestDecodeOBB(t *testing.T) {
+	obb, _ := DecoderFor("obb")
+	// A 40×20 box at (100, 100) turned a quarter turn is bounded by 20×40.
+	data := []float32{100, 100, 40, 20, 0.8, 1, math.Pi / 2}
+	got, err := obb.Decode(data, []int64{1, 1, 7}, 1, 1, 0.5, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("got %d detections, want 1", len(got))
+	}
+	want := [4]int{90, 80, 110, 120}
+	for i := range want {
+		if d := got[0].Box[i] - want[i]; d < -1 || d > 1 {
+			t.Errorf("box = %v, want %v ±1", got[0].Box, want)
+			break
+		}
+	}
+}
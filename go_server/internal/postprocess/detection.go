@@ -0,0 +1,116 @@
+// Package postprocess turns raw model output into detections.
+package postprocess
+
+import (
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+
+	"yolo-server/stage"
+)
+
+// ── 타입 ────────────────────────────────────────────────────────────────────
+
+// Detection and Attributes live in yolo-server/stage, which plugins built
+// outside this module can import.
+type (
+	Detection  = stage.Detection
+	Attributes = stage.Attributes
+)
+
+// Labels maps class ids to names, as stored in the model metadata.
+type Labels map[int]string
+
+func (l Labels) Name(label int) string {
+	if name, ok := l[label]; ok {
+		return name
+	}
+	return fmt.Sprintf("cls%d", label)
+}
+
+// ParseLabels parses the ultralytics Python-dict string:
+// "{0: 'person', 1: 'bicycle', ...}" → Labels
+// The JSON form {"0": "person", ...} is accepted too.
+func ParseLabels(raw string) Labels {
+	result := make(Labels)
+	raw = strings.TrimSpace(raw)
+	raw = strings.TrimPrefix(raw, "{")
+	raw = strings.TrimSuffix(raw, "}")
+
+	var entries []string
+	var cur strings.Builder
+	inQuote := false
+	var quoteChar byte
+	for i := 0; i < len(raw); i++ {
+		ch := raw[i]
+		switch {
+		case !inQuote && (ch == '\'' || ch == '"'):
+			inQuote = true
+			quoteChar = ch
+			cur.WriteByte(ch)
+		case inQuote && ch == quoteChar:
+			inQuote = false
+			cur.WriteByte(ch)
+		case !inQuote && ch == ',':
+			entries = append(entries, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteByte(ch)
+		}
+	}
+	if cur.Len() > 0 {
+		entries = append(entries, cur.String())
+	}
+
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		colonIdx := strings.Index(entry, ":")
+		if colonIdx < 0 {
+			continue
+		}
+		keyStr := strings.Trim(strings.TrimSpace(entry[:colonIdx]), "'\"")
+		valStr := strings.Trim(strings.TrimSpace(entry[colonIdx+1:]), "'\"")
+		idx, err := strconv.Atoi(keyStr)
+		if err != nil {
+			continue
+		}
+		result[idx] = valStr
+	}
+	return result
+}
+
+// Unmasked drops the detections whose box centre lies in one of zones.
+// dets is filtered in place.
+func Unmasked(dets []Detection, zones []image.Rectangle) []Detection {
+	if len(zones) == 0 {
+		return dets
+	}
+	keep := dets[:0]
+	for _, d := range dets {
+		if !inAny(d.Centre(), zones) {
+			keep = append(keep, d)
+		}
+	}
+	return keep
+}
+
+// TopScore keeps the detections scoring within margin of the best of their
+// class in dets, for thresholds that follow the scene. dets is filtered in
+// place.
+func TopScore(dets []Detection, margin float64) []Detection {
+	if margin <= 0 {
+		return dets
+	}
+	top := map[int]float64{}
+	for _, d := range dets {
+		top[d.Label] = max(top[d.Label], d.Score)
+	}
+	keep := dets[:0]
+	for _, d := range dets {
+		if d.Score >= top[d.Label]-margin {
+			keep = append(keep, d)
+		}
+	}
+	return keep
+}
@@ -0,0 +1,72 @@
+package postprocess
+
+import (
+	"image"
+	"reflect"
+	"testing"
+)
+
+func TestParseLabels(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want Labels
+	}{
+		{"{0: 'person', 1: 'bicycle'}", Labels{0: "person", 1: "bicycle"}},
+		{`{"0": "person", "1": "bicycle"}`, Labels{0: "person", 1: "bicycle"}},
+		{"{0: 'traffic light', 1: \"stop, sign\"}", Labels{0: "traffic light", 1: "stop, sign"}},
+		{"  {2: 'car'}  ", Labels{2: "car"}},
+		{"{x: 'bad', 1: 'ok', nocolon}", Labels{1: "ok"}},
+		{"", Labels{}},
+	}
+	for _, tt := range tests {
+		if got := ParseLabels(tt.raw); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseLabels(%q) = %v, want %v", tt.raw, got, tt.want)
+		}
+	}
+	if got := (Labels{0: "person"}).Name(7); got != "cls7" {
+		t.Errorf("Name of an unknown label = %q, want cls7", got)
+	}
+}
+
+func TestUnmasked(t *testing.T) {
+	dets := []Detection{
+		{Box: [4]int{0, 0, 10, 10}, Score: 1},     // centre (5, 5)
+		{Box: [4]int{90, 90, 110, 110}, Score: 2}, // centre (100, 100)
+		{Box: [4]int{0, 40, 100, 60}, Score: 3},   // centre (50, 50), box overlaps the zone
+	}
+	zones := []image.Rectangle{image.Rect(80, 80, 120, 120), image.Rect(45, 45, 55, 55)}
+	got := Unmasked(append([]Detection(nil), dets...), zones)
+	if len(got) != 1 || got[0].Score != 1 {
+		t.Errorf("Unmasked = %+v, want only the box centred outside the zones", got)
+	}
+	if got := Unmasked(append([]Detection(nil), dets...), nil); len(got) != 3 {
+		t.Errorf("Unmasked without zones dropped boxes: %+v", got)
+	}
+}
+
+func TestTopScore(t *testing.T) {
+	dets := []Detection{
+		{Label: 0, Score: 0.9},
+		{Label: 0, Score: 0.75},
+		{Label: 0, Score: 0.5},
+		{Label: 1, Score: 0.3}, // best of its class
+	}
+	tests := []struct {
+		margin float64
+		want   []float64
+	}{
+		{0, []float64{0.9, 0.75, 0.5, 0.3}},
+		{0.2, []float64{0.9, 0.75, 0.3}},
+		{0.01, []float64{0.9, 0.3}},
+	}
+	for _, tt := range tests {
+		got := TopScore(append([]Detection(nil), dets...), tt.margin)
+		var scores []float64
+		for _, d := range got {
+			scores = append(scores, d.Score)
+		}
+		if !reflect.DeepEqual(scores, tt.want) {
+			t.Errorf("TopScore(margin %v) = %v, want %v", tt.margin, scores, tt.want)
+		}
+	}
+}
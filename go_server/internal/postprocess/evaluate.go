@@ -0,0 +1,204 @@
+package postprocess
+
+import (
+	"math"
+	"sort"
+)
+
+// ── 평가 ─────────────────────────────────────────────────────────────────────
+// Evaluate scores detections against ground truth the way COCO does for
+// boxes: per class and IoU threshold, detections are taken by falling
+// score and each is matched to the best-overlapping unmatched ground-truth
+// box of its image, making a true positive, or is a false positive. One
+// that only overlaps a crowd region is neither. AP is the precision
+// envelope averaged over 101 recall points, AP50 at IoU 0.5 and AP50-95
+// averaged over 0.5, 0.55, ..., 0.95; the mAPs average the classes that
+// have ground truth. Precision and recall are also given at one score
+// threshold and IoU 0.5, for the operating point a deployment uses.
+
+// EvalBox is a ground-truth box, or a detection with its score.
+type EvalBox struct {
+	Image int
+	Class string
+	Box   [4]float64 // x1, y1, x2, y2
+	Score float64
+	Crowd bool // ground truth only: a region of many, matched by none
+}
+
+// ClassEvaluation is one class's result. The APs are nil for a class
+// without ground truth.
+type ClassEvaluation struct {
+	Name        string   `json:"name"`
+	GroundTruth int      `json:"ground_truth"`
+	Detections  int      `json:"detections"`
+	AP50        *float64 `json:"ap50"`
+	AP5095      *float64 `json:"ap50_95"`
+	Precision   float64  `json:"precision"` // at the score threshold, IoU 0.5
+	Recall      float64  `json:"recall"`
+}
+
+// Evaluation is the result of Evaluate.
+type Evaluation struct {
+	MAP50   float64           `json:"map50"`
+	MAP5095 float64           `json:"map50_95"`
+	Classes []ClassEvaluation `json:"classes"`
+}
+
+// Evaluate scores dets against gt. Precision and recall count the
+// detections scoring at least threshold.
+func Evaluate(gt, dets []EvalBox, threshold float64) Evaluation {
+	byClass := map[string]*[2][]EvalBox{}
+	class := func(name string) *[2][]EvalBox {
+		c, ok := byClass[name]
+		if !ok {
+			c = &[2][]EvalBox{}
+			byClass[name] = c
+		}
+		return c
+	}
+	for _, b := range gt {
+		c := class(b.Class)
+		c[0] = append(c[0], b)
+	}
+	for _, b := range dets {
+		c := class(b.Class)
+		c[1] = append(c[1], b)
+	}
+
+	ev := Evaluation{Classes: []ClassEvaluation{}}
+	var sum50, sum5095 float64
+	n := 0
+	for name, c := range byClass {
+		ce := evaluateClass(name, c[0], c[1], threshold)
+		if ce.AP50 != nil {
+			sum50 += *ce.AP50
+			sum5095 += *ce.AP5095
+			n++
+		}
+		ev.Classes = append(ev.Classes, ce)
+	}
+	if n > 0 {
+		ev.MAP50, ev.MAP5095 = round4(sum50/float64(n)), round4(sum5095/float64(n))
+	}
+	sort.Slice(ev.Classes, func(i, j int) bool { return ev.Classes[i].Name < ev.Classes[j].Name })
+	return ev
+}
+
+func evaluateClass(name string, gt, dets []EvalBox, threshold float64) ClassEvaluation {
+	sort.SliceStable(dets, func(i, j int) bool { return dets[i].Score > dets[j].Score })
+	byImage := map[int][]EvalBox{}
+	positives := 0
+	for _, b := range gt {
+		byImage[b.Image] = append(byImage[b.Image], b)
+		if !b.Crowd {
+			positives++
+		}
+	}
+	ce := ClassEvaluation{Name: name, GroundTruth: positives, Detections: len(dets)}
+	if positives == 0 {
+		return ce
+	}
+	var ap5095 float64
+	for i := range 10 {
+		iou := 0.5 + 0.05*float64(i)
+		tp := matchDetections(dets, byImage, iou)
+		ap := averagePrecision(tp, positives)
+		if i == 0 {
+			ap50 := round4(ap)
+			ce.AP50 = &ap50
+			var hits, kept int
+			for k, d := range dets {
+				if d.Score >= threshold && tp[k] >= 0 {
+					kept++
+					hits += tp[k]
+				}
+			}
+			if kept > 0 {
+				ce.Precision = round4(float64(hits) / float64(kept))
+			}
+			ce.Recall = round4(float64(hits) / float64(positives))
+		}
+		ap5095 += ap / 10
+	}
+	ap5095 = round4(ap5095)
+	ce.AP5095 = &ap5095
+	return ce
+}
+
+// matchDetections marks each of dets, sorted by falling score, 1 for a
+// true positive, 0 for a false one and -1 when it is ignored.
+func matchDetections(dets []EvalBox, gt map[int][]EvalBox, iou float64) []int {
+	used := map[int][]bool{}
+	out := make([]int, len(dets))
+	for k, d := range dets {
+		boxes := gt[d.Image]
+		if used[d.Image] == nil {
+			used[d.Image] = make([]bool, len(boxes))
+		}
+		best, bestIoU, crowd := -1, iou, false
+		for j, g := range boxes {
+			v := boxIoU(d.Box, g.Box)
+			if g.Crowd {
+				crowd = crowd || v >= iou
+				continue
+			}
+			if !used[d.Image][j] && v >= bestIoU {
+				best, bestIoU = j, v
+			}
+		}
+		switch {
+		case best >= 0:
+			used[d.Image][best] = true
+			out[k] = 1
+		case crowd:
+			out[k] = -1
+		}
+	}
+	return out
+}
+
+// averagePrecision is the 101-point interpolated AP of the marks tp.
+func averagePrecision(tp []int, positives int) float64 {
+	var recall, precision []float64
+	hits, seen := 0, 0
+	for _, t := range tp {
+		if t < 0 {
+			continue
+		}
+		seen++
+		hits += t
+		recall = append(recall, float64(hits)/float64(positives))
+		precision = append(precision, float64(hits)/float64(seen))
+	}
+	for i := len(precision) - 2; i >= 0; i-- {
+		precision[i] = max(precision[i], precision[i+1])
+	}
+	var sum float64
+	k := 0
+	for r := range 101 {
+		at := float64(r) / 100
+		for k < len(recall) && recall[k] < at {
+			k++
+		}
+		if k < len(recall) {
+			sum += precision[k]
+		}
+	}
+	return sum / 101
+}
+
+func boxIoU(a, b [4]float64) float64 {
+	ix := math.Min(a[2], b[2]) - math.Max(a[0], b[0])
+	iy := math.Min(a[3], b[3]) - math.Max(a[1], b[1])
+	if ix <= 0 || iy <= 0 {
+		return 0
+	}
+	inter := ix * iy
+	union := (a[2]-a[0])*(a[3]-a[1]) + (b[2]-b[0])*(b[3]-b[1]) - inter
+	if union <= 0 {
+		return 0
+	}
+	return inter / union
+}
+
+func round4(f float64) float64 { return math.Round(f*1e4) / 1e4 }
@@ -0,0 +1,113 @@
+package postprocess
+
+import "testing"
+
+func TestEvaluate(t *testing.T) {
+	box := func(img int, class string, x1, y1, x2, y2, score float64) EvalBox {
+		return EvalBox{Image: img, Class: class, Box: [4]float64{x1, y1, x2, y2}, Score: score}
+	}
+	tests := []struct {
+		name      string
+		gt, dets  []EvalBox
+		threshold float64
+		map50     float64
+		map5095   float64
+		precision float64 // of the first class
+		recall    float64
+	}{
+		{
+			name:      "perfect",
+			gt:        []EvalBox{box(1, "car", 0, 0, 100, 100, 0), box(2, "car", 10, 10, 50, 50, 0)},
+			dets:      []EvalBox{box(1, "car", 0, 0, 100, 100, 0.9), box(2, "car", 10, 10, 50, 50, 0.8)},
+			threshold: 0.5,
+			map50:     1, map5095: 1, precision: 1, recall: 1,
+		},
+		{
+			name:      "nothing detected",
+			gt:        []EvalBox{box(1, "car", 0, 0, 100, 100, 0)},
+			threshold: 0.5,
+		},
+		{
+			name: "wrong image is a false positive",
+			gt:   []EvalBox{box(1, "car", 0, 0, 100, 100, 0)},
+			dets: []EvalBox{
+				box(2, "car", 0, 0, 100, 100, 0.9),
+				box(1, "car", 0, 0, 100, 100, 0.8),
+			},
+			threshold: 0.5,
+			// Recall reaches 1 at the second detection, precision 0.5.
+			map50: 0.5, map5095: 0.5, precision: 0.5, recall: 1,
+		},
+		{
+			name: "duplicate is a false positive",
+			gt:   []EvalBox{box(1, "car", 0, 0, 100, 100, 0)},
+			dets: []EvalBox{
+				box(1, "car", 0, 0, 100, 100, 0.9),
+				box(1, "car", 0, 0, 100, 100, 0.8),
+			},
+			threshold: 0.5,
+			map50:     1, map5095: 1, precision: 0.5, recall: 1,
+		},
+		{
+			name: "loose box counts at low IoU only",
+			gt:   []EvalBox{box(1, "car", 0, 0, 100, 100, 0)},
+			// IoU 0.64: a hit at 0.5, 0.55 and 0.6 only.
+			dets:      []EvalBox{box(1, "car", 0, 0, 80, 80, 0.9)},
+			threshold: 0.5,
+			map50:     1, map5095: 0.3, precision: 1, recall: 1,
+		},
+		{
+			name: "threshold leaves out low scores",
+			gt:   []EvalBox{box(1, "car", 0, 0, 100, 100, 0), box(1, "car", 200, 200, 300, 300, 0)},
+			dets: []EvalBox{
+				box(1, "car", 0, 0, 100, 100, 0.9),
+				box(1, "car", 200, 200, 300, 300, 0.2),
+			},
+			threshold: 0.5,
+			map50:     1, map5095: 1, precision: 1, recall: 0.5,
+		},
+		{
+			name: "crowd match is ignored",
+			gt: []EvalBox{
+				box(1, "person", 0, 0, 50, 50, 0),
+				{Image: 1, Class: "person", Box: [4]float64{100, 100, 300, 300}, Crowd: true},
+			},
+			dets: []EvalBox{
+				box(1, "person", 100, 100, 300, 300, 0.95),
+				box(1, "person", 0, 0, 50, 50, 0.9),
+			},
+			threshold: 0.5,
+			map50:     1, map5095: 1, precision: 1, recall: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ev := Evaluate(tt.gt, tt.dets, tt.threshold)
+			if ev.MAP50 != tt.map50 || ev.MAP5095 != tt.map5095 {
+				t.Errorf("mAP50 = %v, mAP50-95 = %v, want %v and %v", ev.MAP50, ev.MAP5095, tt.map50, tt.map5095)
+			}
+			if len(ev.Classes) == 0 {
+				t.Fatal("no classes evaluated")
+			}
+			c := ev.Classes[0]
+			if c.Precision != tt.precision || c.Recall != tt.recall {
+				t.Errorf("precision = %v, recall = %v, want %v and %v", c.Precision, c.Recall, tt.precision, tt.recall)
+			}
+		})
+	}
+}
+
+func TestEvaluateClassWithoutGroundTruth(t *testing.T) {
+	gt := []EvalBox{{Image: 1, Class: "car", Box: [4]float64{0, 0, 10, 10}}}
+	dets := []EvalBox{
+		{Image: 1, Class: "car", Box: [4]float64{0, 0, 10, 10}, Score: 0.9},
+		{Image: 1, Class: "dog", Box: [4]float64{0, 0, 10, 10}, Score: 0.9},
+	}
+	ev := Evaluate(gt, dets, 0.5)
+	if ev.MAP50 != 1 {
+		t.Errorf("mAP50 = %v, want 1: a class without ground truth must not count", ev.MAP50)
+	}
+	if len(ev.Classes) != 2 || ev.Classes[1].Name != "dog" || ev.Classes[1].AP50 != nil {
+		t.Errorf("classes = %+v, want car then dog without AP", ev.Classes)
+	}
+}
@@ -0,0 +1,119 @@
+package postprocess
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ── 배타 클래스 ──────────────────────────────────────────────────────────────
+// Some classes cannot both be right about one object: a model unsure
+// whether a vehicle is a car or a truck often answers both, with two
+// nearly equal boxes that class-wise NMS leaves alone. An ExclusiveClasses,
+// read from <model>.exclusive.json next to the model, lists such groups.
+// When boxes of different classes of one group overlap by more than iou,
+// only the higher-scoring one is kept:
+//
+//	{"iou": 0.7, "groups": [["car", "truck", "bus"], ["person", "rider"]]}
+
+// DefaultExclusiveIoU is the overlap at which exclusive boxes are one
+// object when the file gives none.
+const DefaultExclusiveIoU = 0.7
+
+// ExclusiveClasses are groups of mutually exclusive class names.
+type ExclusiveClasses struct {
+	IoU    float64    `json:"iou,omitempty"`
+	Groups [][]string `json:"groups"`
+
+	group map[string]int // name → index in Groups
+}
+
+// ExclusivePath is model/yolo26n.onnx → model/yolo26n.exclusive.json.
+func ExclusivePath(modelPath string) string {
+	return strings.TrimSuffix(modelPath, filepath.Ext(modelPath)) + ".exclusive.json"
+}
+
+// LoadExclusiveClasses reads the groups next to modelPath; nil when there
+// are none.
+func LoadExclusiveClasses(modelPath string) (*ExclusiveClasses, error) {
+	path := ExclusivePath(modelPath)
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var x ExclusiveClasses
+	if err := json.Unmarshal(raw, &x); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := x.init(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &x, nil
+}
+
+func (x *ExclusiveClasses) init() error {
+	if x.IoU == 0 {
+		x.IoU = DefaultExclusiveIoU
+	}
+	if !(x.IoU > 0 && x.IoU <= 1) {
+		return fmt.Errorf("iou: want a value in (0, 1], got %g", x.IoU)
+	}
+	x.group = map[string]int{}
+	for i, g := range x.Groups {
+		if len(g) < 2 {
+			return fmt.Errorf("groups[%d]: want at least two classes", i)
+		}
+		for _, name := range g {
+			if j, ok := x.group[name]; ok {
+				return fmt.Errorf("groups[%d]: %s is already in groups[%d]", i, name, j)
+			}
+			x.group[name] = i
+		}
+	}
+	return nil
+}
+
+// Apply drops every box that overlaps a higher-scoring box of another class
+// of its group. dets is filtered in place and keeps its order.
+func (x *ExclusiveClasses) Apply(dets []Detection) []Detection {
+	if x == nil || len(dets) < 2 {
+		return dets
+	}
+	order := make([]int, len(dets))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return dets[order[i]].Score > dets[order[j]].Score })
+	drop := make([]bool, len(dets))
+	var kept []int
+	for _, i := range order {
+		g, ok := x.group[dets[i].Name]
+		if !ok {
+			continue
+		}
+		for _, k := range kept {
+			if dets[k].Name != dets[i].Name && x.group[dets[k].Name] == g && IoU(dets[k].Box, dets[i].Box) > x.IoU {
+				drop[i] = true
+				break
+			}
+		}
+		if !drop[i] {
+			kept = append(kept, i)
+		}
+	}
+	out := dets[:0]
+	for i, d := range dets {
+		if !drop[i] {
+			out = append(out, d)
+		}
+	}
+	return out
+}
@@ -0,0 +1,459 @@
+package postprocess
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ── 조건식 ───────────────────────────────────────────────────────────────────
+// An Expr is a condition on one detection, compiled once from text such as
+//
+//	score > 0.5 && name == "person" && box.area > 2000
+//	name in ["car", "truck"] and not (color == "white")
+//
+// Values are numbers, strings and booleans. Operators, loosest first:
+// || (or); && (and); == != < <= > >= and in [list]; + -; * /; unary ! (not)
+// and -. Every name has a fixed type, so mixing types is an error when the
+// expression is compiled, not when it runs. The names are:
+//
+//	score, label, name
+//	box.x1, box.y1, box.x2, box.y2, box.w, box.h, box.area, box.cx, box.cy
+//	plate, color, direction ("" without the attribute)
+//	speed (px/s; 0 untracked)
+//	ground.x, ground.y, distance (metres; 0 uncalibrated)
+//	speed_kmh (0 untracked or uncalibrated)
+
+type Expr struct {
+	src  string
+	eval func(d *Detection) value
+}
+
+// value is a number, string or bool; kind says which.
+type value struct {
+	kind kind
+	num  float64
+	str  string
+}
+
+type kind uint8
+
+const (
+	kindNum kind = iota
+	kindStr
+	kindBool
+)
+
+func (k kind) String() string {
+	return [...]string{"number", "string", "boolean"}[k]
+}
+
+func numValue(f float64) value { return value{kind: kindNum, num: f} }
+func strValue(s string) value  { return value{kind: kindStr, str: s} }
+func boolValue(b bool) value {
+	if b {
+		return value{kind: kindBool, num: 1}
+	}
+	return value{kind: kindBool}
+}
+
+// exprVars are the names an Expr may read.
+var exprVars = map[string]struct {
+	kind kind
+	get  func(d *Detection) value
+}{
+	"score":     {kindNum, func(d *Detection) value { return numValue(d.Score) }},
+	"label":     {kindNum, func(d *Detection) value { return numValue(float64(d.Label)) }},
+	"name":      {kindStr, func(d *Detection) value { return strValue(d.Name) }},
+	"box.x1":    {kindNum, func(d *Detection) value { return numValue(float64(d.Box[0])) }},
+	"box.y1":    {kindNum, func(d *Detection) value { return numValue(float64(d.Box[1])) }},
+	"box.x2":    {kindNum, func(d *Detection) value { return numValue(float64(d.Box[2])) }},
+	"box.y2":    {kindNum, func(d *Detection) value { return numValue(float64(d.Box[3])) }},
+	"box.w":     {kindNum, func(d *Detection) value { return numValue(float64(d.Box[2] - d.Box[0])) }},
+	"box.h":     {kindNum, func(d *Detection) value { return numValue(float64(d.Box[3] - d.Box[1])) }},
+	"box.area":  {kindNum, func(d *Detection) value { return numValue(float64((d.Box[2] - d.Box[0]) * (d.Box[3] - d.Box[1]))) }},
+	"box.cx":    {kindNum, func(d *Detection) value { return numValue(float64(d.Box[0]+d.Box[2]) / 2) }},
+	"box.cy":    {kindNum, func(d *Detection) value { return numValue(float64(d.Box[1]+d.Box[3]) / 2) }},
+	"plate":     {kindStr, func(d *Detection) value { return strValue(attr(d).Plate) }},
+	"color":     {kindStr, func(d *Detection) value { return strValue(attr(d).Color) }},
+	"direction": {kindStr, func(d *Detection) value { return strValue(attr(d).Direction) }},
+	"speed": {kindNum, func(d *Detection) value {
+		if v := attr(d).Velocity; v != nil {
+			return numValue(math.Hypot(v[0], v[1]))
+		}
+		return numValue(0)
+	}},
+	"ground.x":  {kindNum, func(d *Detection) value { return numValue(groundAt(d, 0)) }},
+	"ground.y":  {kindNum, func(d *Detection) value { return numValue(groundAt(d, 1)) }},
+	"distance":  {kindNum, func(d *Detection) value { return numValue(attr(d).Distance) }},
+	"speed_kmh": {kindNum, func(d *Detection) value { return numValue(attr(d).SpeedKmh) }},
+}
+
+func groundAt(d *Detection, i int) float64 {
+	if g := attr(d).Ground; g != nil {
+		return g[i]
+	}
+	return 0
+}
+
+var noAttributes Attributes
+
+func attr(d *Detection) *Attributes {
+	if d.Attributes == nil {
+		return &noAttributes
+	}
+	return d.Attributes
+}
+
+// CompileExpr parses src into a boolean Expr.
+func CompileExpr(src string) (*Expr, error) {
+	p := &exprParser{src: src}
+	if err := p.lex(); err != nil {
+		return nil, err
+	}
+	n, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf(t, "unexpected %q", t.text)
+	}
+	if n.kind != kindBool {
+		return nil, fmt.Errorf("expression is a %s, want a condition", n.kind)
+	}
+	return &Expr{src: src, eval: n.eval}, nil
+}
+
+// Match reports whether d satisfies e.
+func (e *Expr) Match(d *Detection) bool { return truth(e.eval(d)) }
+
+func (e *Expr) String() string { return e.src }
+
+type tokKind uint8
+
+const (
+	tokEOF tokKind = iota
+	tokNum
+	tokStr
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind tokKind
+	text string
+	num  float64
+	pos  int
+}
+
+type exprParser struct {
+	src  string
+	toks []token
+	i    int
+}
+
+func (p *exprParser) errorf(t token, format string, args ...any) error {
+	return fmt.Errorf("at %d: %s", t.pos+1, fmt.Sprintf(format, args...))
+}
+
+var exprOps = []string{"||", "&&", "==", "!=", "<=", ">=", "<", ">", "!", "+", "-", "*", "/", "(", ")", "[", "]", ","}
+
+func (p *exprParser) lex() error {
+	s := p.src
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '9':
+			j := i
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.') {
+				j++
+			}
+			f, err := strconv.ParseFloat(s[i:j], 64)
+			if err != nil {
+				return fmt.Errorf("at %d: bad number %q", i+1, s[i:j])
+			}
+			p.toks = append(p.toks, token{kind: tokNum, text: s[i:j], num: f, pos: i})
+			i = j
+		case c == '"' || c == '\'':
+			j := strings.IndexByte(s[i+1:], s[i])
+			if j < 0 {
+				return fmt.Errorf("at %d: unterminated string", i+1)
+			}
+			p.toks = append(p.toks, token{kind: tokStr, text: s[i+1 : i+1+j], pos: i})
+			i += j + 2
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(s) && (unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j])) || s[j] == '_' || s[j] == '.') {
+				j++
+			}
+			p.toks = append(p.toks, token{kind: tokIdent, text: s[i:j], pos: i})
+			i = j
+		default:
+			op := ""
+			for _, o := range exprOps {
+				if strings.HasPrefix(s[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return fmt.Errorf("at %d: unexpected %q", i+1, s[i])
+			}
+			p.toks = append(p.toks, token{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	p.toks = append(p.toks, token{kind: tokEOF, text: "end", pos: len(s)})
+	return nil
+}
+
+func (p *exprParser) peek() token { return p.toks[p.i] }
+func (p *exprParser) next() token { t := p.toks[p.i]; p.i++; return t }
+
+// accept consumes the next token if it is one of ops, or one of the words
+// standing for them.
+func (p *exprParser) accept(ops ...string) (string, bool) {
+	t := p.peek()
+	text := t.text
+	if t.kind == tokIdent {
+		text = map[string]string{"or": "||", "and": "&&", "not": "!", "in": "in"}[t.text]
+	} else if t.kind != tokOp {
+		return "", false
+	}
+	for _, o := range ops {
+		if text == o {
+			p.i++
+			return o, true
+		}
+	}
+	return "", false
+}
+
+func (p *exprParser) expect(op string) error {
+	if _, ok := p.accept(op); !ok {
+		t := p.peek()
+		return p.errorf(t, "want %q, got %q", op, t.text)
+	}
+	return nil
+}
+
+// node is a compiled subexpression; kind is what eval returns.
+type node struct {
+	kind kind
+	eval func(d *Detection) value
+}
+
+func (p *exprParser) or() (node, error)  { return p.logical("||", p.and) }
+func (p *exprParser) and() (node, error) { return p.logical("&&", p.comparison) }
+
+func (p *exprParser) logical(op string, operand func() (node, error)) (node, error) {
+	l, err := operand()
+	if err != nil {
+		return l, err
+	}
+	for {
+		t := p.peek()
+		if _, ok := p.accept(op); !ok {
+			return l, nil
+		}
+		r, err := operand()
+		if err != nil {
+			return r, err
+		}
+		if err := p.want(t, kindBool, l, r); err != nil {
+			return l, err
+		}
+		a, b := l.eval, r.eval
+		if op == "||" {
+			l = node{kindBool, func(d *Detection) value { return boolValue(truth(a(d)) || truth(b(d))) }}
+		} else {
+			l = node{kindBool, func(d *Detection) value { return boolValue(truth(a(d)) && truth(b(d))) }}
+		}
+	}
+}
+
+func truth(v value) bool { return v.kind == kindBool && v.num != 0 }
+
+// want checks that the operands of the operator at t are of kind k.
+func (p *exprParser) want(t token, k kind, operands ...node) error {
+	for _, n := range operands {
+		if n.kind != k {
+			return p.errorf(t, "%s wants a %s, got a %s", t.text, k, n.kind)
+		}
+	}
+	return nil
+}
+
+func (p *exprParser) comparison() (node, error) {
+	l, err := p.additive()
+	if err != nil {
+		return l, err
+	}
+	t := p.peek()
+	op, ok := p.accept("==", "!=", "<", "<=", ">", ">=", "in")
+	if !ok {
+		return l, nil
+	}
+	if op == "in" {
+		return p.in(t, l)
+	}
+	r, err := p.additive()
+	if err != nil {
+		return r, err
+	}
+	if l.kind != r.kind {
+		return l, p.errorf(t, "cannot compare a %s with a %s", l.kind, r.kind)
+	}
+	if l.kind == kindBool && op != "==" && op != "!=" {
+		return l, p.errorf(t, "booleans are not ordered")
+	}
+	a, b := l.eval, r.eval
+	cmp := map[string]func(int) bool{
+		"==": func(c int) bool { return c == 0 }, "!=": func(c int) bool { return c != 0 },
+		"<": func(c int) bool { return c < 0 }, "<=": func(c int) bool { return c <= 0 },
+		">": func(c int) bool { return c > 0 }, ">=": func(c int) bool { return c >= 0 },
+	}[op]
+	return node{kindBool, func(d *Detection) value {
+		x, y := a(d), b(d)
+		if x.kind == kindStr {
+			return boolValue(cmp(strings.Compare(x.str, y.str)))
+		}
+		switch {
+		case x.num < y.num:
+			return boolValue(cmp(-1))
+		case x.num > y.num:
+			return boolValue(cmp(1))
+		}
+		return boolValue(cmp(0))
+	}}, nil
+}
+
+// in parses the [list] of `l in [list]`, whose items must be constants.
+func (p *exprParser) in(t token, l node) (node, error) {
+	if err := p.expect("["); err != nil {
+		return l, err
+	}
+	var items []value
+	for {
+		if _, ok := p.accept("]"); ok {
+			break
+		}
+		if len(items) > 0 {
+			if err := p.expect(","); err != nil {
+				return l, err
+			}
+		}
+		it := p.next()
+		switch it.kind {
+		case tokNum:
+			items = append(items, numValue(it.num))
+		case tokStr:
+			items = append(items, strValue(it.text))
+		default:
+			return l, p.errorf(it, "in lists hold numbers and strings, got %q", it.text)
+		}
+		if items[len(items)-1].kind != l.kind {
+			return l, p.errorf(it, "cannot compare a %s with a %s", l.kind, items[len(items)-1].kind)
+		}
+	}
+	a := l.eval
+	return node{kindBool, func(d *Detection) value {
+		x := a(d)
+		for _, it := range items {
+			if it == x {
+				return boolValue(true)
+			}
+		}
+		return boolValue(false)
+	}}, nil
+}
+
+func (p *exprParser) additive() (node, error)       { return p.arith(p.multiplicative, "+", "-") }
+func (p *exprParser) multiplicative() (node, error) { return p.arith(p.unary, "*", "/") }
+
+func (p *exprParser) arith(operand func() (node, error), ops ...string) (node, error) {
+	l, err := operand()
+	if err != nil {
+		return l, err
+	}
+	for {
+		t := p.peek()
+		op, ok := p.accept(ops...)
+		if !ok {
+			return l, nil
+		}
+		r, err := operand()
+		if err != nil {
+			return r, err
+		}
+		if err := p.want(t, kindNum, l, r); err != nil {
+			return l, err
+		}
+		a, b := l.eval, r.eval
+		f := map[string]func(x, y float64) float64{
+			"+": func(x, y float64) float64 { return x + y },
+			"-": func(x, y float64) float64 { return x - y },
+			"*": func(x, y float64) float64 { return x * y },
+			"/": func(x, y float64) float64 { return x / y },
+		}[op]
+		l = node{kindNum, func(d *Detection) value { return numValue(f(a(d).num, b(d).num)) }}
+	}
+}
+
+func (p *exprParser) unary() (node, error) {
+	t := p.peek()
+	op, ok := p.accept("!", "-")
+	if !ok {
+		return p.primary()
+	}
+	n, err := p.unary()
+	if err != nil {
+		return n, err
+	}
+	a := n.eval
+	if op == "!" {
+		if err := p.want(t, kindBool, n); err != nil {
+			return n, err
+		}
+		return node{kindBool, func(d *Detection) value { return boolValue(!truth(a(d))) }}, nil
+	}
+	if err := p.want(t, kindNum, n); err != nil {
+		return n, err
+	}
+	return node{kindNum, func(d *Detection) value { return numValue(-a(d).num) }}, nil
+}
+
+func (p *exprParser) primary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNum:
+		v := numValue(t.num)
+		return node{kindNum, func(*Detection) value { return v }}, nil
+	case tokStr:
+		v := strValue(t.text)
+		return node{kindStr, func(*Detection) value { return v }}, nil
+	case tokIdent:
+		switch t.text {
+		case "true", "false":
+			v := boolValue(t.text == "true")
+			return node{kindBool, func(*Detection) value { return v }}, nil
+		}
+		if v, ok := exprVars[t.text]; ok {
+			return node{v.kind, v.get}, nil
+		}
+		return node{}, p.errorf(t, "unknown name %q", t.text)
+	case tokOp:
+		if t.text == "(" {
+			n, err := p.or()
+			if err != nil {
+				return n, err
+			}
+			return n, p.expect(")")
+		}
+	}
+	return node{}, p.errorf(t, "unexpected %q", t.text)
+}
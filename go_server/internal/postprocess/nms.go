@@ -0,0 +1,47 @@
+package postprocess
+
+import "sort"
+
+// ── NMS ──────────────────────────────────────────────────────────────────────
+// Boxes from several passes over one frame (tiles, TTA augmentations) are
+// merged with class-wise non-maximum suppression.
+
+// NMS keeps the highest-scoring box of every same-label cluster whose IoU
+// exceeds iouThreshold. dets is reordered in place.
+func NMS(dets []Detection, iouThreshold float64) []Detection {
+	return nms(dets, iouThreshold, false)
+}
+
+// nms is NMS, across labels when agnostic.
+func nms(dets []Detection, iouThreshold float64, agnostic bool) []Detection {
+	sort.SliceStable(dets, func(i, j int) bool { return dets[i].Score > dets[j].Score })
+	keep := dets[:0]
+	for _, d := range dets {
+		suppressed := false
+		for _, k := range keep {
+			if (agnostic || k.Label == d.Label) && IoU(k.Box, d.Box) > iouThreshold {
+				suppressed = true
+				break
+			}
+		}
+		if !suppressed {
+			keep = append(keep, d)
+		}
+	}
+	return keep
+}
+
+// IoU is the intersection over union of two x1, y1, x2, y2 boxes.
+func IoU(a, b [4]int) float64 {
+	ix := min(a[2], b[2]) - max(a[0], b[0])
+	iy := min(a[3], b[3]) - max(a[1], b[1])
+	if ix <= 0 || iy <= 0 {
+		return 0
+	}
+	inter := float64(ix * iy)
+	union := float64((a[2]-a[0])*(a[3]-a[1])+(b[2]-b[0])*(b[3]-b[1])) - inter
+	if union <= 0 {
+		return 0
+	}
+	return inter / union
+}
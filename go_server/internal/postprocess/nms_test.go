@@ -0,0 +1,100 @@
+package postprocess
+
+import (
+	"math"
+	"testing"
+)
+
+func TestIoU(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b [4]int
+		want float64
+	}{
+		{"identical", [4]int{0, 0, 10, 10}, [4]int{0, 0, 10, 10}, 1},
+		{"disjoint", [4]int{0, 0, 10, 10}, [4]int{20, 20, 30, 30}, 0},
+		{"touching", [4]int{0, 0, 10, 10}, [4]int{10, 0, 20, 10}, 0},
+		{"half overlap", [4]int{0, 0, 10, 10}, [4]int{5, 0, 15, 10}, 50.0 / 150},
+		{"contained", [4]int{0, 0, 10, 10}, [4]int{0, 0, 5, 10}, 0.5},
+		{"degenerate", [4]int{0, 0, 0, 0}, [4]int{0, 0, 0, 0}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IoU(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("IoU(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+			if got := IoU(tt.b, tt.a); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("IoU is not symmetric: IoU(%v, %v) = %v, want %v", tt.b, tt.a, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNMS(t *testing.T) {
+	person := func(box [4]int, score float64) Detection {
+		return Detection{Box: box, Score: score, Label: 0, Name: "person"}
+	}
+	car := func(box [4]int, score float64) Detection {
+		return Detection{Box: box, Score: score, Label: 2, Name: "car"}
+	}
+	tests := []struct {
+		name     string
+		dets     []Detection
+		iou      float64
+		agnostic bool
+		want     []float64 // scores kept, in order
+	}{
+		{
+			name: "empty",
+			iou:  0.5,
+		},
+		{
+			name: "keeps the best of a cluster",
+			dets: []Detection{person([4]int{0, 0, 10, 10}, 0.6), person([4]int{1, 0, 11, 10}, 0.9)},
+			iou:  0.5,
+			want: []float64{0.9},
+		},
+		{
+			name: "keeps boxes below the threshold",
+			dets: []Detection{person([4]int{0, 0, 10, 10}, 0.6), person([4]int{5, 0, 15, 10}, 0.9)},
+			iou:  0.5,
+			want: []float64{0.9, 0.6},
+		},
+		{
+			name: "class-wise keeps other labels",
+			dets: []Detection{person([4]int{0, 0, 10, 10}, 0.9), car([4]int{0, 0, 10, 10}, 0.8)},
+			iou:  0.5,
+			want: []float64{0.9, 0.8},
+		},
+		{
+			name:     "agnostic suppresses across labels",
+			dets:     []Detection{person([4]int{0, 0, 10, 10}, 0.9), car([4]int{0, 0, 10, 10}, 0.8)},
+			iou:      0.5,
+			agnostic: true,
+			want:     []float64{0.9},
+		},
+		{
+			name: "suppressed box does not suppress others",
+			dets: []Detection{
+				person([4]int{0, 0, 10, 10}, 0.9),
+				person([4]int{4, 0, 14, 10}, 0.8), // IoU 0.43 with the first
+				person([4]int{8, 0, 18, 10}, 0.7), // IoU 0.11 with the first
+			},
+			iou:  0.4,
+			want: []float64{0.9, 0.7},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := nms(tt.dets, tt.iou, tt.agnostic)
+			if len(got) != len(tt.want) {
+				t.Fatalf("kept %d detections %v, want scores %v", len(got), got, tt.want)
+			}
+			for i, d := range got {
+				if d.Score != tt.want[i] {
+					t.Errorf("detection %d has score %v, want %v", i, d.Score, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package postprocess
+
+import (
+	"fmt"
+	"net/url"
+	"plugin"
+
+	"yolo-server/stage"
+)
+
+// A plugin stage is a Go plugin, built with go build -buildmode=plugin
+// against the same source and Go version as the server, that exports
+//
+//	func NewStage(args url.Values) (stage.Stage, error)
+//
+// NewStage is called once at startup with the stage's arguments, path
+// included. Plugins need cgo, so the server must be built with it. They
+// import yolo-server/stage rather than this package, which is internal.
+
+// NewStageFunc is the type of a plugin's NewStage.
+type NewStageFunc = stage.NewStageFunc
+
+func openPlugin(args url.Values) (Stage, error) {
+	path := args.Get("path")
+	if path == "" {
+		return nil, fmt.Errorf("want path=<plugin .so>")
+	}
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	sym, err := p.Lookup("NewStage")
+	if err != nil {
+		return nil, err
+	}
+	newStage, ok := sym.(NewStageFunc)
+	if !ok {
+		return nil, fmt.Errorf("%s: NewStage is a %T, want func(url.Values) (stage.Stage, error)", path, sym)
+	}
+	return newStage(args)
+}
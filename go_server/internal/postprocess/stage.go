@@ -0,0 +1,234 @@
+package postprocess
+
+import (
+	"fmt"
+	"image"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"yolo-server/stage"
+)
+
+// ── 후처리 단계 ──────────────────────────────────────────────────────────────
+// A Chain is a list of stages run over every frame's detections after the
+// detector's own thresholding and NMS. It is declared as stages separated
+// by ';', each a name and query-string arguments:
+//
+//	filter?score=0.5&classes=person,car&min_area=400&max_area=90000
+//	nms?iou=0.5&agnostic=1
+//	zones?keep=0,0,640,360&keep=700,0,1280,360&drop=300,200,340,240
+//	expr?keep=score > 0.5 and name in ["car", "truck"]
+//	plugin?path=/etc/yolo/stage.so&any=argument
+//
+// filter drops detections below a score, of other classes or outside an
+// area range; nms suppresses overlapping boxes again, across classes with
+// agnostic; zones keeps detections whose box centre lies in a keep zone,
+// when there are any, and in no drop zone; expr keeps detections matching
+// an Expr (see expr.go), where a query string needs "and" for && and %2B
+// for +. plugin loads a Go plugin (see plugin.go) for logic of one's own.
+//
+// There is no tracker stage. One Chain is built at startup and shared by
+// every stream and /detect, so a stage sees frames of all of them at once
+// and cannot keep per-stream state; the tracker (internal/track) runs in
+// each stream's pipeline, after the chain. WebAssembly stages are out of
+// scope: they would need an embedded WASM runtime as a dependency.
+
+// A Stage transforms one frame's detections. It may change dets in place
+// and is called from many goroutines at once.
+type Stage = stage.Stage
+
+// Chain runs its stages in order; the zero Chain passes detections through.
+type Chain []Stage
+
+func (c Chain) Run(dets []Detection) []Detection {
+	for _, s := range c {
+		dets = s.Process(dets)
+	}
+	return dets
+}
+
+// ParseChain builds the Chain that spec declares.
+func ParseChain(spec string) (Chain, error) {
+	var c Chain
+	for _, part := range strings.Split(spec, ";") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		name, query, _ := strings.Cut(part, "?")
+		args, err := url.ParseQuery(query)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		var s Stage
+		switch name {
+		case "filter":
+			s, err = newFilter(args)
+		case "nms":
+			s, err = newNMSStage(args)
+		case "zones":
+			s, err = newZones(args)
+		case "expr":
+			s, err = newExprStage(args)
+		case "plugin":
+			s, err = openPlugin(args)
+		default:
+			return nil, fmt.Errorf("unknown stage %q; want filter, nms, zones, expr or plugin", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		c = append(c, s)
+	}
+	return c, nil
+}
+
+type filter struct {
+	score            float64
+	classes          []string // nil = all
+	minArea, maxArea int      // 0 = no bound
+}
+
+func newFilter(args url.Values) (*filter, error) {
+	f := &filter{}
+	var err error
+	if v := args.Get("score"); v != "" {
+		if f.score, err = strconv.ParseFloat(v, 64); err != nil || f.score < 0 || f.score > 1 {
+			return nil, fmt.Errorf("score: want a number in [0, 1], got %q", v)
+		}
+	}
+	for _, c := range strings.Split(args.Get("classes"), ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			f.classes = append(f.classes, c)
+		}
+	}
+	for _, b := range []struct {
+		key string
+		to  *int
+	}{{"min_area", &f.minArea}, {"max_area", &f.maxArea}} {
+		if v := args.Get(b.key); v != "" {
+			if *b.to, err = strconv.Atoi(v); err != nil || *b.to < 0 {
+				return nil, fmt.Errorf("%s: want a non-negative integer, got %q", b.key, v)
+			}
+		}
+	}
+	return f, nil
+}
+
+func (f *filter) Process(dets []Detection) []Detection {
+	keep := dets[:0]
+	for _, d := range dets {
+		area := (d.Box[2] - d.Box[0]) * (d.Box[3] - d.Box[1])
+		if d.Score >= f.score &&
+			(f.classes == nil || slices.Contains(f.classes, d.Name)) &&
+			area >= f.minArea && (f.maxArea == 0 || area <= f.maxArea) {
+			keep = append(keep, d)
+		}
+	}
+	return keep
+}
+
+type nmsStage struct {
+	iou      float64
+	agnostic bool
+}
+
+func newNMSStage(args url.Values) (*nmsStage, error) {
+	n := &nmsStage{iou: 0.5}
+	var err error
+	if v := args.Get("iou"); v != "" {
+		if n.iou, err = strconv.ParseFloat(v, 64); err != nil || n.iou <= 0 || n.iou > 1 {
+			return nil, fmt.Errorf("iou: want a number in (0, 1], got %q", v)
+		}
+	}
+	if v := args.Get("agnostic"); v != "" {
+		if n.agnostic, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("agnostic: want a boolean, got %q", v)
+		}
+	}
+	return n, nil
+}
+
+func (n *nmsStage) Process(dets []Detection) []Detection {
+	return nms(dets, n.iou, n.agnostic)
+}
+
+type zones struct {
+	keep, drop []image.Rectangle
+}
+
+func newZones(args url.Values) (*zones, error) {
+	z := &zones{}
+	for _, b := range []struct {
+		key string
+		to  *[]image.Rectangle
+	}{{"keep", &z.keep}, {"drop", &z.drop}} {
+		for _, v := range args[b.key] {
+			var c [4]int
+			parts := strings.Split(v, ",")
+			if len(parts) != 4 {
+				return nil, fmt.Errorf("%s: want x1,y1,x2,y2, got %q", b.key, v)
+			}
+			for i, p := range parts {
+				n, err := strconv.Atoi(strings.TrimSpace(p))
+				if err != nil {
+					return nil, fmt.Errorf("%s: want x1,y1,x2,y2, got %q", b.key, v)
+				}
+				c[i] = n
+			}
+			r := image.Rect(c[0], c[1], c[2], c[3])
+			if r.Empty() {
+				return nil, fmt.Errorf("%s: empty zone %q", b.key, v)
+			}
+			*b.to = append(*b.to, r)
+		}
+	}
+	if z.keep == nil && z.drop == nil {
+		return nil, fmt.Errorf("want a keep or drop zone")
+	}
+	return z, nil
+}
+
+func (z *zones) Process(dets []Detection) []Detection {
+	keep := dets[:0]
+	for _, d := range dets {
+		c := d.Centre()
+		if (z.keep == nil || inAny(c, z.keep)) && !inAny(c, z.drop) {
+			keep = append(keep, d)
+		}
+	}
+	return keep
+}
+
+func inAny(p image.Point, zones []image.Rectangle) bool {
+	for _, z := range zones {
+		if p.In(z) {
+			return true
+		}
+	}
+	return false
+}
+
+type exprStage struct{ keep *Expr }
+
+func newExprStage(args url.Values) (*exprStage, error) {
+	if args.Get("keep") == "" {
+		return nil, fmt.Errorf("want keep=<expression>")
+	}
+	e, err := CompileExpr(args.Get("keep"))
+	if err != nil {
+		return nil, fmt.Errorf("keep: %w", err)
+	}
+	return &exprStage{keep: e}, nil
+}
+
+func (s *exprStage) Process(dets []Detection) []Detection {
+	keep := dets[:0]
+	for i := range dets {
+		if s.keep.Match(&dets[i]) {
+			keep = append(keep, dets[i])
+		}
+	}
+	return keep
+}
@@ -0,0 +1,77 @@
+package postprocess
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseChain(t *testing.T) {
+	dets := func() []Detection {
+		return []Detection{
+			{Box: [4]int{0, 0, 100, 100}, Score: 0.9, Label: 0, Name: "person"},
+			{Box: [4]int{5, 0, 105, 100}, Score: 0.7, Label: 2, Name: "car"},
+			{Box: [4]int{500, 500, 510, 510}, Score: 0.4, Label: 2, Name: "car"},
+			{Box: [4]int{300, 0, 400, 100}, Score: 0.8, Label: 7, Name: "truck"},
+		}
+	}
+	tests := []struct {
+		spec string
+		want []string // names kept, in order
+	}{
+		{"", []string{"person", "car", "car", "truck"}},
+		{" ; ", []string{"person", "car", "car", "truck"}},
+		{"filter?score=0.5", []string{"person", "car", "truck"}},
+		{"filter?classes=car,truck", []string{"car", "car", "truck"}},
+		{"filter?min_area=1000&max_area=9999", nil},
+		{"filter?min_area=1000", []string{"person", "car", "truck"}},
+		{"nms?iou=0.5", []string{"person", "truck", "car", "car"}},
+		{"nms?iou=0.5&agnostic=1", []string{"person", "truck", "car"}},
+		{"zones?keep=0,0,200,200", []string{"person", "car"}},
+		{"zones?drop=0,0,200,200", []string{"car", "truck"}},
+		{"zones?keep=0,0,1000,1000&drop=490,490,520,520", []string{"person", "car", "truck"}},
+		{`expr?keep=name in ["car", "truck"] and score > 0.5`, []string{"car", "truck"}},
+		{"filter?score=0.5;zones?keep=200,0,1000,1000", []string{"truck"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			c, err := ParseChain(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, d := range c.Run(dets()) {
+				got = append(got, d.Name)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("kept %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseChainErrors(t *testing.T) {
+	tests := []struct {
+		spec, want string
+	}{
+		{"sharpen", `unknown stage "sharpen"`},
+		{"filter?score=2", "score: want a number in [0, 1]"},
+		{"filter?min_area=-1", "min_area: want a non-negative integer"},
+		{"nms?iou=0", "iou: want a number in (0, 1]"},
+		{"nms?agnostic=maybe", "agnostic: want a boolean"},
+		{"zones", "want a keep or drop zone"},
+		{"zones?keep=1,2,3", "keep: want x1,y1,x2,y2"},
+		{"zones?drop=5,5,5,9", "drop: empty zone"},
+		{"expr", "want keep=<expression>"},
+		{"expr?keep=score", "keep:"},
+		{"plugin", "want path=<plugin .so>"},
+		{"filter?score=%zz", "filter: invalid URL escape"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			_, err := ParseChain(tt.spec)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseChain(%q) = %v, want an error containing %q", tt.spec, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package preprocess
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// ── 객체 썸네일 ──────────────────────────────────────────────────────────────
+// Crops are small JPEGs of single detections, for notifications and search
+// UIs that show the object without the whole frame. They are cut in Go
+// from the redacted frame, so privacy zones and blurred classes stay
+// hidden in them too.
+
+const cropQuality = 80
+
+// Crops cuts boxes out of frame b, each scaled down to at most maxSize
+// pixels on its longer side. orientation is the EXIF orientation the
+// coordinates assume, 1 when they are in the stored pixels. A box outside
+// the frame gets a nil crop.
+func Crops(b []byte, orientation int, boxes []image.Rectangle, maxSize int, mask, blur []image.Rectangle) ([][]byte, error) {
+	img, _, err := decodeRGBA(b)
+	if err != nil {
+		return nil, err
+	}
+	img = orient(img, orientation)
+	redact(img, mask, blur)
+	out := make([][]byte, len(boxes))
+	for i, r := range boxes {
+		if r = r.Intersect(img.Bounds()); r.Empty() {
+			continue
+		}
+		w, h := r.Dx(), r.Dy()
+		if long := max(w, h); long > maxSize {
+			w, h = max(w*maxSize/long, 1), max(h*maxSize/long, 1)
+		}
+		dst := image.NewRGBA(image.Rect(0, 0, w, h))
+		xdraw.ApproxBiLinear.Scale(dst, dst.Bounds(), img, r, xdraw.Src, nil)
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: cropQuality}); err != nil {
+			return nil, err
+		}
+		out[i] = buf.Bytes()
+	}
+	return out, nil
+}
+
+// orient turns img upright for EXIF orientation o (2..8); 1 and unknown
+// values leave it as stored.
+func orient(img *image.RGBA, o int) *image.RGBA {
+	if o < 2 || o > 8 {
+		return img
+	}
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	ow, oh := w, h
+	if o >= 5 {
+		ow, oh = h, w
+	}
+	out := image.NewRGBA(image.Rect(0, 0, ow, oh))
+	for y := 0; y < oh; y++ {
+		for x := 0; x < ow; x++ {
+			var sx, sy int
+			switch o {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			out.SetRGBA(x, y, img.RGBAAt(sx, sy))
+		}
+	}
+	return out
+}
@@ -0,0 +1,66 @@
+package preprocess
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+
+	"golang.org/x/image/webp"
+)
+
+// ── 디코딩 ──────────────────────────────────────────────────────────────────
+// Frames arrive as JPEG or PNG from most clients, but browsers can produce
+// WebP (and sometimes AVIF) far more cheaply via canvas.toBlob. OpenCV is
+// tried first for every format; the container sniffed from the magic bytes
+// only decides what to do when OpenCV was built without that codec.
+
+const (
+	formatUnknown = ""
+	formatJPEG    = "jpeg"
+	formatPNG     = "png"
+	formatWebP    = "webp"
+	formatAVIF    = "avif"
+)
+
+// ErrDecode wraps every failure to decode a frame; callers map it to 400.
+var ErrDecode = errors.New("image decode failed")
+
+// sniffFormat identifies the image container from its leading bytes.
+func sniffFormat(b []byte) string {
+	switch {
+	case len(b) >= 3 && b[0] == 0xFF && b[1] == 0xD8 && b[2] == 0xFF:
+		return formatJPEG
+	case len(b) >= 8 && bytes.Equal(b[:8], []byte("\x89PNG\r\n\x1a\n")):
+		return formatPNG
+	case len(b) >= 12 && bytes.Equal(b[:4], []byte("RIFF")) && bytes.Equal(b[8:12], []byte("WEBP")):
+		return formatWebP
+	case len(b) >= 12 && bytes.Equal(b[4:8], []byte("ftyp")) &&
+		(bytes.Equal(b[8:12], []byte("avif")) || bytes.Equal(b[8:12], []byte("avis"))):
+		return formatAVIF
+	}
+	return formatUnknown
+}
+
+// FrameDims reads the pixel size from the image header without decoding
+// it, so callers can refuse frames too large to decode. ok is false for
+// containers it cannot parse (AVIF, formats only OpenCV knows).
+func FrameDims(b []byte) (w, h int, ok bool) {
+	var cfg image.Config
+	var err error
+	switch sniffFormat(b) {
+	case formatJPEG:
+		cfg, err = jpeg.DecodeConfig(bytes.NewReader(b))
+	case formatPNG:
+		cfg, err = png.DecodeConfig(bytes.NewReader(b))
+	case formatWebP:
+		cfg, err = webp.DecodeConfig(bytes.NewReader(b))
+	default:
+		return 0, 0, false
+	}
+	if err != nil {
+		return 0, 0, false
+	}
+	return cfg.Width, cfg.Height, true
+}
@@ -0,0 +1,76 @@
+package preprocess
+
+import (
+	"image"
+	"math"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// ── 색상 배치 기술자 ─────────────────────────────────────────────────────────
+// Without an embedding model, objects are compared by a colour layout
+// descriptor: the mean colour of each cell of a 4×4 grid over the image,
+// which tells a red car from a blue one and a person in a white shirt and
+// dark trousers from one in a dark coat; and a 4×4×4 RGB histogram, which
+// does not care where in the box the colours are. It finds the same-looking
+// object again under similar light, not the same object.
+
+const (
+	layoutGrid = 4
+	layoutBins = 4
+	layoutSide = 16 // pixels the image is scaled to first
+)
+
+// ColorLayout is the colour layout descriptor of image b, a unit vector of
+// ColorLayoutLen values.
+func ColorLayout(b []byte) ([]float32, error) {
+	img, _, err := decodeRGBA(b)
+	if err != nil {
+		return nil, err
+	}
+	small := image.NewRGBA(image.Rect(0, 0, layoutSide, layoutSide))
+	xdraw.ApproxBiLinear.Scale(small, small.Bounds(), img, img.Bounds(), xdraw.Src, nil)
+	grid := make([]float32, layoutGrid*layoutGrid*3)
+	hist := make([]float32, layoutBins*layoutBins*layoutBins)
+	cell := layoutSide / layoutGrid
+	bin := func(v uint8) int { return int(v) * layoutBins / 256 }
+	for y := 0; y < layoutSide; y++ {
+		for x := 0; x < layoutSide; x++ {
+			p := small.RGBAAt(x, y)
+			g := ((y/cell)*layoutGrid + x/cell) * 3
+			grid[g] += float32(p.R)
+			grid[g+1] += float32(p.G)
+			grid[g+2] += float32(p.B)
+			hist[(bin(p.R)*layoutBins+bin(p.G))*layoutBins+bin(p.B)]++
+		}
+	}
+	// The grid is centred on its grey level, so that colours rather than
+	// brightness set cells apart; each half is then scaled to length 1/√2,
+	// so the whole is a unit vector.
+	var mean float32
+	for _, v := range grid {
+		mean += v / float32(len(grid))
+	}
+	for i := range grid {
+		grid[i] -= mean
+	}
+	return append(unitScaled(grid), unitScaled(hist)...), nil
+}
+
+// ColorLayoutLen is the length of a ColorLayout descriptor.
+const ColorLayoutLen = layoutGrid*layoutGrid*3 + layoutBins*layoutBins*layoutBins
+
+func unitScaled(v []float32) []float32 {
+	var sum float64
+	for _, f := range v {
+		sum += float64(f) * float64(f)
+	}
+	if sum == 0 {
+		return v
+	}
+	k := float32(1 / math.Sqrt(2*sum))
+	for i := range v {
+		v[i] *= k
+	}
+	return v
+}
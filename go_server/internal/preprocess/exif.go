@@ -0,0 +1,79 @@
+package preprocess
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// ── EXIF 방향 ────────────────────────────────────────────────────────────────
+// Phone uploads are usually stored sensor-side up with an EXIF Orientation
+// tag describing how to display them. The REST path decodes the raw pixels
+// and applies the tag itself, so boxes always refer to the upright image the
+// user sees, independent of how the OpenCV build treats EXIF.
+
+// ExifOrientation returns the EXIF Orientation (1..8) of a JPEG, or 1 when
+// the tag is absent or the data is not a JPEG.
+func ExifOrientation(b []byte) int {
+	if len(b) < 4 || b[0] != 0xFF || b[1] != 0xD8 {
+		return 1
+	}
+	pos := 2
+	for pos+4 <= len(b) {
+		if b[pos] != 0xFF {
+			return 1
+		}
+		marker := b[pos+1]
+		if marker == 0xDA || marker == 0xD9 { // start of scan / end of image
+			return 1
+		}
+		size := int(binary.BigEndian.Uint16(b[pos+2:]))
+		end := pos + 2 + size
+		if size < 2 || end > len(b) {
+			return 1
+		}
+		seg := b[pos+4 : end]
+		if marker == 0xE1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return tiffOrientation(seg[6:])
+		}
+		pos = end
+	}
+	return 1
+}
+
+// tiffOrientation reads tag 0x0112 from IFD0 of a TIFF-structured block.
+func tiffOrientation(t []byte) int {
+	if len(t) < 8 {
+		return 1
+	}
+	var bo binary.ByteOrder
+	switch string(t[:2]) {
+	case "II":
+		bo = binary.LittleEndian
+	case "MM":
+		bo = binary.BigEndian
+	default:
+		return 1
+	}
+	if bo.Uint16(t[2:]) != 42 {
+		return 1
+	}
+	ifd := int(bo.Uint32(t[4:]))
+	if ifd < 8 || ifd+2 > len(t) {
+		return 1
+	}
+	n := int(bo.Uint16(t[ifd:]))
+	for i := 0; i < n; i++ {
+		e := ifd + 2 + i*12
+		if e+12 > len(t) {
+			return 1
+		}
+		if bo.Uint16(t[e:]) != 0x0112 {
+			continue
+		}
+		if o := int(bo.Uint16(t[e+8:])); o >= 1 && o <= 8 {
+			return o
+		}
+		return 1
+	}
+	return 1
+}
@@ -0,0 +1,105 @@
+package preprocess
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// jpegWithOrientation encodes a small JPEG and, when o > 0, splices in an
+// APP1 Exif segment whose IFD0 holds Orientation o in byte order bo.
+func jpegWithOrientation(t *testing.T, o int, bo binary.ByteOrder) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 8, 4)), nil); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	if o == 0 {
+		return b
+	}
+	tiff := make([]byte, 8+2+12+4)
+	if bo == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	bo.PutUint16(tiff[2:], 42)
+	bo.PutUint32(tiff[4:], 8)
+	bo.PutUint16(tiff[8:], 1)       // one entry
+	bo.PutUint16(tiff[10:], 0x0112) // Orientation
+	bo.PutUint16(tiff[12:], 3)      // SHORT
+	bo.PutUint32(tiff[14:], 1)
+	bo.PutUint16(tiff[18:], uint16(o))
+	seg := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(len(seg)+2))
+	out := append([]byte{}, b[:2]...)
+	out = append(out, app1...)
+	out = append(out, seg...)
+	return append(out, b[2:]...)
+}
+
+func TestExifOrientation(t *testing.T) {
+	var png8 bytes.Buffer
+	if err := png.Encode(&png8, image.NewGray(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		b    []byte
+		want int
+	}{
+		{"no exif", jpegWithOrientation(t, 0, nil), 1},
+		{"little endian 6", jpegWithOrientation(t, 6, binary.LittleEndian), 6},
+		{"big endian 8", jpegWithOrientation(t, 8, binary.BigEndian), 8},
+		{"big endian 3", jpegWithOrientation(t, 3, binary.BigEndian), 3},
+		{"out of range", jpegWithOrientation(t, 9, binary.LittleEndian), 1},
+		{"png", png8.Bytes(), 1},
+		{"empty", nil, 1},
+		{"truncated", jpegWithOrientation(t, 6, binary.LittleEndian)[:12], 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExifOrientation(tt.b); got != tt.want {
+				t.Errorf("ExifOrientation = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// A 3×2 image whose stored top-left pixel is marked.
+	mark := color.RGBA{R: 255, A: 255}
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	img.SetRGBA(0, 0, mark)
+	tests := []struct {
+		o    int
+		size image.Point
+		at   image.Point // where the mark is seen upright
+	}{
+		{1, image.Pt(3, 2), image.Pt(0, 0)},
+		{2, image.Pt(3, 2), image.Pt(2, 0)},
+		{3, image.Pt(3, 2), image.Pt(2, 1)},
+		{4, image.Pt(3, 2), image.Pt(0, 1)},
+		{5, image.Pt(2, 3), image.Pt(0, 0)},
+		{6, image.Pt(2, 3), image.Pt(1, 0)},
+		{7, image.Pt(2, 3), image.Pt(1, 2)},
+		{8, image.Pt(2, 3), image.Pt(0, 2)},
+		{0, image.Pt(3, 2), image.Pt(0, 0)},
+	}
+	for _, tt := range tests {
+		out := orient(img, tt.o)
+		if got := out.Bounds().Size(); got != tt.size {
+			t.Errorf("orientation %d: size %v, want %v", tt.o, got, tt.size)
+			continue
+		}
+		if got := out.RGBAAt(tt.at.X, tt.at.Y); got != mark {
+			t.Errorf("orientation %d: mark not at %v", tt.o, tt.at)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+//go:build !nocv
+
+package preprocess
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"runtime"
+	"sync"
+
+	"gocv.io/x/gocv"
+)
+
+// ── 전처리 ──────────────────────────────────────────────────────────────────
+
+// Mats holds the native scratch Mats for one frame: the decoded image,
+// its model-input resize, and one bandMats per preprocessing goroutine. Sets
+// are pooled by the caller and reused frame after frame, so OpenCV reuses
+// the allocations instead of reallocating several MB per frame.
+type Mats struct {
+	Decoded gocv.Mat
+	resized gocv.Mat
+	bands   []bandMats
+}
+
+// bandMats converts one horizontal band of rows.
+type bandMats struct {
+	f32    gocv.Mat    // CV_32FC3, pixel/255
+	planes [3]gocv.Mat // CV_32FC1 B, G, R
+}
+
+func NewMats() *Mats {
+	n := runtime.NumCPU()
+	if n > InputSize {
+		n = InputSize
+	}
+	p := &Mats{
+		Decoded: gocv.NewMat(),
+		resized: gocv.NewMat(),
+		bands:   make([]bandMats, n),
+	}
+	for i := range p.bands {
+		b := &p.bands[i]
+		b.f32 = gocv.NewMat()
+		for c := range b.planes {
+			b.planes[c] = gocv.NewMat()
+		}
+	}
+	return p
+}
+
+func (p *Mats) Close() {
+	p.Decoded.Close()
+	p.resized.Close()
+	for i := range p.bands {
+		b := &p.bands[i]
+		b.f32.Close()
+		for c := range b.planes {
+			b.planes[c].Close()
+		}
+	}
+}
+
+// Input resizes img (BGR, any size) to size×size and writes it into inp
+// (3·size² values) as CHW float32/255. It returns the factors that map
+// model coordinates back to img's pixels.
+func (p *Mats) Input(img gocv.Mat, inp []float32, size int) (scaleX, scaleY float32, err error) {
+	if len(inp) != 3*size*size {
+		return 0, 0, fmt.Errorf("input buffer holds %d values, want 3×%d×%d", len(inp), size, size)
+	}
+	scaleX = float32(img.Cols()) / float32(size)
+	scaleY = float32(img.Rows()) / float32(size)
+	gocv.Resize(img, &p.resized, image.Point{X: size, Y: size}, 0, 0, gocv.InterpolationLinear)
+	return scaleX, scaleY, p.toCHW(p.resized, inp, size)
+}
+
+// toCHW fills inp with src (size×size BGR) as CHW float32/255.
+// The rows are split into one band per CPU and converted concurrently;
+// each band writes a disjoint row range of every plane, so no locking.
+func (p *Mats) toCHW(src gocv.Mat, inp []float32, size int) error {
+	rowsPerBand := (size + len(p.bands) - 1) / len(p.bands)
+	errs := make([]error, len(p.bands))
+	var wg sync.WaitGroup
+	for i := range p.bands {
+		r0 := i * rowsPerBand
+		r1 := r0 + rowsPerBand
+		if r1 > size {
+			r1 = size
+		}
+		if r0 >= r1 {
+			break
+		}
+		wg.Add(1)
+		go func(i, r0, r1 int) {
+			defer wg.Done()
+			errs[i] = p.bands[i].convert(src, r0, r1, size, inp)
+		}(i, r0, r1)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// convert scales rows [r0, r1) of src in one vectorized ConvertTo, then
+// extracts each channel into a pooled plane Mat and copies it into inp.
+// ExtractChannel is used instead of gocv.Split because Split allocates
+// three fresh Mats on every call.
+func (b *bandMats) convert(src gocv.Mat, r0, r1, size int, inp []float32) error {
+	band := src.Region(image.Rect(0, r0, size, r1))
+	defer band.Close()
+	band.ConvertToWithParams(&b.f32, gocv.MatTypeCV32FC3, 1.0/255.0, 0)
+
+	off := r0 * size
+	n := (r1 - r0) * size
+	for c := range b.planes {
+		gocv.ExtractChannel(b.f32, &b.planes[c], c)
+		plane, err := b.planes[c].DataPtrFloat32()
+		if err != nil {
+			return fmt.Errorf("plane %d rows %d-%d: %w", c, r0, r1, err)
+		}
+		start := c*size*size + off
+		copy(inp[start:start+n], plane)
+	}
+	return nil
+}
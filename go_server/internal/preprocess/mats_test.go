@@ -0,0 +1,63 @@
+//go:build !nocv
+
+package preprocess
+
+import (
+	"math"
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+func TestMatsInput(t *testing.T) {
+	p := NewMats()
+	defer p.Close()
+
+	tests := []struct {
+		name           string
+		rows, cols     int
+		size           int
+		scaleX, scaleY float32
+	}{
+		{"downscale", 720, 1280, 640, 2, 1.125},
+		{"upscale", 240, 320, 640, 0.5, 0.375},
+		{"square", 640, 640, 640, 1, 1},
+		{"smaller input", 480, 640, 320, 2, 1.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// B=255, G=0, R=51: planes 1, 0 and 0.2 in BGR order.
+			bgr := gocv.NewScalar(255, 0, 51, 0)
+			img := gocv.NewMatWithSizeFromScalar(bgr, tt.rows, tt.cols, gocv.MatTypeCV8UC3)
+			defer img.Close()
+			inp := make([]float32, 3*tt.size*tt.size)
+
+			scaleX, scaleY, err := p.Input(img, inp, tt.size)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if scaleX != tt.scaleX || scaleY != tt.scaleY {
+				t.Errorf("scale = %v, %v, want %v, %v", scaleX, scaleY, tt.scaleX, tt.scaleY)
+			}
+			plane := tt.size * tt.size
+			for c, want := range []float32{1, 0, 0.2} {
+				// First, middle and last pixel of each plane.
+				for _, i := range []int{0, plane / 2, plane - 1} {
+					if got := inp[c*plane+i]; math.Abs(float64(got-want)) > 1e-6 {
+						t.Fatalf("plane %d pixel %d = %v, want %v", c, i, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestMatsInputBufferSize(t *testing.T) {
+	p := NewMats()
+	defer p.Close()
+	img := gocv.NewMatWithSize(480, 640, gocv.MatTypeCV8UC3)
+	defer img.Close()
+	if _, _, err := p.Input(img, make([]float32, 3*320*320), 640); err == nil {
+		t.Error("Input accepted a buffer for another size")
+	}
+}
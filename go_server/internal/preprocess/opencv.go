@@ -0,0 +1,67 @@
+//go:build !nocv
+
+package preprocess
+
+import (
+	"bytes"
+	"fmt"
+
+	"gocv.io/x/gocv"
+	"golang.org/x/image/webp"
+)
+
+// Decode decodes b into dst as 8-bit BGR. flags is gocv.IMReadColor,
+// optionally combined with gocv.IMReadIgnoreOrientation.
+func Decode(b []byte, dst *gocv.Mat, flags gocv.IMReadFlag) error {
+	if err := gocv.IMDecodeIntoMat(b, flags, dst); err == nil && !dst.Empty() {
+		return nil
+	}
+
+	switch sniffFormat(b) {
+	case formatWebP:
+		return decodeWebP(b, dst)
+	case formatAVIF:
+		return fmt.Errorf("%w: avif is not supported by this OpenCV build", ErrDecode)
+	}
+	return ErrDecode
+}
+
+// decodeWebP is the pure-Go fallback for OpenCV builds without libwebp.
+func decodeWebP(b []byte, dst *gocv.Mat) error {
+	img, err := webp.Decode(bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("%w: webp: %v", ErrDecode, err)
+	}
+	m, err := gocv.ImageToMatRGB(img) // despite the name, produces BGR
+	if err != nil {
+		return fmt.Errorf("%w: webp: %v", ErrDecode, err)
+	}
+	defer m.Close()
+	m.CopyTo(dst)
+	return nil
+}
+
+// ApplyOrientation writes src turned upright according to EXIF orientation
+// o into dst. Orientation 1 (or unknown) is a plain copy.
+func ApplyOrientation(src gocv.Mat, dst *gocv.Mat, o int) {
+	switch o {
+	case 2:
+		gocv.Flip(src, dst, 1)
+	case 3:
+		gocv.Rotate(src, dst, gocv.Rotate180Clockwise)
+	case 4:
+		gocv.Flip(src, dst, 0)
+	case 5: // transpose
+		gocv.Rotate(src, dst, gocv.Rotate90Clockwise)
+		gocv.Flip(*dst, dst, 1)
+	case 6:
+		gocv.Rotate(src, dst, gocv.Rotate90Clockwise)
+	case 7: // transverse
+		gocv.Rotate(src, dst, gocv.Rotate90Clockwise)
+		gocv.Flip(*dst, dst, 0)
+	case 8:
+		gocv.Rotate(src, dst, gocv.Rotate90CounterClockwise)
+	default:
+		src.CopyTo(dst)
+	}
+}
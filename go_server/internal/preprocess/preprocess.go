@@ -0,0 +1,11 @@
+// Package preprocess turns encoded frames into the model's input tensor:
+// decoding (with EXIF and WebP handling), resizing and CHW conversion.
+//
+// Everything that needs OpenCV is excluded by the nocv build tag, which
+// leaves the constants and pure-Go helpers for builds without gocv.
+package preprocess
+
+const (
+	InputSize = 640                   // default; other sizes need a model exported with dynamic H×W
+	PlaneSize = InputSize * InputSize // 640×640
+)
@@ -0,0 +1,101 @@
+package preprocess
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+
+	"golang.org/x/image/webp"
+)
+
+// ── 가림 처리 ────────────────────────────────────────────────────────────────
+// Frames that leave the server as images (event snapshots, notifications,
+// session recordings) are redacted in Go so it works in a nocv build too:
+// privacy zones are painted black and the boxes of blurred classes are
+// pixelated. Coordinates are in the frame's stored pixels; EXIF orientation
+// is not applied, as for stream frames. PNG stays PNG; everything else
+// comes back as JPEG, since there is no pure-Go WebP encoder.
+
+const (
+	redactQuality = 90
+	// PixelCells is how many cells a pixelated box has across its longer
+	// side; the video encoder uses it too.
+	PixelCells = 8
+)
+
+// Redact returns b with every mask zone painted black and every blur box
+// pixelated.
+func Redact(b []byte, mask, blur []image.Rectangle) ([]byte, error) {
+	img, format, err := decodeRGBA(b)
+	if err != nil {
+		return nil, err
+	}
+	redact(img, mask, blur)
+	var out bytes.Buffer
+	if format == formatPNG {
+		err = png.Encode(&out, img)
+	} else {
+		err = jpeg.Encode(&out, img, &jpeg.Options{Quality: redactQuality})
+	}
+	return out.Bytes(), err
+}
+
+// decodeRGBA decodes a JPEG, PNG or WebP frame in Go.
+func decodeRGBA(b []byte) (*image.RGBA, string, error) {
+	var src image.Image
+	var err error
+	format := sniffFormat(b)
+	switch format {
+	case formatJPEG:
+		src, err = jpeg.Decode(bytes.NewReader(b))
+	case formatPNG:
+		src, err = png.Decode(bytes.NewReader(b))
+	case formatWebP:
+		src, err = webp.Decode(bytes.NewReader(b))
+	default:
+		return nil, "", fmt.Errorf("%w: not JPEG, PNG or WebP", ErrDecode)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrDecode, err)
+	}
+	img := image.NewRGBA(image.Rect(0, 0, src.Bounds().Dx(), src.Bounds().Dy()))
+	draw.Draw(img, img.Bounds(), src, src.Bounds().Min, draw.Src)
+	return img, format, nil
+}
+
+func redact(img *image.RGBA, mask, blur []image.Rectangle) {
+	for _, r := range blur {
+		pixelate(img, r.Intersect(img.Bounds()))
+	}
+	for _, z := range mask {
+		draw.Draw(img, z, image.Black, image.Point{}, draw.Src)
+	}
+}
+
+// PixelSize is the cell edge that pixelates r in PixelCells cells.
+func PixelSize(r image.Rectangle) int {
+	return max(max(r.Dx(), r.Dy())/PixelCells, 1)
+}
+
+// pixelate fills each cell of r with its average colour.
+func pixelate(img *image.RGBA, r image.Rectangle) {
+	n := PixelSize(r)
+	for y := r.Min.Y; y < r.Max.Y; y += n {
+		for x := r.Min.X; x < r.Max.X; x += n {
+			cell := image.Rect(x, y, x+n, y+n).Intersect(r)
+			var sr, sg, sb, k int
+			for cy := cell.Min.Y; cy < cell.Max.Y; cy++ {
+				for cx := cell.Min.X; cx < cell.Max.X; cx++ {
+					c := img.RGBAAt(cx, cy)
+					sr, sg, sb, k = sr+int(c.R), sg+int(c.G), sb+int(c.B), k+1
+				}
+			}
+			avg := color.RGBA{uint8(sr / k), uint8(sg / k), uint8(sb / k), 255}
+			draw.Draw(img, cell, image.NewUniform(avg), image.Point{}, draw.Src)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package preprocess
+
+import "image"
+
+// ── 타일 추론 ────────────────────────────────────────────────────────────────
+// Tiled (SAHI-style) inference: a large frame is cut into overlapping tiles
+// that are each fed to the model at full 640×640 resolution, so distant
+// objects keep enough pixels to be detected.
+
+// TileRects covers area with size×size tiles whose neighbours overlap by
+// the given fraction. Edge tiles are shifted inward rather than shrunk, so
+// every tile has the same scale. Returns nil if area fits in one tile.
+func TileRects(area image.Rectangle, size int, overlap float64) []image.Rectangle {
+	if area.Dx() <= size && area.Dy() <= size {
+		return nil
+	}
+	stride := int(float64(size) * (1 - overlap))
+	if stride < 1 {
+		stride = 1
+	}
+	xs := tileStarts(area.Min.X, area.Dx(), size, stride)
+	ys := tileStarts(area.Min.Y, area.Dy(), size, stride)
+	out := make([]image.Rectangle, 0, len(xs)*len(ys))
+	for _, y := range ys {
+		for _, x := range xs {
+			out = append(out, image.Rect(x, y, x+size, y+size).Intersect(area))
+		}
+	}
+	return out
+}
+
+func tileStarts(origin, length, size, stride int) []int {
+	if length <= size {
+		return []int{origin}
+	}
+	var starts []int
+	for off := 0; ; off += stride {
+		if off+size >= length {
+			starts = append(starts, origin+length-size)
+			return starts
+		}
+		starts = append(starts, origin+off)
+	}
+}
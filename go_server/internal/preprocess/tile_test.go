@@ -0,0 +1,78 @@
+package preprocess
+
+import (
+	"image"
+	"reflect"
+	"testing"
+)
+
+func TestTileRects(t *testing.T) {
+	tests := []struct {
+		name    string
+		area    image.Rectangle
+		size    int
+		overlap float64
+		want    []image.Rectangle
+	}{
+		{
+			name: "fits in one tile",
+			area: image.Rect(0, 0, 640, 480),
+			size: 640,
+		},
+		{
+			name:    "two tiles across, last shifted inward",
+			area:    image.Rect(0, 0, 1000, 640),
+			size:    640,
+			overlap: 0.2,
+			want:    []image.Rectangle{image.Rect(0, 0, 640, 640), image.Rect(360, 0, 1000, 640)},
+		},
+		{
+			name:    "grid over an offset area",
+			area:    image.Rect(100, 50, 300, 250),
+			size:    128,
+			overlap: 0.5,
+			want: []image.Rectangle{
+				image.Rect(100, 50, 228, 178), image.Rect(164, 50, 292, 178), image.Rect(172, 50, 300, 178),
+				image.Rect(100, 114, 228, 242), image.Rect(164, 114, 292, 242), image.Rect(172, 114, 300, 242),
+				image.Rect(100, 122, 228, 250), image.Rect(164, 122, 292, 250), image.Rect(172, 122, 300, 250),
+			},
+		},
+		{
+			name:    "narrow strip is clipped to the area",
+			area:    image.Rect(0, 0, 1280, 100),
+			size:    640,
+			overlap: 0,
+			want:    []image.Rectangle{image.Rect(0, 0, 640, 100), image.Rect(640, 0, 1280, 100)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := TileRects(tt.area, tt.size, tt.overlap)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("TileRects = %v, want %v", got, tt.want)
+			}
+			for _, r := range got {
+				if !r.In(tt.area) {
+					t.Errorf("tile %v leaves the area %v", r, tt.area)
+				}
+			}
+		})
+	}
+}
+
+func TestTileRectsCoverArea(t *testing.T) {
+	area := image.Rect(0, 0, 1920, 1080)
+	tiles := TileRects(area, 640, 0.25)
+	for y := area.Min.Y; y < area.Max.Y; y += 7 {
+		for x := area.Min.X; x < area.Max.X; x += 7 {
+			p := image.Pt(x, y)
+			covered := false
+			for _, r := range tiles {
+				covered = covered || p.In(r)
+			}
+			if !covered {
+				t.Fatalf("%v is in no tile of %v", p, tiles)
+			}
+		}
+	}
+}
@@ -0,0 +1,147 @@
+// Package recording stores /ws/stream sessions on disk: every frame a
+// client sent, the stream settings in effect for it, and the response the
+// server returned. cmd/replay feeds a recording back through the pipeline.
+//
+// File layout: the magic "YOLOREC1", then one record per frame:
+//
+//	uint32 header length | JSON Entry header | uint32 frame length | frame
+//
+// Lengths are big-endian.
+package recording
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	magic    = "YOLOREC1"
+	maxFrame = 64 << 20 // sanity bound when reading
+)
+
+// Entry is one recorded frame.
+type Entry struct {
+	Time     time.Time       `json:"time"`
+	ROI      []int           `json:"roi,omitempty"`  // x1, y1, x2, y2; absent = whole frame
+	Mask     [][]int         `json:"mask,omitempty"` // privacy zones as ROI; Frame is stored masked
+	Tile     bool            `json:"tile,omitempty"`
+	TTA      bool            `json:"tta,omitempty"`
+	ImgSz    int             `json:"imgsz,omitempty"`  // model input size; absent = default
+	Conf     float64         `json:"conf,omitempty"`   // adaptive threshold floor; absent = conf_threshold
+	Margin   float64         `json:"margin,omitempty"` // adaptive threshold margin; absent = off
+	Fields   []string        `json:"fields,omitempty"` // detection keys answered; absent = all
+	Response json.RawMessage `json:"response"`         // exactly as sent to the client
+	Frame    []byte          `json:"-"`
+}
+
+// ── 쓰기 ─────────────────────────────────────────────────────────────────────
+
+type Writer struct {
+	f *os.File
+	w *bufio.Writer
+}
+
+// Create truncates or creates path and writes the file header.
+func Create(path string) (*Writer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := &Writer{f: f, w: bufio.NewWriter(f)}
+	if _, err := w.w.WriteString(magic); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *Writer) Write(e *Entry) error {
+	header, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(header)))
+	w.w.Write(n[:])
+	w.w.Write(header)
+	binary.BigEndian.PutUint32(n[:], uint32(len(e.Frame)))
+	w.w.Write(n[:])
+	_, err = w.w.Write(e.Frame) // bufio keeps the first error; this reports it
+	return err
+}
+
+func (w *Writer) Close() error {
+	err := w.w.Flush()
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// ── 읽기 ─────────────────────────────────────────────────────────────────────
+
+type Reader struct {
+	f *os.File
+	r *bufio.Reader
+}
+
+func Open(path string) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &Reader{f: f, r: bufio.NewReader(f)}
+	var m [len(magic)]byte
+	if _, err := io.ReadFull(r.r, m[:]); err != nil || string(m[:]) != magic {
+		f.Close()
+		return nil, fmt.Errorf("%s: not a recording", path)
+	}
+	return r, nil
+}
+
+// Next returns the next entry, or io.EOF after the last one. A file cut
+// off mid-record (the server was killed) ends with io.ErrUnexpectedEOF.
+func (r *Reader) Next() (*Entry, error) {
+	header, err := r.chunk()
+	if err != nil {
+		return nil, err
+	}
+	var e Entry
+	if err := json.Unmarshal(header, &e); err != nil {
+		return nil, fmt.Errorf("record header: %w", err)
+	}
+	if e.Frame, err = r.chunk(); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (r *Reader) chunk() ([]byte, error) {
+	var n [4]byte
+	if _, err := io.ReadFull(r.r, n[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(n[:])
+	if size > maxFrame {
+		return nil, fmt.Errorf("record of %d bytes exceeds limit", size)
+	}
+	b := make([]byte, size)
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return b, nil
+}
+
+func (r *Reader) Close() error { return r.f.Close() }
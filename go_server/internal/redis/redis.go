@@ -0,0 +1,266 @@
+// Package redis is a minimal Redis client: the server only reads and writes
+// a few small values, which does not justify pulling in a full client.
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ── RESP ─────────────────────────────────────────────────────────────────────
+// Commands go out as RESP arrays of bulk strings on pooled connections, one
+// command per round trip. A connection that fails or times out mid-command
+// is closed rather than returned to the pool, so a late reply can never be
+// read as the answer to the next command.
+
+const (
+	maxIdle     = 8
+	dialTimeout = 2 * time.Second
+	opTimeout   = time.Second // when ctx has no deadline
+)
+
+// ErrNil is returned by Get for a key that does not exist.
+var ErrNil = errors.New("redis: nil")
+
+// Error is an error reply from the server.
+type Error string
+
+func (e Error) Error() string { return "redis: " + string(e) }
+
+type conn struct {
+	c  net.Conn
+	br *bufio.Reader
+}
+
+// Client is safe for concurrent use.
+type Client struct {
+	addr     string
+	user     string
+	password string
+	db       int
+	idle     chan *conn
+}
+
+// New parses redis://[user:password@]host[:port][/db] and returns a client
+// for it; connections are made on first use.
+func New(rawURL string) (*Client, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "redis" || u.Host == "" {
+		return nil, fmt.Errorf("want redis://host:port[/db], got %q", rawURL)
+	}
+	c := &Client{addr: u.Host, idle: make(chan *conn, maxIdle)}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		c.user = u.User.Username()
+		c.password, _ = u.User.Password()
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if c.db, err = strconv.Atoi(db); err != nil || c.db < 0 {
+			return nil, fmt.Errorf("bad database %q", db)
+		}
+	}
+	return c, nil
+}
+
+// Close closes the idle connections.
+func (c *Client) Close() error {
+	for {
+		select {
+		case cn := <-c.idle:
+			cn.c.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.do(ctx, "PING")
+	return err
+}
+
+// Get returns the value of key, or ErrNil.
+func (c *Client) Get(ctx context.Context, key string) ([]byte, error) {
+	return c.bulk(ctx, "GET", key)
+}
+
+// GetDel is Get that also deletes key (Redis 6.2+), so only one caller
+// gets the value.
+func (c *Client) GetDel(ctx context.Context, key string) ([]byte, error) {
+	return c.bulk(ctx, "GETDEL", key)
+}
+
+func (c *Client) bulk(ctx context.Context, cmd, key string) ([]byte, error) {
+	v, err := c.do(ctx, cmd, key)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, ErrNil
+	}
+	b, ok := v.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("redis: %s: unexpected reply %T", cmd, v)
+	}
+	return b, nil
+}
+
+// Set stores val under key, expiring after ttl; 0 keeps it for good.
+func (c *Client) Set(ctx context.Context, key string, val []byte, ttl time.Duration) error {
+	args := []any{"SET", key, val}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	_, err := c.do(ctx, args...)
+	return err
+}
+
+func (c *Client) Del(ctx context.Context, key string) error {
+	_, err := c.do(ctx, "DEL", key)
+	return err
+}
+
+// do runs one command. Replies are nil, int64, string (status), []byte
+// (bulk) or []any; an error reply is returned as Error.
+func (c *Client) do(ctx context.Context, args ...any) (any, error) {
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(opTimeout)
+	}
+	_ = cn.c.SetDeadline(deadline)
+	v, err := cn.roundTrip(args)
+	var rerr Error
+	if err != nil && !errors.As(err, &rerr) {
+		cn.c.Close()
+		return nil, err
+	}
+	c.put(cn)
+	return v, err
+}
+
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	select {
+	case cn := <-c.idle:
+		return cn, nil
+	default:
+	}
+	ctx, cancel := context.WithTimeout(ctx, dialTimeout)
+	defer cancel()
+	nc, err := (&net.Dialer{}).DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, err
+	}
+	cn := &conn{c: nc, br: bufio.NewReader(nc)}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = nc.SetDeadline(deadline)
+	}
+	if c.password != "" {
+		auth := []any{"AUTH", c.password}
+		if c.user != "" {
+			auth = []any{"AUTH", c.user, c.password}
+		}
+		if _, err := cn.roundTrip(auth); err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+	if c.db != 0 {
+		if _, err := cn.roundTrip([]any{"SELECT", strconv.Itoa(c.db)}); err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+	return cn, nil
+}
+
+func (c *Client) put(cn *conn) {
+	select {
+	case c.idle <- cn:
+	default:
+		cn.c.Close()
+	}
+}
+
+func (cn *conn) roundTrip(args []any) (any, error) {
+	buf := fmt.Appendf(nil, "*%d\r\n", len(args))
+	for _, a := range args {
+		var b []byte
+		switch a := a.(type) {
+		case string:
+			b = []byte(a)
+		case []byte:
+			b = a
+		default:
+			panic(fmt.Sprintf("redis: argument of type %T", a))
+		}
+		buf = fmt.Appendf(buf, "$%d\r\n", len(b))
+		buf = append(append(buf, b...), "\r\n"...)
+	}
+	if _, err := cn.c.Write(buf); err != nil {
+		return nil, err
+	}
+	return cn.read()
+}
+
+func (cn *conn) read() (any, error) {
+	line, err := cn.br.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+	kind, rest := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return rest, nil
+	case '-':
+		return nil, Error(rest)
+	case ':':
+		return strconv.ParseInt(rest, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(rest)
+		if err != nil || n < 0 {
+			return nil, err // $-1 is nil
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(cn.br, b); err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	case '*':
+		n, err := strconv.Atoi(rest)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		out := make([]any, n)
+		for i := range out {
+			// An error inside an array still consumes its element.
+			v, err := cn.read()
+			var rerr Error
+			if err != nil && !errors.As(err, &rerr) {
+				return nil, err
+			}
+			out[i] = v
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("redis: unknown reply type %q", kind)
+}
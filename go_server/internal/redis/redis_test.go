@@ -0,0 +1,218 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name    string
+		reply   string
+		want    any
+		wantErr string
+	}{
+		{"status", "+OK\r\n", "OK", ""},
+		{"error", "-ERR wrong type\r\n", nil, "redis: ERR wrong type"},
+		{"integer", ":42\r\n", int64(42), ""},
+		{"negative integer", ":-3\r\n", int64(-3), ""},
+		{"bulk", "$5\r\nhello\r\n", []byte("hello"), ""},
+		{"bulk with CRLF inside", "$4\r\na\r\nb\r\n", []byte("a\r\nb"), ""},
+		{"empty bulk", "$0\r\n\r\n", []byte{}, ""},
+		{"nil bulk", "$-1\r\n", nil, ""},
+		{"array", "*3\r\n:1\r\n$1\r\nx\r\n$-1\r\n", []any{int64(1), []byte("x"), nil}, ""},
+		{"array with error", "*2\r\n-ERR no\r\n:2\r\n", []any{nil, int64(2)}, ""},
+		{"nested array", "*1\r\n*1\r\n+a\r\n", []any{[]any{"a"}}, ""},
+		{"nil array", "*-1\r\n", nil, ""},
+		{"missing CR", "+OK\n", nil, "malformed reply"},
+		{"unknown type", "!1\r\n", nil, "unknown reply type"},
+		{"bad integer", ":x\r\n", nil, "invalid syntax"},
+		{"short bulk", "$5\r\nhel", nil, "unexpected EOF"},
+		{"truncated", "+OK", nil, "EOF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cn := &conn{br: bufio.NewReader(strings.NewReader(tt.reply))}
+			got, err := cn.read()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("read(%q) error = %v, want %q", tt.reply, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("read(%q): %v", tt.reply, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("read(%q) = %#v, want %#v", tt.reply, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		url                  string
+		addr, user, password string
+		db                   int
+		wantErr              bool
+	}{
+		{url: "redis://cache", addr: "cache:6379"},
+		{url: "redis://cache:6380/2", addr: "cache:6380", db: 2},
+		{url: "redis://:secret@cache", addr: "cache:6379", password: "secret"},
+		{url: "redis://app:secret@[::1]:7000/0", addr: "[::1]:7000", user: "app", password: "secret"},
+		{url: "rediss://cache", wantErr: true},
+		{url: "redis://", wantErr: true},
+		{url: "redis://cache/x", wantErr: true},
+		{url: "redis://cache/-1", wantErr: true},
+	}
+	for _, tt := range tests {
+		c, err := New(tt.url)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("New(%q) succeeded, want an error", tt.url)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("New(%q): %v", tt.url, err)
+			continue
+		}
+		if c.addr != tt.addr || c.user != tt.user || c.password != tt.password || c.db != tt.db {
+			t.Errorf("New(%q) = %s %q:%q db %d, want %s %q:%q db %d", tt.url,
+				c.addr, c.user, c.password, c.db, tt.addr, tt.user, tt.password, tt.db)
+		}
+	}
+}
+
+// fakeServer answers GET, GETDEL, SET, DEL, PING, AUTH and SELECT from a
+// map, recording every command it is sent.
+type fakeServer struct {
+	ln net.Listener
+
+	mu   sync.Mutex
+	data map[string]string
+	cmds []string
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("no loopback listener: %v", err)
+	}
+	s := &fakeServer{ln: ln, data: map[string]string{}}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(nc)
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) serve(nc net.Conn) {
+	defer nc.Close()
+	cn := &conn{c: nc, br: bufio.NewReader(nc)}
+	for {
+		v, err := cn.read()
+		if err != nil {
+			return
+		}
+		var args []string
+		for _, a := range v.([]any) {
+			args = append(args, string(a.([]byte)))
+		}
+		s.mu.Lock()
+		s.cmds = append(s.cmds, strings.Join(args, " "))
+		var reply string
+		switch strings.ToUpper(args[0]) {
+		case "PING":
+			reply = "+PONG\r\n"
+		case "AUTH", "SELECT":
+			reply = "+OK\r\n"
+		case "SET":
+			s.data[args[1]] = args[2]
+			reply = "+OK\r\n"
+		case "GET", "GETDEL":
+			val, ok := s.data[args[1]]
+			if ok {
+				reply = "$" + strconv.Itoa(len(val)) + "\r\n" + val + "\r\n"
+			} else {
+				reply = "$-1\r\n"
+			}
+			if args[0] == "GETDEL" {
+				delete(s.data, args[1])
+			}
+		case "DEL":
+			delete(s.data, args[1])
+			reply = ":1\r\n"
+		default:
+			reply = "-ERR unknown command '" + args[0] + "'\r\n"
+		}
+		s.mu.Unlock()
+		if _, err := nc.Write([]byte(reply)); err != nil {
+			return
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	s := newFakeServer(t)
+	c, err := New("redis://app:pw@" + s.ln.Addr().String() + "/3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := c.Ping(ctx); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	if _, err := c.Get(ctx, "k"); !errors.Is(err, ErrNil) {
+		t.Fatalf("Get of a missing key = %v, want ErrNil", err)
+	}
+	if err := c.Set(ctx, "k", []byte("v\r\n1"), 1500*time.Millisecond); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if b, err := c.Get(ctx, "k"); err != nil || string(b) != "v\r\n1" {
+		t.Fatalf("Get = %q, %v; want the stored value", b, err)
+	}
+	if b, err := c.GetDel(ctx, "k"); err != nil || string(b) != "v\r\n1" {
+		t.Fatalf("GetDel = %q, %v; want the stored value", b, err)
+	}
+	if _, err := c.GetDel(ctx, "k"); !errors.Is(err, ErrNil) {
+		t.Fatalf("second GetDel = %v, want ErrNil", err)
+	}
+	if err := c.Del(ctx, "k"); err != nil {
+		t.Fatalf("Del: %v", err)
+	}
+	var rerr Error
+	if _, err := c.do(ctx, "FLUSHALL"); !errors.As(err, &rerr) {
+		t.Fatalf("unknown command = %v, want an Error reply", err)
+	}
+	if err := c.Ping(ctx); err != nil {
+		t.Fatalf("Ping after an error reply: %v", err) // the connection is still usable
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	want := []string{"AUTH app pw", "SELECT 3", "PING", "GET k", "SET k v\r\n1 PX 1500",
+		"GET k", "GETDEL k", "GETDEL k", "DEL k", "FLUSHALL", "PING"}
+	if !reflect.DeepEqual(s.cmds, want) {
+		t.Errorf("server saw %q, want %q", s.cmds, want)
+	}
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"log/slog"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"yolo-server/internal/preprocess"
+)
+
+// ── 적응형 품질 ──────────────────────────────────────────────────────────────
+// When ADAPTIVE_QUEUE_DEPTH or ADAPTIVE_P95 is set, a controller checks the
+// load sample (load.go) every loadInterval. Over target it lowers the quality level by one step; after adaptiveCalm
+// quiet intervals it raises it again. The first steps cap the model input
+// size at each smaller INPUT_SIZES entry (dynamic-shape models only), the
+// remaining ones make streams skip 1, 2, … frames after each inferred one,
+// answered like frames dropped by ?every=/?fps= sampling. Stream clients are
+// sent {"quality": {...}} whenever their level changes.
+
+const adaptiveCalm = 3 // quiet intervals before raising the level again
+
+// quality is the degradation in effect. The zero value is full quality.
+type quality struct {
+	Level int `json:"level"`
+	ImgSz int `json:"imgsz,omitempty"` // input size cap; 0 = none
+	Skip  int `json:"skip,omitempty"`  // frames skipped after each inferred one
+}
+
+// inputSize applies the cap to a stream's requested size (0 = default).
+func (q quality) inputSize(requested int) int {
+	if requested == 0 {
+		requested = preprocess.InputSize
+	}
+	if q.ImgSz > 0 && q.ImgSz < requested {
+		return q.ImgSz
+	}
+	return requested
+}
+
+type adaptive struct {
+	queueTarget int
+	p95Target   time.Duration
+	ladder      []int // input sizes below the default, largest first
+	maxSkip     int
+
+	cur  atomic.Pointer[quality]
+	calm int // quiet ticks in a row; load monitor goroutine only
+}
+
+// newAdaptive returns nil when neither target is set.
+func newAdaptive(cfg Config) *adaptive {
+	if cfg.AdaptiveQueueDepth == 0 && cfg.AdaptiveP95 == 0 {
+		return nil
+	}
+	a := &adaptive{queueTarget: cfg.AdaptiveQueueDepth, p95Target: cfg.AdaptiveP95, maxSkip: cfg.AdaptiveMaxSkip}
+	for _, n := range cfg.InputSizes {
+		if n < preprocess.InputSize {
+			a.ladder = append(a.ladder, n)
+		}
+	}
+	slices.Sort(a.ladder)
+	slices.Reverse(a.ladder)
+	a.cur.Store(&quality{})
+	return a
+}
+
+// current is the quality to serve now. Safe on a nil controller.
+func (a *adaptive) current() quality {
+	if a == nil {
+		return quality{}
+	}
+	return *a.cur.Load()
+}
+
+// overloaded reports whether ls is over either target.
+func (a *adaptive) overloaded(ls loadSample) bool {
+	return (a.queueTarget > 0 && ls.depth > a.queueTarget) || (a.p95Target > 0 && ls.p95 > a.p95Target)
+}
+
+func (a *adaptive) tick(ls loadSample) {
+	depth, p95 := ls.depth, ls.p95
+	over := a.overloaded(ls)
+	// Hysteresis: only count as quiet well below both targets.
+	quiet := (a.queueTarget == 0 || depth <= a.queueTarget/2) && (a.p95Target == 0 || p95 < a.p95Target*7/10)
+
+	level := a.current().Level
+	switch {
+	case over:
+		a.calm = 0
+		if level < len(a.ladder)+a.maxSkip {
+			level++
+		}
+	case quiet && level > 0:
+		if a.calm++; a.calm >= adaptiveCalm {
+			a.calm = 0
+			level--
+		}
+	default:
+		a.calm = 0
+	}
+	if level == a.current().Level {
+		return
+	}
+	q := a.qualityAt(level)
+	a.cur.Store(&q)
+	slog.Info("quality level changed", "level", q.Level, "imgsz", q.ImgSz, "skip", q.Skip,
+		"inflight", depth, "p95", p95)
+}
+
+func (a *adaptive) qualityAt(level int) quality {
+	q := quality{Level: level}
+	if level == 0 {
+		return q
+	}
+	if len(a.ladder) > 0 {
+		q.ImgSz = a.ladder[min(level, len(a.ladder))-1]
+	}
+	q.Skip = max(level-len(a.ladder), 0)
+	return q
+}
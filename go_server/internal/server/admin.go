@@ -0,0 +1,132 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"yolo-server/internal/inference"
+)
+
+// ── 관리 API ─────────────────────────────────────────────────────────────────
+// /admin/* endpoints change server state at runtime. They are only mounted
+// when ADMIN_TOKEN is set, and require "Authorization: Bearer <token>".
+// Every change is written to the log as an audit entry.
+
+func (s *Server) requireAdmin(next http.HandlerFunc) http.Handler {
+	token := []byte(s.cfg.AdminToken)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		presented, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(presented), token) != 1 {
+			writeJSONError(w, http.StatusUnauthorized, "admin token required")
+			return
+		}
+		next(w, r)
+	})
+}
+
+func (s *Server) registerAdmin(mux *http.ServeMux) {
+	if s.cfg.AdminToken == "" {
+		return
+	}
+	mux.Handle("GET /admin/ip-filter", s.requireAdmin(s.adminGetIPFilter))
+	mux.Handle("PUT /admin/ip-filter", s.requireAdmin(s.adminPutIPFilter))
+	mux.Handle("GET /admin/config", s.requireAdmin(s.adminGetConfig))
+	mux.Handle("PATCH /admin/config", s.requireAdmin(s.adminPatchConfig))
+	mux.Handle("GET /admin/connections", s.requireAdmin(s.adminListConnections))
+	mux.Handle("DELETE /admin/connections/{id}", s.requireAdmin(s.adminCloseConnection))
+	mux.Handle("GET /admin/memory", s.requireAdmin(s.adminMemory))
+	mux.Handle("GET /admin/gpu", s.requireAdmin(s.adminGPU))
+	mux.Handle("GET /admin/tenants", s.requireAdmin(s.adminTenants))
+	mux.Handle("GET /admin/models", s.requireAdmin(s.adminModels))
+	mux.Handle("POST /admin/score-calibration/fit", s.requireAdmin(s.adminFitCalibration))
+	mux.Handle("POST /admin/evaluate", s.requireAdmin(s.adminEvaluate))
+	mux.Handle("POST /admin/models/{tenant}/pin", s.requireAdmin(s.adminPinModel))
+	mux.Handle("DELETE /admin/models/{tenant}/pin", s.requireAdmin(s.adminUnpinModel))
+	mux.Handle("GET /admin/workers", s.requireAdmin(s.adminWorkers))
+	mux.Handle("GET /admin/videos", s.requireAdmin(s.adminVideos))
+	mux.Handle("GET /admin/videos/{name}", s.requireAdmin(s.adminGetVideo))
+	mux.Handle("DELETE /admin/videos/{name}", s.requireAdmin(s.adminDeleteVideo))
+	mux.Handle("GET /admin/events", s.requireAdmin(anyEvents(s.listEvents)))
+	mux.Handle("GET /admin/events/{id}", s.requireAdmin(anyEvents(s.getEvent)))
+	mux.Handle("POST /admin/events/{id}/ack", s.requireAdmin(anyEvents(s.ackEvent)))
+	mux.Handle("GET /admin/events/{id}/snapshot", s.requireAdmin(anyEvents(s.eventSnapshot)))
+	mux.Handle("GET /admin/events/{id}/clip", s.requireAdmin(anyEvents(s.eventClip)))
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (s *Server) adminGetIPFilter(w http.ResponseWriter, _ *http.Request) {
+	r := s.ipFilter.get()
+	if r == nil {
+		r = &ipRules{}
+	}
+	writeJSON(w, http.StatusOK, r)
+}
+
+// adminPutIPFilter replaces both lists. Body: {"allow": [...], "deny": [...]}
+// with CIDRs or bare addresses; an omitted list is cleared.
+func (s *Server) adminPutIPFilter(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Allow []string `json:"allow"`
+		Deny  []string `json:"deny"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	allow, err := parsePrefixes(body.Allow)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "allow: "+err.Error())
+		return
+	}
+	deny, err := parsePrefixes(body.Deny)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "deny: "+err.Error())
+		return
+	}
+	rules := &ipRules{Allow: allow, Deny: deny}
+	s.ipFilter.set(rules)
+	slog.Info("admin: ip filter updated", "remote", s.clientIP(r), "allow", allow, "deny", deny)
+	writeJSON(w, http.StatusOK, rules)
+}
+
+func (s *Server) adminListConnections(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"connections": s.conns.list(s.cfg.LatencySLO)})
+}
+
+func (s *Server) adminCloseConnection(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid connection id")
+		return
+	}
+	c := s.conns.get(id)
+	if c == nil {
+		writeJSONError(w, http.StatusNotFound, "no such connection")
+		return
+	}
+	c.close("closed by administrator")
+	slog.Info("admin: connection closed", "remote", s.clientIP(r), "id", id, "conn_remote", c.remote, "key", c.key)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// workerPool is the BACKEND=workers detector.
+type workerPool interface {
+	Workers() []inference.WorkerStatus
+}
+
+func (s *Server) adminWorkers(w http.ResponseWriter, _ *http.Request) {
+	workers := []inference.WorkerStatus{}
+	if d, ok := s.det.(workerPool); ok {
+		workers = d.Workers()
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"workers": workers})
+}
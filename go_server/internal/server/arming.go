@@ -0,0 +1,294 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ── 경비 모드 ────────────────────────────────────────────────────────────────
+// Every stream is in an arming mode, named as Home Assistant's alarm
+// panel: disarmed, armed_home, armed_away or armed_night. A disarmed
+// stream's frames are answered as skipped without inference. In the
+// armed modes events are raised for the classes ARM_CLASSES gives the
+// mode, or for all of EVENT_CLASSES. A stream is in ARM_DEFAULT unless its
+// arming is set, per credential and stream name (?stream= id or conn<id>):
+//
+//	PUT  /streams/{id}/arming      {"mode": ..., "schedule": [...]}
+//	POST /streams/{id}/arming/set  {"mode": ...}
+//	GET  /streams/{id}/arming
+//
+// The schedule is a list of weekly windows, {"days": ["mon", ...], "from":
+// "22:00", "to": "06:30", "mode": ...}, in server local time; the first
+// window that covers the moment gives the mode, and "mode" applies outside
+// them. A window past midnight belongs to the day it starts on. A set mode,
+// through the API or MQTT, overrides the schedule until it next changes
+// window. A stream whose mode is not ARM_DEFAULT, or stops being, is told
+// {"arming": mode} with its next frame. Arming is kept in memory; MQTT
+// commands reach every replica, the API only the one it hits.
+
+const (
+	armDisarmed  = "disarmed"
+	armHome      = "armed_home"
+	armAway      = "armed_away"
+	armNight     = "armed_night"
+	maxArmWindow = 32
+)
+
+var armModes = []string{armDisarmed, armHome, armAway, armNight}
+
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+func validArmMode(m string) bool { return slices.Contains(armModes, m) }
+
+// parseArmClasses reads ARM_CLASSES, "mode=class+class,...".
+func parseArmClasses(v string, eventClasses []string) (map[string][]string, error) {
+	if len(eventClasses) == 0 {
+		return nil, fmt.Errorf("needs EVENT_CLASSES")
+	}
+	m := map[string][]string{}
+	for _, rule := range strings.Split(v, ",") {
+		mode, classes, ok := strings.Cut(strings.TrimSpace(rule), "=")
+		switch {
+		case !ok || classes == "":
+			return nil, fmt.Errorf("want mode=class[+class...], got %q", rule)
+		case !validArmMode(mode) || mode == armDisarmed:
+			return nil, fmt.Errorf("mode: want armed_home, armed_away or armed_night, got %q", mode)
+		}
+		for _, c := range strings.Split(classes, "+") {
+			if !slices.Contains(eventClasses, c) {
+				return nil, fmt.Errorf("%q is not in EVENT_CLASSES", c)
+			}
+			if !slices.Contains(m[mode], c) {
+				m[mode] = append(m[mode], c)
+			}
+		}
+	}
+	return m, nil
+}
+
+type armWindow struct {
+	Days []string `json:"days,omitempty"` // empty = every day
+	From string   `json:"from"`           // "15:04"
+	To   string   `json:"to"`
+	Mode string   `json:"mode"`
+
+	from, to int // minutes into the day
+}
+
+// parse validates w and fills in from and to.
+func (w *armWindow) parse() error {
+	for _, t := range []struct {
+		s  string
+		to *int
+	}{{w.From, &w.from}, {w.To, &w.to}} {
+		at, err := time.Parse("15:04", t.s)
+		if err != nil {
+			return fmt.Errorf("want HH:MM, got %q", t.s)
+		}
+		*t.to = at.Hour()*60 + at.Minute()
+	}
+	for _, d := range w.Days {
+		if !slices.Contains(weekdays, d) {
+			return fmt.Errorf("day: want one of %s, got %q", strings.Join(weekdays, ", "), d)
+		}
+	}
+	if !validArmMode(w.Mode) {
+		return fmt.Errorf("mode: want one of %s, got %q", strings.Join(armModes, ", "), w.Mode)
+	}
+	return nil
+}
+
+// covers reports whether w holds at t. from == to is the whole day.
+func (w *armWindow) covers(t time.Time) bool {
+	m, day := t.Hour()*60+t.Minute(), int(t.Weekday())
+	switch {
+	case w.from == w.to:
+	case w.from < w.to:
+		if m < w.from || m >= w.to {
+			return false
+		}
+	case m >= w.from:
+	case m < w.to:
+		day = (day + 6) % 7 // the window started yesterday
+	default:
+		return false
+	}
+	return len(w.Days) == 0 || slices.Contains(w.Days, weekdays[day])
+}
+
+type arming struct {
+	Mode     string      `json:"mode,omitempty"` // outside the schedule; "" = ARM_DEFAULT
+	Schedule []armWindow `json:"schedule,omitempty"`
+
+	override    string // set mode; "" = none
+	overrideWin int    // the window it was set in; -1 = none
+}
+
+// window is the index of the window covering t, or -1.
+func (a *arming) window(t time.Time) int {
+	for i := range a.Schedule {
+		if a.Schedule[i].covers(t) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (a *arming) mode(t time.Time, def string) string {
+	w := a.window(t)
+	switch {
+	case a.override != "" && a.overrideWin == w:
+		return a.override
+	case w >= 0:
+		return a.Schedule[w].Mode
+	case a.Mode != "":
+		return a.Mode
+	}
+	return def
+}
+
+type armingStore struct {
+	def     string
+	classes map[string][]string // ARM_CLASSES, event classes by mode
+
+	mu      sync.Mutex
+	streams map[string]*arming // by armKey
+	changed func(client, stream string)
+}
+
+func armKey(client, stream string) string { return client + "\x00" + stream }
+
+// mode is the stream's mode at t.
+func (as *armingStore) mode(client, stream string, t time.Time) string {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	if a := as.streams[armKey(client, stream)]; a != nil {
+		return a.mode(t, as.def)
+	}
+	return as.def
+}
+
+// raises reports whether class raises events in mode.
+func (as *armingStore) raises(mode, class string) bool {
+	if mode == armDisarmed {
+		return false
+	}
+	classes, ok := as.classes[mode]
+	return !ok || slices.Contains(classes, class)
+}
+
+// configure replaces the stream's mode and schedule, dropping an override.
+func (as *armingStore) configure(client, stream string, a *arming) {
+	as.mu.Lock()
+	as.streams[armKey(client, stream)] = a
+	as.mu.Unlock()
+	as.notify(client, stream)
+}
+
+// set overrides the stream's mode until its schedule changes window.
+func (as *armingStore) set(client, stream, mode string) {
+	as.mu.Lock()
+	a := as.streams[armKey(client, stream)]
+	if a == nil {
+		a = &arming{}
+		as.streams[armKey(client, stream)] = a
+	}
+	a.override, a.overrideWin = mode, a.window(time.Now())
+	as.mu.Unlock()
+	as.notify(client, stream)
+}
+
+func (as *armingStore) notify(client, stream string) {
+	if as.changed != nil {
+		as.changed(client, stream)
+	}
+}
+
+// ── API ──────────────────────────────────────────────────────────────────────
+
+type armingView struct {
+	arming
+	Override  string `json:"override,omitempty"`
+	Effective string `json:"effective"`
+}
+
+func (s *Server) getArming(w http.ResponseWriter, r *http.Request) {
+	client, stream, ok := armTarget(w, r)
+	if !ok {
+		return
+	}
+	as := s.arming
+	now := time.Now()
+	as.mu.Lock()
+	v := armingView{Effective: as.def}
+	if a := as.streams[armKey(client, stream)]; a != nil {
+		v.arming, v.Effective = *a, a.mode(now, as.def)
+		if a.overrideWin == a.window(now) {
+			v.Override = a.override
+		}
+	}
+	as.mu.Unlock()
+	writeJSON(w, http.StatusOK, v)
+}
+
+func (s *Server) putArming(w http.ResponseWriter, r *http.Request) {
+	client, stream, ok := armTarget(w, r)
+	if !ok {
+		return
+	}
+	var a arming
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&a); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if a.Mode != "" && !validArmMode(a.Mode) {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("mode: want one of %s, got %q", strings.Join(armModes, ", "), a.Mode))
+		return
+	}
+	if len(a.Schedule) > maxArmWindow {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("schedule: at most %d windows", maxArmWindow))
+		return
+	}
+	for i := range a.Schedule {
+		if err := a.Schedule[i].parse(); err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("schedule[%d]: %v", i, err))
+			return
+		}
+	}
+	s.arming.configure(client, stream, &a)
+	s.getArming(w, r)
+}
+
+func (s *Server) setArming(w http.ResponseWriter, r *http.Request) {
+	client, stream, ok := armTarget(w, r)
+	if !ok {
+		return
+	}
+	var body struct {
+		Mode string `json:"mode"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&body); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if !validArmMode(body.Mode) {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("mode: want one of %s, got %q", strings.Join(armModes, ", "), body.Mode))
+		return
+	}
+	s.arming.set(client, stream, body.Mode)
+	s.getArming(w, r)
+}
+
+func armTarget(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	id := r.PathValue("id")
+	if !validStreamID(id) {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("stream: want 1..%d of [A-Za-z0-9._-], got %q", maxStreamID, id))
+		return "", "", false
+	}
+	return clientLabel(r), id, true
+}
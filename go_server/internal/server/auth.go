@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// ── 인증 ─────────────────────────────────────────────────────────────────────
+// Two credentials are accepted, either of which admits a request:
+//   - API keys, configured as API_KEYS="name:key,name:key", from the
+//     X-API-Key header or the ?key= query parameter;
+//   - JWTs verified against JWT_JWKS_URL (see jwt.go), from an
+//     "Authorization: Bearer" header or the ?access_token= query parameter.
+//
+// Query parameters exist for browser WebSocket clients, which cannot set
+// headers. With neither configured, every request is accepted as before,
+// and so is every request on a LISTEN listener marked noauth.
+
+type apiKey struct {
+	name string
+	key  []byte
+}
+
+type ctxKey int
+
+const (
+	ctxKeyName  ctxKey = iota // string: API key name, or "jwt:<sub>"
+	ctxListener               // *listenSpec the request arrived on
+	ctxTenant                 // *tenant the credential belongs to
+)
+
+func parseAPIKeys(raw string) ([]apiKey, error) {
+	var keys []apiKey
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, key, ok := strings.Cut(entry, ":")
+		if !ok || name == "" || key == "" {
+			return nil, fmt.Errorf("API_KEYS: want name:key, got %q", entry)
+		}
+		keys = append(keys, apiKey{name: name, key: []byte(key)})
+	}
+	return keys, nil
+}
+
+// lookupKey returns the name of the key matching presented. Every
+// configured key is compared in constant time so timing reveals nothing.
+func (s *Server) lookupKey(presented string) (string, bool) {
+	p := []byte(presented)
+	name, found := "", false
+	for _, k := range s.cfg.APIKeys {
+		if subtle.ConstantTimeCompare(p, k.key) == 1 {
+			name, found = k.name, true
+		}
+	}
+	return name, found
+}
+
+// requireAuth rejects requests without a valid credential with 401 before
+// they reach next — for /ws/stream this is before the upgrade handshake.
+func (s *Server) requireAuth(next http.Handler) http.Handler {
+	if len(s.cfg.APIKeys) == 0 && s.jwt == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if l := listenerOf(r); l != nil && l.noAuth {
+			next.ServeHTTP(w, r)
+			return
+		}
+		name, err := s.authenticate(r)
+		if err != nil {
+			slog.Warn("auth rejected", "path", r.URL.Path, "remote", r.RemoteAddr, "err", err)
+			writeJSONError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		ctx := context.WithValue(r.Context(), ctxKeyName, name)
+		if t := s.tenantKeys[name]; t != nil {
+			ctx = context.WithValue(ctx, ctxTenant, t)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (s *Server) authenticate(r *http.Request) (string, error) {
+	if len(s.cfg.APIKeys) > 0 {
+		presented := r.Header.Get("X-API-Key")
+		if presented == "" {
+			presented = r.URL.Query().Get("key")
+		}
+		if presented != "" {
+			if name, ok := s.lookupKey(presented); ok {
+				return name, nil
+			}
+			return "", errors.New("invalid API key")
+		}
+	}
+	if s.jwt != nil {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			token = r.URL.Query().Get("access_token")
+		}
+		if token != "" {
+			claims, err := s.jwt.verify(r.Context(), token)
+			if err != nil {
+				return "", err
+			}
+			return "jwt:" + claims.Sub, nil
+		}
+	}
+	return "", errors.New("missing credentials")
+}
+
+// keyName returns the API key name attached by requireAuth, or "".
+func keyName(r *http.Request) string {
+	name, _ := r.Context().Value(ctxKeyName).(string)
+	return name
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// ── 배치 메시지 ──────────────────────────────────────────────────────────────
+// A gateway with many small frames to send can pack up to maxBatchFrames
+// of them into one binary message:
+//
+//	"YBT1" | count uint16 | count × (length uint32 | frame)
+//
+// integers big-endian. Each frame is what a message would otherwise hold,
+// a capture stamp (e2e.go) included. The frames are the stream's next
+// frames in order and go through the pipeline like any others: each takes
+// a credit, is sampled, inferred and tracked, and at most ?inflight= of them
+// run at once. Their answers are held back until the last one is ready and
+// then sent in one text message, {"batch": [<answer>, ...]}, in the order
+// they were released. A batch that does not parse is refused whole.
+
+const (
+	batchMagic     = "YBT1"
+	maxBatchFrames = 256
+)
+
+// isBatch reports whether a binary message is a batch.
+func isBatch(data []byte) bool {
+	return len(data) >= len(batchMagic) && string(data[:len(batchMagic)]) == batchMagic
+}
+
+// splitBatch returns a batch's frames, which share data's memory.
+func splitBatch(data []byte) ([][]byte, error) {
+	data = data[len(batchMagic):]
+	if len(data) < 2 {
+		return nil, fmt.Errorf("batch: truncated header")
+	}
+	n := int(binary.BigEndian.Uint16(data))
+	data = data[2:]
+	if n == 0 || n > maxBatchFrames {
+		return nil, fmt.Errorf("batch: want 1..%d frames, got %d", maxBatchFrames, n)
+	}
+	frames := make([][]byte, n)
+	for i := range frames {
+		if len(data) < 4 {
+			return nil, fmt.Errorf("batch: frame %d: truncated header", i)
+		}
+		size := binary.BigEndian.Uint32(data)
+		data = data[4:]
+		if size == 0 || uint64(size) > uint64(len(data)) {
+			return nil, fmt.Errorf("batch: frame %d: length %d exceeds the message", i, size)
+		}
+		frames[i], data = data[:size], data[size:]
+	}
+	if len(data) > 0 {
+		return nil, fmt.Errorf("batch: %d bytes after the last frame", len(data))
+	}
+	return frames, nil
+}
+
+// batchAnswer collects the answers of one batch.
+type batchAnswer struct {
+	left int // frames not yet released
+	buf  *bytes.Buffer
+}
+
+// queuedFrame is a frame of a batch waiting for an inflight slot.
+type queuedFrame struct {
+	data  []byte
+	batch *batchAnswer
+}
+
+// batch queues a batch's frames; run feeds them to frame as slots free up.
+func (p *pipeline) batch(data []byte) error {
+	frames, err := splitBatch(data)
+	if err != nil {
+		return p.WriteJSON(wsError{Error: err.Error(), Code: "bad_batch"})
+	}
+	b := &batchAnswer{left: len(frames), buf: p.buffer()}
+	b.buf.WriteString(`{"batch":[`)
+	for _, f := range frames {
+		p.queued = append(p.queued, queuedFrame{data: f, batch: b})
+	}
+	return nil
+}
+
+// collect adds a released answer of a batch, which is nil when a summary
+// took it, and sends the batch once it is complete.
+func (p *pipeline) collect(b *batchAnswer, buf *bytes.Buffer) error {
+	if buf != nil {
+		if b.buf.Bytes()[b.buf.Len()-1] != '[' {
+			b.buf.WriteByte(',')
+		}
+		b.buf.Write(bytes.TrimRight(buf.Bytes(), "\n"))
+		p.s.bufPool.Put(buf)
+	}
+	if b.left--; b.left > 0 {
+		return nil
+	}
+	b.buf.WriteString("]}")
+	return p.enqueue(b.buf)
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// batchMsg builds a batch of frames with count declared separately, so
+// tests can lie about it.
+func batchMsg(count int, frames ...[]byte) []byte {
+	b := binary.BigEndian.AppendUint16([]byte(batchMagic), uint16(count))
+	for _, f := range frames {
+		b = binary.BigEndian.AppendUint32(b, uint32(len(f)))
+		b = append(b, f...)
+	}
+	return b
+}
+
+func TestSplitBatch(t *testing.T) {
+	a, b := []byte("frame-a"), []byte("b")
+	full := make([][]byte, maxBatchFrames)
+	for i := range full {
+		full[i] = []byte{byte(i)}
+	}
+	tests := []struct {
+		name string
+		data []byte
+		want [][]byte // nil = error
+	}{
+		{"one frame", batchMsg(1, a), [][]byte{a}},
+		{"two frames", batchMsg(2, a, b), [][]byte{a, b}},
+		{"maxBatchFrames", batchMsg(maxBatchFrames, full...), full},
+		{"magic only", []byte(batchMagic), nil},
+		{"truncated count", append([]byte(batchMagic), 0), nil},
+		{"count 0", batchMsg(0), nil},
+		{"count 257", batchMsg(maxBatchFrames+1, append(full, []byte{1})...), nil},
+		{"fewer frames than count", batchMsg(2, a), nil},
+		{"truncated frame header", append(batchMsg(1), 0, 0, 1), nil},
+		{"zero-length frame", batchMsg(2, a, []byte{}), nil},
+		{"length past the end", batchMsg(1, a)[:len(batchMsg(1, a))-1], nil},
+		{"length of 4 GiB", binary.BigEndian.AppendUint32(batchMsg(1), 0xFFFFFFFF), nil},
+		{"trailing bytes", append(batchMsg(1, a), 'x'), nil},
+		{"more frames than count", batchMsg(1, a, b), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !isBatch(tt.data) {
+				t.Fatal("isBatch = false")
+			}
+			got, err := splitBatch(tt.data)
+			if tt.want == nil {
+				if err == nil {
+					t.Errorf("splitBatch = %d frames, want an error", len(got))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitBatch = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsBatch(t *testing.T) {
+	for _, data := range [][]byte{nil, []byte("YBT"), []byte("\xff\xd8\xff\xe0"), []byte("YST1x")} {
+		if isBatch(data) {
+			t.Errorf("isBatch(%q) = true", data)
+		}
+	}
+}
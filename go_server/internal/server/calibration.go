@@ -0,0 +1,135 @@
+package server
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sync"
+
+	"yolo-server/internal/calib"
+	"yolo-server/internal/postprocess"
+)
+
+// ── 카메라 보정 ──────────────────────────────────────────────────────────────
+// A calibrated stream's detections carry where they stand on the ground
+// plane, "ground": [x, y] in metres, and, when the camera's position is
+// known, their "distance" from it: the middle of the box's bottom edge,
+// mapped through the stream's calibration (internal/calib). Streams are
+// calibrated by CALIBRATION_FILE, by stream id, or per credential and
+// stream through the API, which takes precedence:
+//
+//	PUT    /streams/{id}/calibration  {"homography": ...} or {"intrinsics": ..., "pose": ...}
+//	GET    /streams/{id}/calibration
+//	DELETE /streams/{id}/calibration
+//
+// The ground attributes are set before POSTPROCESS runs, so expressions can
+// fence areas in metres. API calibrations are kept in memory.
+
+type calibrationStore struct {
+	file calib.Cameras
+
+	mu      sync.Mutex
+	streams map[string]*calib.Camera // by armKey
+}
+
+func newCalibrationStore(cfg Config) *calibrationStore {
+	return &calibrationStore{file: cfg.Calibration, streams: map[string]*calib.Camera{}}
+}
+
+// lookup is the stream's calibration, nil if it has none.
+func (cs *calibrationStore) lookup(client, stream string) *calib.Camera {
+	if stream == "" {
+		return nil
+	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if c := cs.streams[armKey(client, stream)]; c != nil {
+		return c
+	}
+	return cs.file[stream]
+}
+
+// locate sets the ground attributes of dets from the stream's calibration.
+func (cs *calibrationStore) locate(client, stream string, dets []postprocess.Detection) {
+	cam := cs.lookup(client, stream)
+	if cam == nil {
+		return
+	}
+	for i := range dets {
+		gx, gy, ok := cam.Ground(groundPoint(dets[i]))
+		if !ok {
+			continue
+		}
+		dist, _ := cam.Distance(gx, gy)
+		dets[i].SetAttributes(func(a *postprocess.Attributes) {
+			a.Ground = &[2]float64{roundCm(gx), roundCm(gy)}
+			a.Distance = roundCm(dist)
+		})
+	}
+}
+
+// groundPoint is where d stands: the middle of its box's bottom edge.
+func groundPoint(d postprocess.Detection) (float64, float64) {
+	return float64(d.Box[0]+d.Box[2]) / 2, float64(d.Box[3])
+}
+
+func roundCm(m float64) float64 { return math.Round(m*100) / 100 }
+
+// ── API ──────────────────────────────────────────────────────────────────────
+
+type calibrationView struct {
+	*calib.Camera
+	Source string `json:"source"` // "api" or "file"
+}
+
+func (s *Server) getCalibration(w http.ResponseWriter, r *http.Request) {
+	client, stream, ok := armTarget(w, r)
+	if !ok {
+		return
+	}
+	cs := s.calibration
+	cs.mu.Lock()
+	v := calibrationView{Camera: cs.streams[armKey(client, stream)], Source: "api"}
+	cs.mu.Unlock()
+	if v.Camera == nil {
+		v = calibrationView{Camera: cs.file[stream], Source: "file"}
+	}
+	if v.Camera == nil {
+		writeJSONError(w, http.StatusNotFound, "stream is not calibrated")
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+func (s *Server) putCalibration(w http.ResponseWriter, r *http.Request) {
+	client, stream, ok := armTarget(w, r)
+	if !ok {
+		return
+	}
+	var c calib.Camera
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<12)).Decode(&c); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if err := c.Prepare(); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.calibration.mu.Lock()
+	s.calibration.streams[armKey(client, stream)] = &c
+	s.calibration.mu.Unlock()
+	writeJSON(w, http.StatusOK, calibrationView{Camera: &c, Source: "api"})
+}
+
+// deleteCalibration drops the API calibration; CALIBRATION_FILE's, if
+// any, applies again.
+func (s *Server) deleteCalibration(w http.ResponseWriter, r *http.Request) {
+	client, stream, ok := armTarget(w, r)
+	if !ok {
+		return
+	}
+	s.calibration.mu.Lock()
+	delete(s.calibration.streams, armKey(client, stream))
+	s.calibration.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
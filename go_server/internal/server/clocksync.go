@@ -0,0 +1,95 @@
+package server
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ── 시계 동기화 ──────────────────────────────────────────────────────────────
+// Capture stamps (e2e.go) are on the client's clock. A client can let the
+// server learn how far off that clock is with an NTP-style exchange of text
+// messages, all times in microseconds since the Unix epoch:
+//
+//	client → {"sync": {"t0": <client send>}}
+//	server → {"sync": {"t0": …, "t1": <server receipt>, "t2": <server send>}}
+//	client → {"sync": {"t0": …, "t1": …, "t2": …, "t3": <client receipt>}}
+//	server → {"sync": {"offset_us": θ, "rtt_us": δ, "samples": n}}
+//
+// θ = ((t1−t0) + (t2−t3)) / 2 is how far the server's clock is ahead of the
+// client's, and δ = (t3−t0) − (t2−t1) the round trip, which bounds θ's
+// error by δ/2. The stream keeps its last clockSamples rounds and uses the
+// θ of the one with the shortest round trip. From the first round on,
+// capture stamps are moved onto the server's clock before latencies are
+// measured, and events raised on a stamped frame carry its capture time.
+
+const clockSamples = 8
+
+// syncMsg is the "sync" member of a text message.
+type syncMsg struct {
+	T0 *int64 `json:"t0"`
+	T1 *int64 `json:"t1,omitempty"`
+	T2 *int64 `json:"t2,omitempty"`
+	T3 *int64 `json:"t3,omitempty"`
+}
+
+// syncResult answers a completed round.
+type syncResult struct {
+	OffsetUS int64 `json:"offset_us"`
+	RTTUS    int64 `json:"rtt_us"`
+	Samples  int   `json:"samples"`
+}
+
+// clockSync is a stream's estimate of its client's clock. The pipeline's
+// goroutine alone uses it.
+type clockSync struct {
+	rounds [clockSamples]struct{ offset, rtt time.Duration }
+	n      int
+	next   int
+	offset time.Duration // server − client, of the best round
+	rtt    time.Duration
+}
+
+// add takes a round and picks the best of those kept.
+func (cs *clockSync) add(offset, rtt time.Duration) {
+	cs.rounds[cs.next].offset, cs.rounds[cs.next].rtt = offset, rtt
+	cs.next = (cs.next + 1) % clockSamples
+	cs.n = min(cs.n+1, clockSamples)
+	best := 0
+	for i := 1; i < cs.n; i++ {
+		if cs.rounds[i].rtt < cs.rounds[best].rtt {
+			best = i
+		}
+	}
+	cs.offset, cs.rtt = cs.rounds[best].offset, cs.rounds[best].rtt
+}
+
+// correct moves a capture stamp onto the server's clock.
+func (cs *clockSync) correct(captured time.Time) time.Time {
+	if captured.IsZero() {
+		return captured
+	}
+	return captured.Add(cs.offset)
+}
+
+// sync handles the "sync" member of a text message received at at.
+func (p *pipeline) sync(raw json.RawMessage, at time.Time) error {
+	var m syncMsg
+	if err := json.Unmarshal(raw, &m); err != nil || m.T0 == nil {
+		return p.WriteJSON(wsError{Error: "sync: want {\"t0\": <microseconds>}", Code: "bad_control"})
+	}
+	if m.T1 == nil || m.T2 == nil || m.T3 == nil {
+		t1 := at.UnixMicro()
+		t2 := time.Now().UnixMicro()
+		return p.WriteJSON(map[string]syncMsg{"sync": {T0: m.T0, T1: &t1, T2: &t2}})
+	}
+	t0, t1, t2, t3 := *m.T0, *m.T1, *m.T2, *m.T3
+	rtt := (t3 - t0) - (t2 - t1)
+	if rtt < 0 || t2 < t1 {
+		return p.WriteJSON(wsError{Error: "sync: times out of order", Code: "bad_control"})
+	}
+	p.clock.add(time.Duration((t1-t0)+(t2-t3))*time.Microsecond/2, time.Duration(rtt)*time.Microsecond)
+	p.ci.setClockOffset(p.clock.offset)
+	return p.WriteJSON(map[string]syncResult{"sync": {
+		OffsetUS: p.clock.offset.Microseconds(), RTTUS: p.clock.rtt.Microseconds(), Samples: p.clock.n,
+	}})
+}
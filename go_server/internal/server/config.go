@@ -0,0 +1,1151 @@
+package server
+
+import (
+	"compress/flate"
+	"crypto/ed25519"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"yolo-server/internal/calib"
+	"yolo-server/internal/inference"
+	"yolo-server/internal/postprocess"
+	"yolo-server/internal/preprocess"
+	"yolo-server/internal/track"
+	"yolo-server/internal/video"
+)
+
+// ── 설정 ────────────────────────────────────────────────────────────────────
+// Config is read from the environment once at startup. Every knob has a
+// default that reproduces the previous hard-coded behaviour.
+
+const listenAddr = ":8001"
+
+type Config struct {
+	Addr       string        // $PORT (Cloud Run) or listenAddr
+	DrainDelay time.Duration // DRAIN_DELAY, /readyz fails this long before shutdown
+	ModelPath  string        // MODEL_PATH
+	ModelData  []byte        // ModelPath's verified bytes; nil opens the file
+
+	Backend      string // BACKEND or -backend: "onnxruntime", "triton" or "mock"
+	TritonURL    string // TRITON_URL, e.g. http://triton:8000
+	TritonModel  string // TRITON_MODEL
+	TritonInput  string // TRITON_INPUT, input tensor name
+	TritonOutput string // TRITON_OUTPUT, output tensor name
+
+	WorkerURLs []string // WORKER_URLS, inference workers for BACKEND=workers
+	WorkerKey  string   // WORKER_KEY, API key presented to them
+
+	MockFixtures string        // MOCK_FIXTURES, JSON detections keyed by frame SHA-256
+	MockLatency  time.Duration // MOCK_LATENCY, simulated inference time
+
+	// Checks before a model is loaded (signing.go).
+	ModelSigningKeys   []ed25519.PublicKey // MODEL_SIGNING_KEYS, PEM files
+	ModelRequireSigned bool                // MODEL_REQUIRE_SIGNED
+	ModelLicenses      []string            // MODEL_LICENSES, "license" metadata prefixes
+
+	// TLS: either a cert/key pair or autocert domains; neither = plain HTTP.
+	// HTTPRedirectAddr serves the HTTP→HTTPS redirect (and ACME challenges)
+	// while TLS is on; empty disables that listener.
+	TLSCertFile      string   // TLS_CERT_FILE
+	TLSKeyFile       string   // TLS_KEY_FILE
+	AutocertDomains  []string // TLS_AUTOCERT_DOMAINS, comma-separated
+	AutocertCacheDir string   // TLS_AUTOCERT_CACHE
+	HTTPRedirectAddr string   // HTTP_REDIRECT_ADDR
+
+	Listen []listenSpec // LISTEN; empty = Addr alone (listen.go)
+	H2C    bool         // H2C, cleartext HTTP/2 on the non-TLS listeners
+
+	Origins originAllowlist // CORS_ORIGINS, comma-separated; applies to CORS and WS upgrades
+
+	APIKeys []apiKey // API_KEYS, "name:key,..."
+
+	AdminToken string // ADMIN_TOKEN; empty leaves /admin/* unmounted
+
+	// Initial CIDR lists; replaceable at runtime via PUT /admin/ip-filter.
+	IPAllow []netip.Prefix // IP_ALLOW, comma-separated; empty = allow all
+	IPDeny  []netip.Prefix // IP_DENY, comma-separated
+
+	// Take the client address from X-Real-IP / X-Forwarded-For, but only
+	// on requests whose peer is one of TrustedProxies; anyone else could
+	// write the headers themselves (nginx/default.conf sets X-Real-IP).
+	TrustProxyHeaders bool           // TRUST_PROXY_HEADERS
+	TrustedProxies    []netip.Prefix // TRUSTED_PROXIES, comma-separated; default loopback
+
+	// JWT bearer tokens; an empty JWKS URL disables JWT auth. Issuer and
+	// audience are required with it: providers such as Firebase sign the
+	// tokens of every project with one key set.
+	JWTJWKSURL  string // JWT_JWKS_URL
+	JWTIssuer   string // JWT_ISSUER
+	JWTAudience string // JWT_AUDIENCE
+
+	ConfigFile string // CONFIG_FILE, JSON overrides reloaded on change
+
+	Tenants map[string]TenantConfig // TENANTS_FILE (tenant.go)
+
+	// Tenant models kept loaded vs loaded on demand (standby.go).
+	ModelPreload    []string      // MODEL_PRELOAD, tenant names; nil = all
+	ModelIdleUnload time.Duration // MODEL_IDLE_UNLOAD, 0 = never
+
+	// Session recording for replay; an empty RecordDir disables it.
+	RecordDir  string // RECORD_DIR
+	RecordMode string // RECORD_MODE, "full" or "ring"
+	RecordRing int    // RECORD_RING, frames kept per connection in ring mode
+
+	// Annotated MP4 of streams opened with ?video=1; needs OpenCV. An
+	// empty VideoDir disables it.
+	VideoDir          string        // VIDEO_DIR
+	VideoFPS          float64       // VIDEO_FPS, frame rate of the files
+	VideoCodec        string        // VIDEO_CODEC, FourCC
+	VideoSegment      time.Duration // VIDEO_SEGMENT, longest file; 0 = one per stream
+	VideoSegmentBytes int64         // VIDEO_SEGMENT_BYTES, largest file; 0 = no limit
+
+	// Classes pixelated in every image and video the server emits.
+	BlurClasses []string // BLUR_CLASSES, comma-separated, e.g. "person,face"
+
+	// Live HLS of streams opened with ?hls=1, at VideoFPS; needs OpenCV.
+	// An empty HLSDir disables it.
+	HLSDir      string        // HLS_DIR
+	HLSCodec    string        // HLS_CODEC, FourCC
+	HLSSegment  time.Duration // HLS_SEGMENT, target segment duration
+	HLSListSize int           // HLS_LIST_SIZE, segments in the playlist
+	HLSLinger   time.Duration // HLS_LINGER, kept after the stream ends
+
+	// Events raised by detections of EventClasses; empty disables them.
+	// Clips, at VideoFPS with VideoCodec, need OpenCV.
+	EventClasses  []string          // EVENT_CLASSES, comma-separated class names
+	EventWhen     *postprocess.Expr // EVENT_WHEN, further condition on those detections; nil = any
+	EventCooldown time.Duration     // EVENT_COOLDOWN, per stream and class
+	EventKeep     int               // EVENT_KEEP, events kept in memory
+	EventClipDir  string            // EVENT_CLIP_DIR; empty = no clips
+	EventPreroll  time.Duration     // EVENT_PREROLL, clip before the event
+	EventPostroll time.Duration     // EVENT_POSTROLL, clip after the event
+
+	// Arming modes (arming.go).
+	ArmDefault string              // ARM_DEFAULT, mode of a stream not set otherwise
+	ArmClasses map[string][]string // ARM_CLASSES, e.g. "armed_home=car+dog"; unlisted modes take all of EVENT_CLASSES
+
+	// Event notifications, routed to sinks by class; "*" is any class.
+	EventNotify    map[string][]string // EVENT_NOTIFY, e.g. "person=slack+email,*=telegram"
+	NotifyTemplate string              // NOTIFY_TEMPLATE, text/template over the event
+	NotifySubject  string              // NOTIFY_SUBJECT, mail subject, same
+	SlackWebhook   string              // NOTIFY_SLACK_URL
+	TelegramToken  string              // NOTIFY_TELEGRAM_TOKEN
+	TelegramChat   string              // NOTIFY_TELEGRAM_CHAT
+	SMTPAddr       string              // NOTIFY_SMTP_ADDR, host:port
+	SMTPUser       string              // NOTIFY_SMTP_USER; empty = no login
+	SMTPPassword   string              // NOTIFY_SMTP_PASSWORD
+	SMTPFrom       string              // NOTIFY_SMTP_FROM
+	SMTPTo         []string            // NOTIFY_SMTP_TO, comma-separated
+
+	// Home Assistant MQTT discovery; an empty MQTTURL disables it.
+	MQTTURL             string        // MQTT_URL, mqtt[s]://[user:password@]host[:port]
+	MQTTTopic           string        // MQTT_TOPIC, base of the state topics
+	MQTTDiscoveryPrefix string        // MQTT_DISCOVERY_PREFIX
+	MQTTClasses         []string      // MQTT_CLASSES, comma-separated; default EVENT_CLASSES
+	MQTTOffDelay        time.Duration // MQTT_OFF_DELAY, a sensor stays on this long after its class
+	MQTTStale           time.Duration // MQTT_STALE, a stream is unavailable after this without frames
+
+	LogLevel       slog.Level // LOG_LEVEL
+	LogFormat      string     // LOG_FORMAT, "text" or "json"
+	LogFrames      bool       // LOG_FRAMES, debug line per inferred frame
+	LogSampleBurst int        // LOG_SAMPLE_BURST, warnings/errors per message per second; 0 = all
+
+	ConfThreshold  float64 // CONF_THRESHOLD, minimum score reported
+	MaxConnections int     // MAX_CONNECTIONS, concurrent streams; 0 = unlimited
+
+	// Worker slots and priority classes (sched.go).
+	InferWorkers int                 // INFER_WORKERS, frames at the model at once; 0 = unlimited
+	KeyPriority  map[string]priority // KEY_PRIORITY, "name:batch,..."; unlisted keys are realtime
+
+	// Per-client limits (API key name, else remote IP); zero = unlimited.
+	RateLimitFPS   float64 // RATE_LIMIT_FPS, sustained frames per second
+	RateLimitBurst int     // RATE_LIMIT_BURST, bucket size; default ceil(FPS)
+	FrameQuota     uint64  // FRAME_QUOTA_MONTHLY, frames per calendar month
+
+	// ONNX Runtime session options. Zero thread counts keep ORT's defaults.
+	// The graph optimization level is not exposed by onnxruntime_go v1.14.0,
+	// so ORT's default (all optimizations) always applies.
+	IntraOpThreads int    // ORT_INTRA_OP_THREADS
+	InterOpThreads int    // ORT_INTER_OP_THREADS
+	CPUMemArena    bool   // ORT_CPU_MEM_ARENA; disable on memory-constrained instances
+	MemPattern     bool   // ORT_MEM_PATTERN
+	ORTProvider    string // ORT_PROVIDER, "cpu" or "cuda"
+	ORTDeviceID    int    // ORT_DEVICE_ID, GPU ordinal for the CUDA provider
+
+	// Licence plate reading by a second, OCR model over the crops of
+	// LPRClasses, run in ONNX Runtime; an empty LPRModel disables it.
+	LPRModel       string   // LPR_MODEL
+	LPRClasses     []string // LPR_CLASSES, comma-separated
+	LPRAlphabet    string   // LPR_ALPHABET, the model's characters in class order
+	LPRDecode      string   // LPR_DECODE, "ctc" or "slots"
+	LPRMinScore    float64  // LPR_MIN_SCORE, least confidence reported
+	PlateAllowlist []string // PLATE_ALLOWLIST, comma-separated plates that raise no events
+
+	// Attributes worked out for each detection: the engine names the
+	// colour of ColorClasses, and streams report the motion of tracked
+	// boxes.
+	ColorClasses     []string // COLOR_CLASSES, comma-separated
+	MotionAttributes bool     // MOTION_ATTRIBUTES
+
+	// Ground-plane calibration of streams by id; their detections are
+	// fused per client into one world. Nil without CALIBRATION_FILE.
+	Calibration      calib.Cameras // CALIBRATION_FILE, JSON
+	WorldMergeRadius float64       // WORLD_MERGE_RADIUS, metres within which sightings are one object
+	WorldWindow      time.Duration // WORLD_WINDOW, how long a stream's newest frame counts
+
+	// Detection thumbnails, asked for per stream with ?crops=.
+	CropMaxSize int // CROP_MAX_SIZE, longer side in pixels
+	CropCache   int // CROP_CACHE, ?crops=ref crops kept for GET /crops/{id}
+
+	// Crowd counts, asked for per stream with ?crowd=1: a density map
+	// model run in ONNX Runtime, or without one the detections of
+	// CrowdClass.
+	CrowdModel     string // CROWD_MODEL
+	CrowdNormalize string // CROWD_NORMALIZE, "imagenet" or "none"
+	CrowdClass     string // CROWD_CLASS
+
+	// Searchable gallery of detection crops (gallery.go); an empty
+	// GalleryDir disables it. Crops are described by an embedding model
+	// run in ONNX Runtime, or without one by their colours.
+	GalleryDir      string        // GALLERY_DIR
+	GalleryKeep     int           // GALLERY_KEEP, newest crops kept
+	GalleryInterval time.Duration // GALLERY_INTERVAL, per stream and track, or class without tracks
+	GalleryClasses  []string      // GALLERY_CLASSES, comma-separated; empty = all
+	EmbedModel      string        // EMBED_MODEL
+	EmbedNormalize  string        // EMBED_NORMALIZE, "imagenet" or "none"
+
+	// Retention of stored data by kind (retention.go): "recordings",
+	// "videos", "events" or "gallery". Kinds without either keep all.
+	RetainAge      map[string]time.Duration // RETAIN_AGE, e.g. "recordings=7d,events=720h"
+	RetainBytes    map[string]int64         // RETAIN_BYTES, e.g. "videos=50GiB"
+	RetainInterval time.Duration            // RETAIN_INTERVAL, between sweeps
+
+	// Postprocess runs over every frame's detections, after the detector.
+	Postprocess postprocess.Chain // POSTPROCESS, e.g. "filter?score=0.6;zones?drop=0,0,100,100"
+
+	// permessage-deflate for WebSocket responses. Clients can still opt out
+	// per connection with ?compress=0.
+	WSCompression      bool // WS_COMPRESSION
+	WSCompressionLevel int  // WS_COMPRESSION_LEVEL, flate level -2..9
+
+	// Tiled (SAHI-style) inference, enabled per stream with ?tile=1.
+	TileSize    int     // TILE_SIZE, tile edge in source pixels
+	TileOverlap float64 // TILE_OVERLAP, fraction of TileSize shared by neighbours
+	NMSIoU      float64 // NMS_IOU, same-class IoU above which tile boxes merge
+
+	// Test-time augmentation, enabled per stream/request with ?tta=1.
+	TTAScales []float64 // TTA_SCALES, comma-separated, each in (0, 1]
+	TTAFlip   bool      // TTA_FLIP, add a horizontally mirrored pass
+
+	// Model input sizes clients may pick with ?imgsz=. Anything besides
+	// 640 needs a model exported with dynamic spatial dims.
+	InputSizes []int // INPUT_SIZES, comma-separated multiples of 32
+
+	// Frame sampling defaults; clients override them with ?every=, ?fps=
+	// and ?echo=.
+	StreamEvery int     // STREAM_EVERY, infer every Nth frame
+	StreamFPS   float64 // STREAM_FPS, most frames inferred per second; 0 = all
+	StreamEcho  bool    // STREAM_ECHO, answer skipped frames with extrapolated boxes
+
+	// Adaptive thresholds: with a margin, a stream keeps the boxes within it
+	// of their class's top score, down to the floor, instead of applying
+	// conf_threshold. Clients override the margin with ?conf_margin=.
+	StreamConfMargin float64 // STREAM_CONF_MARGIN, 0 = off
+	StreamConfFloor  float64 // STREAM_CONF_FLOOR
+
+	// STREAM_STABLE, default ?stable=: "K/N" reports an object once it was
+	// seen in K of the last N inferred frames; "" = every box.
+	StreamStable string
+
+	StreamInflight int // STREAM_INFLIGHT, default ?inflight=: frames per stream at the model at once
+
+	LatencySLO time.Duration // LATENCY_SLO, capture→answer target for stamped frames
+
+	FlowCredits int // FLOW_CREDITS, default credit window for ?flow=credit
+
+	MuxMaxStreams int // MUX_MAX_STREAMS, logical streams per ?mux=1 connection
+
+	PollIdleTimeout time.Duration // POLL_IDLE_TIMEOUT, long-poll sessions end after this without requests
+
+	// Spooling of batch long-poll frames that find the queue full
+	// (spool.go); an empty SpoolDir rejects them instead.
+	SpoolDir   string // SPOOL_DIR
+	SpoolBytes int64  // SPOOL_BYTES, server-wide
+
+	// Stream state shared between replicas (shared.go); off without a URL.
+	RedisURL       string        // REDIS_URL, redis://[user:password@]host:port[/db]
+	StreamStateTTL time.Duration // STREAM_STATE_TTL, kept this long after a stream's last write
+
+	ResumeWindow time.Duration // RESUME_WINDOW, how long an ended stream can be resumed; 0 = no tokens
+
+	// Memory ceilings in bytes (mem.go); 0 = none.
+	MemLimit     int64 // MEM_LIMIT, server-wide
+	MemConnLimit int64 // MEM_CONN_LIMIT, per connection or upload
+
+	// Adaptive quality under load; both targets zero disables it.
+	AdaptiveQueueDepth int           // ADAPTIVE_QUEUE_DEPTH, frames in flight
+	AdaptiveP95        time.Duration // ADAPTIVE_P95, inference latency
+	AdaptiveMaxSkip    int           // ADAPTIVE_MAX_SKIP, most frames skipped per inferred one
+
+	// Hung inference watchdog; a zero factor disables it.
+	WatchdogFactor float64       // WATCHDOG_FACTOR, ceiling as a multiple of the median run
+	WatchdogMin    time.Duration // WATCHDOG_MIN, lower bound of the ceiling
+	WatchdogReset  bool          // WATCHDOG_RESET, recreate the ORT session after a hang
+}
+
+// LoadConfig reads Config from the environment.
+func LoadConfig() (Config, error) {
+	cfg := Config{
+		Addr:      listenAddr,
+		ModelPath: "model/yolo26n.onnx",
+
+		Backend:      "onnxruntime",
+		TritonModel:  "yolo",
+		TritonInput:  "images",
+		TritonOutput: "output0",
+
+		RecordMode: recordRing,
+		RecordRing: 300,
+
+		VideoFPS:     10,
+		VideoCodec:   "mp4v",
+		VideoSegment: 5 * time.Minute,
+		HLSCodec:     "avc1",
+		HLSSegment:   2 * time.Second,
+		HLSListSize:  6,
+		HLSLinger:    30 * time.Second,
+
+		EventCooldown: 30 * time.Second,
+		EventKeep:     1000,
+		EventPreroll:  5 * time.Second,
+		EventPostroll: 10 * time.Second,
+
+		ArmDefault: armAway,
+
+		NotifyTemplate: `{{.Class}} on {{.Stream}} at {{.Time.Format "2006-01-02 15:04:05 MST"}}, score {{printf "%.2f" .Score}}`,
+		NotifySubject:  `{{.Class}} on {{.Stream}}`,
+
+		MQTTTopic:           "yolo",
+		MQTTDiscoveryPrefix: "homeassistant",
+		MQTTOffDelay:        5 * time.Second,
+		MQTTStale:           10 * time.Second,
+
+		ConfThreshold: 0.4,
+
+		LPRAlphabet: "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+		LPRDecode:   "ctc",
+		LPRMinScore: 0.5,
+
+		WorldMergeRadius: 1,
+		WorldWindow:      time.Second,
+
+		LogFormat:      "text",
+		LogSampleBurst: 10,
+
+		AutocertCacheDir: "autocert-cache",
+		HTTPRedirectAddr: ":80",
+
+		CPUMemArena: true,
+		MemPattern:  true,
+
+		WSCompressionLevel: flate.BestSpeed,
+
+		TileSize:    preprocess.InputSize,
+		TileOverlap: 0.2,
+		NMSIoU:      0.5,
+
+		TTAScales: []float64{1, 0.83, 0.67},
+		TTAFlip:   true,
+
+		InputSizes: []int{preprocess.InputSize},
+
+		StreamEvery: 1,
+		StreamEcho:  true,
+
+		StreamConfFloor: 0.05,
+
+		StreamInflight: 1,
+
+		LatencySLO: 150 * time.Millisecond,
+
+		FlowCredits: 4,
+
+		MuxMaxStreams: 32,
+
+		PollIdleTimeout: time.Minute,
+
+		StreamStateTTL: 10 * time.Minute,
+
+		ResumeWindow: 2 * time.Minute,
+
+		WatchdogFactor: 10,
+		WatchdogMin:    5 * time.Second,
+
+		AdaptiveMaxSkip: 3,
+	}
+	// Cloud Run injects $PORT (typically 8080); fall back to the default.
+	if port := os.Getenv("PORT"); port != "" {
+		cfg.Addr = ":" + strings.TrimPrefix(port, ":")
+	}
+
+	cfg.ModelPath = envString("MODEL_PATH", cfg.ModelPath)
+
+	cfg.TLSCertFile = os.Getenv("TLS_CERT_FILE")
+	cfg.TLSKeyFile = os.Getenv("TLS_KEY_FILE")
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return cfg, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	for _, d := range strings.Split(os.Getenv("TLS_AUTOCERT_DOMAINS"), ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			cfg.AutocertDomains = append(cfg.AutocertDomains, d)
+		}
+	}
+	if cfg.TLSCertFile != "" && len(cfg.AutocertDomains) > 0 {
+		return cfg, fmt.Errorf("set either TLS_CERT_FILE/TLS_KEY_FILE or TLS_AUTOCERT_DOMAINS, not both")
+	}
+	cfg.AutocertCacheDir = envString("TLS_AUTOCERT_CACHE", cfg.AutocertCacheDir)
+	cfg.HTTPRedirectAddr = envString("HTTP_REDIRECT_ADDR", cfg.HTTPRedirectAddr)
+
+	origins := os.Getenv("CORS_ORIGINS")
+	if origins == "" {
+		origins = "*"
+	}
+	cfg.Origins = parseOrigins(origins)
+
+	var err error
+	if cfg.Listen, err = parseListen(os.Getenv("LISTEN")); err != nil {
+		return cfg, err
+	}
+	if cfg.H2C, err = envBool("H2C", false); err != nil {
+		return cfg, err
+	}
+	for _, l := range cfg.Listen {
+		if l.tls && cfg.TLSCertFile == "" && len(cfg.AutocertDomains) == 0 {
+			return cfg, fmt.Errorf("LISTEN: %s has tls but neither TLS_CERT_FILE nor TLS_AUTOCERT_DOMAINS is set", l)
+		}
+	}
+
+	cfg.TritonURL = os.Getenv("TRITON_URL")
+	cfg.TritonModel = envString("TRITON_MODEL", cfg.TritonModel)
+	cfg.TritonInput = envString("TRITON_INPUT", cfg.TritonInput)
+	cfg.TritonOutput = envString("TRITON_OUTPUT", cfg.TritonOutput)
+	for _, u := range strings.Split(os.Getenv("WORKER_URLS"), ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			if !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+				return cfg, fmt.Errorf("WORKER_URLS: want http(s) base URLs, got %q", u)
+			}
+			cfg.WorkerURLs = append(cfg.WorkerURLs, u)
+		}
+	}
+	cfg.WorkerKey = os.Getenv("WORKER_KEY")
+	cfg.MockFixtures = os.Getenv("MOCK_FIXTURES")
+	if cfg.MockLatency, err = envDuration("MOCK_LATENCY", 0); err != nil {
+		return cfg, err
+	}
+	if v := os.Getenv("MODEL_SIGNING_KEYS"); v != "" {
+		if cfg.ModelSigningKeys, err = loadSigningKeys(strings.Split(v, ",")); err != nil {
+			return cfg, fmt.Errorf("MODEL_SIGNING_KEYS: %w", err)
+		}
+	}
+	if cfg.ModelRequireSigned, err = envBool("MODEL_REQUIRE_SIGNED", false); err != nil {
+		return cfg, err
+	}
+	if cfg.ModelRequireSigned && len(cfg.ModelSigningKeys) == 0 {
+		return cfg, fmt.Errorf("MODEL_REQUIRE_SIGNED: set MODEL_SIGNING_KEYS")
+	}
+	for _, l := range strings.Split(os.Getenv("MODEL_LICENSES"), ",") {
+		if l = strings.TrimSpace(l); l != "" {
+			cfg.ModelLicenses = append(cfg.ModelLicenses, l)
+		}
+	}
+	if err := cfg.SetBackend(envString("BACKEND", cfg.Backend)); err != nil {
+		return cfg, err
+	}
+	if cfg.APIKeys, err = parseAPIKeys(os.Getenv("API_KEYS")); err != nil {
+		return cfg, err
+	}
+	cfg.AdminToken = os.Getenv("ADMIN_TOKEN")
+	if cfg.IPAllow, err = parsePrefixes(strings.Split(os.Getenv("IP_ALLOW"), ",")); err != nil {
+		return cfg, fmt.Errorf("IP_ALLOW: %w", err)
+	}
+	if cfg.IPDeny, err = parsePrefixes(strings.Split(os.Getenv("IP_DENY"), ",")); err != nil {
+		return cfg, fmt.Errorf("IP_DENY: %w", err)
+	}
+	if cfg.TrustProxyHeaders, err = envBool("TRUST_PROXY_HEADERS", false); err != nil {
+		return cfg, err
+	}
+	if cfg.TrustedProxies, err = parsePrefixes(strings.Split(envString("TRUSTED_PROXIES", "127.0.0.0/8,::1"), ",")); err != nil {
+		return cfg, fmt.Errorf("TRUSTED_PROXIES: %w", err)
+	}
+	cfg.JWTJWKSURL = os.Getenv("JWT_JWKS_URL")
+	cfg.JWTIssuer = os.Getenv("JWT_ISSUER")
+	cfg.JWTAudience = os.Getenv("JWT_AUDIENCE")
+	if cfg.JWTJWKSURL != "" && (cfg.JWTIssuer == "" || cfg.JWTAudience == "") {
+		return cfg, fmt.Errorf("JWT_JWKS_URL needs JWT_ISSUER and JWT_AUDIENCE")
+	}
+	if cfg.DrainDelay, err = envDuration("DRAIN_DELAY", 0); err != nil {
+		return cfg, err
+	}
+	cfg.ConfigFile = os.Getenv("CONFIG_FILE")
+	cfg.RecordDir = os.Getenv("RECORD_DIR")
+	switch cfg.RecordMode = envString("RECORD_MODE", cfg.RecordMode); cfg.RecordMode {
+	case recordFull, recordRing:
+	default:
+		return cfg, fmt.Errorf("RECORD_MODE: want full or ring, got %q", cfg.RecordMode)
+	}
+	if cfg.RecordRing, err = envInt("RECORD_RING", cfg.RecordRing); err != nil {
+		return cfg, err
+	}
+	if cfg.RecordRing < 1 {
+		return cfg, fmt.Errorf("RECORD_RING: want at least 1, got %d", cfg.RecordRing)
+	}
+	cfg.VideoDir = os.Getenv("VIDEO_DIR")
+	if cfg.VideoDir != "" && !video.Supported {
+		return cfg, fmt.Errorf("VIDEO_DIR: video encoding needs the OpenCV build")
+	}
+	if cfg.VideoFPS, err = envFloat("VIDEO_FPS", cfg.VideoFPS, 1, 60); err != nil {
+		return cfg, err
+	}
+	if cfg.VideoCodec = envString("VIDEO_CODEC", cfg.VideoCodec); len(cfg.VideoCodec) != 4 {
+		return cfg, fmt.Errorf("VIDEO_CODEC: want a FourCC, got %q", cfg.VideoCodec)
+	}
+	if cfg.VideoSegment, err = envDuration("VIDEO_SEGMENT", cfg.VideoSegment); err != nil {
+		return cfg, err
+	}
+	if cfg.VideoSegment < 0 {
+		return cfg, fmt.Errorf("VIDEO_SEGMENT: want a non-negative duration, got %s", cfg.VideoSegment)
+	}
+	if v := os.Getenv("VIDEO_SEGMENT_BYTES"); v != "" {
+		if cfg.VideoSegmentBytes, err = parseBytes(v); err != nil {
+			return cfg, fmt.Errorf("VIDEO_SEGMENT_BYTES: %w", err)
+		}
+	}
+	for _, c := range strings.Split(os.Getenv("BLUR_CLASSES"), ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			cfg.BlurClasses = append(cfg.BlurClasses, c)
+		}
+	}
+	cfg.HLSDir = os.Getenv("HLS_DIR")
+	if cfg.HLSDir != "" && !video.Supported {
+		return cfg, fmt.Errorf("HLS_DIR: video encoding needs the OpenCV build")
+	}
+	if cfg.HLSCodec = envString("HLS_CODEC", cfg.HLSCodec); len(cfg.HLSCodec) != 4 {
+		return cfg, fmt.Errorf("HLS_CODEC: want a FourCC, got %q", cfg.HLSCodec)
+	}
+	if cfg.HLSSegment, err = envDuration("HLS_SEGMENT", cfg.HLSSegment); err != nil {
+		return cfg, err
+	}
+	if cfg.HLSSegment < time.Second {
+		return cfg, fmt.Errorf("HLS_SEGMENT: want at least 1s, got %s", cfg.HLSSegment)
+	}
+	if cfg.HLSListSize, err = envInt("HLS_LIST_SIZE", cfg.HLSListSize); err != nil {
+		return cfg, err
+	}
+	if cfg.HLSListSize < 3 {
+		return cfg, fmt.Errorf("HLS_LIST_SIZE: want at least 3, got %d", cfg.HLSListSize)
+	}
+	if cfg.HLSLinger, err = envDuration("HLS_LINGER", cfg.HLSLinger); err != nil {
+		return cfg, err
+	}
+	if cfg.HLSLinger < 0 {
+		return cfg, fmt.Errorf("HLS_LINGER: want a non-negative duration, got %s", cfg.HLSLinger)
+	}
+	for _, c := range strings.Split(os.Getenv("EVENT_CLASSES"), ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			cfg.EventClasses = append(cfg.EventClasses, c)
+		}
+	}
+	if v := os.Getenv("EVENT_WHEN"); v != "" {
+		if cfg.EventWhen, err = postprocess.CompileExpr(v); err != nil {
+			return cfg, fmt.Errorf("EVENT_WHEN: %w", err)
+		}
+	}
+	if cfg.EventCooldown, err = envDuration("EVENT_COOLDOWN", cfg.EventCooldown); err != nil {
+		return cfg, err
+	}
+	if cfg.EventCooldown < 0 {
+		return cfg, fmt.Errorf("EVENT_COOLDOWN: want a non-negative duration, got %s", cfg.EventCooldown)
+	}
+	if cfg.EventKeep, err = envInt("EVENT_KEEP", cfg.EventKeep); err != nil {
+		return cfg, err
+	}
+	if cfg.EventKeep < 1 {
+		return cfg, fmt.Errorf("EVENT_KEEP: want at least 1, got %d", cfg.EventKeep)
+	}
+	cfg.EventClipDir = os.Getenv("EVENT_CLIP_DIR")
+	if cfg.EventClipDir != "" && !video.Supported {
+		return cfg, fmt.Errorf("EVENT_CLIP_DIR: video encoding needs the OpenCV build")
+	}
+	if cfg.EventPreroll, err = envDuration("EVENT_PREROLL", cfg.EventPreroll); err != nil {
+		return cfg, err
+	}
+	if cfg.EventPostroll, err = envDuration("EVENT_POSTROLL", cfg.EventPostroll); err != nil {
+		return cfg, err
+	}
+	if cfg.EventPreroll < 0 || cfg.EventPostroll < 0 || cfg.EventPreroll+cfg.EventPostroll > 5*time.Minute {
+		return cfg, fmt.Errorf("EVENT_PREROLL and EVENT_POSTROLL: want non-negative durations of at most 5m together, got %s and %s",
+			cfg.EventPreroll, cfg.EventPostroll)
+	}
+	if cfg.ArmDefault = envString("ARM_DEFAULT", cfg.ArmDefault); !validArmMode(cfg.ArmDefault) {
+		return cfg, fmt.Errorf("ARM_DEFAULT: want one of %s, got %q", strings.Join(armModes, ", "), cfg.ArmDefault)
+	}
+	if v := os.Getenv("ARM_CLASSES"); v != "" {
+		if cfg.ArmClasses, err = parseArmClasses(v, cfg.EventClasses); err != nil {
+			return cfg, fmt.Errorf("ARM_CLASSES: %w", err)
+		}
+	}
+	cfg.NotifyTemplate = envString("NOTIFY_TEMPLATE", cfg.NotifyTemplate)
+	cfg.NotifySubject = envString("NOTIFY_SUBJECT", cfg.NotifySubject)
+	cfg.SlackWebhook = os.Getenv("NOTIFY_SLACK_URL")
+	cfg.TelegramToken = os.Getenv("NOTIFY_TELEGRAM_TOKEN")
+	cfg.TelegramChat = os.Getenv("NOTIFY_TELEGRAM_CHAT")
+	if (cfg.TelegramToken == "") != (cfg.TelegramChat == "") {
+		return cfg, fmt.Errorf("NOTIFY_TELEGRAM_TOKEN and NOTIFY_TELEGRAM_CHAT must be set together")
+	}
+	cfg.SMTPAddr = os.Getenv("NOTIFY_SMTP_ADDR")
+	cfg.SMTPUser = os.Getenv("NOTIFY_SMTP_USER")
+	cfg.SMTPPassword = os.Getenv("NOTIFY_SMTP_PASSWORD")
+	cfg.SMTPFrom = os.Getenv("NOTIFY_SMTP_FROM")
+	for _, a := range strings.Split(os.Getenv("NOTIFY_SMTP_TO"), ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			cfg.SMTPTo = append(cfg.SMTPTo, a)
+		}
+	}
+	if cfg.SMTPAddr != "" && (cfg.SMTPFrom == "" || len(cfg.SMTPTo) == 0) {
+		return cfg, fmt.Errorf("NOTIFY_SMTP_ADDR needs NOTIFY_SMTP_FROM and NOTIFY_SMTP_TO")
+	}
+	if v := os.Getenv("EVENT_NOTIFY"); v != "" {
+		if cfg.EventNotify, err = parseEventNotify(v, cfg); err != nil {
+			return cfg, fmt.Errorf("EVENT_NOTIFY: %w", err)
+		}
+	}
+	cfg.MQTTURL = os.Getenv("MQTT_URL")
+	cfg.MQTTTopic = strings.Trim(envString("MQTT_TOPIC", cfg.MQTTTopic), "/")
+	cfg.MQTTDiscoveryPrefix = strings.Trim(envString("MQTT_DISCOVERY_PREFIX", cfg.MQTTDiscoveryPrefix), "/")
+	for _, c := range strings.Split(os.Getenv("MQTT_CLASSES"), ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			cfg.MQTTClasses = append(cfg.MQTTClasses, c)
+		}
+	}
+	if len(cfg.MQTTClasses) == 0 {
+		cfg.MQTTClasses = cfg.EventClasses
+	}
+	if cfg.MQTTURL != "" && len(cfg.MQTTClasses) == 0 {
+		return cfg, fmt.Errorf("MQTT_URL needs MQTT_CLASSES or EVENT_CLASSES")
+	}
+	if cfg.MQTTTopic == "" || cfg.MQTTDiscoveryPrefix == "" || strings.ContainsAny(cfg.MQTTTopic+cfg.MQTTDiscoveryPrefix, "+#") {
+		return cfg, fmt.Errorf("MQTT_TOPIC and MQTT_DISCOVERY_PREFIX: want topic names without wildcards")
+	}
+	if cfg.MQTTOffDelay, err = envDuration("MQTT_OFF_DELAY", cfg.MQTTOffDelay); err != nil {
+		return cfg, err
+	}
+	if cfg.MQTTStale, err = envDuration("MQTT_STALE", cfg.MQTTStale); err != nil {
+		return cfg, err
+	}
+	if cfg.MQTTOffDelay <= 0 || cfg.MQTTStale <= 0 {
+		return cfg, fmt.Errorf("MQTT_OFF_DELAY and MQTT_STALE: want positive durations, got %s and %s", cfg.MQTTOffDelay, cfg.MQTTStale)
+	}
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		if cfg.LogLevel, err = parseLogLevel(v); err != nil {
+			return cfg, fmt.Errorf("LOG_LEVEL: %w", err)
+		}
+	}
+	switch cfg.LogFormat = envString("LOG_FORMAT", cfg.LogFormat); cfg.LogFormat {
+	case "text", "json":
+	default:
+		return cfg, fmt.Errorf("LOG_FORMAT: want text or json, got %q", cfg.LogFormat)
+	}
+	if cfg.LogFrames, err = envBool("LOG_FRAMES", false); err != nil {
+		return cfg, err
+	}
+	if cfg.LogSampleBurst, err = envInt("LOG_SAMPLE_BURST", cfg.LogSampleBurst); err != nil {
+		return cfg, err
+	}
+	if cfg.ConfThreshold, err = envFloat("CONF_THRESHOLD", cfg.ConfThreshold, 0, 1); err != nil {
+		return cfg, err
+	}
+	if cfg.MaxConnections, err = envInt("MAX_CONNECTIONS", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.InferWorkers, err = envInt("INFER_WORKERS", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.InferWorkers < 0 {
+		return cfg, fmt.Errorf("INFER_WORKERS: want 0 or more, got %d", cfg.InferWorkers)
+	}
+	if cfg.KeyPriority, err = parseKeyPriority(os.Getenv("KEY_PRIORITY")); err != nil {
+		return cfg, err
+	}
+	if cfg.RateLimitFPS, err = envFloat("RATE_LIMIT_FPS", 0, 0, math.MaxFloat64); err != nil {
+		return cfg, err
+	}
+	if cfg.RateLimitBurst, err = envInt("RATE_LIMIT_BURST", 0); err != nil {
+		return cfg, err
+	}
+	if v := os.Getenv("FRAME_QUOTA_MONTHLY"); v != "" {
+		if cfg.FrameQuota, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return cfg, fmt.Errorf("FRAME_QUOTA_MONTHLY: want a non-negative integer, got %q", v)
+		}
+	}
+	if cfg.IntraOpThreads, err = envInt("ORT_INTRA_OP_THREADS", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.InterOpThreads, err = envInt("ORT_INTER_OP_THREADS", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.CPUMemArena, err = envBool("ORT_CPU_MEM_ARENA", cfg.CPUMemArena); err != nil {
+		return cfg, err
+	}
+	if cfg.MemPattern, err = envBool("ORT_MEM_PATTERN", cfg.MemPattern); err != nil {
+		return cfg, err
+	}
+	switch cfg.ORTProvider = envString("ORT_PROVIDER", "cpu"); cfg.ORTProvider {
+	case "cpu", "cuda":
+	default:
+		return cfg, fmt.Errorf("ORT_PROVIDER: want cpu or cuda, got %q", cfg.ORTProvider)
+	}
+	if cfg.ORTDeviceID, err = envInt("ORT_DEVICE_ID", 0); err != nil {
+		return cfg, err
+	}
+	cfg.LPRModel = os.Getenv("LPR_MODEL")
+	for _, c := range strings.Split(envString("LPR_CLASSES", "car,truck"), ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			cfg.LPRClasses = append(cfg.LPRClasses, c)
+		}
+	}
+	if cfg.LPRAlphabet = envString("LPR_ALPHABET", cfg.LPRAlphabet); cfg.LPRAlphabet == "" ||
+		strings.IndexFunc(cfg.LPRAlphabet, func(r rune) bool { return r > unicode.MaxASCII }) >= 0 {
+		return cfg, fmt.Errorf("LPR_ALPHABET: want ASCII characters, got %q", cfg.LPRAlphabet)
+	}
+	switch cfg.LPRDecode = envString("LPR_DECODE", cfg.LPRDecode); cfg.LPRDecode {
+	case "ctc", "slots":
+	default:
+		return cfg, fmt.Errorf("LPR_DECODE: want ctc or slots, got %q", cfg.LPRDecode)
+	}
+	if cfg.LPRMinScore, err = envFloat("LPR_MIN_SCORE", cfg.LPRMinScore, 0, 1); err != nil {
+		return cfg, err
+	}
+	for _, p := range strings.Split(os.Getenv("PLATE_ALLOWLIST"), ",") {
+		if p = normalizePlate(p); p != "" {
+			cfg.PlateAllowlist = append(cfg.PlateAllowlist, p)
+		}
+	}
+	for _, c := range strings.Split(os.Getenv("COLOR_CLASSES"), ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			cfg.ColorClasses = append(cfg.ColorClasses, c)
+		}
+	}
+	if cfg.MotionAttributes, err = envBool("MOTION_ATTRIBUTES", false); err != nil {
+		return cfg, err
+	}
+	if v := os.Getenv("CALIBRATION_FILE"); v != "" {
+		if cfg.Calibration, err = calib.Load(v); err != nil {
+			return cfg, fmt.Errorf("CALIBRATION_FILE: %w", err)
+		}
+	}
+	if cfg.WorldMergeRadius, err = envFloat("WORLD_MERGE_RADIUS", cfg.WorldMergeRadius, 0, math.MaxFloat64); err != nil {
+		return cfg, err
+	}
+	if cfg.WorldWindow, err = envDuration("WORLD_WINDOW", cfg.WorldWindow); err != nil {
+		return cfg, err
+	}
+	if cfg.WorldWindow <= 0 {
+		return cfg, fmt.Errorf("WORLD_WINDOW: want a positive duration, got %s", cfg.WorldWindow)
+	}
+	if cfg.CropMaxSize, err = envInt("CROP_MAX_SIZE", 128); err != nil {
+		return cfg, err
+	}
+	if cfg.CropMaxSize < 16 || cfg.CropMaxSize > 1024 {
+		return cfg, fmt.Errorf("CROP_MAX_SIZE: want 16..1024, got %d", cfg.CropMaxSize)
+	}
+	if cfg.CropCache, err = envInt("CROP_CACHE", 4096); err != nil {
+		return cfg, err
+	}
+	if cfg.CropCache < 1 {
+		return cfg, fmt.Errorf("CROP_CACHE: want at least 1, got %d", cfg.CropCache)
+	}
+	cfg.CrowdModel = os.Getenv("CROWD_MODEL")
+	switch cfg.CrowdNormalize = envString("CROWD_NORMALIZE", "imagenet"); cfg.CrowdNormalize {
+	case "imagenet", "none":
+	default:
+		return cfg, fmt.Errorf("CROWD_NORMALIZE: want imagenet or none, got %q", cfg.CrowdNormalize)
+	}
+	cfg.CrowdClass = envString("CROWD_CLASS", "person")
+	cfg.GalleryDir = os.Getenv("GALLERY_DIR")
+	if cfg.GalleryKeep, err = envInt("GALLERY_KEEP", 100000); err != nil {
+		return cfg, err
+	}
+	if cfg.GalleryKeep < 1 {
+		return cfg, fmt.Errorf("GALLERY_KEEP: want at least 1, got %d", cfg.GalleryKeep)
+	}
+	if cfg.GalleryInterval, err = envDuration("GALLERY_INTERVAL", 10*time.Second); err != nil {
+		return cfg, err
+	}
+	if cfg.GalleryInterval < 0 {
+		return cfg, fmt.Errorf("GALLERY_INTERVAL: want a non-negative duration, got %s", cfg.GalleryInterval)
+	}
+	for _, c := range strings.Split(os.Getenv("GALLERY_CLASSES"), ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			cfg.GalleryClasses = append(cfg.GalleryClasses, c)
+		}
+	}
+	cfg.EmbedModel = os.Getenv("EMBED_MODEL")
+	if cfg.EmbedModel != "" && cfg.GalleryDir == "" {
+		return cfg, fmt.Errorf("EMBED_MODEL: only used by the gallery; set GALLERY_DIR")
+	}
+	switch cfg.EmbedNormalize = envString("EMBED_NORMALIZE", "imagenet"); cfg.EmbedNormalize {
+	case "imagenet", "none":
+	default:
+		return cfg, fmt.Errorf("EMBED_NORMALIZE: want imagenet or none, got %q", cfg.EmbedNormalize)
+	}
+	if v := os.Getenv("RETAIN_AGE"); v != "" {
+		if cfg.RetainAge, err = parseRetain(v, cfg, parseRetainAge); err != nil {
+			return cfg, fmt.Errorf("RETAIN_AGE: %w", err)
+		}
+	}
+	if v := os.Getenv("RETAIN_BYTES"); v != "" {
+		if cfg.RetainBytes, err = parseRetain(v, cfg, parseBytes); err != nil {
+			return cfg, fmt.Errorf("RETAIN_BYTES: %w", err)
+		}
+	}
+	if cfg.RetainInterval, err = envDuration("RETAIN_INTERVAL", 10*time.Minute); err != nil {
+		return cfg, err
+	}
+	if cfg.RetainInterval < time.Second {
+		return cfg, fmt.Errorf("RETAIN_INTERVAL: want at least 1s, got %s", cfg.RetainInterval)
+	}
+	if cfg.Postprocess, err = postprocess.ParseChain(os.Getenv("POSTPROCESS")); err != nil {
+		return cfg, fmt.Errorf("POSTPROCESS: %w", err)
+	}
+	if cfg.WSCompression, err = envBool("WS_COMPRESSION", cfg.WSCompression); err != nil {
+		return cfg, err
+	}
+	if v := os.Getenv("WS_COMPRESSION_LEVEL"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < flate.HuffmanOnly || n > flate.BestCompression {
+			return cfg, fmt.Errorf("WS_COMPRESSION_LEVEL: want %d..%d, got %q", flate.HuffmanOnly, flate.BestCompression, v)
+		}
+		cfg.WSCompressionLevel = n
+	}
+	if cfg.TileSize, err = envInt("TILE_SIZE", cfg.TileSize); err != nil {
+		return cfg, err
+	}
+	if cfg.TileSize < 32 {
+		return cfg, fmt.Errorf("TILE_SIZE: want at least 32, got %d", cfg.TileSize)
+	}
+	if cfg.TileOverlap, err = envFloat("TILE_OVERLAP", cfg.TileOverlap, 0, 0.9); err != nil {
+		return cfg, err
+	}
+	if cfg.NMSIoU, err = envFloat("NMS_IOU", cfg.NMSIoU, 0, 1); err != nil {
+		return cfg, err
+	}
+	if v := os.Getenv("TTA_SCALES"); v != "" {
+		cfg.TTAScales = cfg.TTAScales[:0:0]
+		for _, p := range strings.Split(v, ",") {
+			f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+			if err != nil || f <= 0 || f > 1 {
+				return cfg, fmt.Errorf("TTA_SCALES: want numbers in (0, 1], got %q", v)
+			}
+			cfg.TTAScales = append(cfg.TTAScales, f)
+		}
+	}
+	if cfg.TTAFlip, err = envBool("TTA_FLIP", cfg.TTAFlip); err != nil {
+		return cfg, err
+	}
+	if v := os.Getenv("INPUT_SIZES"); v != "" {
+		cfg.InputSizes = []int{preprocess.InputSize} // the default size is always served
+		for _, p := range strings.Split(v, ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(p))
+			if err != nil || n < 32 || n%32 != 0 || n > 4096 {
+				return cfg, fmt.Errorf("INPUT_SIZES: want multiples of 32 up to 4096, got %q", v)
+			}
+			if !slices.Contains(cfg.InputSizes, n) {
+				cfg.InputSizes = append(cfg.InputSizes, n)
+			}
+		}
+	}
+	if cfg.StreamEvery, err = envInt("STREAM_EVERY", cfg.StreamEvery); err != nil {
+		return cfg, err
+	}
+	if cfg.StreamEvery < 1 {
+		return cfg, fmt.Errorf("STREAM_EVERY: want at least 1, got %d", cfg.StreamEvery)
+	}
+	if cfg.StreamFPS, err = envFloat("STREAM_FPS", 0, 0, math.MaxFloat64); err != nil {
+		return cfg, err
+	}
+	if cfg.StreamEcho, err = envBool("STREAM_ECHO", cfg.StreamEcho); err != nil {
+		return cfg, err
+	}
+	if cfg.StreamConfMargin, err = envFloat("STREAM_CONF_MARGIN", 0, 0, 1); err != nil {
+		return cfg, err
+	}
+	if cfg.StreamConfFloor, err = envFloat("STREAM_CONF_FLOOR", cfg.StreamConfFloor, 0, 1); err != nil {
+		return cfg, err
+	}
+	cfg.StreamStable = strings.TrimSpace(os.Getenv("STREAM_STABLE"))
+	if _, err := track.ParseStable(cfg.StreamStable); err != nil {
+		return cfg, fmt.Errorf("STREAM_STABLE: %w", err)
+	}
+	if cfg.StreamInflight, err = envInt("STREAM_INFLIGHT", cfg.StreamInflight); err != nil {
+		return cfg, err
+	}
+	if cfg.StreamInflight < 1 || cfg.StreamInflight > maxInflight {
+		return cfg, fmt.Errorf("STREAM_INFLIGHT: want 1..%d, got %d", maxInflight, cfg.StreamInflight)
+	}
+	if cfg.LatencySLO, err = envDuration("LATENCY_SLO", cfg.LatencySLO); err != nil {
+		return cfg, err
+	}
+	if cfg.LatencySLO <= 0 {
+		return cfg, fmt.Errorf("LATENCY_SLO: want a positive duration, got %s", cfg.LatencySLO)
+	}
+	if cfg.FlowCredits, err = envInt("FLOW_CREDITS", cfg.FlowCredits); err != nil {
+		return cfg, err
+	}
+	if cfg.FlowCredits < 1 || cfg.FlowCredits > maxFlowCredits {
+		return cfg, fmt.Errorf("FLOW_CREDITS: want 1..%d, got %d", maxFlowCredits, cfg.FlowCredits)
+	}
+	if cfg.MuxMaxStreams, err = envInt("MUX_MAX_STREAMS", cfg.MuxMaxStreams); err != nil {
+		return cfg, err
+	}
+	if cfg.MuxMaxStreams < 1 {
+		return cfg, fmt.Errorf("MUX_MAX_STREAMS: want at least 1, got %d", cfg.MuxMaxStreams)
+	}
+	if cfg.PollIdleTimeout, err = envDuration("POLL_IDLE_TIMEOUT", cfg.PollIdleTimeout); err != nil {
+		return cfg, err
+	}
+	if cfg.PollIdleTimeout < time.Second {
+		return cfg, fmt.Errorf("POLL_IDLE_TIMEOUT: want at least 1s, got %s", cfg.PollIdleTimeout)
+	}
+	cfg.SpoolDir = os.Getenv("SPOOL_DIR")
+	cfg.SpoolBytes = 1 << 30
+	if v := os.Getenv("SPOOL_BYTES"); v != "" {
+		if cfg.SpoolBytes, err = parseBytes(v); err != nil {
+			return cfg, fmt.Errorf("SPOOL_BYTES: %w", err)
+		}
+	}
+	if cfg.SpoolBytes < 1 {
+		return cfg, fmt.Errorf("SPOOL_BYTES: want a positive size")
+	}
+	cfg.RedisURL = os.Getenv("REDIS_URL")
+	if cfg.StreamStateTTL, err = envDuration("STREAM_STATE_TTL", cfg.StreamStateTTL); err != nil {
+		return cfg, err
+	}
+	if cfg.StreamStateTTL < time.Second {
+		return cfg, fmt.Errorf("STREAM_STATE_TTL: want at least 1s, got %s", cfg.StreamStateTTL)
+	}
+	if cfg.ResumeWindow, err = envDuration("RESUME_WINDOW", cfg.ResumeWindow); err != nil {
+		return cfg, err
+	}
+	if cfg.ResumeWindow < 0 {
+		return cfg, fmt.Errorf("RESUME_WINDOW: want a non-negative duration, got %s", cfg.ResumeWindow)
+	}
+	if v := os.Getenv("MEM_LIMIT"); v != "" {
+		if cfg.MemLimit, err = parseBytes(v); err != nil {
+			return cfg, fmt.Errorf("MEM_LIMIT: %w", err)
+		}
+	}
+	if v := os.Getenv("MEM_CONN_LIMIT"); v != "" {
+		if cfg.MemConnLimit, err = parseBytes(v); err != nil {
+			return cfg, fmt.Errorf("MEM_CONN_LIMIT: %w", err)
+		}
+	}
+	if cfg.AdaptiveQueueDepth, err = envInt("ADAPTIVE_QUEUE_DEPTH", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.AdaptiveP95, err = envDuration("ADAPTIVE_P95", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.AdaptiveMaxSkip, err = envInt("ADAPTIVE_MAX_SKIP", cfg.AdaptiveMaxSkip); err != nil {
+		return cfg, err
+	}
+	if cfg.AdaptiveQueueDepth < 0 || cfg.AdaptiveP95 < 0 || cfg.AdaptiveMaxSkip < 0 {
+		return cfg, fmt.Errorf("ADAPTIVE_*: want non-negative values")
+	}
+	if cfg.WatchdogFactor, err = envFloat("WATCHDOG_FACTOR", cfg.WatchdogFactor, 0, 1000); err != nil {
+		return cfg, err
+	}
+	if cfg.WatchdogMin, err = envDuration("WATCHDOG_MIN", cfg.WatchdogMin); err != nil {
+		return cfg, err
+	}
+	if cfg.WatchdogReset, err = envBool("WATCHDOG_RESET", cfg.WatchdogReset); err != nil {
+		return cfg, err
+	}
+	if path := os.Getenv("TENANTS_FILE"); path != "" {
+		if cfg.Tenants, err = loadTenants(path, settingsFromConfig(cfg)); err != nil {
+			return cfg, err
+		}
+	}
+	if v, ok := os.LookupEnv("MODEL_PRELOAD"); ok {
+		cfg.ModelPreload = []string{}
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+			if cfg.Tenants[name].Model == "" {
+				return cfg, fmt.Errorf("MODEL_PRELOAD: %q is not a tenant with its own model", name)
+			}
+			cfg.ModelPreload = append(cfg.ModelPreload, name)
+		}
+	}
+	if cfg.ModelIdleUnload, err = envDuration("MODEL_IDLE_UNLOAD", 10*time.Minute); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+func envString(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	return def
+}
+
+func envInt(key string, def int) (int, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return def, fmt.Errorf("%s: want a non-negative integer, got %q", key, v)
+	}
+	return n, nil
+}
+
+func envFloat(key string, def, lo, hi float64) (float64, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < lo || f > hi {
+		return def, fmt.Errorf("%s: want a number in [%g, %g], got %q", key, lo, hi, v)
+	}
+	return f, nil
+}
+
+func envDuration(key string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return def, fmt.Errorf("%s: want a duration like 10s, got %q", key, v)
+	}
+	return d, nil
+}
+
+func envBool(key string, def bool) (bool, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return def, fmt.Errorf("%s: want a boolean, got %q", key, v)
+	}
+	return b, nil
+}
+
+// SessionOptions are the ORT settings for inference.Load.
+func (cfg Config) SessionOptions() inference.SessionOptions {
+	return inference.SessionOptions{
+		IntraOpThreads: cfg.IntraOpThreads,
+		InterOpThreads: cfg.InterOpThreads,
+		CPUMemArena:    cfg.CPUMemArena,
+		MemPattern:     cfg.MemPattern,
+		Provider:       cfg.ORTProvider,
+		DeviceID:       cfg.ORTDeviceID,
+	}
+}
+
+// SetBackend selects the inference backend and checks its settings.
+func (cfg *Config) SetBackend(name string) error {
+	switch name {
+	case "onnxruntime", "mock":
+	case "triton":
+		if cfg.TritonURL == "" {
+			return fmt.Errorf("BACKEND=triton requires TRITON_URL")
+		}
+	case "workers":
+		if len(cfg.WorkerURLs) == 0 {
+			return fmt.Errorf("BACKEND=workers requires WORKER_URLS")
+		}
+	default:
+		return fmt.Errorf("BACKEND: want onnxruntime, triton, workers or mock, got %q", name)
+	}
+	cfg.Backend = name
+	return nil
+}
+
+// SetLogLevel sets the minimum log level by name, as LOG_LEVEL does.
+func (cfg *Config) SetLogLevel(name string) error {
+	l, err := parseLogLevel(name)
+	if err != nil {
+		return fmt.Errorf("log level: %w", err)
+	}
+	cfg.LogLevel = l
+	return nil
+}
+
+// TritonConfig is the remote backend part of cfg.
+func (cfg Config) TritonConfig() inference.TritonConfig {
+	return inference.TritonConfig{
+		URL:    cfg.TritonURL,
+		Model:  cfg.TritonModel,
+		Input:  cfg.TritonInput,
+		Output: cfg.TritonOutput,
+	}
+}
+
+// PlateConfig is the LPR_* part of cfg.
+func (cfg Config) PlateConfig() inference.PlateConfig {
+	return inference.PlateConfig{
+		Path:     cfg.LPRModel,
+		Classes:  cfg.LPRClasses,
+		Alphabet: cfg.LPRAlphabet,
+		Decode:   cfg.LPRDecode,
+		MinScore: cfg.LPRMinScore,
+	}
+}
+
+// DensityConfig is the CROWD_* part of cfg.
+func (cfg Config) DensityConfig() inference.DensityConfig {
+	return inference.DensityConfig{Path: cfg.CrowdModel, Normalize: cfg.CrowdNormalize}
+}
+
+// EmbedConfig is the EMBED_* part of cfg.
+func (cfg Config) EmbedConfig() inference.EmbedConfig {
+	return inference.EmbedConfig{Path: cfg.EmbedModel, Normalize: cfg.EmbedNormalize}
+}
+
+// DispatchConfig is the BACKEND=workers part of cfg.
+func (cfg Config) DispatchConfig() inference.DispatchConfig {
+	return inference.DispatchConfig{URLs: cfg.WorkerURLs, Key: cfg.WorkerKey}
+}
+
+// EngineConfig is the pipeline part of cfg for inference.Load.
+func (cfg Config) EngineConfig() inference.Config {
+	return inference.Config{
+		TileSize:    cfg.TileSize,
+		TileOverlap: cfg.TileOverlap,
+		TTAScales:   cfg.TTAScales,
+		TTAFlip:     cfg.TTAFlip,
+		InputSizes:  cfg.InputSizes,
+		Watchdog: inference.WatchdogConfig{
+			Factor: cfg.WatchdogFactor,
+			Min:    cfg.WatchdogMin,
+			Reset:  cfg.WatchdogReset,
+		},
+		ColorClasses: cfg.ColorClasses,
+	}
+}
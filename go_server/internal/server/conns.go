@@ -0,0 +1,162 @@
+package server
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ── 연결 관리 ────────────────────────────────────────────────────────────────
+// Every live stream, over /ws/stream or long-poll (poll.go), is registered
+// so operators can list them and force-close misbehaving clients through
+// the admin API.
+
+const statsAlpha = 0.1 // EWMA weight of the newest sample for fps/latency
+
+type connInfo struct {
+	id        uint64
+	remote    string
+	key       string
+	model     string
+	transport string // "ws", "poll" or "mux"
+	stream    string // ?stream= id of a logical stream of a ?mux=1 connection
+	tenant    string
+	priority  priority
+	started   time.Time
+	closeFn   func(reason string) // set by the transport
+
+	frames atomic.Uint64 // inferred successfully
+	drops  atomic.Uint64 // rejected by limits or failed inference
+	mem    atomic.Int64  // bytes accounted to this connection (mem.go)
+
+	mu        sync.Mutex
+	latencyMS float64 // EWMA of decode→postprocess time
+	fps       float64 // EWMA of frame arrival rate
+	lastFrame time.Time
+	e2e       e2eLatency // capture→answer of stamped frames (e2e.go)
+}
+
+// connStats is the JSON view served by GET /admin/connections.
+type connStats struct {
+	ID        uint64    `json:"id"`
+	Remote    string    `json:"remote"`
+	Key       string    `json:"key,omitempty"`
+	Tenant    string    `json:"tenant,omitempty"`
+	Model     string    `json:"model"`
+	Transport string    `json:"transport"`
+	Stream    string    `json:"stream,omitempty"`
+	Priority  string    `json:"priority"`
+	Started   time.Time `json:"started"`
+	FPS       float64   `json:"fps"`
+	LatencyMS float64   `json:"latency_ms"`
+	Frames    uint64    `json:"frames"`
+	Drops     uint64    `json:"drops"`
+	MemBytes  int64     `json:"mem_bytes"`
+	E2E       *e2eStats `json:"e2e,omitempty"`
+}
+
+// recordFrame updates the rolling stats after a frame was processed in d.
+func (c *connInfo) recordFrame(now time.Time, d time.Duration) {
+	c.frames.Add(1)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ms := float64(d) / float64(time.Millisecond)
+	if c.lastFrame.IsZero() {
+		c.latencyMS = ms
+	} else {
+		c.latencyMS += statsAlpha * (ms - c.latencyMS)
+		if gap := now.Sub(c.lastFrame).Seconds(); gap > 0 {
+			c.fps += statsAlpha * (1/gap - c.fps)
+		}
+	}
+	c.lastFrame = now
+}
+
+// stats is c's view; slo is LATENCY_SLO.
+func (c *connInfo) stats(slo time.Duration) connStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return connStats{
+		ID:        c.id,
+		Remote:    c.remote,
+		Key:       c.key,
+		Tenant:    c.tenant,
+		Model:     c.model,
+		Transport: c.transport,
+		Stream:    c.stream,
+		Priority:  c.priority.String(),
+		Started:   c.started,
+		FPS:       round2(c.fps),
+		LatencyMS: round2(c.latencyMS),
+		Frames:    c.frames.Load(),
+		Drops:     c.drops.Load(),
+		MemBytes:  c.mem.Load(),
+		E2E:       c.e2eStats(slo),
+	}
+}
+
+// close tears the stream down; its handler then cleans up.
+func (c *connInfo) close(reason string) { c.closeFn(reason) }
+
+type connRegistry struct {
+	mu     sync.Mutex
+	nextID uint64
+	conns  map[uint64]*connInfo
+}
+
+func (r *connRegistry) add(c *connInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conns == nil {
+		r.conns = make(map[uint64]*connInfo)
+	}
+	r.nextID++
+	c.id = r.nextID
+	r.conns[c.id] = c
+}
+
+func (r *connRegistry) remove(id uint64) {
+	r.mu.Lock()
+	delete(r.conns, id)
+	r.mu.Unlock()
+}
+
+func (r *connRegistry) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.conns)
+}
+
+func (r *connRegistry) countTenant(name string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, c := range r.conns {
+		if c.tenant == name {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *connRegistry) get(id uint64) *connInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.conns[id]
+}
+
+func (r *connRegistry) list(slo time.Duration) []connStats {
+	r.mu.Lock()
+	out := make([]connStats, 0, len(r.conns))
+	for _, c := range r.conns {
+		out = append(out, c.stats(slo))
+	}
+	r.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+func round2(f float64) float64 {
+	return float64(int64(f*100+0.5)) / 100
+}
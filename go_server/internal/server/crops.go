@@ -0,0 +1,104 @@
+package server
+
+import (
+	"encoding/base64"
+	"image"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"yolo-server/internal/postprocess"
+	"yolo-server/internal/preprocess"
+)
+
+// ── 객체 썸네일 ──────────────────────────────────────────────────────────────
+// ?crops=inline puts a JPEG of each detection of an inferred frame into its
+// attributes as "crop", base64; ?crops=ref keeps it on the server instead
+// and gives its "crop_id", fetched with GET /crops/{id} by the same
+// credential. Crops are at most CROP_MAX_SIZE pixels on their longer side
+// and redacted like snapshots (preprocess.Crops). The newest CROP_CACHE
+// referenced crops are kept in memory.
+
+const (
+	cropsInline = "inline"
+	cropsRef    = "ref"
+)
+
+type cropStore struct {
+	mu    sync.Mutex
+	crops map[string]storedCrop
+	ring  []string // ids, oldest first once full
+	next  int
+}
+
+type storedCrop struct {
+	owner string
+	jpeg  []byte
+}
+
+func newCropStore(n int) *cropStore {
+	return &cropStore{crops: map[string]storedCrop{}, ring: make([]string, n)}
+}
+
+// put keeps b for owner, dropping the oldest crop when full, and returns
+// its id.
+func (cs *cropStore) put(owner string, b []byte) string {
+	id := newSessionID()
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if old := cs.ring[cs.next]; old != "" {
+		delete(cs.crops, old)
+	}
+	cs.ring[cs.next], cs.next = id, (cs.next+1)%len(cs.ring)
+	cs.crops[id] = storedCrop{owner: owner, jpeg: b}
+	return id
+}
+
+func (cs *cropStore) get(owner, id string) []byte {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if c, ok := cs.crops[id]; ok && c.owner == owner {
+		return c.jpeg
+	}
+	return nil
+}
+
+// addCrops gives dets, found in frame, their crops as st asks. A frame
+// that cannot be cropped in Go is answered without them.
+func (s *Server) addCrops(r *http.Request, st *streamState, frame []byte, orientation int, mask []image.Rectangle, dets []postprocess.Detection) {
+	if st.crops == "" || len(dets) == 0 {
+		return
+	}
+	boxes := make([]image.Rectangle, len(dets))
+	for i, d := range dets {
+		boxes[i] = image.Rect(d.Box[0], d.Box[1], d.Box[2], d.Box[3])
+	}
+	crops, err := preprocess.Crops(frame, orientation, boxes, s.cfg.CropMaxSize, mask, s.blurRegions(dets))
+	if err != nil {
+		slog.Debug("crops", "err", err)
+		return
+	}
+	owner := clientLabel(r)
+	for i, c := range crops {
+		if c == nil {
+			continue
+		}
+		dets[i].SetAttributes(func(a *postprocess.Attributes) {
+			if st.crops == cropsInline {
+				a.Crop = base64.StdEncoding.EncodeToString(c)
+			} else {
+				a.CropID = s.crops.put(owner, c)
+			}
+		})
+	}
+}
+
+func (s *Server) getCrop(w http.ResponseWriter, r *http.Request) {
+	b := s.crops.get(clientLabel(r), r.PathValue("id"))
+	if b == nil {
+		writeJSONError(w, http.StatusNotFound, "no such crop")
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	_, _ = w.Write(b)
+}
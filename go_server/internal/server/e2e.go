@@ -0,0 +1,118 @@
+package server
+
+import (
+	"encoding/binary"
+	"math"
+	"slices"
+	"time"
+)
+
+// ── 종단 지연 ────────────────────────────────────────────────────────────────
+// A client may stamp a frame with the time it was captured by putting a
+// 12-byte header in front of the encoded image: the magic "YTS1" and the
+// capture time in microseconds since the Unix epoch, as a big-endian int64.
+// JPEG, PNG and WebP never start with the magic, so stamped and unstamped
+// frames can be mixed. For every stamped frame that is inferred, the time
+// from capture to its answer being handed to the transport is that frame's
+// end-to-end latency. Each stream keeps its last e2eWindow latencies for
+// GET /admin/connections, and counts the frames answered within LATENCY_SLO
+// for the yolo_e2e_frames_* metrics. Until the client syncs its clock
+// (clocksync.go), the stamps are taken as they are.
+
+const (
+	frameStampMagic = "YTS1"
+	frameStampSize  = len(frameStampMagic) + 8
+	e2eWindow       = 1024 // latencies kept per stream for the percentiles
+)
+
+// splitFrameStamp strips the capture stamp off data; captured is zero when
+// there is none.
+func splitFrameStamp(data []byte) (frame []byte, captured time.Time) {
+	if len(data) <= frameStampSize || string(data[:len(frameStampMagic)]) != frameStampMagic {
+		return data, time.Time{}
+	}
+	us := int64(binary.BigEndian.Uint64(data[len(frameStampMagic):frameStampSize]))
+	return data[frameStampSize:], time.UnixMicro(us)
+}
+
+// e2eLatency is a stream's end-to-end latencies. connInfo.mu guards it.
+type e2eLatency struct {
+	ring   [e2eWindow]float64 // ms
+	n      int                // samples in ring
+	next   int
+	total  uint64
+	within uint64 // total at most LATENCY_SLO
+	synced bool   // offset is measured (clocksync.go)
+	offset time.Duration
+}
+
+// e2eStats is the JSON view of e2eLatency in GET /admin/connections.
+type e2eStats struct {
+	Frames    uint64  `json:"frames"`
+	P50MS     float64 `json:"p50_ms"`
+	P95MS     float64 `json:"p95_ms"`
+	P99MS     float64 `json:"p99_ms"`
+	SLOMS     float64 `json:"slo_ms"`
+	WithinSLO float64 `json:"within_slo"` // fraction of frames
+
+	ClockOffsetMS *float64 `json:"clock_offset_ms,omitempty"` // server − client; nil unsynced
+}
+
+// recordE2E adds a stamped frame's latency d; within is d <= LATENCY_SLO.
+func (c *connInfo) recordE2E(d time.Duration, within bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := &c.e2e
+	e.ring[e.next] = float64(d) / float64(time.Millisecond)
+	e.next = (e.next + 1) % e2eWindow
+	e.n = min(e.n+1, e2eWindow)
+	e.total++
+	if within {
+		e.within++
+	}
+}
+
+func (c *connInfo) setClockOffset(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.e2e.synced, c.e2e.offset = true, d
+}
+
+// e2eStats summarizes c.e2e; nil before a stamped frame. c.mu is held.
+func (c *connInfo) e2eStats(slo time.Duration) *e2eStats {
+	e := &c.e2e
+	if e.total == 0 && !e.synced {
+		return nil
+	}
+	st := &e2eStats{Frames: e.total, SLOMS: float64(slo) / float64(time.Millisecond)}
+	if e.synced {
+		ms := round2(float64(e.offset) / float64(time.Millisecond))
+		st.ClockOffsetMS = &ms
+	}
+	if e.total == 0 {
+		return st
+	}
+	ms := slices.Clone(e.ring[:e.n])
+	slices.Sort(ms)
+	at := func(q float64) float64 {
+		return round2(ms[min(int(math.Ceil(q*float64(len(ms))))-1, len(ms)-1)])
+	}
+	st.P50MS, st.P95MS, st.P99MS = at(0.50), at(0.95), at(0.99)
+	st.WithinSLO = round2(float64(e.within) / float64(e.total))
+	return st
+}
+
+// observeE2E records the latency of an answered, stamped frame.
+func (p *pipeline) observeE2E(a *answer) {
+	if a.captured.IsZero() || !a.ok {
+		return
+	}
+	d := max(time.Since(a.captured), 0)
+	slo := p.s.cfg.LatencySLO
+	p.ci.recordE2E(d, d <= slo)
+	client := clientLabel(p.r)
+	p.s.e2eFrames.inc(client)
+	if d <= slo {
+		p.s.e2eWithinSLO.inc(client)
+	}
+}
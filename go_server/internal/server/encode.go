@@ -0,0 +1,280 @@
+package server
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"yolo-server/internal/postprocess"
+)
+
+// ── JSON 인코딩 ──────────────────────────────────────────────────────────────
+// wsResponse is written once per frame, so it is encoded by hand with
+// strconv.Append* instead of through encoding/json's reflection. The output
+// is byte-compatible with encoding/json apart from the trailing newline the
+// Encoder adds, an empty list being written as [] rather than null, and the
+// time being written as "ts" in Unix milliseconds. A stream's ?fields=
+// leaves out the detection keys it does not name, at high frame rates
+// saving both the bytes and the encoding.
+
+// detFields is a set of detection keys; 0 is all of them.
+type detFields uint8
+
+const (
+	fieldBox detFields = 1 << iota
+	fieldScore
+	fieldLabel
+	fieldName
+	fieldAttributes
+)
+
+var detFieldNames = []string{"box", "score", "label", "name", "attributes"} // by bit
+
+// parseDetFields parses a comma-separated list of detection keys.
+func parseDetFields(v string) (detFields, error) {
+	var f detFields
+	for _, name := range strings.Split(v, ",") {
+		i := slices.Index(detFieldNames, strings.TrimSpace(name))
+		if i < 0 {
+			return 0, fmt.Errorf("fields: want some of %s, got %q", strings.Join(detFieldNames, ","), name)
+		}
+		f |= 1 << i
+	}
+	return f, nil
+}
+
+// names lists the keys in f; nil for all.
+func (f detFields) names() []string {
+	if f == 0 {
+		return nil
+	}
+	var out []string
+	for i, name := range detFieldNames {
+		if f&(1<<i) != 0 {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+func (f detFields) has(g detFields) bool { return f == 0 || f&g != 0 }
+
+func (r wsResponse) appendJSON(dst []byte) []byte {
+	dst = append(dst, '{')
+	if r.Frame > 0 {
+		dst = append(dst, `"frame":`...)
+		dst = strconv.AppendUint(dst, r.Frame, 10)
+		dst = append(dst, ',')
+	}
+	dst = append(dst, `"detections":[`...)
+	for i := range r.Detections {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = appendDetection(dst, &r.Detections[i], r.fields)
+	}
+	dst = append(dst, ']')
+	if r.Skipped {
+		dst = append(dst, `,"skipped":true`...)
+	}
+	if r.Interpolated {
+		dst = append(dst, `,"interpolated":true`...)
+	}
+	if c := r.Crowd; c != nil {
+		dst = append(dst, `,"crowd":{"source":`...)
+		dst = appendJSONString(dst, c.Source)
+		dst = appendCrowdCount(append(dst, ','), c.crowdCount)
+		if len(c.Zones) > 0 {
+			dst = append(dst, `,"zones":[`...)
+			for i, z := range c.Zones {
+				if i > 0 {
+					dst = append(dst, ',')
+				}
+				dst = appendJSONString(append(dst, `{"name":`...), z.Name)
+				dst = append(appendCrowdCount(append(dst, ','), z.crowdCount), '}')
+			}
+			dst = append(dst, ']')
+		}
+		dst = append(dst, '}')
+	}
+	if r.Width > 0 {
+		dst = append(dst, `,"width":`...)
+		dst = strconv.AppendInt(dst, int64(r.Width), 10)
+		dst = append(dst, `,"height":`...)
+		dst = strconv.AppendInt(dst, int64(r.Height), 10)
+	}
+	if r.ImgSz > 0 {
+		dst = append(dst, `,"imgsz":`...)
+		dst = strconv.AppendInt(dst, int64(r.ImgSz), 10)
+	}
+	if r.Model != "" {
+		dst = append(dst, `,"model":`...)
+		dst = appendJSONString(dst, r.Model)
+	}
+	if r.ModelVersion != "" {
+		dst = append(dst, `,"model_version":`...)
+		dst = appendJSONString(dst, r.ModelVersion)
+	}
+	if !r.Time.IsZero() {
+		dst = append(dst, `,"ts":`...)
+		dst = strconv.AppendInt(dst, r.Time.UnixMilli(), 10)
+	}
+	return append(dst, '}')
+}
+
+func appendCrowdCount(dst []byte, c crowdCount) []byte {
+	dst = append(dst, `"count":`...)
+	dst = strconv.AppendFloat(dst, c.Count, 'f', -1, 64)
+	dst = append(dst, `,"low":`...)
+	dst = strconv.AppendFloat(dst, c.Low, 'f', -1, 64)
+	dst = append(dst, `,"high":`...)
+	return strconv.AppendFloat(dst, c.High, 'f', -1, 64)
+}
+
+func appendDetection(dst []byte, d *postprocess.Detection, f detFields) []byte {
+	dst = append(dst, '{')
+	n := len(dst)
+	key := func(k string) {
+		if len(dst) > n {
+			dst = append(dst, ',')
+		}
+		dst = append(dst, k...)
+	}
+	if f.has(fieldBox) {
+		key(`"box":[`)
+		for i, v := range d.Box {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			dst = strconv.AppendInt(dst, int64(v), 10)
+		}
+		dst = append(dst, ']')
+	}
+	if f.has(fieldScore) {
+		key(`"score":`)
+		dst = strconv.AppendFloat(dst, d.Score, 'f', -1, 64)
+	}
+	if f.has(fieldLabel) {
+		key(`"label":`)
+		dst = strconv.AppendInt(dst, int64(d.Label), 10)
+	}
+	if f.has(fieldName) {
+		key(`"name":`)
+		dst = appendJSONString(dst, d.Name)
+	}
+	if a := d.Attributes; a != nil && f.has(fieldAttributes) {
+		key(`"attributes":`)
+		dst = appendAttributes(dst, a)
+	}
+	return append(dst, '}')
+}
+
+func appendAttributes(dst []byte, a *postprocess.Attributes) []byte {
+	dst = append(dst, '{')
+	n := len(dst)
+	key := func(k string) {
+		if len(dst) > n {
+			dst = append(dst, ',')
+		}
+		dst = append(dst, k...)
+	}
+	if a.Plate != "" {
+		key(`"plate":`)
+		dst = appendJSONString(dst, a.Plate)
+	}
+	if a.PlateScore != 0 {
+		key(`"plate_score":`)
+		dst = strconv.AppendFloat(dst, a.PlateScore, 'f', -1, 64)
+	}
+	if a.Color != "" {
+		key(`"color":`)
+		dst = appendJSONString(dst, a.Color)
+	}
+	if a.Direction != "" {
+		key(`"direction":`)
+		dst = appendJSONString(dst, a.Direction)
+	}
+	if v := a.Velocity; v != nil {
+		key(`"velocity":[`)
+		dst = strconv.AppendFloat(dst, v[0], 'f', -1, 64)
+		dst = strconv.AppendFloat(append(dst, ','), v[1], 'f', -1, 64)
+		dst = append(dst, ']')
+	}
+	if g := a.Ground; g != nil {
+		key(`"ground":[`)
+		dst = strconv.AppendFloat(dst, g[0], 'f', -1, 64)
+		dst = strconv.AppendFloat(append(dst, ','), g[1], 'f', -1, 64)
+		dst = append(dst, ']')
+	}
+	if a.Distance != 0 {
+		key(`"distance":`)
+		dst = strconv.AppendFloat(dst, a.Distance, 'f', -1, 64)
+	}
+	if a.SpeedKmh != 0 {
+		key(`"speed_kmh":`)
+		dst = strconv.AppendFloat(dst, a.SpeedKmh, 'f', -1, 64)
+	}
+	if a.Crop != "" {
+		key(`"crop":`)
+		dst = appendJSONString(dst, a.Crop)
+	}
+	if a.CropID != "" {
+		key(`"crop_id":`)
+		dst = appendJSONString(dst, a.CropID)
+	}
+	return append(dst, '}')
+}
+
+const hexDigits = "0123456789abcdef"
+
+// appendJSONString quotes s the way encoding/json does, including the
+// HTML-safe escapes for <, > and &.
+func appendJSONString(dst []byte, s string) []byte {
+	dst = append(dst, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		b := s[i]
+		if b < utf8.RuneSelf {
+			if b >= 0x20 && b != '"' && b != '\\' && b != '<' && b != '>' && b != '&' {
+				i++
+				continue
+			}
+			dst = append(dst, s[start:i]...)
+			switch b {
+			case '"', '\\':
+				dst = append(dst, '\\', b)
+			case '\n':
+				dst = append(dst, '\\', 'n')
+			case '\r':
+				dst = append(dst, '\\', 'r')
+			case '\t':
+				dst = append(dst, '\\', 't')
+			default:
+				dst = append(dst, '\\', 'u', '0', '0', hexDigits[b>>4], hexDigits[b&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, "\ufffd"...)
+			i += size
+			start = i
+			continue
+		}
+		if r == '\u2028' || r == '\u2029' {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, '\\', 'u', '2', '0', '2', hexDigits[r&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	dst = append(dst, s[start:]...)
+	return append(dst, '"')
+}
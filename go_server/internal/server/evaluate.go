@@ -0,0 +1,184 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"yolo-server/internal/postprocess"
+)
+
+// ── 데이터셋 평가 ────────────────────────────────────────────────────────────
+// POST /admin/evaluate scores the model against a labelled dataset. The
+// multipart body holds a COCO ground-truth file as "ground_truth" and
+// either the images, as "image" parts named like the file's file_name, or
+// a COCO results list as "results", e.g. one saved from an earlier run.
+// Images are inferred as they arrive, at batch priority and at ?conf=
+// (default 0.001, so the whole precision-recall curve is seen), and only
+// the images sent count; with results every image of the file does.
+// Boxes are the model's own, before POSTPROCESS stages, and are matched to
+// the ground truth's categories by name. The answer is
+// postprocess.Evaluation, with precision and recall at ?score=
+// (default CONF_THRESHOLD).
+
+const (
+	evalConfDefault = 0.001
+	maxEvalMeta     = 256 << 20 // ground_truth and results parts
+)
+
+// cocoGroundTruth is the part of a COCO file evaluation reads.
+type cocoGroundTruth struct {
+	Images []struct {
+		ID       int    `json:"id"`
+		FileName string `json:"file_name"`
+	} `json:"images"`
+	Annotations []struct {
+		ImageID    int        `json:"image_id"`
+		CategoryID int        `json:"category_id"`
+		BBox       [4]float64 `json:"bbox"`
+		IsCrowd    int        `json:"iscrowd"`
+	} `json:"annotations"`
+	Categories []struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	} `json:"categories"`
+}
+
+// cocoResult is one entry of a COCO results list.
+type cocoResult struct {
+	ImageID    int        `json:"image_id"`
+	CategoryID int        `json:"category_id"`
+	BBox       [4]float64 `json:"bbox"`
+	Score      float64    `json:"score"`
+}
+
+// evaluationResponse is the answer of POST /admin/evaluate.
+type evaluationResponse struct {
+	Images  int      `json:"images"`            // evaluated
+	Missing int      `json:"missing"`           // in the ground truth but not sent
+	Unknown []string `json:"unknown,omitempty"` // sent but not in the ground truth
+	Elapsed float64  `json:"elapsed_s"`
+	postprocess.Evaluation
+}
+
+func xywh(b [4]float64) [4]float64 { return [4]float64{b[0], b[1], b[0] + b[2], b[1] + b[3]} }
+
+func (s *Server) adminEvaluate(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	q := r.URL.Query()
+	st, err := newStreamState(q, &s.cfg)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	opts := st.options(s.settings(), true)
+	opts.ConfThreshold, opts.ConfMargin = evalConfDefault, 0
+	score := s.settings().ConfThreshold
+	for name, dst := range map[string]*float64{"conf": &opts.ConfThreshold, "score": &score} {
+		if v := q.Get(name); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil || f < 0 || f > 1 {
+				writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("%s: want [0, 1], got %q", name, v))
+				return
+			}
+			*dst = f
+		}
+	}
+	mr, err := r.MultipartReader()
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "want a multipart/form-data body")
+		return
+	}
+
+	var gt *cocoGroundTruth
+	var results []cocoResult
+	dets := map[string][]postprocess.Detection{} // by image file name
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "read body failed")
+			return
+		}
+		switch part.FormName() {
+		case "ground_truth":
+			gt = &cocoGroundTruth{}
+			err = json.NewDecoder(io.LimitReader(part, maxEvalMeta)).Decode(gt)
+		case "results":
+			err = json.NewDecoder(io.LimitReader(part, maxEvalMeta)).Decode(&results)
+		case "image":
+			var data []byte
+			if data, err = io.ReadAll(io.LimitReader(part, maxUploadSize+1)); err == nil && len(data) > maxUploadSize {
+				err = fmt.Errorf("larger than %d bytes", maxUploadSize)
+			}
+			if err == nil {
+				free := s.sched.acquire(prioBatch)
+				dets[path.Base(part.FileName())], err = s.detector(nil).Detect(data, opts)
+				free()
+			}
+			if err != nil {
+				err = fmt.Errorf("%s: %w", part.FileName(), err)
+			}
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("%s: %v", part.FormName(), err))
+			return
+		}
+	}
+	if gt == nil {
+		writeJSONError(w, http.StatusBadRequest, "ground_truth: a COCO file is required")
+		return
+	}
+
+	names := map[int]string{}
+	for _, c := range gt.Categories {
+		names[c.ID] = c.Name
+	}
+	ids := map[string]int{}
+	for _, img := range gt.Images {
+		ids[path.Base(img.FileName)] = img.ID
+	}
+	resp := evaluationResponse{}
+	evaluated := map[int]bool{}
+	var found []postprocess.EvalBox
+	for name, ds := range dets {
+		id, ok := ids[name]
+		if !ok {
+			resp.Unknown = append(resp.Unknown, name)
+			continue
+		}
+		evaluated[id] = true
+		for _, d := range ds {
+			box := [4]float64{float64(d.Box[0]), float64(d.Box[1]), float64(d.Box[2]), float64(d.Box[3])}
+			found = append(found, postprocess.EvalBox{Image: id, Class: d.Name, Box: box, Score: d.Score})
+		}
+	}
+	if results != nil {
+		for _, img := range gt.Images {
+			evaluated[img.ID] = true
+		}
+		for _, res := range results {
+			found = append(found, postprocess.EvalBox{Image: res.ImageID, Class: names[res.CategoryID], Box: xywh(res.BBox), Score: res.Score})
+		}
+	}
+	var truth []postprocess.EvalBox
+	for _, a := range gt.Annotations {
+		if evaluated[a.ImageID] {
+			truth = append(truth, postprocess.EvalBox{Image: a.ImageID, Class: names[a.CategoryID], Box: xywh(a.BBox), Crowd: a.IsCrowd != 0})
+		}
+	}
+	resp.Images, resp.Missing = len(evaluated), len(gt.Images)-len(evaluated)
+	resp.Evaluation = postprocess.Evaluate(truth, found, score)
+	resp.Elapsed = time.Since(start).Round(time.Millisecond).Seconds()
+	slog.Info("admin: model evaluated", "remote", s.clientIP(r), "images", resp.Images,
+		"map50", resp.MAP50, "map50_95", resp.MAP5095, "elapsed", time.Since(start))
+	writeJSON(w, http.StatusOK, resp)
+}
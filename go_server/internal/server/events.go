@@ -0,0 +1,617 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"yolo-server/internal/postprocess"
+	"yolo-server/internal/preprocess"
+	"yolo-server/internal/video"
+)
+
+// ── 이벤트 ───────────────────────────────────────────────────────────────────
+// With EVENT_CLASSES set, an inferred frame with a detection of one of
+// those classes, matching EVENT_WHEN if set, raises an event, at most once
+// per stream and class every EVENT_COOLDOWN. The newest EVENT_KEEP events
+// are kept in memory. With EVENT_CLIP_DIR set as well, each event keeps the
+// frame that raised it as its snapshot, and gets an MP4 clip, drawn as for
+// ?video=1, from EVENT_PREROLL before the frame to EVENT_POSTROLL after it;
+// a stream keeps its last EVENT_PREROLL of frames for this, charged to its
+// connection like the recording ring. The clip is
+// encoded once the post-roll is in, or the stream ends, and the event's
+// "clip" goes from "pending" to "ready" or "failed". Events are queried and
+// acknowledged through the API below. With LPR_MODEL set, an event carries
+// the plate read off its detection, and detections of PLATE_ALLOWLIST
+// plates raise none.
+
+type event struct {
+	ID       string     `json:"id"`
+	Type     string     `json:"type"` // what raised it; eventClass
+	Time     time.Time  `json:"time"`
+	Captured *time.Time `json:"captured,omitempty"` // the frame's capture stamp, see e2e.go
+	Client   string     `json:"client"`
+	Stream   string     `json:"stream"` // ?stream= id, or conn<id> without one
+	Class    string     `json:"class"`
+	Score    float64    `json:"score"`
+	Box      [4]int     `json:"box"`
+	Plate    string     `json:"plate,omitempty"`
+	Snapshot string     `json:"snapshot,omitempty"` // URL of the frame, once saved
+	Clip     string     `json:"clip,omitempty"`     // "pending", "ready" or "failed"; "" without clips
+	ClipURL  string     `json:"clip_url,omitempty"`
+	AckedAt  *time.Time `json:"acked_at,omitempty"`
+	AckedBy  string     `json:"acked_by,omitempty"`
+
+	snapshot string // file name in EVENT_CLIP_DIR
+}
+
+const (
+	eventClass = "class" // a watched class was detected
+
+	clipPending = "pending"
+	clipReady   = "ready"
+	clipFailed  = "failed"
+
+	maxEventList = 1000
+)
+
+type eventLog struct {
+	classes map[string]bool
+	keep    int
+	clipDir string      // "" = no clips
+	fired   *counterVec // by class
+
+	mu     sync.Mutex
+	events []*event // oldest first
+}
+
+func newEventLog(cfg Config, m *metricSet) *eventLog {
+	el := &eventLog{
+		classes: map[string]bool{},
+		keep:    cfg.EventKeep,
+		clipDir: cfg.EventClipDir,
+		fired:   m.newCounterVec("yolo_events_total", "Events raised, by class.", "class"),
+	}
+	for _, c := range cfg.EventClasses {
+		el.classes[c] = true
+	}
+	m.newGaugeFunc("yolo_events_unacked", "Kept events not yet acknowledged, by class.", "class", el.unacked)
+	return el
+}
+
+func (el *eventLog) unacked() map[string]int64 {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	n := map[string]int64{}
+	for _, e := range el.events {
+		if e.AckedAt == nil {
+			n[e.Class]++
+		}
+	}
+	return n
+}
+
+func (el *eventLog) add(ev *event) {
+	el.fired.inc(ev.Class)
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	el.events = append(el.events, ev)
+	for len(el.events) > el.keep {
+		el.removeMedia(el.events[0])
+		el.events[0] = nil
+		el.events = el.events[1:]
+	}
+}
+
+// prune drops the events raised before cutoff, then the oldest while their
+// snapshots and clips take more than quota bytes; 0 is no quota.
+func (el *eventLog) prune(cutoff time.Time, quota int64) pruned {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	var p pruned
+	sizes := make([]int64, len(el.events))
+	for i, e := range el.events {
+		sizes[i] = el.mediaSize(e)
+		p.kept += sizes[i]
+	}
+	n := 0
+	for ; n < len(el.events) && (el.events[n].Time.Before(cutoff) || quota > 0 && p.kept > quota); n++ {
+		el.removeMedia(el.events[n])
+		el.events[n] = nil
+		p.removed++
+		p.freed += sizes[n]
+		p.kept -= sizes[n]
+	}
+	el.events = el.events[n:]
+	return p
+}
+
+// mediaSize is the bytes of ev's snapshot and clip on disk.
+func (el *eventLog) mediaSize(ev *event) int64 {
+	var n int64
+	if ev.snapshot != "" {
+		if st, err := os.Stat(filepath.Join(el.clipDir, ev.snapshot)); err == nil {
+			n += st.Size()
+		}
+	}
+	if ev.Clip == clipReady {
+		if st, err := os.Stat(el.clipPath(ev.ID)); err == nil {
+			n += st.Size()
+		}
+	}
+	return n
+}
+
+// setClip records how ev's clip came out. A clip of an event already let go
+// is removed.
+func (el *eventLog) setClip(ev *event, state string) {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	ev.Clip = state
+	if !el.kept(ev) {
+		el.removeMedia(ev)
+	}
+}
+
+// saveSnapshot writes the frame that raised ev.
+func (el *eventLog) saveSnapshot(ev *event, data []byte) {
+	name := ev.ID + snapshotExt(data)
+	if err := os.WriteFile(filepath.Join(el.clipDir, name), data, 0o644); err != nil {
+		slog.Warn("event snapshot", "id", ev.ID, "err", err)
+		return
+	}
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	ev.snapshot, ev.Snapshot = name, "/events/"+ev.ID+"/snapshot"
+	if !el.kept(ev) {
+		el.removeMedia(ev)
+	}
+}
+
+func snapshotExt(data []byte) string {
+	switch http.DetectContentType(data) {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	case "image/webp":
+		return ".webp"
+	}
+	return ".bin"
+}
+
+// kept reports whether ev is still in the log. el.mu is held.
+func (el *eventLog) kept(ev *event) bool {
+	for _, e := range el.events {
+		if e == ev {
+			return true
+		}
+	}
+	return false
+}
+
+func (el *eventLog) removeMedia(ev *event) {
+	if ev.Clip == clipReady {
+		_ = os.Remove(el.clipPath(ev.ID))
+	}
+	if ev.snapshot != "" {
+		_ = os.Remove(filepath.Join(el.clipDir, ev.snapshot))
+	}
+}
+
+func (el *eventLog) clipPath(id string) string {
+	return filepath.Join(el.clipDir, id+".mp4")
+}
+
+// find returns a copy of event id, if it belongs to client; "" is any
+// client.
+func (el *eventLog) find(client, id string) (event, bool) {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	if e := el.lookup(client, id); e != nil {
+		return *e, true
+	}
+	return event{}, false
+}
+
+// lookup is find without the copy. el.mu is held.
+func (el *eventLog) lookup(client, id string) *event {
+	for _, e := range el.events {
+		if e.ID == id && (client == "" || e.Client == client) {
+			return e
+		}
+	}
+	return nil
+}
+
+// ack marks event id acknowledged by who, unless it already is, and
+// returns a copy.
+func (el *eventLog) ack(client, id, who string) (event, bool) {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	e := el.lookup(client, id)
+	if e == nil {
+		return event{}, false
+	}
+	if e.AckedAt == nil {
+		now := time.Now()
+		e.AckedAt, e.AckedBy = &now, who
+	}
+	return *e, true
+}
+
+// ── 스트림별 감시 ────────────────────────────────────────────────────────────
+
+type eventWatch struct {
+	s       *Server
+	ci      *connInfo
+	client  string
+	stream  string
+	last    map[string]time.Time // last event by class
+	pre     *video.Buffer        // nil without clips
+	clips   []*eventClip         // waiting for their post-roll
+	charged int64                // bytes of pre and clips charged to ci
+}
+
+type eventClip struct {
+	ev    *event
+	buf   *video.Buffer
+	until time.Time
+}
+
+// newEventWatch watches a stream, or returns nil without EVENT_CLASSES.
+func (s *Server) newEventWatch(r *http.Request, ci *connInfo, st *streamState) *eventWatch {
+	if s.events == nil {
+		return nil
+	}
+	w := &eventWatch{s: s, ci: ci, client: clientLabel(r), stream: streamName(ci, st), last: map[string]time.Time{}}
+	if s.events.clipDir != "" {
+		w.pre = video.NewBuffer(s.cfg.EventPreroll, s.cfg.VideoFPS)
+	}
+	return w
+}
+
+// observe takes a frame as the client was shown it; inferred frames are
+// checked for events.
+func (w *eventWatch) observe(f video.Frame, inferred bool) {
+	if w == nil {
+		return
+	}
+	if w.pre != nil {
+		w.pre.Add(f)
+	}
+	open := w.clips[:0]
+	for _, c := range w.clips {
+		if f.At.After(c.until) {
+			w.finish(c)
+			continue
+		}
+		c.buf.Add(f)
+		open = append(open, c)
+	}
+	w.clips = open
+	if inferred {
+		w.check(f)
+	}
+	if w.pre != nil {
+		w.account()
+	}
+}
+
+// account charges ci for what the buffers hold now. A frame in both the
+// pre-roll and a clip counts twice, which errs on the safe side.
+func (w *eventWatch) account() {
+	n := w.pre.Bytes()
+	for _, c := range w.clips {
+		n += c.buf.Bytes()
+	}
+	w.s.mem.charge(w.ci, memEvent, n-w.charged)
+	w.charged = n
+}
+
+func (w *eventWatch) check(f video.Frame) {
+	mode := w.s.arming.mode(w.client, w.stream, f.At)
+	best := map[string]postprocess.Detection{}
+	for _, d := range f.Dets {
+		if w.s.events.classes[d.Name] && w.s.arming.raises(mode, d.Name) && d.Score > best[d.Name].Score &&
+			!w.s.allowedPlate(d) && (w.s.cfg.EventWhen == nil || w.s.cfg.EventWhen.Match(&d)) {
+			best[d.Name] = d
+		}
+	}
+	var data []byte // the frame as it may leave the server, once needed
+	for class, d := range best {
+		if last, ok := w.last[class]; ok && f.At.Sub(last) < w.s.cfg.EventCooldown {
+			continue
+		}
+		w.last[class] = f.At
+		ev := &event{
+			ID: newSessionID(), Type: eventClass, Time: f.At, Client: w.client, Stream: w.stream,
+			Class: class, Score: d.Score, Box: d.Box,
+		}
+		if d.Attributes != nil {
+			ev.Plate = d.Attributes.Plate
+		}
+		if !f.Captured.IsZero() {
+			captured := f.Captured
+			ev.Captured = &captured
+		}
+		if w.pre != nil {
+			ev.Clip, ev.ClipURL = clipPending, "/events/"+ev.ID+"/clip"
+			c := &eventClip{ev: ev, buf: video.NewBuffer(w.s.cfg.EventPreroll+w.s.cfg.EventPostroll, w.s.cfg.VideoFPS), until: f.At.Add(w.s.cfg.EventPostroll)}
+			for _, pf := range w.pre.Frames() {
+				c.buf.Add(pf)
+			}
+			w.clips = append(w.clips, c)
+		}
+		if data == nil {
+			data = frameData(f)
+		}
+		w.s.notifier.event(ev, data)
+		w.s.feeds.publish(w.client, w.stream, "event", ev)
+		w.s.events.add(ev)
+		if w.pre != nil && data != nil {
+			go w.s.events.saveSnapshot(ev, data)
+		}
+		slog.Info("event", "id", ev.ID, "client", ev.Client, "stream", ev.Stream, "class", class, "score", d.Score)
+	}
+}
+
+// allowedPlate reports whether the plate read off d is on PLATE_ALLOWLIST.
+func (s *Server) allowedPlate(d postprocess.Detection) bool {
+	return d.Attributes != nil && d.Attributes.Plate != "" &&
+		slices.Contains(s.cfg.PlateAllowlist, normalizePlate(d.Attributes.Plate))
+}
+
+// normalizePlate is p as plates are compared: upper case, without spaces
+// or dashes.
+func normalizePlate(p string) string {
+	return strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(p)))
+}
+
+// frameData is f's image with its privacy zones blacked out and blurred
+// classes pixelated, or nil if it cannot be redacted.
+func frameData(f video.Frame) []byte {
+	if len(f.Mask) == 0 && len(f.Blur) == 0 {
+		return f.Data
+	}
+	b, err := preprocess.Redact(f.Data, f.Mask, f.Blur)
+	if err != nil {
+		slog.Warn("event snapshot redact", "err", err)
+		return nil
+	}
+	return b
+}
+
+// finish encodes c in the background; its frames stay charged to the
+// connection until they are written.
+func (w *eventWatch) finish(c *eventClip) {
+	el := w.s.events
+	cfg := video.Config{FPS: w.s.cfg.VideoFPS, Codec: w.s.cfg.VideoCodec}
+	n := c.buf.Bytes()
+	w.charged -= n
+	go func() {
+		defer w.s.mem.charge(w.ci, memEvent, -n)
+		state := clipReady
+		if err := video.WriteClip(cfg, el.clipPath(c.ev.ID), c.buf.Frames()); err != nil {
+			slog.Warn("event clip", "id", c.ev.ID, "err", err)
+			state = clipFailed
+		}
+		el.setClip(c.ev, state)
+	}()
+}
+
+// close encodes the clips still waiting, short of their post-roll.
+func (w *eventWatch) close() {
+	if w == nil {
+		return
+	}
+	for _, c := range w.clips {
+		w.finish(c)
+	}
+	w.clips = nil
+	w.s.mem.charge(w.ci, memEvent, -w.charged)
+	w.charged = 0
+}
+
+// ── API ──────────────────────────────────────────────────────────────────────
+// GET /events lists the caller's events, newest first, filtered by ?type=,
+// ?stream=, ?class=, ?plate=, ?since= and ?until= (RFC 3339) and ?acked=;
+// ?limit= caps the page, and "next", when set, is the ?before= of the next
+// one.
+// GET /events/{id} is one event, POST /events/{id}/ack acknowledges it, and
+// /snapshot and /clip fetch its media. The same routes under /admin/events
+// reach every client's events, and the list takes ?client= as well.
+
+// eventHandler serves the events of client; "" is every client's.
+type eventHandler func(w http.ResponseWriter, r *http.Request, client string)
+
+func ownEvents(h eventHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) { h(w, r, clientLabel(r)) }
+}
+
+func anyEvents(h eventHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) { h(w, r, "") }
+}
+
+type eventQuery struct {
+	client, typ, stream, class string
+	plate                      string // normalized
+	since, until               time.Time
+	acked                      *bool
+	before                     string // newest event ID not to list, with those after it
+	limit                      int
+}
+
+func parseEventQuery(q url.Values) (eventQuery, error) {
+	eq := eventQuery{
+		client: q.Get("client"), typ: q.Get("type"), stream: q.Get("stream"), class: q.Get("class"),
+		plate:  normalizePlate(q.Get("plate")),
+		before: q.Get("before"), limit: 100,
+	}
+	for _, t := range []struct {
+		key string
+		to  *time.Time
+	}{{"since", &eq.since}, {"until", &eq.until}} {
+		if v := q.Get(t.key); v != "" {
+			at, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return eq, fmt.Errorf("%s: want an RFC 3339 time, got %q", t.key, v)
+			}
+			*t.to = at
+		}
+	}
+	if v := q.Get("acked"); v != "" {
+		acked, err := strconv.ParseBool(v)
+		if err != nil {
+			return eq, fmt.Errorf("acked: want a boolean, got %q", v)
+		}
+		eq.acked = &acked
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxEventList {
+			return eq, fmt.Errorf("limit: want 1..%d, got %q", maxEventList, v)
+		}
+		eq.limit = n
+	}
+	return eq, nil
+}
+
+func (eq *eventQuery) match(e *event) bool {
+	return (eq.client == "" || e.Client == eq.client) &&
+		(eq.typ == "" || e.Type == eq.typ) &&
+		(eq.stream == "" || e.Stream == eq.stream) &&
+		(eq.class == "" || e.Class == eq.class) &&
+		(eq.plate == "" || normalizePlate(e.Plate) == eq.plate) &&
+		(eq.since.IsZero() || !e.Time.Before(eq.since)) &&
+		(eq.until.IsZero() || e.Time.Before(eq.until)) &&
+		(eq.acked == nil || (e.AckedAt != nil) == *eq.acked)
+}
+
+// query returns a page of matching events, newest first, and the cursor of
+// the next page, or "" on the last.
+func (el *eventLog) query(eq eventQuery) ([]event, string) {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	i := len(el.events) - 1
+	if eq.before != "" {
+		for i >= 0 && el.events[i].ID != eq.before {
+			i--
+		}
+		i-- // an unknown cursor has fallen out of the log; the page is empty
+	}
+	events := []event{}
+	for ; i >= 0; i-- {
+		if e := el.events[i]; eq.match(e) {
+			if len(events) == eq.limit {
+				return events, events[len(events)-1].ID
+			}
+			events = append(events, *e)
+		}
+	}
+	return events, ""
+}
+
+func (s *Server) listEvents(w http.ResponseWriter, r *http.Request, client string) {
+	eq, err := parseEventQuery(r.URL.Query())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if client != "" {
+		eq.client = client
+	}
+	events, next := []event{}, ""
+	if s.events != nil {
+		events, next = s.events.query(eq)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"events": events, "next": next})
+}
+
+func (s *Server) getEvent(w http.ResponseWriter, r *http.Request, client string) {
+	ev, ok := s.findEvent(w, r, client)
+	if ok {
+		writeJSON(w, http.StatusOK, ev)
+	}
+}
+
+// ackEvent acknowledges the event; acknowledging it again changes nothing.
+func (s *Server) ackEvent(w http.ResponseWriter, r *http.Request, client string) {
+	who := client
+	if who == "" {
+		who = "admin"
+	}
+	if s.events != nil {
+		if ev, ok := s.events.ack(client, r.PathValue("id"), who); ok {
+			writeJSON(w, http.StatusOK, ev)
+			return
+		}
+	}
+	writeJSONError(w, http.StatusNotFound, "no such event")
+}
+
+func (s *Server) findEvent(w http.ResponseWriter, r *http.Request, client string) (event, bool) {
+	if s.events != nil {
+		if ev, ok := s.events.find(client, r.PathValue("id")); ok {
+			return ev, true
+		}
+	}
+	writeJSONError(w, http.StatusNotFound, "no such event")
+	return event{}, false
+}
+
+func (s *Server) eventSnapshot(w http.ResponseWriter, r *http.Request, client string) {
+	ev, ok := s.findEvent(w, r, client)
+	if !ok {
+		return
+	}
+	if ev.snapshot == "" {
+		writeJSONError(w, http.StatusNotFound, "event has no snapshot")
+		return
+	}
+	serveEventFile(w, r, filepath.Join(s.events.clipDir, ev.snapshot), "")
+}
+
+func (s *Server) eventClip(w http.ResponseWriter, r *http.Request, client string) {
+	ev, ok := s.findEvent(w, r, client)
+	switch {
+	case !ok:
+		return
+	case ev.Clip == clipPending:
+		w.Header().Set("Retry-After", strconv.Itoa(int(s.cfg.EventPostroll.Seconds())+1))
+		writeJSONError(w, http.StatusConflict, "clip is still being recorded")
+		return
+	case ev.Clip != clipReady:
+		writeJSONError(w, http.StatusNotFound, "event has no clip")
+		return
+	}
+	serveEventFile(w, r, s.events.clipPath(ev.ID), "video/mp4")
+}
+
+// serveEventFile serves path with range support; an empty contentType is
+// sniffed.
+func serveEventFile(w http.ResponseWriter, r *http.Request, path, contentType string) {
+	f, err := os.Open(path)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "event media is gone")
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"yolo-server/internal/video"
+)
+
+func TestEventWatchChargesPreroll(t *testing.T) {
+	s := &Server{}
+	ci := &connInfo{}
+	w := &eventWatch{s: s, ci: ci, pre: video.NewBuffer(time.Second, 10)}
+
+	start := time.Now()
+	for i := 0; i < 30; i++ {
+		w.observe(video.Frame{Data: make([]byte, 100), At: start.Add(time.Duration(i) * 100 * time.Millisecond)}, false)
+		if got, want := ci.mem.Load(), w.pre.Bytes(); got != want {
+			t.Fatalf("frame %d: connection charged %d, pre-roll holds %d", i, got, want)
+		}
+	}
+	if got := w.pre.Bytes(); got != 1100 {
+		t.Errorf("pre-roll holds %d bytes, want 1100", got)
+	}
+	if got := s.mem.stats().ByKind["event"]; got != 1100 {
+		t.Errorf("event memory = %d, want 1100", got)
+	}
+
+	w.close()
+	if got := ci.mem.Load(); got != 0 {
+		t.Errorf("connection charged %d after close, want 0", got)
+	}
+	if got := s.mem.total.Load(); got != 0 {
+		t.Errorf("server charged %d after close, want 0", got)
+	}
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"yolo-server/internal/postprocess"
+	"yolo-server/internal/video"
+)
+
+// ── 스트림 구독 (SSE) ────────────────────────────────────────────────────────
+// GET /streams/{id}/events follows one of the caller's streams as
+// Server-Sent Events, for consumers that would rather not speak WebSocket:
+// a "detections" event for every inferred frame, and an "event" event for
+// every event the stream raises. {id} is the stream's ?stream= id, or
+// conn<id> without one, as in events. Subscribing does not wait for the
+// stream; frames are sent from whenever it runs, across reconnects.
+
+const (
+	// feedSubQueue is how many messages a slow subscriber may fall behind
+	// before messages are skipped.
+	feedSubQueue = 16
+	// feedKeepalive spaces the comments that keep an idle response open
+	// through proxies.
+	feedKeepalive = 15 * time.Second
+)
+
+type feedMsg struct {
+	kind string // SSE event name
+	data []byte
+}
+
+// feedFrame is the data of a "detections" message.
+type feedFrame struct {
+	Frame      uint64                  `json:"frame"`
+	Time       time.Time               `json:"time"`
+	Captured   *time.Time              `json:"captured,omitempty"`
+	Detections []postprocess.Detection `json:"detections"`
+}
+
+type feeds struct {
+	mu   sync.Mutex
+	subs map[string]map[chan feedMsg]struct{} // by armKey(client, stream)
+}
+
+func newFeeds() *feeds {
+	return &feeds{subs: map[string]map[chan feedMsg]struct{}{}}
+}
+
+func (fs *feeds) subscribe(client, stream string) chan feedMsg {
+	ch := make(chan feedMsg, feedSubQueue)
+	k := armKey(client, stream)
+	fs.mu.Lock()
+	if fs.subs[k] == nil {
+		fs.subs[k] = map[chan feedMsg]struct{}{}
+	}
+	fs.subs[k][ch] = struct{}{}
+	fs.mu.Unlock()
+	return ch
+}
+
+func (fs *feeds) unsubscribe(client, stream string, ch chan feedMsg) {
+	k := armKey(client, stream)
+	fs.mu.Lock()
+	delete(fs.subs[k], ch)
+	if len(fs.subs[k]) == 0 {
+		delete(fs.subs, k)
+	}
+	fs.mu.Unlock()
+}
+
+// publish sends v to the stream's subscribers, and costs nothing without
+// any.
+func (fs *feeds) publish(client, stream, kind string, v any) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	subs := fs.subs[armKey(client, stream)]
+	if len(subs) == 0 {
+		return
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	for ch := range subs {
+		select {
+		case ch <- feedMsg{kind: kind, data: b}:
+		default: // behind; it gets the next one
+		}
+	}
+}
+
+// frame publishes an inferred frame's detections.
+func (fs *feeds) frame(client, stream string, seq uint64, f video.Frame) {
+	ff := feedFrame{Frame: seq, Time: f.At, Detections: f.Dets}
+	if !f.Captured.IsZero() {
+		ff.Captured = &f.Captured
+	}
+	if ff.Detections == nil {
+		ff.Detections = []postprocess.Detection{}
+	}
+	fs.publish(client, stream, "detections", ff)
+}
+
+// ── API ──────────────────────────────────────────────────────────────────────
+
+// streamEvents serves GET /streams/{id}/events until the client leaves.
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request) {
+	client, stream, ok := armTarget(w, r)
+	if !ok {
+		return
+	}
+	rc := http.NewResponseController(w)
+	ch := s.feeds.subscribe(client, stream)
+	defer s.feeds.unsubscribe(client, stream, ch)
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no") // nginx would hold the events back
+	w.WriteHeader(http.StatusOK)
+	_, err := io.WriteString(w, ": "+stream+"\n\n")
+	t := time.NewTicker(feedKeepalive)
+	defer t.Stop()
+	for err == nil {
+		if err = rc.Flush(); err != nil {
+			return
+		}
+		select {
+		case m := <-ch:
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", m.kind, m.data)
+		case <-t.C:
+			_, err = io.WriteString(w, ": keepalive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestFeedsPublish(t *testing.T) {
+	fs := newFeeds()
+	fs.publish("a", "cam", "event", 1) // no subscribers: nothing to do
+
+	ch := fs.subscribe("a", "cam")
+	other := fs.subscribe("b", "cam")
+	for i := 0; i < feedSubQueue+3; i++ {
+		fs.publish("a", "cam", "event", i)
+	}
+	if got := len(ch); got != feedSubQueue {
+		t.Errorf("queued %d, want %d; a slow subscriber must not block", got, feedSubQueue)
+	}
+	if got := len(other); got != 0 {
+		t.Errorf("another client's subscriber got %d messages", got)
+	}
+	if m := <-ch; m.kind != "event" || string(m.data) != "0" {
+		t.Errorf("first message = %s %s, want event 0", m.kind, m.data)
+	}
+
+	fs.unsubscribe("a", "cam", ch)
+	fs.unsubscribe("b", "cam", other)
+	if len(fs.subs) != 0 {
+		t.Errorf("subscriptions left: %v", fs.subs)
+	}
+}
+
+func TestStreamEvents(t *testing.T) {
+	srv := httptest.NewServer(newTestServer(t, ""))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/streams/no%20such/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid id: status %d, want 400", resp.StatusCode)
+	}
+
+	resp, err = http.Get(srv.URL + "/streams/cam-1/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	sse := bufio.NewReader(resp.Body)
+	if line, err := sse.ReadString('\n'); err != nil || !strings.HasPrefix(line, ":") {
+		t.Fatalf("first line = %q, %v; want a comment", line, err)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws/stream?stream=cam-1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := conn.WriteMessage(websocket.BinaryMessage, testPNG(t, 64, 48)); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			resp.Body.Close() // fail the read below rather than hang
+		}
+	}()
+	var event string
+	for {
+		line, err := sse.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading events: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			if event != "detections" {
+				t.Fatalf("event %q, want detections", event)
+			}
+			var ff feedFrame
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ff); err != nil {
+				t.Fatal(err)
+			}
+			if ff.Frame != 1 || ff.Detections == nil {
+				t.Errorf("detections = %+v, want frame 1 with a detections list", ff)
+			}
+			return
+		}
+	}
+}
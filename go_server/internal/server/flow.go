@@ -0,0 +1,113 @@
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// ── 흐름 제어 ────────────────────────────────────────────────────────────────
+// Streams opt in with ?flow=. In "advise" mode the server sends
+//
+//	{"backpressure": {"queue_depth": 3, "fps": 7.5, "saturated": true}}
+//
+// when the load advice (load.go) changes, at most once per loadInterval.
+// "credit" mode adds a credit window: {"credits": n} grants n more frames,
+// and a frame sent without credit is answered with code "no_credit" and not
+// inferred. Credits are handed back as frames are answered, up to ?credits=
+// (FLOW_CREDITS) normally and up to one while the server is saturated, so a
+// client that follows them never has more than that many frames
+// outstanding. Frames still in transit are invisible to the server, so only
+// sends beyond every credit granted so far are caught.
+
+const (
+	flowAdvise = "advise"
+	flowCredit = "credit"
+
+	maxFlowCredits = 64
+)
+
+// jsonWriter is where flow-control messages go: the stream's pipeline.
+type jsonWriter interface {
+	WriteJSON(v any) error
+}
+
+// flowState belongs to one stream's pipeline goroutine; no locking.
+type flowState struct {
+	mode    string // "", flowAdvise or flowCredit
+	window  int
+	credits int    // frames the client may still send
+	sent    advice // last advice sent
+}
+
+func newFlowState(q url.Values, window int) (*flowState, error) {
+	fl := &flowState{mode: q.Get("flow"), window: window}
+	switch fl.mode {
+	case "", flowAdvise, flowCredit:
+	default:
+		return nil, fmt.Errorf("flow: want advise or credit, got %q", fl.mode)
+	}
+	if v := q.Get("credits"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxFlowCredits {
+			return nil, fmt.Errorf("credits: want 1..%d, got %q", maxFlowCredits, v)
+		}
+		fl.window = n
+	}
+	return fl, nil
+}
+
+// start sends the initial advice and credit grant.
+func (fl *flowState) start(conn jsonWriter, adv advice) error {
+	if fl.mode == "" {
+		return nil
+	}
+	fl.sent = adv
+	if err := conn.WriteJSON(map[string]advice{"backpressure": adv}); err != nil {
+		return err
+	}
+	return fl.answered(conn, adv)
+}
+
+// receive is called for every frame before it is handled. It reports
+// whether the frame was sent within the client's credit.
+func (fl *flowState) receive(conn jsonWriter, adv advice) (bool, error) {
+	if fl.mode == "" {
+		return true, nil
+	}
+	if adv != fl.sent {
+		fl.sent = adv
+		if err := conn.WriteJSON(map[string]advice{"backpressure": adv}); err != nil {
+			return false, err
+		}
+	}
+	if fl.mode != flowCredit {
+		return true, nil
+	}
+	if fl.credits == 0 {
+		return false, nil
+	}
+	fl.credits--
+	return true, nil
+}
+
+// answered hands credit back once a frame has been answered.
+func (fl *flowState) answered(conn jsonWriter, adv advice) error {
+	if fl.mode != flowCredit {
+		return nil
+	}
+	return fl.topUp(conn, adv)
+}
+
+func (fl *flowState) topUp(conn jsonWriter, adv advice) error {
+	want := fl.window
+	if adv.Saturated {
+		want = 1
+	}
+	if fl.credits >= want {
+		return nil
+	}
+	n := want - fl.credits
+	fl.credits = want
+	return conn.WriteJSON(map[string]int{"credits": n})
+}
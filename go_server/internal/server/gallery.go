@@ -0,0 +1,588 @@
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"yolo-server/internal/hnsw"
+	"yolo-server/internal/inference"
+	"yolo-server/internal/postprocess"
+	"yolo-server/internal/preprocess"
+	"yolo-server/internal/video"
+)
+
+// ── 검색 갤러리 ──────────────────────────────────────────────────────────────
+// With GALLERY_DIR set, every stream's inferred frames feed a searchable
+// gallery of what they saw: a detection of GALLERY_CLASSES (any class
+// without it) is cropped as for ?crops= and indexed once per
+// GALLERY_INTERVAL for each track, or for each class when the tracker did
+// not see the frame. A crop is described by EMBED_MODEL (internal/
+// inference), or without one by its colour layout (preprocess.ColorLayout),
+// and the vector goes into an in-memory HNSW index (internal/hnsw).
+//
+// Crops are JPEGs in GALLERY_DIR, and gallery.jsonl there holds their
+// metadata and vectors, so the index is rebuilt on start. The newest
+// GALLERY_KEEP crops are kept. Crops described another way, after
+// EMBED_MODEL changed, are dropped on start, as their vectors do not
+// compare. Indexing runs in the background; a stream whose crops find it
+// behind has them left out, counted in yolo_gallery_dropped_total.
+
+const (
+	galleryLog   = "gallery.jsonl"
+	galleryQueue = 64
+	galleryM     = 16  // HNSW links per node
+	galleryBuild = 100 // HNSW candidates per insert
+	maxSearchK   = 100
+
+	embedderColor = "color-layout"
+)
+
+type galleryEntry struct {
+	ID     string    `json:"id"`
+	Time   time.Time `json:"time"`
+	Client string    `json:"client"`
+	Stream string    `json:"stream"`
+	Track  uint64    `json:"track,omitempty"`
+	Class  string    `json:"class"`
+	Score  float64   `json:"score"`
+	Box    [4]int    `json:"box"`
+
+	key  uint64 // in the index
+	vec  []float32
+	size int64 // of the crop
+}
+
+// galleryRecord is a line of gallery.jsonl.
+type galleryRecord struct {
+	galleryEntry
+	Embedder string `json:"embedder"`
+	Vector   []byte `json:"vector"` // little-endian float32s
+}
+
+type galleryJob struct {
+	client, stream string
+	at             time.Time
+	frame          []byte
+	mask, blur     []image.Rectangle
+	dets           []postprocess.Detection
+	tracks         []uint64 // by detection; 0 when not tracked
+}
+
+type gallery struct {
+	dir      string
+	keep     int
+	cropSize int                                       // CROP_MAX_SIZE
+	embedder string                                    // "color-layout" or "model:<file>"
+	embed    func(crops [][]byte) ([][]float32, error) // vectors of crops
+	jobs     chan galleryJob
+	dropped  *counterVec // by client
+
+	mu      sync.Mutex
+	index   *hnsw.Index
+	entries map[uint64]*galleryEntry // by key
+	byID    map[string]uint64
+	order   []uint64 // keys, oldest first
+	nextKey uint64
+	log     *os.File
+	lines   int // in log
+}
+
+// newGallery loads GALLERY_DIR and starts indexing in the background. det
+// embeds crops with EMBED_MODEL.
+func newGallery(cfg Config, det inference.Detector, m *metricSet) (*gallery, error) {
+	if err := os.MkdirAll(cfg.GalleryDir, 0o755); err != nil {
+		return nil, err
+	}
+	g := &gallery{
+		dir: cfg.GalleryDir, keep: cfg.GalleryKeep, cropSize: cfg.CropMaxSize, embedder: embedderColor,
+		embed: colorLayouts,
+		jobs:  make(chan galleryJob, galleryQueue),
+		dropped: m.newCounterVec("yolo_gallery_dropped_total",
+			"Crops left out of the gallery because indexing was behind.", "client"),
+		index:   hnsw.New(galleryM, galleryBuild),
+		entries: map[uint64]*galleryEntry{},
+		byID:    map[string]uint64{},
+	}
+	if cfg.EmbedModel != "" {
+		e, ok := det.(inference.Embedder)
+		if !ok {
+			return nil, fmt.Errorf("EMBED_MODEL: the %s backend cannot embed", cfg.Backend)
+		}
+		g.embedder, g.embed = "model:"+filepath.Base(cfg.EmbedModel), e.Embed
+	}
+	if err := g.load(); err != nil {
+		return nil, err
+	}
+	m.newGaugeFunc("yolo_gallery_crops", "Crops in the search gallery, by client.", "client", g.counts)
+	go g.run()
+	return g, nil
+}
+
+func colorLayouts(crops [][]byte) ([][]float32, error) {
+	out := make([][]float32, len(crops))
+	for i, c := range crops {
+		v, err := preprocess.ColorLayout(c)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+// load reads gallery.jsonl, keeps the newest crops that are still there
+// and described the current way, and writes it back with only those.
+func (g *gallery) load() error {
+	f, err := os.Open(filepath.Join(g.dir, galleryLog))
+	if errors.Is(err, os.ErrNotExist) {
+		return g.rewrite()
+	}
+	if err != nil {
+		return err
+	}
+	var recs []galleryRecord
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<20)
+	bad := 0
+	for sc.Scan() {
+		var rec galleryRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil || rec.ID == "" || len(rec.Vector)%4 != 0 {
+			bad++ // a line cut short by a crash
+			continue
+		}
+		recs = append(recs, rec)
+	}
+	err = sc.Err()
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %w", galleryLog, err)
+	}
+	dropped := 0
+	for i, rec := range recs {
+		if rec.Embedder != g.embedder || len(recs)-i > g.keep {
+			_ = os.Remove(g.cropPath(rec.ID))
+			dropped++
+			continue
+		}
+		st, err := os.Stat(g.cropPath(rec.ID))
+		if err != nil {
+			dropped++
+			continue
+		}
+		e := rec.galleryEntry
+		e.size = st.Size()
+		e.vec = make([]float32, len(rec.Vector)/4)
+		for j := range e.vec {
+			e.vec[j] = math.Float32frombits(binary.LittleEndian.Uint32(rec.Vector[4*j:]))
+		}
+		g.insert(&e)
+	}
+	if bad > 0 || dropped > 0 {
+		slog.Warn("gallery load", "kept", len(g.order), "dropped", dropped, "unreadable", bad)
+	}
+	return g.rewrite()
+}
+
+// rewrite replaces gallery.jsonl with the kept entries and opens it for
+// appending. g.mu is held, or g is not shared yet.
+func (g *gallery) rewrite() error {
+	path := filepath.Join(g.dir, galleryLog)
+	tmp, err := os.CreateTemp(g.dir, galleryLog+".*")
+	if err != nil {
+		return err
+	}
+	_ = tmp.Chmod(0o644)
+	w := bufio.NewWriter(tmp)
+	for _, key := range g.order {
+		w.Write(g.record(g.entries[key]))
+	}
+	err = w.Flush()
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if g.log != nil {
+		g.log.Close()
+	}
+	if g.log, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644); err != nil {
+		return err
+	}
+	g.lines = len(g.order)
+	return nil
+}
+
+// record is e's line in gallery.jsonl.
+func (g *gallery) record(e *galleryEntry) []byte {
+	vec := make([]byte, 4*len(e.vec))
+	for i, v := range e.vec {
+		binary.LittleEndian.PutUint32(vec[4*i:], math.Float32bits(v))
+	}
+	b, _ := json.Marshal(galleryRecord{galleryEntry: *e, Embedder: g.embedder, Vector: vec})
+	return append(b, '\n')
+}
+
+func (g *gallery) cropPath(id string) string {
+	return filepath.Join(g.dir, id+".jpg")
+}
+
+// insert indexes e, dropping the oldest entry when full. g.mu is held, or
+// g is not shared yet.
+func (g *gallery) insert(e *galleryEntry) {
+	g.nextKey++
+	e.key = g.nextKey
+	g.entries[e.key] = e
+	g.byID[e.ID] = e.key
+	g.order = append(g.order, e.key)
+	g.index.Add(e.key, e.vec)
+	for len(g.order) > g.keep {
+		g.dropOldest()
+	}
+}
+
+// dropOldest removes the oldest entry and its crop. g.mu is held.
+func (g *gallery) dropOldest() *galleryEntry {
+	old := g.entries[g.order[0]]
+	g.index.Delete(old.key)
+	delete(g.entries, old.key)
+	delete(g.byID, old.ID)
+	_ = os.Remove(g.cropPath(old.ID))
+	g.order[0] = 0
+	g.order = g.order[1:]
+	return old
+}
+
+// prune drops the crops taken before cutoff, then the oldest while the
+// rest take more than quota bytes; 0 is no quota.
+func (g *gallery) prune(cutoff time.Time, quota int64) pruned {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var p pruned
+	for _, key := range g.order {
+		p.kept += g.entries[key].size
+	}
+	for len(g.order) > 0 {
+		if e := g.entries[g.order[0]]; !e.Time.Before(cutoff) && (quota == 0 || p.kept <= quota) {
+			break
+		}
+		old := g.dropOldest()
+		p.removed++
+		p.freed += old.size
+		p.kept -= old.size
+	}
+	if p.removed > 0 {
+		if err := g.rewrite(); err != nil {
+			slog.Warn("gallery log compaction", "err", err)
+		}
+	}
+	return p
+}
+
+// add stores crop and indexes e.
+func (g *gallery) add(e *galleryEntry, crop []byte) {
+	e.size = int64(len(crop))
+	if err := os.WriteFile(g.cropPath(e.ID), crop, 0o644); err != nil {
+		slog.Warn("gallery crop", "id", e.ID, "err", err)
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.insert(e)
+	if _, err := g.log.Write(g.record(e)); err != nil {
+		slog.Warn("gallery log", "err", err)
+	}
+	// Lines of dropped entries pile up in the log until it is compacted.
+	if g.lines++; g.lines > 2*g.keep {
+		if err := g.rewrite(); err != nil {
+			slog.Warn("gallery log compaction", "err", err)
+		}
+	}
+}
+
+func (g *gallery) counts() map[string]int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	n := map[string]int64{}
+	for _, e := range g.entries {
+		n[e.Client]++
+	}
+	return n
+}
+
+// run indexes the crops of queued jobs.
+func (g *gallery) run() {
+	for j := range g.jobs {
+		boxes := make([]image.Rectangle, len(j.dets))
+		for i, d := range j.dets {
+			boxes[i] = image.Rect(d.Box[0], d.Box[1], d.Box[2], d.Box[3])
+		}
+		crops, err := preprocess.Crops(j.frame, 1, boxes, g.cropSize, j.mask, j.blur)
+		if err != nil {
+			slog.Debug("gallery crops", "err", err)
+			continue
+		}
+		var kept []int
+		for i, c := range crops {
+			if c != nil {
+				kept = append(kept, i)
+			}
+		}
+		in := make([][]byte, len(kept))
+		for n, i := range kept {
+			in[n] = crops[i]
+		}
+		vecs, err := g.embed(in)
+		if err != nil {
+			slog.Warn("gallery embed", "err", err)
+			continue
+		}
+		for n, i := range kept {
+			d := j.dets[i]
+			g.add(&galleryEntry{
+				ID: newSessionID(), Time: j.at, Client: j.client, Stream: j.stream, Track: j.tracks[i],
+				Class: d.Name, Score: d.Score, Box: d.Box, vec: vecs[n],
+			}, crops[i])
+		}
+	}
+}
+
+// ── 스트림별 수집 ────────────────────────────────────────────────────────────
+
+type galleryWatch struct {
+	g        *gallery
+	client   string
+	stream   string
+	classes  []string
+	interval time.Duration
+	last     map[galleryKey]time.Time // last indexed
+}
+
+// galleryKey is a track, or a class when track is 0.
+type galleryKey struct {
+	track uint64
+	class string
+}
+
+// newGalleryWatch feeds a stream to the gallery, or returns nil without
+// GALLERY_DIR.
+func (s *Server) newGalleryWatch(r *http.Request, ci *connInfo, st *streamState) *galleryWatch {
+	if s.gallery == nil {
+		return nil
+	}
+	return &galleryWatch{
+		g: s.gallery, client: clientLabel(r), stream: streamName(ci, st),
+		classes: s.cfg.GalleryClasses, interval: s.cfg.GalleryInterval,
+		last: map[galleryKey]time.Time{},
+	}
+}
+
+// observe takes an inferred frame as the client was shown it; ids are its
+// detections' track IDs, nil when the tracker did not see them.
+func (w *galleryWatch) observe(f video.Frame, ids []uint64) {
+	if w == nil {
+		return
+	}
+	job := galleryJob{client: w.client, stream: w.stream, at: f.At, frame: f.Data, mask: f.Mask, blur: f.Blur}
+	for i, d := range f.Dets {
+		if len(w.classes) > 0 && !slices.Contains(w.classes, d.Name) {
+			continue
+		}
+		k := galleryKey{class: d.Name}
+		if len(ids) == len(f.Dets) {
+			k = galleryKey{track: ids[i]}
+		}
+		if last, ok := w.last[k]; ok && f.At.Sub(last) < w.interval {
+			continue
+		}
+		w.last[k] = f.At
+		job.dets = append(job.dets, d)
+		job.tracks = append(job.tracks, k.track)
+	}
+	if len(w.last) > 1024 {
+		for k, at := range w.last {
+			if f.At.Sub(at) >= w.interval {
+				delete(w.last, k)
+			}
+		}
+	}
+	if len(job.dets) == 0 {
+		return
+	}
+	select {
+	case w.g.jobs <- job:
+	default:
+		w.g.dropped.add(w.client, uint64(len(job.dets)))
+	}
+}
+
+// ── API ──────────────────────────────────────────────────────────────────────
+// POST /search takes an image of an object, typically a crop, and finds
+// the caller's gallery crops that look most like it; GET /search?like=
+// takes a gallery crop's id instead. ?k= caps the results (10), and
+// ?stream=, ?class=, ?since=, ?until= and ?min_similarity= filter them.
+// GET /gallery/{id} is a crop's JPEG.
+
+type searchResult struct {
+	galleryEntry
+	Similarity float64 `json:"similarity"` // cosine, 1 for the same vector
+	Crop       string  `json:"crop"`       // URL
+}
+
+type searchQuery struct {
+	k             int
+	stream, class string
+	since, until  time.Time
+	minSimilarity float64
+}
+
+func parseSearchQuery(r *http.Request) (searchQuery, error) {
+	q := r.URL.Query()
+	sq := searchQuery{k: 10, stream: q.Get("stream"), class: q.Get("class"), minSimilarity: -1}
+	if v := q.Get("k"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxSearchK {
+			return sq, fmt.Errorf("k: want 1..%d, got %q", maxSearchK, v)
+		}
+		sq.k = n
+	}
+	for _, t := range []struct {
+		key string
+		to  *time.Time
+	}{{"since", &sq.since}, {"until", &sq.until}} {
+		if v := q.Get(t.key); v != "" {
+			at, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return sq, fmt.Errorf("%s: want an RFC 3339 time, got %q", t.key, v)
+			}
+			*t.to = at
+		}
+	}
+	if v := q.Get("min_similarity"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < -1 || f > 1 {
+			return sq, fmt.Errorf("min_similarity: want -1..1, got %q", v)
+		}
+		sq.minSimilarity = f
+	}
+	return sq, nil
+}
+
+func (sq *searchQuery) match(e *galleryEntry, client string) bool {
+	return e.Client == client &&
+		(sq.stream == "" || e.Stream == sq.stream) &&
+		(sq.class == "" || e.Class == sq.class) &&
+		(sq.since.IsZero() || !e.Time.Before(sq.since)) &&
+		(sq.until.IsZero() || e.Time.Before(sq.until))
+}
+
+// search is the k entries of client nearest vec that sq lets through,
+// nearest first. skip, if set, is left out.
+func (g *gallery) search(vec []float32, client string, sq searchQuery, skip string) []searchResult {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	out := []searchResult{}
+	// Filters are applied to what the index finds; when they leave too few,
+	// the search widens until it has seen everything.
+	for ef := max(4*sq.k, 64); ; ef *= 4 {
+		out = out[:0]
+		for _, res := range g.index.Search(vec, ef, ef) {
+			e := g.entries[res.ID]
+			sim := math.Round(float64(1-res.Distance)*1000) / 1000
+			if e.ID == skip || !sq.match(e, client) || sim < sq.minSimilarity {
+				continue
+			}
+			out = append(out, searchResult{galleryEntry: *e, Similarity: sim, Crop: "/gallery/" + e.ID})
+			if len(out) == sq.k {
+				return out
+			}
+		}
+		if ef >= g.index.Len() {
+			return out
+		}
+	}
+}
+
+// vector is entry id's vector, if client's.
+func (g *gallery) vector(client, id string) ([]float32, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	e := g.entries[g.byID[id]]
+	if e == nil || e.Client != client {
+		return nil, false
+	}
+	return e.vec, true
+}
+
+func (s *Server) searchGallery(w http.ResponseWriter, r *http.Request) {
+	if s.gallery == nil {
+		writeJSONError(w, http.StatusNotFound, "no gallery; set GALLERY_DIR")
+		return
+	}
+	sq, err := parseSearchQuery(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	client := clientLabel(r)
+	like := r.URL.Query().Get("like")
+	var vec []float32
+	if r.Method == http.MethodGet {
+		var ok bool
+		if vec, ok = s.gallery.vector(client, like); !ok {
+			writeJSONError(w, http.StatusNotFound, "no such crop")
+			return
+		}
+	} else {
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxUploadSize))
+		if err != nil {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, "image too large")
+			return
+		}
+		if _, err := s.admitFrame(r); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			_ = json.NewEncoder(w).Encode(limitError(err))
+			return
+		}
+		vecs, err := s.gallery.embed([][]byte{data})
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		vec, like = vecs[0], ""
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"results": s.gallery.search(vec, client, sq, like)})
+}
+
+func (s *Server) getGalleryCrop(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if s.gallery == nil {
+		writeJSONError(w, http.StatusNotFound, "no such crop")
+		return
+	}
+	if _, ok := s.gallery.vector(clientLabel(r), id); !ok {
+		writeJSONError(w, http.StatusNotFound, "no such crop")
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	http.ServeFile(w, r, s.gallery.cropPath(id))
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ── GPU 상태 ─────────────────────────────────────────────────────────────────
+// With ORT_PROVIDER=cuda the device is polled with nvidia-smi every
+// gpuInterval for its name and memory. After gpuMaxFailures probes in a row
+// fail (the device is gone, typically after a driver reset) /readyz answers
+// "gpu_lost": the ORT session cannot recover, so the pod should be
+// restarted. Without nvidia-smi on PATH the device is reported but not
+// monitored, and readiness is unaffected.
+
+const (
+	gpuInterval     = 10 * time.Second
+	gpuProbeTimeout = 5 * time.Second
+	gpuMaxFailures  = 2
+)
+
+// gpuStatus is the JSON view served by GET /admin/gpu.
+type gpuStatus struct {
+	Provider  string    `json:"provider"` // ORT execution provider
+	Device    int       `json:"device"`
+	Monitored bool      `json:"monitored"`
+	Healthy   bool      `json:"healthy"`
+	Name      string    `json:"name,omitempty"`
+	MemUsed   int64     `json:"memory_used_bytes"`
+	MemTotal  int64     `json:"memory_total_bytes"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+type gpuMonitor struct {
+	device   int
+	smi      string // nvidia-smi path; "" when not found
+	status   atomic.Pointer[gpuStatus]
+	failures int // consecutive failed probes; monitor goroutine only
+}
+
+func newGPUMonitor(device int) *gpuMonitor {
+	g := &gpuMonitor{device: device}
+	st := &gpuStatus{Provider: "cuda", Device: device, Healthy: true}
+	if path, err := exec.LookPath("nvidia-smi"); err != nil {
+		st.Error = "nvidia-smi not found; device not monitored"
+		slog.Warn("gpu monitoring disabled", "err", err)
+	} else {
+		g.smi, st.Monitored = path, true
+	}
+	g.status.Store(st)
+	return g
+}
+
+func (g *gpuMonitor) current() gpuStatus { return *g.status.Load() }
+
+// lost reports whether the device has stopped answering.
+func (g *gpuMonitor) lost() bool {
+	st := g.status.Load()
+	return st.Monitored && !st.Healthy
+}
+
+func (g *gpuMonitor) run(ctx context.Context) {
+	if g.smi == "" {
+		return
+	}
+	t := time.NewTicker(gpuInterval)
+	defer t.Stop()
+	for {
+		g.check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (g *gpuMonitor) check(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, gpuProbeTimeout)
+	defer cancel()
+	st := gpuStatus{Provider: "cuda", Device: g.device, Monitored: true, Healthy: true, CheckedAt: time.Now()}
+	err := g.probe(ctx, &st)
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return // shutting down
+	}
+	prev := g.status.Load()
+	if err == nil {
+		if g.failures >= gpuMaxFailures {
+			slog.Info("gpu device back", "device", g.device)
+		}
+		g.failures = 0
+		g.status.Store(&st)
+		return
+	}
+	g.failures++
+	// Keep the last good readings so the endpoint still shows the device.
+	st.Name, st.MemUsed, st.MemTotal = prev.Name, prev.MemUsed, prev.MemTotal
+	st.Error = err.Error()
+	if g.failures >= gpuMaxFailures {
+		st.Healthy = false
+		if prev.Healthy {
+			slog.Error("gpu device lost", "device", g.device, "err", err)
+		}
+	}
+	g.status.Store(&st)
+}
+
+// probe fills st from nvidia-smi, which reports memory in MiB.
+func (g *gpuMonitor) probe(ctx context.Context, st *gpuStatus) error {
+	out, err := exec.CommandContext(ctx, g.smi,
+		"--query-gpu=name,memory.used,memory.total",
+		"--format=csv,noheader,nounits",
+		"--id="+strconv.Itoa(g.device)).Output()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("nvidia-smi: %s", msg)
+		}
+		return fmt.Errorf("nvidia-smi: %w", err)
+	}
+	f := strings.Split(strings.TrimSpace(string(out)), ",")
+	if len(f) != 3 {
+		return fmt.Errorf("nvidia-smi: unexpected output %q", out)
+	}
+	used, err1 := strconv.ParseInt(strings.TrimSpace(f[1]), 10, 64)
+	total, err2 := strconv.ParseInt(strings.TrimSpace(f[2]), 10, 64)
+	if err1 != nil || err2 != nil {
+		return fmt.Errorf("nvidia-smi: unexpected output %q", out)
+	}
+	st.Name, st.MemUsed, st.MemTotal = strings.TrimSpace(f[0]), used<<20, total<<20
+	return nil
+}
+
+func (s *Server) adminGPU(w http.ResponseWriter, _ *http.Request) {
+	if s.gpu == nil {
+		writeJSON(w, http.StatusOK, gpuStatus{Provider: s.cfg.ORTProvider, Healthy: true})
+		return
+	}
+	writeJSON(w, http.StatusOK, s.gpu.current())
+}
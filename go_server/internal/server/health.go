@@ -0,0 +1,87 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// ── 헬스 체크 ────────────────────────────────────────────────────────────────
+// Kubernetes-style probes:
+//
+//	/livez    the process is serving HTTP
+//	/readyz   warmup finished, not draining and the GPU (if any) present;
+//	          "/" answers the same
+//	/startupz warmup finished
+//
+// Failing probes answer 503 so they work with plain HTTP checks.
+
+// warmup lets the detectors prime themselves, then marks the server
+// started.
+func (s *Server) warmup() {
+	start := time.Now()
+	if err := s.det.Warmup(); err != nil {
+		slog.Error("warmup failed", "err", err)
+		return
+	}
+	for _, t := range s.tenants {
+		if t.det == nil {
+			continue
+		}
+		if err := t.det.Warmup(); err != nil {
+			slog.Error("warmup failed", "tenant", t.name, "err", err)
+			return
+		}
+	}
+	s.started.Store(true)
+	slog.Info("warmup done", "elapsed", time.Since(start))
+}
+
+func probeStatus(w http.ResponseWriter, ok bool, status string) {
+	code := http.StatusOK
+	if !ok {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, map[string]string{"status": status})
+}
+
+func (s *Server) livez(w http.ResponseWriter, _ *http.Request) {
+	probeStatus(w, true, "ok")
+}
+
+func (s *Server) startupz(w http.ResponseWriter, _ *http.Request) {
+	if !s.started.Load() {
+		probeStatus(w, false, "starting")
+		return
+	}
+	probeStatus(w, true, "ok")
+}
+
+func (s *Server) readyz(w http.ResponseWriter, _ *http.Request) {
+	switch {
+	case !s.started.Load():
+		probeStatus(w, false, "starting")
+	case s.draining.Load():
+		probeStatus(w, false, "draining")
+	case s.gpu != nil && s.gpu.lost():
+		probeStatus(w, false, "gpu_lost")
+	case s.noWorkers():
+		probeStatus(w, false, "no_workers")
+	default:
+		probeStatus(w, true, "ok")
+	}
+}
+
+// noWorkers reports whether BACKEND=workers has no worker ready.
+func (s *Server) noWorkers() bool {
+	d, ok := s.det.(workerPool)
+	if !ok {
+		return false
+	}
+	for _, w := range d.Workers() {
+		if w.Up {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"yolo-server/internal/video"
+)
+
+// ── HLS ──────────────────────────────────────────────────────────────────────
+// With HLS_DIR set, a stream opened with ?hls=1 is also published, drawn as
+// for ?video=1, as a live playlist at GET /hls/{name}/index.m3u8, where
+// name is the stream's ?stream= id or conn<id> without one. Playlists are
+// scoped to the credential like shared state: a key only reaches its own.
+// Players rarely carry query strings over to segment URIs, so the playlist
+// passes on the ?key= or ?access_token= it was fetched with. A stream that
+// reconnects under the same ?stream= continues its playlist within
+// HLS_LINGER, after a discontinuity; otherwise the playlist is ended
+// HLS_LINGER after the stream, and removed HLS_LINGER after that.
+
+type hlsRegistry struct {
+	mu sync.Mutex
+	m  map[string]*hlsStream // by directory
+}
+
+type hlsStream struct {
+	pl    *video.Playlist
+	rec   *video.Recorder // the stream writing it; nil once it ended
+	timer *time.Timer     // pending end or removal
+}
+
+// hlsDir is where r's stream name is published.
+func (s *Server) hlsDir(r *http.Request, name string) string {
+	scope := sha256.Sum256([]byte(clientLabel(r)))
+	return filepath.Join(s.cfg.HLSDir, hex.EncodeToString(scope[:8]), name)
+}
+
+// openHLS starts the stream's playlist, or takes it over from the stream
+// that last wrote it. It returns nil without ?hls=1.
+func (s *Server) openHLS(r *http.Request, ci *connInfo, st *streamState) *video.Recorder {
+	if !st.hls || s.hls == nil {
+		return nil
+	}
+	dir := s.hlsDir(r, streamName(ci, st))
+	h := s.hls
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hs := h.m[dir]
+	if hs != nil {
+		if hs.timer != nil {
+			hs.timer.Stop()
+			hs.timer = nil
+		}
+		if hs.rec != nil {
+			hs.rec.Close() // its last segment goes in before ours
+		}
+	} else {
+		pl, err := video.NewPlaylist(dir, s.cfg.HLSSegment, s.cfg.HLSListSize)
+		if err != nil {
+			slog.Warn("hls playlist", "dir", dir, "err", err)
+			return nil
+		}
+		hs = &hlsStream{pl: pl}
+		h.m[dir] = hs
+	}
+	hs.rec = video.StartHLS(video.Config{
+		FPS:     s.cfg.VideoFPS,
+		Codec:   s.cfg.HLSCodec,
+		Segment: s.cfg.HLSSegment,
+	}, hs.pl)
+	return hs.rec
+}
+
+// closeHLS finishes rec's segment and, unless another stream has taken the
+// playlist over, schedules its end.
+func (s *Server) closeHLS(rec *video.Recorder) {
+	if rec == nil {
+		return
+	}
+	rec.Close()
+	h := s.hls
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for dir, hs := range h.m {
+		if hs.rec != rec {
+			continue
+		}
+		hs.rec = nil
+		hs.timer = time.AfterFunc(s.cfg.HLSLinger, func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			if hs.rec != nil {
+				return
+			}
+			hs.pl.End()
+			hs.timer = time.AfterFunc(s.cfg.HLSLinger, func() {
+				h.mu.Lock()
+				defer h.mu.Unlock()
+				if hs.rec == nil && h.m[dir] == hs {
+					delete(h.m, dir)
+					_ = os.RemoveAll(dir)
+				}
+			})
+		})
+		return
+	}
+}
+
+func (s *Server) hlsFile(w http.ResponseWriter, r *http.Request) {
+	name, file := r.PathValue("name"), r.PathValue("file")
+	isList := file == video.PlaylistName
+	if s.hls == nil || !validStreamID(name) || !isList &&
+		(file != filepath.Base(file) || !strings.HasPrefix(file, "seg-") || !strings.HasSuffix(file, ".ts")) {
+		writeJSONError(w, http.StatusNotFound, "no such playlist")
+		return
+	}
+	path := filepath.Join(s.hlsDir(r, name), file)
+	if !isList {
+		f, err := os.Open(path)
+		if err != nil {
+			writeJSONError(w, http.StatusNotFound, "no such segment")
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "video/mp2t")
+		http.ServeContent(w, r, file, info.ModTime(), f)
+		return
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "no such playlist")
+		return
+	}
+	if auth := hlsAuthQuery(r); auth != "" {
+		var out bytes.Buffer
+		for _, l := range bytes.SplitAfter(b, []byte("\n")) {
+			if uri := bytes.TrimSuffix(l, []byte("\n")); len(uri) > 0 && uri[0] != '#' {
+				out.Write(uri)
+				out.WriteString("?" + auth + "\n")
+				continue
+			}
+			out.Write(l)
+		}
+		b = out.Bytes()
+	}
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	w.Header().Set("Cache-Control", "no-cache")
+	_, _ = w.Write(b)
+}
+
+// hlsAuthQuery is the query credential r was authenticated with, for
+// segment URIs; "" if it used a header.
+func hlsAuthQuery(r *http.Request) string {
+	q := url.Values{}
+	for _, k := range []string{"key", "access_token"} {
+		if v := r.URL.Query().Get(k); v != "" {
+			q.Set(k, v)
+		}
+	}
+	return q.Encode()
+}
@@ -0,0 +1,384 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"yolo-server/internal/mqtt"
+	"yolo-server/internal/video"
+)
+
+// ── Home Assistant ───────────────────────────────────────────────────────────
+// With MQTT_URL set, every stream opened with ?stream=<id> appears in Home
+// Assistant as a device with one occupancy binary sensor per class in
+// MQTT_CLASSES, through MQTT discovery. A sensor turns on with an inferred
+// frame holding its class and off MQTT_OFF_DELAY after the last one. The
+// device is available while the stream runs and frames keep coming: it
+// goes unavailable after MQTT_STALE without a frame, when the stream ends,
+// or, through the broker's will, when the server goes away. Topics:
+//
+//	<MQTT_TOPIC>/status                  online | offline, the server
+//	<MQTT_TOPIC>/<node>/availability     online | offline, the stream
+//	<MQTT_TOPIC>/<node>/<class>          ON | OFF
+//
+//	<MQTT_TOPIC>/<node>/arming           the stream's arming mode
+//	<MQTT_TOPIC>/<node>/arming/set       DISARM | ARM_HOME | ARM_AWAY | ARM_NIGHT
+//
+// The device also gets an alarm control panel over the last two, which
+// sets the stream's arming (arming.go) as the API does. node is the stream
+// id, prefixed with the credential's name unless it is anonymous.
+// Everything is retained and republished on reconnect, so a restarted
+// broker or Home Assistant catches up.
+
+type homeAssistant struct {
+	c       *mqtt.Client
+	base    string // MQTT_TOPIC
+	prefix  string // MQTT_DISCOVERY_PREFIX
+	classes []string
+	model   string
+	off     time.Duration
+	stale   time.Duration
+	arming  *armingStore
+
+	mu      sync.Mutex
+	refs    map[string]int        // streams per node
+	live    map[*haWatch]struct{} // to announce again on reconnect
+	targets map[string]haTarget   // every node seen, for commands
+}
+
+type haTarget struct{ client, stream string }
+
+// haCommands maps alarm panel commands to arming modes.
+var haCommands = map[string]string{
+	"DISARM":    armDisarmed,
+	"ARM_HOME":  armHome,
+	"ARM_AWAY":  armAway,
+	"ARM_NIGHT": armNight,
+}
+
+func newHomeAssistant(cfg Config, model string, arming *armingStore) (*homeAssistant, error) {
+	ha := &homeAssistant{
+		base: cfg.MQTTTopic, prefix: cfg.MQTTDiscoveryPrefix, classes: cfg.MQTTClasses, model: model,
+		off: cfg.MQTTOffDelay, stale: cfg.MQTTStale, arming: arming,
+		refs: map[string]int{}, live: map[*haWatch]struct{}{}, targets: map[string]haTarget{},
+	}
+	c, err := mqtt.New(cfg.MQTTURL, mqtt.Options{
+		ClientID:  "yolo-server-" + newSessionID()[:8],
+		Will:      &mqtt.Message{Topic: ha.base + "/status", Payload: []byte("offline"), Retain: true},
+		OnConnect: ha.connected,
+		Subscribe: []string{ha.base + "/+/arming/set"},
+		OnMessage: ha.command,
+	})
+	if err != nil {
+		return nil, err
+	}
+	ha.c = c
+	return ha, nil
+}
+
+func (ha *homeAssistant) publish(topic, payload string) {
+	if !ha.c.Publish(mqtt.Message{Topic: topic, Payload: []byte(payload), Retain: true}) {
+		slog.Debug("mqtt publish dropped", "topic", topic)
+	}
+}
+
+// connected undoes the will and announces the running streams.
+func (ha *homeAssistant) connected() {
+	ha.publish(ha.base+"/status", "online")
+	ha.mu.Lock()
+	live := make([]*haWatch, 0, len(ha.live))
+	for w := range ha.live {
+		live = append(live, w)
+	}
+	ha.mu.Unlock()
+	for _, w := range live {
+		w.mu.Lock()
+		if !w.closed {
+			w.announce()
+		}
+		w.mu.Unlock()
+	}
+}
+
+// command applies an alarm panel command to the node's stream.
+func (ha *homeAssistant) command(topic string, payload []byte) {
+	node, ok := strings.CutSuffix(strings.TrimPrefix(topic, ha.base+"/"), "/arming/set")
+	mode, known := haCommands[strings.TrimSpace(string(payload))]
+	ha.mu.Lock()
+	t, seen := ha.targets[node]
+	ha.mu.Unlock()
+	if !ok || !known || !seen {
+		slog.Debug("mqtt command ignored", "topic", topic, "payload", string(payload))
+		return
+	}
+	ha.arming.set(t.client, t.stream, mode)
+}
+
+// armingChanged publishes the stream's new mode, also for a node whose
+// stream has ended.
+func (ha *homeAssistant) armingChanged(client, stream string) {
+	ha.mu.Lock()
+	var watches []*haWatch
+	idle := map[string]bool{}
+	for node, t := range ha.targets {
+		if t == (haTarget{client, stream}) {
+			idle[node] = true
+		}
+	}
+	for w := range ha.live {
+		if w.client == client && w.stream == stream {
+			watches = append(watches, w)
+			delete(idle, w.node)
+		}
+	}
+	ha.mu.Unlock()
+	now := time.Now()
+	for _, w := range watches {
+		w.mu.Lock()
+		w.publishArming(now)
+		w.mu.Unlock()
+	}
+	for node := range idle {
+		ha.publish(ha.base+"/"+node+"/arming", ha.arming.mode(client, stream, now))
+	}
+}
+
+// close marks the server offline and disconnects.
+func (ha *homeAssistant) close() {
+	if ha == nil {
+		return
+	}
+	ha.publish(ha.base+"/status", "offline")
+	ha.c.Close()
+}
+
+// haNode is the MQTT name of a stream.
+func haNode(client, stream string) string {
+	if client == "anonymous" {
+		return haName(stream)
+	}
+	return haName(client + "_" + stream)
+}
+
+// haName keeps only [A-Za-z0-9_-] of s, for topics and IDs.
+func haName(s string) string {
+	return strings.Map(func(c rune) rune {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '_', c == '-':
+			return c
+		}
+		return '_'
+	}, s)
+}
+
+// ── 스트림별 상태 ────────────────────────────────────────────────────────────
+
+type haWatch struct {
+	ha     *homeAssistant
+	node   string
+	client string
+	stream string
+
+	mu        sync.Mutex
+	on        map[string]*time.Timer // sensors on, with their off timers
+	available bool
+	stale     *time.Timer
+	armed     string // arming mode last published
+	closed    bool
+}
+
+// newHAWatch publishes the stream to Home Assistant, or returns nil
+// without MQTT_URL or ?stream=.
+func (s *Server) newHAWatch(r *http.Request, ci *connInfo, st *streamState) *haWatch {
+	ha := s.ha
+	if ha == nil || st.id == "" {
+		return nil
+	}
+	client := clientLabel(r)
+	w := &haWatch{ha: ha, node: haNode(client, st.id), client: client, stream: streamName(ci, st), on: map[string]*time.Timer{}, available: true}
+	w.stale = time.AfterFunc(ha.stale, w.expire)
+	ha.mu.Lock()
+	ha.refs[w.node]++
+	ha.live[w] = struct{}{}
+	ha.targets[w.node] = haTarget{client, w.stream}
+	ha.mu.Unlock()
+	w.mu.Lock()
+	w.announce()
+	w.mu.Unlock()
+	return w
+}
+
+// announce publishes discovery, availability and sensor states. w.mu is
+// held.
+func (w *haWatch) announce() {
+	ha := w.ha
+	for _, class := range ha.classes {
+		id := ha.base + "_" + w.node + "_" + haName(class)
+		cfg, _ := json.Marshal(map[string]any{
+			"name":         class,
+			"unique_id":    id,
+			"device_class": "occupancy",
+			"state_topic":  w.topic(class),
+			"availability": []map[string]string{
+				{"topic": ha.base + "/status"},
+				{"topic": ha.base + "/" + w.node + "/availability"},
+			},
+			"availability_mode": "all",
+			"device": map[string]any{
+				"identifiers":  []string{ha.base + "_" + w.node},
+				"name":         w.stream,
+				"manufacturer": "stream-yolo",
+				"model":        ha.model,
+			},
+		})
+		ha.publish(ha.prefix+"/binary_sensor/"+id+"/config", string(cfg))
+		state := "OFF"
+		if w.on[class] != nil {
+			state = "ON"
+		}
+		ha.publish(w.topic(class), state)
+	}
+	panel := ha.base + "_" + w.node + "_arming"
+	cfg, _ := json.Marshal(map[string]any{
+		"name":               "Arming",
+		"unique_id":          panel,
+		"state_topic":        w.topic("arming"),
+		"command_topic":      w.topic("arming") + "/set",
+		"code_arm_required":  false,
+		"supported_features": []string{"arm_home", "arm_away", "arm_night"},
+		"availability": []map[string]string{
+			{"topic": ha.base + "/status"},
+			{"topic": ha.base + "/" + w.node + "/availability"},
+		},
+		"availability_mode": "all",
+		"device":            map[string]any{"identifiers": []string{ha.base + "_" + w.node}},
+	})
+	ha.publish(ha.prefix+"/alarm_control_panel/"+panel+"/config", string(cfg))
+	w.armed = ""
+	w.publishArming(time.Now())
+	w.publishAvailability()
+}
+
+// publishArming publishes the stream's mode at t if it changed. w.mu is
+// held.
+func (w *haWatch) publishArming(t time.Time) {
+	if mode := w.ha.arming.mode(w.client, w.stream, t); mode != w.armed {
+		w.armed = mode
+		w.ha.publish(w.topic("arming"), mode)
+	}
+}
+
+func (w *haWatch) topic(class string) string {
+	return w.ha.base + "/" + w.node + "/" + haName(class)
+}
+
+func (w *haWatch) publishAvailability() {
+	state := "offline"
+	if w.available {
+		state = "online"
+	}
+	w.ha.publish(w.ha.base+"/"+w.node+"/availability", state)
+}
+
+// observe takes a frame as the client was shown it; inferred frames set
+// the sensors.
+func (w *haWatch) observe(f video.Frame, inferred bool) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stale.Reset(w.ha.stale)
+	if !w.available {
+		w.available = true
+		w.publishAvailability()
+	}
+	w.publishArming(f.At)
+	if !inferred {
+		return
+	}
+	for _, class := range w.ha.classes {
+		seen := false
+		for _, d := range f.Dets {
+			if d.Name == class {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			continue
+		}
+		if t := w.on[class]; t != nil {
+			t.Reset(w.ha.off)
+			continue
+		}
+		w.on[class] = time.AfterFunc(w.ha.off, func() { w.clear(class) })
+		w.ha.publish(w.topic(class), "ON")
+	}
+}
+
+// clear turns class's sensor off.
+func (w *haWatch) clear(class string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.on[class] == nil || w.closed {
+		return
+	}
+	delete(w.on, class)
+	w.ha.publish(w.topic(class), "OFF")
+}
+
+// expire marks the stream unavailable after MQTT_STALE without frames.
+func (w *haWatch) expire() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed || !w.available {
+		return
+	}
+	w.available = false
+	w.publishAvailability()
+}
+
+// close turns the sensors off and, unless another stream publishes the
+// same node, marks it unavailable.
+func (w *haWatch) close() {
+	if w == nil {
+		return
+	}
+	ha := w.ha
+	ha.mu.Lock()
+	defer ha.mu.Unlock()
+	delete(ha.live, w)
+	ha.refs[w.node]--
+	last := ha.refs[w.node] == 0
+	if last {
+		delete(ha.refs, w.node)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	w.stale.Stop()
+	for class, t := range w.on {
+		t.Stop()
+		if last {
+			ha.publish(w.topic(class), "OFF")
+		}
+	}
+	if last {
+		w.available = false
+		w.publishAvailability()
+	}
+}
+
+// haModel names the model for the device registry.
+func haModel(v VersionInfo) string {
+	if v.ModelPath == "" {
+		return "YOLO"
+	}
+	return filepath.Base(v.ModelPath)
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+)
+
+// ── IP 필터 ──────────────────────────────────────────────────────────────────
+// CIDR allow/deny lists applied to every HTTP and WebSocket request. A
+// denied prefix always wins; a non-empty allowlist admits only matching
+// addresses. The rules can be replaced at runtime through the admin API,
+// so they live behind an atomic pointer instead of in Config.
+
+type ipRules struct {
+	Allow []netip.Prefix `json:"allow"`
+	Deny  []netip.Prefix `json:"deny"`
+}
+
+type ipFilter struct {
+	rules atomic.Pointer[ipRules]
+}
+
+func parsePrefixes(raw []string) ([]netip.Prefix, error) {
+	out := make([]netip.Prefix, 0, len(raw))
+	for _, s := range raw {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") { // bare address → single-host prefix
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q", s)
+			}
+			out = append(out, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", s)
+		}
+		out = append(out, p.Masked())
+	}
+	return out, nil
+}
+
+func (f *ipFilter) set(r *ipRules) { f.rules.Store(r) }
+func (f *ipFilter) get() *ipRules  { return f.rules.Load() }
+
+func (f *ipFilter) allows(addr netip.Addr) bool {
+	r := f.get()
+	if r == nil {
+		return true
+	}
+	addr = addr.Unmap()
+	for _, p := range r.Deny {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	if len(r.Allow) == 0 {
+		return true
+	}
+	for _, p := range r.Allow {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) filterIPs(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addr, err := netip.ParseAddr(s.clientIP(r))
+		if err != nil || !s.ipFilter.allows(addr) {
+			slog.Warn("ip rejected", "path", r.URL.Path, "ip", s.clientIP(r))
+			writeJSONError(w, http.StatusForbidden, "forbidden")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP is the peer address or, when TRUST_PROXY_HEADERS is on and the
+// peer is a trusted proxy, the address that proxy reports: X-Real-IP, else
+// the rightmost X-Forwarded-For entry not added by a trusted proxy. Entries
+// further left were written by the client and are never believed.
+func (s *Server) clientIP(r *http.Request) string {
+	peer := peerIP(r)
+	if !s.cfg.TrustProxyHeaders || !s.trustedProxy(peer) {
+		return peer
+	}
+	if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+		return ip
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if !s.trustedProxy(hop) {
+			return hop
+		}
+		peer = hop
+	}
+	return peer
+}
+
+// peerIP is the address of the connection's other end.
+func peerIP(r *http.Request) string {
+	if l := listenerOf(r); l != nil && l.network == "unix" {
+		return "127.0.0.1" // a unix socket peer is on this host
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (s *Server) trustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range s.cfg.TrustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies, err := parsePrefixes([]string{"127.0.0.0/8", "10.0.0.5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		trust  bool
+		remote string
+		realIP string
+		xff    []string
+		want   string
+	}{
+		{"peer", false, "203.0.113.7:5000", "", nil, "203.0.113.7"},
+		{"headers ignored when off", false, "127.0.0.1:5000", "198.51.100.1", []string{"198.51.100.2"}, "127.0.0.1"},
+		{"X-Real-IP from a trusted proxy", true, "127.0.0.1:5000", "198.51.100.1", nil, "198.51.100.1"},
+		{"X-Real-IP wins over X-Forwarded-For", true, "127.0.0.1:5000", "198.51.100.1", []string{"198.51.100.2"}, "198.51.100.1"},
+		{"spoofed X-Real-IP from an untrusted peer", true, "203.0.113.7:5000", "10.1.1.1", nil, "203.0.113.7"},
+		{"spoofed X-Forwarded-For from an untrusted peer", true, "203.0.113.7:5000", "", []string{"10.1.1.1"}, "203.0.113.7"},
+		{"spoofed leftmost entry", true, "127.0.0.1:5000", "", []string{"10.1.1.1, 198.51.100.2"}, "198.51.100.2"},
+		{"trusted hops are skipped", true, "127.0.0.1:5000", "", []string{"10.1.1.1, 198.51.100.2, 10.0.0.5"}, "198.51.100.2"},
+		{"repeated headers", true, "127.0.0.1:5000", "", []string{"10.1.1.1", "198.51.100.2"}, "198.51.100.2"},
+		{"only trusted hops", true, "127.0.0.1:5000", "", []string{"10.0.0.5"}, "10.0.0.5"},
+		{"no headers", true, "127.0.0.1:5000", "", nil, "127.0.0.1"},
+		{"IPv6 peer", false, "[2001:db8::1]:5000", "", nil, "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{cfg: Config{TrustProxyHeaders: tt.trust, TrustedProxies: proxies}}
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remote
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+			for _, v := range tt.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if got := s.clientIP(r); got != tt.want {
+				t.Errorf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterIPs(t *testing.T) {
+	allow, _ := parsePrefixes([]string{"198.51.100.0/24"})
+	deny, _ := parsePrefixes([]string{"198.51.100.66"})
+	proxies, _ := parsePrefixes([]string{"127.0.0.1"})
+	s := &Server{cfg: Config{TrustProxyHeaders: true, TrustedProxies: proxies}}
+	s.ipFilter.set(&ipRules{Allow: allow, Deny: deny})
+	h := s.filterIPs(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name   string
+		remote string
+		xff    string
+		want   int
+	}{
+		{"allowed peer", "198.51.100.9:1", "", http.StatusOK},
+		{"denied inside the allowlist", "198.51.100.66:1", "", http.StatusForbidden},
+		{"outside the allowlist", "203.0.113.7:1", "", http.StatusForbidden},
+		{"spoofed allowed address", "203.0.113.7:1", "198.51.100.9", http.StatusForbidden},
+		{"allowed client behind the proxy", "127.0.0.1:1", "198.51.100.9", http.StatusOK},
+		{"spoofed allowed address behind the proxy", "127.0.0.1:1", "198.51.100.9, 203.0.113.7", http.StatusForbidden},
+		{"unparsable address", "not-an-ip", "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remote
+			if tt.xff != "" {
+				r.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePrefixes(t *testing.T) {
+	got, err := parsePrefixes([]string{" 10.1.2.3/8 ", "", "192.0.2.1", "::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.0.2.1/32"),
+		netip.MustParsePrefix("::1/128"),
+	}
+	if len(got) != len(want) {
+		t.Fatalf("parsePrefixes = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("prefix %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+	for _, bad := range []string{"10.0.0.0/33", "example.com", "1.2.3"} {
+		if _, err := parsePrefixes([]string{bad}); err == nil {
+			t.Errorf("parsePrefixes(%q) succeeded", bad)
+		}
+	}
+}
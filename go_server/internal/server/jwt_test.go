@@ -0,0 +1,178 @@
+package server
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	testIssuer   = "https://securetoken.google.com/project-a"
+	testAudience = "project-a"
+)
+
+type jwtFixture struct {
+	rsaKey  *rsa.PrivateKey
+	ecKey   *ecdsa.PrivateKey
+	fetches atomic.Int32
+	v       *jwtVerifier
+}
+
+func newJWTFixture(t *testing.T) *jwtFixture {
+	t.Helper()
+	f := &jwtFixture{}
+	var err error
+	if f.rsaKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		t.Fatal(err)
+	}
+	if f.ecKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	set := map[string][]jwk{"keys": {
+		{Kty: "RSA", Kid: "rsa", N: b64(f.rsaKey.N.Bytes()), E: b64(big.NewInt(int64(f.rsaKey.E)).Bytes())},
+		{Kty: "EC", Kid: "ec", Crv: "P-256", X: b64(f.ecKey.X.FillBytes(make([]byte, 32))), Y: b64(f.ecKey.Y.FillBytes(make([]byte, 32)))},
+	}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.fetches.Add(1)
+		_ = json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(srv.Close)
+	f.v = newJWTVerifier(srv.URL, testIssuer, testAudience)
+	return f
+}
+
+// sign builds a token; alg selects the key ("RS256", "ES256") and any other
+// alg leaves the signature as given in sig.
+func (f *jwtFixture) sign(t *testing.T, hdr jwtHeader, claims map[string]any, sig []byte) string {
+	t.Helper()
+	enc := func(v any) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	input := enc(hdr) + "." + enc(claims)
+	digest := sha256.Sum256([]byte(input))
+	var err error
+	switch hdr.Alg {
+	case "RS256":
+		sig, err = rsa.SignPKCS1v15(rand.Reader, f.rsaKey, crypto.SHA256, digest[:])
+	case "ES256":
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, f.ecKey, digest[:])
+		if err == nil {
+			sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestJWTVerify(t *testing.T) {
+	f := newJWTFixture(t)
+	now := time.Now().Unix()
+	claims := func(edit func(c map[string]any)) map[string]any {
+		c := map[string]any{"iss": testIssuer, "aud": testAudience, "sub": "user-1", "exp": now + 3600}
+		if edit != nil {
+			edit(c)
+		}
+		return c
+	}
+	rs := jwtHeader{Alg: "RS256", Kid: "rsa"}
+
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"RS256", f.sign(t, rs, claims(nil), nil), true},
+		{"ES256", f.sign(t, jwtHeader{Alg: "ES256", Kid: "ec"}, claims(nil), nil), true},
+		{"audience list", f.sign(t, rs, claims(func(c map[string]any) { c["aud"] = []string{"other", testAudience} }), nil), true},
+		{"within leeway", f.sign(t, rs, claims(func(c map[string]any) { c["exp"] = now - 30 }), nil), true},
+		{"alg none", f.sign(t, jwtHeader{Alg: "none", Kid: "rsa"}, claims(nil), nil), false},
+		{"HS256", f.sign(t, jwtHeader{Alg: "HS256", Kid: "rsa"}, claims(nil), []byte("0123456789abcdef0123456789abcdef")), false},
+		{"alg does not match the key", f.sign(t, jwtHeader{Alg: "ES256", Kid: "rsa"}, claims(nil), nil), false},
+		{"expired", f.sign(t, rs, claims(func(c map[string]any) { c["exp"] = now - 3600 }), nil), false},
+		{"no exp", f.sign(t, rs, claims(func(c map[string]any) { delete(c, "exp") }), nil), false},
+		{"not yet valid", f.sign(t, rs, claims(func(c map[string]any) { c["nbf"] = now + 3600 }), nil), false},
+		{"another project's audience", f.sign(t, rs, claims(func(c map[string]any) { c["aud"] = "project-b" }), nil), false},
+		{"no audience", f.sign(t, rs, claims(func(c map[string]any) { delete(c, "aud") }), nil), false},
+		{"wrong issuer", f.sign(t, rs, claims(func(c map[string]any) { c["iss"] = "https://securetoken.google.com/project-b" }), nil), false},
+		{"unknown kid", f.sign(t, jwtHeader{Alg: "RS256", Kid: "gone"}, claims(nil), nil), false},
+		{"malformed", "a.b", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := f.v.verify(context.Background(), tt.token)
+			if tt.ok {
+				if err != nil || c.Sub != "user-1" {
+					t.Errorf("verify = %+v, %v, want the claims", c, err)
+				}
+			} else if !errors.Is(err, errJWT) {
+				t.Errorf("verify = %+v, %v, want errJWT", c, err)
+			}
+		})
+	}
+
+	// A tampered payload keeps the original signature.
+	good := f.sign(t, rs, claims(nil), nil)
+	forged := f.sign(t, jwtHeader{Alg: "none"}, claims(func(c map[string]any) { c["sub"] = "admin" }), nil)
+	parts, forgedParts := strings.Split(good, "."), strings.Split(forged, ".")
+	tampered := parts[0] + "." + forgedParts[1] + "." + parts[2]
+	if _, err := f.v.verify(context.Background(), tampered); !errors.Is(err, errJWT) {
+		t.Errorf("tampered claims verified: %v", err)
+	}
+}
+
+func TestJWTUnknownKidRefetch(t *testing.T) {
+	f := newJWTFixture(t)
+	ctx := context.Background()
+	claims := map[string]any{"iss": testIssuer, "aud": testAudience, "exp": time.Now().Unix() + 60}
+	if _, err := f.v.verify(ctx, f.sign(t, jwtHeader{Alg: "RS256", Kid: "rsa"}, claims, nil)); err != nil {
+		t.Fatal(err)
+	}
+	for range 5 {
+		_, _ = f.v.verify(ctx, f.sign(t, jwtHeader{Alg: "RS256", Kid: "unknown"}, claims, nil))
+	}
+	if n := f.fetches.Load(); n != 1 {
+		t.Errorf("JWKS fetched %d times, want once per jwksMinRefresh", n)
+	}
+}
+
+func TestLoadConfigJWT(t *testing.T) {
+	tests := []struct {
+		issuer, audience string
+		ok               bool
+	}{
+		{testIssuer, testAudience, true},
+		{"", testAudience, false},
+		{testIssuer, "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		t.Setenv("JWT_JWKS_URL", "https://www.googleapis.com/service_accounts/v1/jwk/securetoken@system.gserviceaccount.com")
+		t.Setenv("JWT_ISSUER", tt.issuer)
+		t.Setenv("JWT_AUDIENCE", tt.audience)
+		if _, err := LoadConfig(); (err == nil) != tt.ok {
+			t.Errorf("LoadConfig(iss %q, aud %q) = %v, want ok %v", tt.issuer, tt.audience, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ── 속도 제한 ────────────────────────────────────────────────────────────────
+// Frames are limited per client identity: the API key name, or the remote
+// IP for unauthenticated clients. Each identity gets a token bucket for
+// frames per second and a calendar-month frame quota (UTC). Quota usage is
+// kept in memory only and restarts from zero with the process.
+
+var (
+	errRateLimited   = errors.New("rate limited")
+	errQuotaExceeded = errors.New("monthly frame quota exceeded")
+)
+
+const limiterIdleTTL = time.Hour // idle IP entries are dropped after this
+
+type limiter struct {
+	mu      sync.Mutex
+	rate    float64 // tokens per second; 0 = unlimited
+	burst   float64
+	quota   uint64 // frames per month; 0 = unlimited
+	clients map[string]*clientLimit
+	pruned  time.Time
+}
+
+type clientLimit struct {
+	tokens float64
+	last   time.Time
+	month  string // "2006-01" the usage count belongs to
+	used   uint64
+}
+
+func newLimiter(rate float64, burst int, quota uint64) *limiter {
+	l := &limiter{clients: make(map[string]*clientLimit)}
+	l.setLimits(rate, burst, quota)
+	return l
+}
+
+// setLimits changes the limits for all clients; usage so far is kept.
+func (l *limiter) setLimits(rate float64, burst int, quota uint64) {
+	if burst < 1 {
+		burst = int(math.Ceil(rate))
+	}
+	l.mu.Lock()
+	l.rate, l.burst, l.quota = rate, float64(burst), quota
+	l.mu.Unlock()
+}
+
+// allow consumes one frame for id. On errRateLimited, retryAfter is how long
+// until a token is available.
+func (l *limiter) allow(id string, now time.Time) (retryAfter time.Duration, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate <= 0 && l.quota == 0 {
+		return 0, nil
+	}
+	l.prune(now)
+
+	c, ok := l.clients[id]
+	if !ok {
+		c = &clientLimit{tokens: l.burst, last: now}
+		l.clients[id] = c
+	}
+
+	if l.rate > 0 {
+		c.tokens = math.Min(l.burst, c.tokens+now.Sub(c.last).Seconds()*l.rate)
+		c.last = now
+		if c.tokens < 1 {
+			return time.Duration((1 - c.tokens) / l.rate * float64(time.Second)), errRateLimited
+		}
+	}
+	c.last = now
+	if l.quota > 0 {
+		if month := now.UTC().Format("2006-01"); c.month != month {
+			c.month, c.used = month, 0
+		}
+		if c.used >= l.quota {
+			return 0, errQuotaExceeded
+		}
+		c.used++
+	}
+	if l.rate > 0 {
+		c.tokens--
+	}
+	return 0, nil
+}
+
+// prune drops idle per-IP and per-JWT-subject entries so anonymous clients
+// and identity providers cannot grow the map without bound. A subject's
+// entry is kept while it still holds this month's quota usage. Entries for
+// API keys are kept to preserve their quota.
+func (l *limiter) prune(now time.Time) {
+	if now.Sub(l.pruned) < limiterIdleTTL {
+		return
+	}
+	l.pruned = now
+	month := now.UTC().Format("2006-01")
+	for id, c := range l.clients {
+		if now.Sub(c.last) <= limiterIdleTTL {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(id, "ip:"):
+			delete(l.clients, id)
+		case strings.HasPrefix(id, "jwt:") && (l.quota == 0 || c.month != month):
+			delete(l.clients, id)
+		}
+	}
+}
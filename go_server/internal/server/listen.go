@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ── 리스너 ───────────────────────────────────────────────────────────────────
+// LISTEN serves the same routes on several addresses, each with its own
+// settings:
+//
+//	LISTEN=":8443;tls, unix:/run/yolo/yolo.sock;noauth;mode=0660"
+//
+// An address is host:port or unix:<path>. "tls" terminates TLS with the
+// TLS_* certificate, "noauth" skips API key and JWT checks (for a sidecar
+// proxy that already authenticated the client; the admin token is still
+// required), and "mode=" sets a unix socket's permissions. Without LISTEN
+// the server listens on PORT, with TLS when TLS_* is set.
+
+type listenSpec struct {
+	network string // "tcp" or "unix"
+	addr    string
+	tls     bool
+	noAuth  bool
+	mode    fs.FileMode // unix socket permissions; 0 = umask default
+}
+
+func (l listenSpec) String() string {
+	if l.network == "unix" {
+		return "unix:" + l.addr
+	}
+	return l.addr
+}
+
+func parseListen(raw string) ([]listenSpec, error) {
+	var specs []listenSpec
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, ";")
+		l := listenSpec{network: "tcp", addr: strings.TrimSpace(parts[0])}
+		if path, ok := strings.CutPrefix(l.addr, "unix:"); ok {
+			l.network, l.addr = "unix", path
+		} else if _, _, err := net.SplitHostPort(l.addr); err != nil {
+			return nil, fmt.Errorf("LISTEN: want host:port or unix:<path>, got %q", l.addr)
+		}
+		if l.addr == "" {
+			return nil, fmt.Errorf("LISTEN: empty address in %q", entry)
+		}
+		for _, opt := range parts[1:] {
+			opt = strings.TrimSpace(opt)
+			switch {
+			case opt == "tls":
+				l.tls = true
+			case opt == "noauth":
+				l.noAuth = true
+			case strings.HasPrefix(opt, "mode="):
+				m, err := strconv.ParseUint(strings.TrimPrefix(opt, "mode="), 8, 32)
+				if err != nil || m > 0o777 || l.network != "unix" {
+					return nil, fmt.Errorf("LISTEN: mode= wants octal permissions on a unix socket, got %q", entry)
+				}
+				l.mode = fs.FileMode(m)
+			default:
+				return nil, fmt.Errorf("LISTEN: unknown option %q in %q", opt, entry)
+			}
+		}
+		specs = append(specs, l)
+	}
+	return specs, nil
+}
+
+// listeners is LISTEN, or the single default listener.
+func (cfg Config) listeners() []listenSpec {
+	if len(cfg.Listen) > 0 {
+		return cfg.Listen
+	}
+	tlsOn := cfg.TLSCertFile != "" || len(cfg.AutocertDomains) > 0
+	return []listenSpec{{network: "tcp", addr: cfg.Addr, tls: tlsOn}}
+}
+
+// tlsAddr is the first TLS listener's address, which the HTTP redirect
+// points at.
+func (cfg Config) tlsAddr() string {
+	for _, l := range cfg.listeners() {
+		if l.tls && l.network == "tcp" {
+			return l.addr
+		}
+	}
+	return cfg.Addr
+}
+
+// listen opens l. A stale unix socket left by an earlier run is removed
+// first; anything else at the path is an error.
+func (l listenSpec) listen() (net.Listener, error) {
+	if l.network != "unix" {
+		return net.Listen("tcp", l.addr)
+	}
+	if fi, err := os.Lstat(l.addr); err == nil {
+		if fi.Mode().Type() != fs.ModeSocket {
+			return nil, fmt.Errorf("%s exists and is not a socket", l.addr)
+		}
+		if err := os.Remove(l.addr); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	ln, err := net.Listen("unix", l.addr)
+	if err != nil {
+		return nil, err
+	}
+	if l.mode != 0 {
+		if err := os.Chmod(l.addr, l.mode); err != nil {
+			ln.Close()
+			return nil, err
+		}
+	}
+	return ln, nil
+}
+
+// baseContext tags every request from l's connections with l, so auth and
+// clientIP can tell which listener it arrived on.
+func (l *listenSpec) baseContext(net.Listener) context.Context {
+	return context.WithValue(context.Background(), ctxListener, l)
+}
+
+func listenerOf(r *http.Request) *listenSpec {
+	l, _ := r.Context().Value(ctxListener).(*listenSpec)
+	return l
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"math"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"yolo-server/internal/latency"
+)
+
+// ── 부하 측정 ────────────────────────────────────────────────────────────────
+// Every inference is counted while in flight and its latency recorded. Once
+// per loadInterval the monitor turns that into a loadSample, which drives
+// adaptive quality (adaptive.go) and the backpressure advice sent to
+// streams that opted in with ?flow= (see flow.go).
+
+const loadInterval = time.Second
+
+type loadStats struct {
+	inflight atomic.Int64
+	peak     atomic.Int64 // highest inflight since the last sample
+	lat      latency.Recorder
+}
+
+// loadSample summarizes one interval.
+type loadSample struct {
+	depth      int // peak frames in flight
+	p95        time.Duration
+	throughput float64 // frames inferred per second
+}
+
+// begin counts a frame entering inference; the returned func records its
+// latency when it leaves.
+func (l *loadStats) begin() func() {
+	n := l.inflight.Add(1)
+	for p := l.peak.Load(); n > p && !l.peak.CompareAndSwap(p, n); p = l.peak.Load() {
+	}
+	start := time.Now()
+	return func() {
+		l.lat.Add(time.Since(start))
+		l.inflight.Add(-1)
+	}
+}
+
+func (l *loadStats) sample(interval time.Duration) loadSample {
+	sum := l.lat.Summary(true)
+	return loadSample{
+		depth:      int(l.peak.Swap(l.inflight.Load())),
+		p95:        sum.P95,
+		throughput: float64(sum.Count) / interval.Seconds(),
+	}
+}
+
+// advice is the backpressure message sent to flow-controlled streams.
+type advice struct {
+	QueueDepth int     `json:"queue_depth"`
+	FPS        float64 `json:"fps"`       // recommended send rate per stream; 0 = no limit
+	Saturated  bool    `json:"saturated"` // credit windows shrink to one frame
+}
+
+// currentAdvice is the latest advice, or RATE_LIMIT_FPS before the first
+// sample.
+func (s *Server) currentAdvice() advice {
+	if adv := s.advice.Load(); adv != nil {
+		return *adv
+	}
+	return advice{FPS: s.settings().RateLimitFPS}
+}
+
+func (s *Server) monitorLoad(ctx context.Context) {
+	t := time.NewTicker(loadInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			ls := s.load.sample(loadInterval)
+			if s.adapt != nil {
+				s.adapt.tick(ls)
+			}
+			adv := s.adviseFor(ls)
+			s.advice.Store(&adv)
+		}
+	}
+}
+
+// adviseFor derives the per-stream send rate from a load sample. The queue
+// target is ADAPTIVE_QUEUE_DEPTH, or the CPU count when that is unset. Over
+// target, the measured throughput is shared among the streams and scaled
+// down by how far the queue overshot, so clients that follow the advice
+// bring the queue back to target; under target only RATE_LIMIT_FPS applies.
+func (s *Server) adviseFor(ls loadSample) advice {
+	target := s.cfg.AdaptiveQueueDepth
+	if target == 0 {
+		target = runtime.NumCPU()
+	}
+	adv := advice{QueueDepth: ls.depth, FPS: s.settings().RateLimitFPS}
+	adv.Saturated = ls.depth > target || (s.adapt != nil && s.adapt.overloaded(ls))
+	if adv.Saturated && ls.throughput > 0 {
+		share := ls.throughput / float64(max(s.conns.count(), 1))
+		share *= math.Min(1, float64(target)/float64(max(ls.depth, 1)))
+		if adv.FPS == 0 || share < adv.FPS {
+			adv.FPS = share
+		}
+	}
+	if adv.FPS > 0 {
+		adv.FPS = max(math.Round(adv.FPS*10)/10, 0.1) // never round a limit away
+	}
+	return adv
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ── 로깅 ─────────────────────────────────────────────────────────────────────
+// LOG_FORMAT picks the text or JSON handler and LOG_LEVEL the minimum level;
+// the level is a LevelVar so /admin/config and CONFIG_FILE can change it
+// live. Warnings and errors are sampled per message: after LOG_SAMPLE_BURST
+// records within logSampleWindow the rest are dropped, and the next record
+// that gets through carries a "suppressed" count.
+
+const logSampleWindow = time.Second
+
+var logLevel slog.LevelVar
+
+func parseLogLevel(s string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(strings.TrimSpace(s))); err != nil {
+		return 0, fmt.Errorf("want debug, info, warn or error, got %q", s)
+	}
+	return l, nil
+}
+
+// SetupLogging installs the slog default handler described by cfg.
+func SetupLogging(w io.Writer, cfg Config) {
+	logLevel.Set(cfg.LogLevel)
+	opts := &slog.HandlerOptions{Level: &logLevel}
+	var h slog.Handler
+	if cfg.LogFormat == "json" {
+		h = slog.NewJSONHandler(w, opts)
+	} else {
+		h = slog.NewTextHandler(w, opts)
+	}
+	if cfg.LogSampleBurst > 0 {
+		h = &samplingHandler{Handler: h, s: &sampler{burst: cfg.LogSampleBurst, seen: make(map[string]*sampleWindow)}}
+	}
+	slog.SetDefault(slog.New(h))
+}
+
+type sampler struct {
+	burst int
+
+	mu   sync.Mutex
+	seen map[string]*sampleWindow // by level + message
+}
+
+type sampleWindow struct {
+	start      time.Time
+	n          int
+	suppressed int
+}
+
+// admit reports whether a record may be written and how many were dropped
+// since the last one that was.
+func (s *sampler) admit(r slog.Record) (ok bool, suppressed int) {
+	key := r.Level.String() + "\x00" + r.Message
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w := s.seen[key]
+	if w == nil {
+		w = &sampleWindow{}
+		s.seen[key] = w
+	}
+	if r.Time.Sub(w.start) >= logSampleWindow {
+		w.start, w.n = r.Time, 0
+	}
+	if w.n >= s.burst {
+		w.suppressed++
+		return false, 0
+	}
+	w.n++
+	suppressed, w.suppressed = w.suppressed, 0
+	return true, suppressed
+}
+
+type samplingHandler struct {
+	slog.Handler
+	s *sampler
+}
+
+func (h *samplingHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level < slog.LevelWarn {
+		return h.Handler.Handle(ctx, r)
+	}
+	ok, suppressed := h.s.admit(r)
+	if !ok {
+		return nil
+	}
+	if suppressed > 0 {
+		r = r.Clone()
+		r.AddAttrs(slog.Int("suppressed", suppressed))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *samplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &samplingHandler{Handler: h.Handler.WithAttrs(attrs), s: h.s}
+}
+
+func (h *samplingHandler) WithGroup(name string) slog.Handler {
+	return &samplingHandler{Handler: h.Handler.WithGroup(name), s: h.s}
+}
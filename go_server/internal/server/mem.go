@@ -0,0 +1,145 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"yolo-server/internal/preprocess"
+)
+
+// ── 메모리 계정 ──────────────────────────────────────────────────────────────
+// The large allocations a client can cause are counted per connection and
+// server-wide: the frames being handled, their decoded images (estimated
+// from the header before OpenCV allocates them), the answers waiting to be
+// written, the recording ring and the frames kept for event clips. A frame
+// that would take its connection past MEM_CONN_LIMIT, or the server past
+// MEM_LIMIT, is refused before it is decoded. The engine's own pools are bounded by poolSize and not counted.
+
+type memKind int
+
+const (
+	memFrame     memKind = iota // encoded frame being handled
+	memDecode                   // decoded image and its working copy
+	memBuffer                   // answers waiting to be written
+	memRecording                // recording ring (RECORD_MODE=ring)
+	memEvent                    // event clip pre- and post-roll frames
+	memKinds
+)
+
+var memKindNames = [memKinds]string{"frame", "decode", "buffer", "recording", "event"}
+
+var (
+	errConnMemory   = errors.New("frame exceeds the connection's memory limit")
+	errServerMemory = errors.New("server memory limit reached; retry later")
+)
+
+type memLedger struct {
+	limit     int64 // MEM_LIMIT; 0 = none
+	connLimit int64 // MEM_CONN_LIMIT; 0 = none
+	total     atomic.Int64
+	byKind    [memKinds]atomic.Int64
+}
+
+// reserve charges n bytes to ci and the server if both stay within their
+// limits.
+func (m *memLedger) reserve(ci *connInfo, kind memKind, n int64) error {
+	if m.connLimit > 0 && ci.mem.Load()+n > m.connLimit {
+		return errConnMemory
+	}
+	for {
+		cur := m.total.Load()
+		if m.limit > 0 && cur+n > m.limit {
+			return errServerMemory
+		}
+		if m.total.CompareAndSwap(cur, cur+n) {
+			break
+		}
+	}
+	m.byKind[kind].Add(n)
+	ci.mem.Add(n)
+	return nil
+}
+
+// charge counts n bytes (negative to release) without checking limits, for
+// memory that is already allocated.
+func (m *memLedger) charge(ci *connInfo, kind memKind, n int64) {
+	m.total.Add(n)
+	m.byKind[kind].Add(n)
+	ci.mem.Add(n)
+}
+
+// decodeCost estimates the decoded image plus one working copy (EXIF
+// rotation, ROI crop) as 8-bit BGR; 0 when the header cannot be read.
+func decodeCost(frame []byte) int64 {
+	w, h, ok := preprocess.FrameDims(frame)
+	if !ok {
+		return 0
+	}
+	return 2 * 3 * int64(w) * int64(h)
+}
+
+// reserveFrame charges a frame and its decode; the returned func releases
+// both.
+func (s *Server) reserveFrame(ci *connInfo, frame []byte) (func(), error) {
+	n, d := int64(len(frame)), decodeCost(frame)
+	if err := s.mem.reserve(ci, memFrame, n); err != nil {
+		return nil, err
+	}
+	if err := s.mem.reserve(ci, memDecode, d); err != nil {
+		s.mem.charge(ci, memFrame, -n)
+		return nil, err
+	}
+	return func() {
+		s.mem.charge(ci, memFrame, -n)
+		s.mem.charge(ci, memDecode, -d)
+	}, nil
+}
+
+func memError(err error) wsError {
+	return wsError{Error: err.Error(), Code: "memory_limit"}
+}
+
+// memStats is the JSON view served by GET /admin/memory.
+type memStats struct {
+	Total     int64            `json:"total_bytes"`
+	Limit     int64            `json:"limit_bytes,omitempty"`
+	ConnLimit int64            `json:"conn_limit_bytes,omitempty"`
+	ByKind    map[string]int64 `json:"by_kind"`
+}
+
+func (m *memLedger) stats() memStats {
+	st := memStats{Total: m.total.Load(), Limit: m.limit, ConnLimit: m.connLimit, ByKind: make(map[string]int64, memKinds)}
+	for k := memKind(0); k < memKinds; k++ {
+		st.ByKind[memKindNames[k]] = m.byKind[k].Load()
+	}
+	return st
+}
+
+func (s *Server) adminMemory(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.mem.stats())
+}
+
+// parseBytes accepts a byte count with an optional binary suffix: "512MiB",
+// "2GiB", "65536". K/M/G and KB/MB/GB are read as binary too.
+func parseBytes(v string) (int64, error) {
+	s := strings.TrimSpace(strings.ToUpper(v))
+	mult := int64(1)
+	for _, u := range []struct {
+		suffix string
+		mult   int64
+	}{{"KIB", 1 << 10}, {"MIB", 1 << 20}, {"GIB", 1 << 30}, {"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}} {
+		if rest, ok := strings.CutSuffix(s, u.suffix); ok {
+			s, mult = strings.TrimSpace(rest), u.mult
+			break
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSuffix(s, "B"), 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("want a byte size such as 512MiB, got %q", v)
+	}
+	return n * mult, nil
+}
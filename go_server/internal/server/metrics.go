@@ -0,0 +1,125 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ── 메트릭 ───────────────────────────────────────────────────────────────────
+// A minimal Prometheus text-format exporter: the server only needs a handful
+// of labelled counters and gauges, which does not justify pulling in
+// client_golang. Metrics register themselves in a metricSet and are written
+// in registration order by /metrics.
+
+type metric interface {
+	writeTo(w io.Writer)
+}
+
+type metricSet struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+func (m *metricSet) register(x metric) {
+	m.mu.Lock()
+	m.metrics = append(m.metrics, x)
+	m.mu.Unlock()
+}
+
+func (m *metricSet) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, x := range m.metrics {
+		x.writeTo(w)
+	}
+}
+
+// gaugeFunc is a gauge (or counter) with a single label whose values are
+// read from fn at scrape time.
+type gaugeFunc struct {
+	name, help, label, typ string
+	fn                     func() map[string]int64
+}
+
+func (m *metricSet) newGaugeFunc(name, help, label string, fn func() map[string]int64) {
+	m.register(&gaugeFunc{name: name, help: help, label: label, typ: "gauge", fn: fn})
+}
+
+// newCounterFunc is newGaugeFunc for a count kept elsewhere.
+func (m *metricSet) newCounterFunc(name, help, label string, fn func() map[string]int64) {
+	m.register(&gaugeFunc{name: name, help: help, label: label, typ: "counter", fn: fn})
+}
+
+func (g *gaugeFunc) writeTo(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", g.name, g.help, g.name, g.typ)
+	vals := g.fn()
+	keys := make([]string, 0, len(vals))
+	for k := range vals {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s{%s=%q} %d\n", g.name, g.label, k, vals[k])
+	}
+}
+
+// maxLabelValues caps the series of one counterVec; values past it are
+// counted under "other".
+const maxLabelValues = 500
+
+// clientMetricLabel folds JWT subjects ("jwt:<sub>", or "tenant/jwt:<sub>")
+// into one "jwt" series: subjects are unbounded and identify end users.
+func clientMetricLabel(v string) string {
+	if i := strings.Index(v, "jwt:"); i == 0 || i > 0 && v[i-1] == '/' {
+		return v[:i] + "jwt"
+	}
+	return v
+}
+
+// counterVec is a counter with a single label. Counters labelled "client"
+// fold JWT subjects together.
+type counterVec struct {
+	name, help, label string
+
+	mu   sync.Mutex
+	vals map[string]uint64
+}
+
+func (m *metricSet) newCounterVec(name, help, label string) *counterVec {
+	c := &counterVec{name: name, help: help, label: label, vals: make(map[string]uint64)}
+	m.register(c)
+	return c
+}
+
+func (c *counterVec) add(labelValue string, n uint64) {
+	if c.label == "client" {
+		labelValue = clientMetricLabel(labelValue)
+	}
+	c.mu.Lock()
+	if _, ok := c.vals[labelValue]; !ok && len(c.vals) >= maxLabelValues {
+		labelValue = "other"
+	}
+	c.vals[labelValue] += n
+	c.mu.Unlock()
+}
+
+func (c *counterVec) inc(labelValue string) { c.add(labelValue, 1) }
+
+func (c *counterVec) writeTo(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	keys := make([]string, 0, len(c.vals))
+	for k := range c.vals {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s{%s=%q} %d\n", c.name, c.label, k, c.vals[k])
+	}
+}
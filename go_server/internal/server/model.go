@@ -0,0 +1,70 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"yolo-server/internal/inference"
+	"yolo-server/internal/postprocess"
+)
+
+// ── 모델 정보 ────────────────────────────────────────────────────────────────
+
+// modelInfoResponse is /model/info: the parsed ONNX header and all
+// metadata_props, with the keys clients usually want pulled out.
+type modelInfoResponse struct {
+	Path    string             `json:"path"`
+	SHA256  string             `json:"sha256"`
+	Backend string             `json:"backend"`
+	Task    string             `json:"task"`
+	Stride  int                `json:"stride,omitempty"`
+	ImgSz   []int              `json:"imgsz,omitempty"`
+	Author  string             `json:"author,omitempty"`
+	Names   postprocess.Labels `json:"names,omitempty"`
+	inference.ModelInfo
+}
+
+func (s *Server) modelInfo(w http.ResponseWriter, _ *http.Request) {
+	m := s.model
+	writeJSON(w, http.StatusOK, modelInfoResponse{
+		Path:      s.versionInfo.ModelPath,
+		SHA256:    s.versionInfo.ModelSHA256,
+		Backend:   s.cfg.Backend,
+		Task:      m.Task(),
+		Stride:    m.Stride(),
+		ImgSz:     m.ImgSz(),
+		Author:    m.Metadata["author"],
+		Names:     m.Labels(),
+		ModelInfo: m,
+	})
+}
+
+// maxCalibrationBody bounds POST /admin/score-calibration/fit; a sample is
+// about 50 bytes.
+const maxCalibrationBody = 64 << 20
+
+// adminFitCalibration fits a score calibration (postprocess/calibrate.go)
+// to labelled detections, for saving next to the model.
+func (s *Server) adminFitCalibration(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Method   string                    `json:"method"`
+		PerClass bool                      `json:"per_class"`
+		Samples  []postprocess.ScoreSample `json:"samples"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCalibrationBody)).Decode(&body); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if body.Method == "" {
+		body.Method = "platt"
+	}
+	fit, err := postprocess.FitScoreCalibration(body.Method, body.Samples, body.PerClass)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	slog.Info("admin: score calibration fitted", "remote", s.clientIP(r), "method", body.Method,
+		"samples", fit.Samples, "ece_before", fit.ECEBefore, "ece_after", fit.ECEAfter)
+	writeJSON(w, http.StatusOK, fit)
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"math"
+
+	"yolo-server/internal/calib"
+	"yolo-server/internal/postprocess"
+	"yolo-server/internal/track"
+)
+
+// ── 이동 방향 ────────────────────────────────────────────────────────────────
+// With MOTION_ATTRIBUTES on, the detections a stream answers with carry the
+// velocity of their tracked box centre in px/s and the way they travel in
+// the image, one of directions. A box moving less than a tenth of its
+// longer side a second is at rest and has no direction. A track seen in
+// one inferred frame has no velocity yet; single images have no track.
+// A calibrated stream's moving detections also carry their speed over the
+// ground in km/h, where their box's bottom edge moves as its centre does.
+
+// directions are the eight ways of travel, clockwise from +x, y pointing
+// down as in the image.
+var directions = [8]string{"right", "down-right", "down", "down-left", "left", "up-left", "up", "up-right"}
+
+// restFraction of a box's longer side per second is the least speed with
+// a direction.
+const restFraction = 0.1
+
+// addMotion sets the motion attributes of dets from ms, the tracker's
+// Motion in the same order, and cam, nil when the stream is not calibrated.
+func addMotion(dets []postprocess.Detection, ms []track.Velocity, cam *calib.Camera) {
+	if len(ms) != len(dets) {
+		return
+	}
+	for i := range dets {
+		v := ms[i]
+		if !v.OK {
+			continue
+		}
+		d := &dets[i]
+		vel := [2]float64{math.Round(v.X*10) / 10, math.Round(v.Y*10) / 10}
+		dir := ""
+		size := float64(max(d.Box[2]-d.Box[0], d.Box[3]-d.Box[1]))
+		if math.Hypot(v.X, v.Y) >= restFraction*size {
+			sector := int(math.Round(math.Atan2(v.Y, v.X)/(math.Pi/4))) + 8
+			dir = directions[sector%8]
+		}
+		kmh := 0.0
+		if cam != nil {
+			gx, gy := groundPoint(*d)
+			if mps, ok := cam.Speed(gx, gy, v.X, v.Y); ok {
+				kmh = math.Round(mps*3.6*10) / 10
+			}
+		}
+		d.SetAttributes(func(a *postprocess.Attributes) { a.Velocity, a.Direction, a.SpeedKmh = &vel, dir, kmh })
+	}
+}
@@ -0,0 +1,203 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ── 다중화 ───────────────────────────────────────────────────────────────────
+// A gateway with several cameras behind one address can carry all of them
+// over one WebSocket opened with ?mux=1. Every message then names the
+// logical stream it belongs to: a binary message starts with a tag,
+//
+//	"YST1" | length uint8 | stream id | frame, stamped frame or batch
+//
+// and a text message has a "stream" member. The first message for an id
+// opens a logical stream with that ?stream= id; it runs its own pipeline,
+// with its own settings, tracker, credits and clock, starting from the
+// connection's query, and is listed, counted and closed in
+// /admin/connections like a connection of its own. Every message the
+// server sends for it gets the same "stream" member. A stream's messages
+// wait in its own queue, so a camera the model cannot keep up with is
+// answered "busy" instead of holding up the others. Logical streams are not
+// resumable, and end with the connection or {"stream": id, "close": true}.
+
+const muxTagMagic = "YST1"
+
+// muxConn is a ?mux=1 connection.
+type muxConn struct {
+	s    *Server
+	r    *http.Request
+	conn *websocket.Conn
+	tmpl *connInfo // what every logical stream's connInfo starts from; not registered
+
+	wmu sync.Mutex // serializes writes to conn
+
+	mu      sync.Mutex
+	streams map[string]*muxStream
+	wg      sync.WaitGroup
+}
+
+type muxStream struct {
+	in   chan streamMsg // the reader's alone; closed when the connection ends
+	stop chan struct{}  // closed to end the stream early
+	once sync.Once
+}
+
+func (ms *muxStream) end() { ms.once.Do(func() { close(ms.stop) }) }
+
+// muxWriter is a logical stream's messageWriter: it adds "stream" to each
+// JSON object written to the shared connection.
+type muxWriter struct {
+	m      *muxConn
+	prefix []byte // {"stream":"<id>"
+}
+
+func (w *muxWriter) WriteMessage(messageType int, data []byte) error {
+	data = bytes.TrimSpace(data)
+	msg := make([]byte, 0, len(w.prefix)+len(data)+1)
+	msg = append(msg, w.prefix...)
+	if len(data) > 2 && data[0] == '{' {
+		msg = append(append(msg, ','), data[1:]...)
+	} else {
+		msg = append(msg, '}')
+	}
+	return w.m.write(messageType, msg)
+}
+
+func (m *muxConn) write(messageType int, data []byte) error {
+	m.wmu.Lock()
+	defer m.wmu.Unlock()
+	return m.conn.WriteMessage(messageType, data)
+}
+
+// refuse answers a message the connection cannot take, for stream id.
+func (m *muxConn) refuse(id string, we wsError) {
+	w := &muxWriter{m: m, prefix: muxPrefix(id)}
+	b, _ := json.Marshal(we)
+	_ = w.WriteMessage(websocket.TextMessage, b)
+}
+
+func muxPrefix(id string) []byte {
+	b, _ := json.Marshal(id)
+	return append([]byte(`{"stream":`), b...)
+}
+
+// splitMuxTag splits a binary message into its stream id and payload.
+func splitMuxTag(data []byte) (string, []byte, error) {
+	if len(data) < len(muxTagMagic)+1 || string(data[:len(muxTagMagic)]) != muxTagMagic {
+		return "", nil, fmt.Errorf("mux: binary messages start with a %s stream tag", muxTagMagic)
+	}
+	n := int(data[len(muxTagMagic)])
+	data = data[len(muxTagMagic)+1:]
+	if n > len(data) || !validStreamID(string(data[:n])) {
+		return "", nil, fmt.Errorf("mux: want a stream id of 1..%d of [A-Za-z0-9._-]", maxStreamID)
+	}
+	return string(data[:n]), data[n:], nil
+}
+
+// serve reads the connection until it ends and routes every message to
+// its logical stream.
+func (m *muxConn) serve() {
+	defer func() {
+		m.mu.Lock()
+		for _, ms := range m.streams {
+			close(ms.in)
+		}
+		m.mu.Unlock()
+		m.wg.Wait()
+	}()
+	for {
+		msgType, data, err := m.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		msg := streamMsg{data: data, control: msgType == websocket.TextMessage}
+		var id string
+		if msg.control {
+			var head struct {
+				Stream string `json:"stream"`
+				Close  bool   `json:"close"`
+			}
+			if err := json.Unmarshal(data, &head); err != nil || !validStreamID(head.Stream) {
+				m.refuse("", wsError{Error: "mux: want a \"stream\" id in every text message", Code: "bad_control"})
+				continue
+			}
+			if id = head.Stream; head.Close {
+				m.close(id)
+				continue
+			}
+		} else if id, msg.data, err = splitMuxTag(data); err != nil {
+			m.refuse("", wsError{Error: err.Error(), Code: "bad_frame"})
+			continue
+		}
+		ms, err := m.open(id)
+		if err != nil {
+			m.refuse(id, wsError{Error: err.Error(), Code: "too_many_streams"})
+			continue
+		}
+		select {
+		case ms.in <- msg:
+		default:
+			m.refuse(id, wsError{Error: "stream is busy; message dropped", Code: "busy"})
+		}
+	}
+}
+
+// open returns logical stream id, starting it if need be.
+func (m *muxConn) open(id string) (*muxStream, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if ms, ok := m.streams[id]; ok {
+		return ms, nil
+	}
+	if len(m.streams) >= m.s.cfg.MuxMaxStreams {
+		return nil, fmt.Errorf("at most %d streams per connection (MUX_MAX_STREAMS)", m.s.cfg.MuxMaxStreams)
+	}
+	if m.s.tooManyConns(tenantOf(m.r)) {
+		return nil, fmt.Errorf("too many connections")
+	}
+	// Both were checked when the connection was opened.
+	st, _ := newStreamState(m.r.URL.Query(), &m.s.cfg)
+	fl, _ := newFlowState(m.r.URL.Query(), m.s.cfg.FlowCredits)
+	st.id = id
+	ms := &muxStream{in: make(chan streamMsg, streamReadQueue), stop: make(chan struct{})}
+	ci := &connInfo{
+		remote: m.tmpl.remote, key: m.tmpl.key, model: m.tmpl.model, transport: "mux", tenant: m.tmpl.tenant,
+		priority: m.tmpl.priority, started: time.Now(), stream: id, closeFn: func(string) { ms.end() },
+	}
+	m.s.conns.add(ci)
+	m.streams[id] = ms
+	slog.Debug("mux stream opened", "id", ci.id, "remote", ci.remote, "stream", id)
+	p := m.s.newPipeline(m.r, ci, st, fl, &muxWriter{m: m, prefix: muxPrefix(id)})
+	p.muxed = true
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		p.run(ms.in, ms.stop)
+		m.s.conns.remove(ci.id)
+		m.mu.Lock()
+		if m.streams[id] == ms {
+			delete(m.streams, id) // the next message for id opens it anew
+		}
+		m.mu.Unlock()
+	}()
+	return ms, nil
+}
+
+// close ends logical stream id.
+func (m *muxConn) close(id string) {
+	m.mu.Lock()
+	ms := m.streams[id]
+	m.mu.Unlock()
+	if ms != nil {
+		ms.end()
+	}
+}
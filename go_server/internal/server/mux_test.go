@@ -0,0 +1,50 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func muxMsg(id string, payload string) []byte {
+	b := append([]byte(muxTagMagic), byte(len(id)))
+	return append(append(b, id...), payload...)
+}
+
+func TestSplitMuxTag(t *testing.T) {
+	long := strings.Repeat("a", maxStreamID)
+	tests := []struct {
+		name    string
+		data    []byte
+		id      string
+		payload string
+		ok      bool
+	}{
+		{"frame", muxMsg("cam-1", "\xff\xd8jpeg"), "cam-1", "\xff\xd8jpeg", true},
+		{"empty payload", muxMsg("cam.2", ""), "cam.2", "", true},
+		{"longest id", muxMsg(long, "x"), long, "x", true},
+		{"no tag", []byte("\xff\xd8\xff\xe0"), "", "", false},
+		{"magic only", []byte(muxTagMagic), "", "", false},
+		{"id length 0", muxMsg("", "x"), "", "", false},
+		{"id longer than the message", append([]byte(muxTagMagic), 10, 'a', 'b'), "", "", false},
+		{"id longer than maxStreamID", muxMsg(long+"a", "x"), "", "", false},
+		{"id length 255", append(append([]byte(muxTagMagic), 255), strings.Repeat("a", 255)...), "", "", false},
+		{"id with a slash", muxMsg("../x", "x"), "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, payload, err := splitMuxTag(tt.data)
+			if !tt.ok {
+				if err == nil {
+					t.Errorf("splitMuxTag = %q, %q, want an error", id, payload)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id != tt.id || string(payload) != tt.payload {
+				t.Errorf("splitMuxTag = %q, %q, want %q, %q", id, payload, tt.id, tt.payload)
+			}
+		})
+	}
+}
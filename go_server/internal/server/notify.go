@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"text/template"
+
+	"yolo-server/internal/notify"
+)
+
+// ── 알림 ─────────────────────────────────────────────────────────────────────
+// EVENT_NOTIFY routes events to sinks by class, e.g.
+// "person=slack+email,*=telegram"; "*" takes every watched class. A sink
+// is usable once its NOTIFY_* settings are given. Each event is rendered
+// with NOTIFY_TEMPLATE, and NOTIFY_SUBJECT for mail, and sent with the
+// frame that raised it where the sink takes images. Every sink sends from
+// its own queue of notifyQueue messages, off the pipeline; a message that
+// finds the queue full is dropped and counted as failed.
+
+const notifyQueue = 64
+
+var sinkNames = []string{"slack", "telegram", "email"}
+
+// parseEventNotify reads EVENT_NOTIFY against the rest of cfg.
+func parseEventNotify(v string, cfg Config) (map[string][]string, error) {
+	configured := map[string]bool{
+		"slack":    cfg.SlackWebhook != "",
+		"telegram": cfg.TelegramToken != "",
+		"email":    cfg.SMTPAddr != "",
+	}
+	if len(cfg.EventClasses) == 0 {
+		return nil, fmt.Errorf("needs EVENT_CLASSES")
+	}
+	routes := map[string][]string{}
+	for _, rule := range strings.Split(v, ",") {
+		class, sinks, ok := strings.Cut(strings.TrimSpace(rule), "=")
+		if !ok || class == "" || sinks == "" {
+			return nil, fmt.Errorf("want class=sink[+sink...], got %q", rule)
+		}
+		if class != "*" && !slices.Contains(cfg.EventClasses, class) {
+			return nil, fmt.Errorf("%q is not in EVENT_CLASSES", class)
+		}
+		for _, sink := range strings.Split(sinks, "+") {
+			switch {
+			case !slices.Contains(sinkNames, sink):
+				return nil, fmt.Errorf("unknown sink %q, want one of %s", sink, strings.Join(sinkNames, ", "))
+			case !configured[sink]:
+				return nil, fmt.Errorf("sink %q is not configured", sink)
+			}
+			if !slices.Contains(routes[class], sink) {
+				routes[class] = append(routes[class], sink)
+			}
+		}
+	}
+	return routes, nil
+}
+
+type notifier struct {
+	routes  map[string][]string
+	text    *template.Template
+	subject *template.Template
+	queues  map[string]chan notify.Message // by sink
+	sent    *counterVec                    // by sink
+	failed  *counterVec                    // by sink
+}
+
+func newNotifier(cfg Config, m *metricSet) (*notifier, error) {
+	n := &notifier{
+		routes: cfg.EventNotify,
+		queues: map[string]chan notify.Message{},
+		sent:   m.newCounterVec("yolo_notifications_sent_total", "Event notifications delivered, by sink.", "sink"),
+		failed: m.newCounterVec("yolo_notifications_failed_total", "Event notifications that failed or were dropped, by sink.", "sink"),
+	}
+	var err error
+	if n.text, err = template.New("text").Parse(cfg.NotifyTemplate); err != nil {
+		return nil, fmt.Errorf("NOTIFY_TEMPLATE: %w", err)
+	}
+	if n.subject, err = template.New("subject").Parse(cfg.NotifySubject); err != nil {
+		return nil, fmt.Errorf("NOTIFY_SUBJECT: %w", err)
+	}
+	sinks := map[string]notify.Sink{}
+	if cfg.SlackWebhook != "" {
+		sinks["slack"] = notify.NewSlack(cfg.SlackWebhook)
+	}
+	if cfg.TelegramToken != "" {
+		sinks["telegram"] = notify.NewTelegram(cfg.TelegramToken, cfg.TelegramChat)
+	}
+	if cfg.SMTPAddr != "" {
+		sinks["email"] = notify.NewEmail(cfg.SMTPAddr, cfg.SMTPUser, cfg.SMTPPassword, cfg.SMTPFrom, cfg.SMTPTo)
+	}
+	for name, sink := range sinks {
+		q := make(chan notify.Message, notifyQueue)
+		n.queues[name] = q
+		go n.run(name, sink, q)
+	}
+	return n, nil
+}
+
+// event notifies ev's sinks; image is the frame that raised it.
+func (n *notifier) event(ev *event, image []byte) {
+	if n == nil {
+		return
+	}
+	sinks := slices.Clone(n.routes[ev.Class])
+	for _, s := range n.routes["*"] {
+		if !slices.Contains(sinks, s) {
+			sinks = append(sinks, s)
+		}
+	}
+	if len(sinks) == 0 {
+		return
+	}
+	m := notify.Message{
+		Text:    n.render(n.text, ev),
+		Subject: n.render(n.subject, ev),
+		Image:   image,
+		Name:    "snapshot" + snapshotExt(image),
+	}
+	for _, s := range sinks {
+		select {
+		case n.queues[s] <- m:
+		default:
+			n.failed.inc(s)
+			slog.Warn("notification dropped", "sink", s, "event", ev.ID)
+		}
+	}
+}
+
+func (n *notifier) render(t *template.Template, ev *event) string {
+	var b strings.Builder
+	if err := t.Execute(&b, ev); err != nil {
+		slog.Warn("notification template", "template", t.Name(), "err", err)
+		return fmt.Sprintf("%s on %s", ev.Class, ev.Stream)
+	}
+	return b.String()
+}
+
+func (n *notifier) run(name string, sink notify.Sink, q <-chan notify.Message) {
+	for m := range q {
+		if err := sink.Send(context.Background(), m); err != nil {
+			n.failed.inc(name)
+			slog.Warn("notification failed", "sink", name, "err", err)
+			continue
+		}
+		n.sent.inc(name)
+	}
+}
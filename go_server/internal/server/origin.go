@@ -0,0 +1,81 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/rs/cors"
+)
+
+// ── CORS / Origin ────────────────────────────────────────────────────────────
+// One allowlist governs both CORS responses and the WebSocket Origin check,
+// so a browser that may call /detect may also open /ws/stream and vice
+// versa. Entries are exact origins ("https://app.example.com"), wildcard
+// subdomains ("https://*.example.com"), or "*" for any origin.
+
+type originAllowlist struct {
+	any      bool
+	exact    map[string]bool
+	suffixes []originSuffix // from "scheme://*.domain" entries
+}
+
+type originSuffix struct {
+	scheme string // "https://"
+	domain string // ".example.com"
+}
+
+func parseOrigins(raw string) originAllowlist {
+	a := originAllowlist{exact: make(map[string]bool)}
+	for _, o := range strings.Split(raw, ",") {
+		o = strings.ToLower(strings.TrimSpace(o))
+		switch {
+		case o == "":
+		case o == "*":
+			a.any = true
+		case strings.Contains(o, "://*."):
+			scheme, domain, _ := strings.Cut(o, "*")
+			a.suffixes = append(a.suffixes, originSuffix{scheme: scheme, domain: domain})
+		default:
+			a.exact[strings.TrimSuffix(o, "/")] = true
+		}
+	}
+	return a
+}
+
+func (a originAllowlist) allows(origin string) bool {
+	if a.any {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if a.exact[origin] {
+		return true
+	}
+	for _, s := range a.suffixes {
+		if rest, ok := strings.CutPrefix(origin, s.scheme); ok && strings.HasSuffix(rest, s.domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkOrigin is the websocket.Upgrader hook. Requests without an Origin
+// header come from non-browser clients and are not subject to CORS.
+func (a originAllowlist) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	return origin == "" || a.allows(origin)
+}
+
+func (a originAllowlist) cors() *cors.Cors {
+	return cors.New(cors.Options{
+		AllowOriginFunc: a.allows,
+		AllowedMethods: []string{
+			http.MethodHead,
+			http.MethodGet,
+			http.MethodPost,
+			http.MethodPut,
+			http.MethodPatch,
+			http.MethodDelete,
+		},
+		AllowedHeaders: []string{"*"},
+	})
+}
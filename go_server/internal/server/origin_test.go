@@ -0,0 +1,62 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOriginAllowlist(t *testing.T) {
+	a := parseOrigins(" https://app.example.com/, https://*.example.org ,HTTP://Local.Test")
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://app.example.com", true},
+		{"HTTPS://APP.EXAMPLE.COM", true},
+		{"http://app.example.com", false},
+		{"https://app.example.com.evil.test", false},
+		{"https://cam.example.org", true},
+		{"https://a.b.example.org", true},
+		{"http://cam.example.org", false},
+		{"https://example.org", false},
+		{"https://evilexample.org", false},
+		{"http://local.test", true},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := a.allows(tt.origin); got != tt.want {
+			t.Errorf("allows(%q) = %v, want %v", tt.origin, got, tt.want)
+		}
+	}
+
+	if !parseOrigins("*").allows("https://anything.test") {
+		t.Error(`"*" refused an origin`)
+	}
+	if parseOrigins("").allows("https://app.example.com") {
+		t.Error("an empty allowlist allowed an origin")
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	a := parseOrigins("https://app.example.com")
+	tests := []struct {
+		name   string
+		origin string
+		want   bool
+	}{
+		{"no header", "", true},
+		{"allowed", "https://app.example.com", true},
+		{"other", "https://evil.test", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/ws/stream", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if got := a.checkOrigin(r); got != tt.want {
+				t.Errorf("checkOrigin = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,513 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"yolo-server/internal/inference"
+	"yolo-server/internal/postprocess"
+	"yolo-server/internal/track"
+	"yolo-server/internal/video"
+)
+
+// ── 스트림 파이프라인 ────────────────────────────────────────────────────────
+// pipeline is everything a stream does with its messages, independent of
+// the transport: control messages, sampling, adaptive skips, flow control,
+// inference, recording and the answer. It runs in three stages joined by
+// bounded channels:
+//
+//	transport reader → in → run → inference goroutines → run → q → writer
+//
+// The transport reads ahead into in (/ws/stream from its socket, the
+// long-poll transport from its request queue). run owns the stream's state,
+// so it needs no locking; it hands up to ?inflight= frames at a time to
+// inference goroutines and releases finished answers to the writer in frame
+// ID order, or as each finishes with ?order=any for clients that reorder by
+// the answers' frame IDs themselves. Reads therefore never wait for the
+// model, and the model only waits for a slow client once streamWriteQueue
+// answers are queued for it.
+
+const (
+	streamReadQueue  = 8  // messages read ahead of the pipeline
+	streamWriteQueue = 16 // messages waiting for the writer
+	maxInflight      = 16 // upper bound of ?inflight=
+	maxMaskZones     = 16 // privacy zones per stream
+)
+
+var errStreamGone = errors.New("stream closed")
+
+// streamMsg is one message from the client: a frame, or a JSON control
+// message.
+type streamMsg struct {
+	data    []byte
+	control bool
+}
+
+// messageWriter is where a stream's messages go. *websocket.Conn is one.
+type messageWriter interface {
+	WriteMessage(messageType int, data []byte) error
+}
+
+// answer is a frame's reply. In frame order it waits in pending for the
+// frames before it.
+type answer struct {
+	seq uint64
+	buf *bytes.Buffer
+
+	// Set for frames that reached the model.
+	recorded bool
+	opts     inference.Options
+	frame    []byte
+	arrived  time.Time
+	dets     []postprocess.Detection
+	ok       bool         // dets are the model's; feed them to the tracker
+	shown    bool         // frame and dets are what the client got; for the video
+	stable   bool         // dets go through ?stable= on release
+	batch    *batchAnswer // sent with the rest of its batch (batch.go); nil alone
+	captured time.Time    // the frame's capture stamp on the server's clock (e2e.go); zero without one
+	resp     *wsResponse  // encoded into buf on release, for MOTION_ATTRIBUTES and ?stable=
+}
+
+type pipeline struct {
+	s   *Server
+	r   *http.Request // the request that opened the stream, for auth and limits
+	t   *tenant       // nil outside tenants
+	ci  *connInfo
+	st  *streamState
+	fl  *flowState
+	out messageWriter // the writer goroutine's alone
+	rec *sessionRecorder
+	sv  *stateSaver     // nil unless the stream's state is shared
+	vid *video.Recorder // nil without ?video=1
+	hls *video.Recorder // nil without ?hls=1
+	ev  *eventWatch     // nil without EVENT_CLASSES
+	ha  *haWatch        // nil without MQTT_URL or ?stream=
+	wd  *worldWatch     // nil without ?stream=
+	sum *summary        // nil without ?summary=
+	gal *galleryWatch   // nil without GALLERY_DIR
+
+	token string // resumes this stream after it ends; "" without RESUME_WINDOW
+	armed string // arming mode the client last knew of (arming.go)
+
+	clock clockSync // the client's clock, once it syncs (clocksync.go)
+	muxed bool      // a logical stream of a ?mux=1 connection (mux.go)
+
+	q          chan *bytes.Buffer // to the writer
+	broken     chan struct{}      // closed when a write fails
+	writerDone chan struct{}
+	results    chan *answer // from inference goroutines
+
+	inflight int                // frames at the model
+	queued   []queuedFrame      // frames of batches waiting for a slot (batch.go)
+	pending  map[uint64]*answer // answered, waiting for earlier frames
+	next     uint64             // the frame ID to release next
+	tracked  time.Time          // arrival of the newest frame the tracker has seen
+
+	sent    quality       // last quality reported to this client
+	tracker track.Tracker // extrapolates results for skipped frames
+	skipped int           // adaptive skips since the last inferred frame
+	seq     uint64        // frames received; the current frame's ID
+}
+
+func (s *Server) newPipeline(r *http.Request, ci *connInfo, st *streamState, fl *flowState, out messageWriter) *pipeline {
+	return &pipeline{
+		s: s, r: r, t: tenantOf(r), ci: ci, st: st, fl: fl, out: out,
+		rec:        s.newSessionRecorder(ci, st.fields),
+		q:          make(chan *bytes.Buffer, streamWriteQueue),
+		broken:     make(chan struct{}),
+		writerDone: make(chan struct{}),
+		results:    make(chan *answer, maxInflight),
+		pending:    make(map[uint64]*answer),
+		next:       1,
+	}
+}
+
+// run handles messages from in until it is closed, done is closed or the
+// client stops accepting writes. Frames still at the model are waited for,
+// since inference cannot be interrupted.
+func (p *pipeline) run(in <-chan streamMsg, done <-chan struct{}) {
+	go p.write()
+	defer p.close()
+	if err := p.resume(); err != nil {
+		return
+	}
+	if p.s.shared != nil && p.st.id != "" {
+		tr := &p.tracker
+		if p.seq > 0 {
+			tr = nil // resumed; the token's tracker is as new as any
+		}
+		p.sv = p.s.shared.open(p.s.streamKey(p.r, p.st.id), tr)
+	}
+	p.vid = p.s.newVideoRecorder(p.ci, p.st)
+	p.hls = p.s.openHLS(p.r, p.ci, p.st)
+	p.ev = p.s.newEventWatch(p.r, p.ci, p.st)
+	p.ha = p.s.newHAWatch(p.r, p.ci, p.st)
+	p.wd = p.s.newWorldWatch(p.r, p.st)
+	p.gal = p.s.newGalleryWatch(p.r, p.ci, p.st)
+	p.armed = p.s.cfg.ArmDefault // clients assume it; the first frame corrects them
+	if err := p.fl.start(p, p.s.currentAdvice()); err != nil {
+		return
+	}
+	var tick <-chan time.Time
+	if p.st.summary > 0 {
+		p.sum = &summary{}
+		t := time.NewTicker(p.st.summary)
+		defer t.Stop()
+		tick = t.C
+	}
+	for {
+		if len(p.queued) > 0 && p.inflight < p.st.inflight {
+			qf := p.queued[0]
+			p.queued = p.queued[1:]
+			if err := p.frame(qf.data, qf.batch); err != nil {
+				return
+			}
+			continue
+		}
+		recv := in
+		if p.inflight >= p.st.inflight || len(p.queued) > 0 {
+			recv = nil // read ahead stops here until a frame finishes
+		}
+		var err error
+		select {
+		case m, ok := <-recv:
+			if !ok {
+				return
+			}
+			if m.control {
+				err = p.control(m.data)
+			} else {
+				err = p.message(m.data)
+			}
+		case a := <-p.results:
+			p.inflight--
+			err = p.finish(a)
+		case <-tick:
+			err = p.sendSummary()
+		case <-done:
+			return
+		case <-p.broken:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (p *pipeline) close() {
+	for ; p.inflight > 0; p.inflight-- {
+		p.s.bufPool.Put((<-p.results).buf)
+	}
+	for _, a := range p.pending {
+		p.s.bufPool.Put(a.buf)
+	}
+	if p.sum != nil {
+		_ = p.sendSummary()
+	}
+	p.suspend()
+	close(p.q)
+	<-p.writerDone
+	p.rec.close()
+	p.sv.close()
+	if p.vid != nil {
+		p.vid.Close()
+	}
+	p.s.closeHLS(p.hls)
+	p.ev.close()
+	p.ha.close()
+	p.wd.close()
+}
+
+// write is the writer goroutine. After a failed write it only drains q.
+func (p *pipeline) write() {
+	defer close(p.writerDone)
+	failed := false
+	for buf := range p.q {
+		if !failed {
+			if err := p.out.WriteMessage(websocket.TextMessage, buf.Bytes()); err != nil {
+				failed = true
+				close(p.broken)
+			}
+		}
+		p.s.mem.charge(p.ci, memBuffer, -int64(buf.Cap()))
+		p.s.bufPool.Put(buf)
+	}
+}
+
+// enqueue hands buf to the writer, waiting while the write queue is full.
+func (p *pipeline) enqueue(buf *bytes.Buffer) error {
+	p.s.mem.charge(p.ci, memBuffer, int64(buf.Cap()))
+	select {
+	case p.q <- buf:
+		return nil
+	case <-p.broken:
+		p.s.mem.charge(p.ci, memBuffer, -int64(buf.Cap()))
+		p.s.bufPool.Put(buf)
+		return errStreamGone
+	}
+}
+
+// WriteJSON queues a notice outside frame order, e.g. a credit grant; it
+// makes the pipeline the flow controller's jsonWriter.
+func (p *pipeline) WriteJSON(v any) error {
+	buf := p.buffer()
+	if err := json.NewEncoder(buf).Encode(v); err != nil {
+		p.s.bufPool.Put(buf)
+		return err
+	}
+	return p.enqueue(buf)
+}
+
+func (p *pipeline) buffer() *bytes.Buffer {
+	buf := p.s.bufPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+// control applies a JSON text message; a bad one is answered, not fatal.
+func (p *pipeline) control(data []byte) error {
+	at := time.Now()
+	if err := p.st.applyControl(data); err != nil {
+		return p.WriteJSON(wsError{Error: err.Error(), Code: "bad_control"})
+	}
+	var m struct {
+		Sync json.RawMessage `json:"sync"`
+	}
+	if json.Unmarshal(data, &m) == nil && len(m.Sync) > 0 {
+		return p.sync(m.Sync, at)
+	}
+	return nil
+}
+
+// message takes a binary message: a frame or a batch of them.
+func (p *pipeline) message(data []byte) error {
+	if isBatch(data) {
+		return p.batch(data)
+	}
+	return p.frame(data, nil)
+}
+
+// frame takes one encoded frame, of batch b or alone: it is answered at
+// once when it is not inferred, or handed to an inference goroutine. An
+// error means the client is gone.
+func (p *pipeline) frame(data []byte, b *batchAnswer) error {
+	s := p.s
+	q := s.adapt.current()
+	if q != p.sent {
+		p.sent = q
+		if err := p.WriteJSON(map[string]quality{"quality": q}); err != nil {
+			return err
+		}
+	}
+	admit, err := p.fl.receive(p, s.currentAdvice())
+	if err != nil {
+		return err
+	}
+	p.seq++
+	arrived := time.Now()
+	data, captured := splitFrameStamp(data)
+	captured = p.clock.correct(captured)
+	opts := p.st.options(s.settingsFor(p.t), false)
+	if q.ImgSz > 0 {
+		opts.InputSize = q.inputSize(opts.InputSize)
+	}
+	mode := s.arming.mode(clientLabel(p.r), streamName(p.ci, p.st), arrived)
+	if mode != p.armed {
+		p.armed = mode
+		if err := p.WriteJSON(map[string]string{"arming": mode}); err != nil {
+			return err
+		}
+	}
+	run := admit && mode != armDisarmed && p.st.sample(arrived)
+	if run && p.skipped < q.Skip {
+		p.skipped++
+		run = false
+	} else if run {
+		p.skipped = 0
+	}
+	switch {
+	case !admit:
+		p.ci.drops.Add(1)
+		a := p.fail(p.seq, wsError{Error: "frame sent without credit", Code: "no_credit"})
+		a.batch = b
+		return p.finish(a)
+	case !run:
+		resp := wsResponse{Frame: p.seq, Skipped: true, fields: p.st.fields}
+		if p.st.echo && mode != armDisarmed {
+			resp.Detections, resp.Interpolated = p.tracker.Predict(arrived), true
+			if s.cfg.MotionAttributes {
+				addMotion(resp.Detections, p.tracker.Motion(), s.calibration.lookup(clientLabel(p.r), p.st.id))
+			}
+			if p.st.stable != nil {
+				resp.Detections = p.st.stable.Hold(resp.Detections, p.tracker.IDs())
+			}
+		}
+		s.frameMeta(&resp, p.t, data, opts.InputSize)
+		a := &answer{seq: p.seq, buf: p.buffer(), opts: opts, frame: data, arrived: arrived, captured: captured, dets: resp.Detections, shown: true, batch: b}
+		a.buf.Write(resp.appendJSON(a.buf.AvailableBuffer()))
+		return p.finish(a)
+	}
+	p.inflight++
+	go func(a *answer) {
+		p.infer(a)
+		p.results <- a
+	}(&answer{seq: p.seq, opts: opts, frame: data, arrived: arrived, captured: captured, stable: p.st.stable != nil, batch: b})
+	return nil
+}
+
+// infer charges the frame to the client's limits, runs it, and writes the
+// answer to a.buf. It runs on its own goroutine and must not touch the
+// pipeline's state.
+func (p *pipeline) infer(a *answer) {
+	s, ci := p.s, p.ci
+	release, err := s.reserveFrame(ci, a.frame)
+	if err != nil {
+		ci.drops.Add(1)
+		s.framesMemoryLimited.inc(clientLabel(p.r))
+		a.buf = p.fail(a.seq, memError(err)).buf
+		return
+	}
+	defer release()
+	if _, err := s.admitFrame(p.r); err != nil {
+		ci.drops.Add(1)
+		a.buf = p.fail(a.seq, limitError(err)).buf
+		return
+	}
+	a.recorded = true
+	free := s.sched.acquire(ci.priority)
+	start := time.Now()
+	done := s.load.begin()
+	detections, err := s.detector(p.t).Detect(a.frame, a.opts)
+	var dm *inference.DensityMap
+	if err == nil {
+		dm = s.density(p.t, p.st, a.frame, a.opts)
+	}
+	done()
+	free()
+	if err != nil {
+		ci.drops.Add(1)
+		slog.Warn("frame failed", "conn", ci.id, "remote", ci.remote, "err", err)
+		a.buf = p.fail(a.seq, detectError(err)).buf
+		return
+	}
+	s.calibration.locate(clientLabel(p.r), p.st.id, detections)
+	detections = s.cfg.Postprocess.Run(detections)
+	s.addCrops(p.r, p.st, a.frame, 1, a.opts.Mask, detections)
+	elapsed := time.Since(start)
+	ci.recordFrame(time.Now(), elapsed)
+	if s.settings().LogFrames {
+		slog.Debug("frame", "conn", ci.id, "bytes", len(a.frame), "detections", len(detections), "elapsed", elapsed)
+	}
+	a.dets, a.ok, a.shown = detections, true, true
+	resp := wsResponse{Frame: a.seq, Detections: detections, Crowd: p.st.estimateCrowd(dm, detections, s.cfg.CrowdClass), fields: p.st.fields}
+	s.frameMeta(&resp, p.t, a.frame, a.opts.InputSize)
+	a.buf = p.buffer()
+	if s.cfg.MotionAttributes || a.stable {
+		a.resp = &resp // the tracker has not seen it yet
+		return
+	}
+	a.buf.Write(resp.appendJSON(a.buf.AvailableBuffer()))
+}
+
+// fail is the answer to frame seq when it fails with we.
+func (p *pipeline) fail(seq uint64, we wsError) *answer {
+	we.Frame = seq
+	a := &answer{seq: seq, buf: p.buffer()}
+	_ = json.NewEncoder(a.buf).Encode(we)
+	return a
+}
+
+// finish files a frame's answer and releases every answer that is now next
+// in frame order, or releases it at once with ?order=any.
+func (p *pipeline) finish(a *answer) error {
+	if p.st.unordered {
+		return p.release(a)
+	}
+	p.pending[a.seq] = a
+	for {
+		a, ok := p.pending[p.next]
+		if !ok {
+			return nil
+		}
+		delete(p.pending, p.next)
+		p.next++
+		if err := p.release(a); err != nil {
+			return err
+		}
+	}
+}
+
+// release records a and queues it for the writer, handing back its credit.
+// Out of order, a result older than the tracker's newest is not fed to it,
+// so extrapolation never runs backwards.
+func (p *pipeline) release(a *answer) error {
+	var ids []uint64
+	if a.ok && a.arrived.After(p.tracked) {
+		p.tracker.Update(a.dets, a.arrived)
+		ids = p.tracker.IDs()
+		p.tracked = a.arrived
+		p.sv.save(&p.tracker)
+		if a.resp != nil && p.s.cfg.MotionAttributes {
+			addMotion(a.dets, p.tracker.Motion(), p.s.calibration.lookup(clientLabel(p.r), p.st.id))
+		}
+	}
+	if a.ok && a.stable && p.st.stable != nil {
+		a.dets, ids = p.st.stable.Filter(a.dets, ids)
+		a.resp.Detections = a.dets
+	}
+	if a.resp != nil {
+		a.buf.Write(a.resp.appendJSON(a.buf.AvailableBuffer()))
+	}
+	if a.recorded {
+		p.rec.add(a.opts, a.frame, a.buf.Bytes())
+	}
+	if a.shown {
+		f := video.Frame{Data: a.frame, Dets: a.dets, At: a.arrived, Captured: a.captured, Mask: a.opts.Mask}
+		if len(p.s.cfg.BlurClasses) > 0 {
+			// Without echo a skipped frame has no boxes; the tracker's
+			// still cover whoever is in it.
+			hide := a.dets
+			if !a.ok && hide == nil {
+				hide = p.tracker.Predict(a.arrived)
+			}
+			f.Blur = p.s.blurRegions(hide)
+		}
+		for _, v := range []*video.Recorder{p.vid, p.hls} {
+			if v != nil && !v.Add(f) {
+				p.s.videoDropped.inc(clientLabel(p.r))
+			}
+		}
+		p.ev.observe(f, a.ok)
+		p.ha.observe(f, a.ok)
+		p.wd.observe(f, a.ok)
+		if a.ok {
+			p.gal.observe(f, ids)
+			p.s.feeds.frame(clientLabel(p.r), streamName(p.ci, p.st), a.seq, f)
+		}
+	}
+	var err error
+	switch {
+	case p.sum != nil && a.shown:
+		p.sum.add(a, ids)
+		p.s.bufPool.Put(a.buf)
+		if a.batch != nil {
+			err = p.collect(a.batch, nil)
+		}
+	case a.batch != nil:
+		err = p.collect(a.batch, a.buf)
+	default:
+		err = p.enqueue(a.buf)
+	}
+	if err != nil {
+		return err
+	}
+	p.observeE2E(a)
+	return p.fl.answered(p, p.s.currentAdvice())
+}
@@ -0,0 +1,295 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ── 롱폴링 ───────────────────────────────────────────────────────────────────
+// A fallback for networks whose proxies block WebSockets:
+//
+//	POST   /poll/sessions                 open a stream; same query as /ws/stream
+//	POST   /poll/sessions/{id}/frames     one frame as the body, or a control
+//	                                      message with Content-Type: application/json
+//	GET    /poll/sessions/{id}/messages   what the socket would have received,
+//	                                      waiting up to ?wait= for the first one
+//	DELETE /poll/sessions/{id}            close it
+//
+// A session runs the same pipeline as a WebSocket, one queued message at a
+// time, so settings, limits, flow control and recording all apply. It ends
+// after POLL_IDLE_TIMEOUT without requests.
+
+const (
+	pollQueue       = 8   // frames and control messages waiting to be handled
+	pollOutbox      = 256 // answers kept for the client; the oldest go first
+	pollDefaultWait = 20 * time.Second
+	pollMaxWait     = 30 * time.Second
+)
+
+var errPollClosed = errors.New("poll session closed")
+
+type pollSession struct {
+	id    string
+	key   string // API key or JWT subject that opened it; "" without auth
+	ci    *connInfo
+	in    chan streamMsg
+	ready chan struct{} // signalled when messages are added to out
+	done  chan struct{} // closed when the session ends
+	idle  *time.Timer
+	spool *sessionSpool // nil unless a batch session with SPOOL_DIR
+
+	mu     sync.Mutex
+	out    [][]byte
+	closed bool
+}
+
+// WriteMessage makes a session the pipeline's messageWriter.
+func (ps *pollSession) WriteMessage(_ int, data []byte) error {
+	b := append([]byte(nil), data...)
+	ps.mu.Lock()
+	if ps.closed {
+		ps.mu.Unlock()
+		return errPollClosed
+	}
+	if len(ps.out) == pollOutbox {
+		ps.out = ps.out[1:]
+	}
+	ps.out = append(ps.out, b)
+	ps.mu.Unlock()
+	select {
+	case ps.ready <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (ps *pollSession) take() []json.RawMessage {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	msgs := make([]json.RawMessage, len(ps.out))
+	for i, b := range ps.out {
+		msgs[i] = b
+	}
+	ps.out = nil
+	return msgs
+}
+
+func (ps *pollSession) close(reason string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.closed {
+		return
+	}
+	ps.closed = true
+	ps.idle.Stop()
+	close(ps.done)
+	slog.Debug("poll session closed", "id", ps.ci.id, "reason", reason)
+}
+
+type pollRegistry struct {
+	mu       sync.Mutex
+	sessions map[string]*pollSession
+}
+
+func (p *pollRegistry) add(ps *pollSession) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.sessions == nil {
+		p.sessions = make(map[string]*pollSession)
+	}
+	p.sessions[ps.id] = ps
+}
+
+func (p *pollRegistry) remove(id string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.sessions, id)
+}
+
+func (p *pollRegistry) get(id string) *pollSession {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.sessions[id]
+}
+
+func newSessionID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// ── 롱폴링 핸들러 ────────────────────────────────────────────────────────────
+
+func (s *Server) pollOpen(w http.ResponseWriter, r *http.Request) {
+	st, err := newStreamState(r.URL.Query(), &s.cfg)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	fl, err := newFlowState(r.URL.Query(), s.cfg.FlowCredits)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	prio, err := s.priorityOf(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	t := tenantOf(r)
+	if s.tooManyConns(t) {
+		writeJSONError(w, http.StatusServiceUnavailable, "too many connections")
+		return
+	}
+
+	ps := &pollSession{
+		id:    newSessionID(),
+		key:   keyName(r),
+		in:    make(chan streamMsg, pollQueue),
+		ready: make(chan struct{}, 1),
+		done:  make(chan struct{}),
+	}
+	ps.ci = &connInfo{remote: s.clientIP(r), key: ps.key, model: s.modelName(t), transport: "poll", priority: prio, started: time.Now(), closeFn: ps.close}
+	if t != nil {
+		ps.ci.tenant = t.name
+	}
+	ps.idle = time.AfterFunc(s.cfg.PollIdleTimeout, func() { ps.close("idle timeout") })
+	if s.spool != nil && prio == prioBatch {
+		ps.spool = s.spool.open(ps.id, clientLabel(r), ps.in, ps.done)
+	}
+	s.conns.add(ps.ci)
+	s.polls.add(ps)
+	slog.Debug("poll session opened", "id", ps.ci.id, "remote", ps.ci.remote, "key", ps.key)
+	go s.runPoll(r, ps, st, fl)
+
+	writeJSON(w, http.StatusCreated, map[string]string{
+		"session":      ps.id,
+		"idle_timeout": s.cfg.PollIdleTimeout.String(),
+	})
+}
+
+// runPoll feeds a session's queue through its pipeline until it closes.
+func (s *Server) runPoll(r *http.Request, ps *pollSession, st *streamState, fl *flowState) {
+	defer s.conns.remove(ps.ci.id)
+	defer s.polls.remove(ps.id)
+	defer ps.close("stream ended")
+	s.newPipeline(r, ps.ci, st, fl, ps).run(ps.in, ps.done)
+}
+
+// pollSessionFor looks up the session in the path and marks it active. A
+// session opened with another key is reported as missing.
+func (s *Server) pollSessionFor(w http.ResponseWriter, r *http.Request) *pollSession {
+	ps := s.polls.get(r.PathValue("id"))
+	if ps == nil || ps.key != keyName(r) {
+		writeJSONError(w, http.StatusNotFound, "poll session not found")
+		return nil
+	}
+	ps.idle.Reset(s.cfg.PollIdleTimeout)
+	return ps
+}
+
+func (s *Server) pollFrame(w http.ResponseWriter, r *http.Request) {
+	ps := s.pollSessionFor(w, r)
+	if ps == nil {
+		return
+	}
+	limit := int64(maxUploadSize)
+	if s.mem.connLimit > 0 {
+		limit = min(limit, s.mem.connLimit)
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, "frame too large")
+		} else {
+			writeJSONError(w, http.StatusBadRequest, "read body failed")
+		}
+		return
+	}
+	m := streamMsg{data: data, control: strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")}
+	select {
+	case <-ps.done:
+		writeJSONError(w, http.StatusNotFound, "poll session not found")
+		return
+	default:
+	}
+	// A spooling session queues everything through its spool, which keeps
+	// the order; anything else is only queued while there is room.
+	queued := false
+	if ps.spool != nil {
+		queued = ps.spool.put(m, ps.in)
+	} else {
+		select {
+		case ps.in <- m:
+			queued = true
+		default:
+		}
+	}
+	if !queued {
+		ps.ci.drops.Add(1)
+		w.Header().Set("Retry-After", "1")
+		writeJSONError(w, http.StatusTooManyRequests, "too many frames queued")
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// pollMessages answers with every message queued for the client, waiting
+// up to ?wait= (default 20s) for the first. The wait is capped at half the
+// idle timeout so a waiting client never lets its session expire.
+func (s *Server) pollMessages(w http.ResponseWriter, r *http.Request) {
+	ps := s.pollSessionFor(w, r)
+	if ps == nil {
+		return
+	}
+	defer ps.idle.Reset(s.cfg.PollIdleTimeout)
+	wait := pollDefaultWait
+	if v := r.URL.Query().Get("wait"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			writeJSONError(w, http.StatusBadRequest, "wait: want a duration like 10s")
+			return
+		}
+		wait = d
+	}
+	wait = min(wait, pollMaxWait, s.cfg.PollIdleTimeout/2)
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		msgs := ps.take()
+		if len(msgs) > 0 {
+			writeJSON(w, http.StatusOK, map[string][]json.RawMessage{"messages": msgs})
+			return
+		}
+		select {
+		case <-ps.ready:
+		case <-timer.C:
+			writeJSON(w, http.StatusOK, map[string][]json.RawMessage{"messages": msgs})
+			return
+		case <-ps.done:
+			writeJSONError(w, http.StatusGone, "poll session closed")
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (s *Server) pollClose(w http.ResponseWriter, r *http.Request) {
+	ps := s.pollSessionFor(w, r)
+	if ps == nil {
+		return
+	}
+	ps.close("closed by client")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"yolo-server/internal/inference"
+	"yolo-server/internal/preprocess"
+	"yolo-server/internal/recording"
+)
+
+// ── 세션 녹화 ────────────────────────────────────────────────────────────────
+// With RECORD_DIR set, every /ws/stream connection is recorded to
+// <dir>/<start>-conn<id>.rec. In "full" mode each frame is written as it is
+// answered; in "ring" mode only the last RECORD_RING frames are kept in
+// memory and written when the connection closes, which bounds disk use
+// while still capturing what led up to a bad report. The ring counts
+// towards the connection's memory and is held to half of MEM_CONN_LIMIT,
+// dropping its oldest frames first.
+
+const (
+	recordFull = "full"
+	recordRing = "ring"
+)
+
+// sessionRecorder belongs to one connection's goroutine; no locking.
+type sessionRecorder struct {
+	path string
+	w    *recording.Writer // full mode
+	err  error             // first write error; recording stops after it
+
+	// ring mode: oldest first
+	ring      []*recording.Entry
+	ringMax   int
+	ringBytes int64
+	budget    int64 // 0 = only ringMax applies
+	mem       *memLedger
+	ci        *connInfo
+
+	fields []string // ?fields=, which the responses are trimmed to
+}
+
+func (s *Server) newSessionRecorder(ci *connInfo, fields detFields) *sessionRecorder {
+	if s.cfg.RecordDir == "" {
+		return nil
+	}
+	name := fmt.Sprintf("%s-conn%d.rec", ci.started.UTC().Format("20060102T150405Z"), ci.id)
+	rec := &sessionRecorder{path: filepath.Join(s.cfg.RecordDir, name), fields: fields.names()}
+	if s.cfg.RecordMode == recordRing {
+		rec.ring = make([]*recording.Entry, 0, s.cfg.RecordRing)
+		rec.ringMax, rec.budget = s.cfg.RecordRing, s.mem.connLimit/2
+		rec.mem, rec.ci = &s.mem, ci
+		return rec
+	}
+	if rec.w, rec.err = recording.Create(rec.path); rec.err != nil {
+		slog.Warn("recording disabled", "conn", ci.id, "err", rec.err)
+	}
+	return rec
+}
+
+// add records one answered frame with the options it was run with. Safe on
+// a nil recorder.
+func (r *sessionRecorder) add(opts inference.Options, frame, response []byte) {
+	if r == nil || r.err != nil {
+		return
+	}
+	e := &recording.Entry{
+		Time:     time.Now(),
+		Tile:     opts.Tile,
+		TTA:      opts.TTA,
+		ImgSz:    opts.InputSize,
+		Fields:   r.fields,
+		Response: append([]byte(nil), response...), // the caller reuses its buffer
+		Frame:    frame,
+	}
+	if opts.ConfMargin > 0 {
+		e.Conf, e.Margin = opts.ConfThreshold, opts.ConfMargin
+	}
+	if roi := opts.ROI; !roi.Empty() {
+		e.ROI = []int{roi.Min.X, roi.Min.Y, roi.Max.X, roi.Max.Y}
+	}
+	if len(opts.Mask) > 0 {
+		for _, z := range opts.Mask {
+			e.Mask = append(e.Mask, []int{z.Min.X, z.Min.Y, z.Max.X, z.Max.Y})
+		}
+		// A frame that cannot be masked is not kept; replaying it fails
+		// to decode, as it most likely did live.
+		masked, err := preprocess.Redact(frame, opts.Mask, nil)
+		if err != nil {
+			masked = nil
+		}
+		e.Frame = masked
+	}
+	if r.ring != nil {
+		r.push(e)
+		return
+	}
+	if r.err = r.w.Write(e); r.err != nil {
+		slog.Warn("recording stopped", "path", r.path, "err", r.err)
+	}
+}
+
+// close flushes the recording; in ring mode this is when the file is
+// written. Safe on a nil recorder.
+func (r *sessionRecorder) close() {
+	if r == nil {
+		return
+	}
+	if r.ring != nil {
+		r.flushRing()
+		r.mem.charge(r.ci, memRecording, -r.ringBytes)
+		return
+	}
+	if r.w != nil {
+		if err := r.w.Close(); err != nil && r.err == nil {
+			slog.Warn("recording close", "path", r.path, "err", err)
+		}
+	}
+}
+
+func entrySize(e *recording.Entry) int64 { return int64(len(e.Frame) + len(e.Response)) }
+
+// push appends e and drops the oldest entries beyond RECORD_RING or the
+// byte budget.
+func (r *sessionRecorder) push(e *recording.Entry) {
+	r.ring = append(r.ring, e)
+	r.ringBytes += entrySize(e)
+	r.mem.charge(r.ci, memRecording, entrySize(e))
+	drop := 0
+	for len(r.ring)-drop > r.ringMax || (r.budget > 0 && r.ringBytes > r.budget && len(r.ring)-drop > 1) {
+		n := entrySize(r.ring[drop])
+		r.ringBytes -= n
+		r.mem.charge(r.ci, memRecording, -n)
+		r.ring[drop] = nil
+		drop++
+	}
+	if drop > 0 {
+		// Shift down rather than reslice, so the backing array is reused.
+		r.ring = r.ring[:copy(r.ring, r.ring[drop:])]
+	}
+}
+
+func (r *sessionRecorder) flushRing() {
+	entries := r.ring
+	if len(entries) == 0 {
+		return
+	}
+	w, err := recording.Create(r.path)
+	if err == nil {
+		for _, e := range entries {
+			if err = w.Write(e); err != nil {
+				break
+			}
+		}
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		slog.Warn("recording write", "path", r.path, "err", err)
+	}
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// ── 설정 파일 핫 리로드 ──────────────────────────────────────────────────────
+// CONFIG_FILE names a JSON file layered over the environment for settings
+// that are safe to change while serving:
+//
+//	{"conf_threshold": 0.5, "nms_iou": 0.45, "max_connections": 100,
+//	 "rate_limit_fps": 10, "rate_limit_burst": 20, "frame_quota_monthly": 0,
+//	 "ip_allow": ["10.0.0.0/8"], "ip_deny": []}
+//
+// A key that is removed from the file falls back to its environment value.
+// The directory is watched rather than the file so that editors that
+// write-and-rename and Kubernetes ConfigMap symlink swaps are both seen.
+// Reloading replaces changes made through /admin/config and /admin/ip-filter.
+
+const reloadDebounce = 200 * time.Millisecond // editors emit several events per save
+
+type fileConfig struct {
+	settingsPatch
+	IPAllow []string `json:"ip_allow"` // nil = IP_ALLOW
+	IPDeny  []string `json:"ip_deny"`  // nil = IP_DENY
+}
+
+// readConfigFile parses path and resolves it against the environment config.
+func readConfigFile(path string, cfg Config) (liveSettings, *ipRules, []byte, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return liveSettings{}, nil, nil, err
+	}
+	var fc fileConfig
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&fc); err != nil {
+		return liveSettings{}, nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	ls, err := fc.apply(settingsFromConfig(cfg))
+	if err != nil {
+		return liveSettings{}, nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	rules := &ipRules{Allow: cfg.IPAllow, Deny: cfg.IPDeny}
+	if fc.IPAllow != nil {
+		if rules.Allow, err = parsePrefixes(fc.IPAllow); err != nil {
+			return liveSettings{}, nil, nil, fmt.Errorf("%s: ip_allow: %w", path, err)
+		}
+	}
+	if fc.IPDeny != nil {
+		if rules.Deny, err = parsePrefixes(fc.IPDeny); err != nil {
+			return liveSettings{}, nil, nil, fmt.Errorf("%s: ip_deny: %w", path, err)
+		}
+	}
+	return ls, rules, raw, nil
+}
+
+// loadConfigFile applies the file once; startup treats an error as fatal.
+func (s *Server) loadConfigFile() error {
+	ls, rules, raw, err := readConfigFile(s.cfg.ConfigFile, s.cfg)
+	if err != nil {
+		return err
+	}
+	s.setSettings(ls)
+	s.ipFilter.set(rules)
+	s.configRaw = raw
+	return nil
+}
+
+// watchConfigFile reapplies CONFIG_FILE whenever its contents change. A file
+// that fails to parse is logged and the running settings are kept.
+func (s *Server) watchConfigFile(ctx context.Context) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := w.Add(filepath.Dir(s.cfg.ConfigFile)); err != nil {
+		w.Close()
+		return err
+	}
+	last := s.configRaw
+	go func() {
+		defer w.Close()
+		var debounce <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				slog.Warn("config watch", "err", err)
+			case _, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				debounce = time.After(reloadDebounce)
+			case <-debounce:
+				debounce = nil
+				last = s.reloadConfigFile(last)
+			}
+		}
+	}()
+	return nil
+}
+
+func (s *Server) reloadConfigFile(last []byte) []byte {
+	ls, rules, raw, err := readConfigFile(s.cfg.ConfigFile, s.cfg)
+	if err != nil {
+		slog.Error("config reload failed; keeping current settings", "err", err)
+		return last
+	}
+	if bytes.Equal(raw, last) {
+		return last
+	}
+	oldRules := s.ipFilter.get()
+	oldSettings, _, _ := s.updateSettings(func(liveSettings) (liveSettings, error) { return ls, nil })
+	s.ipFilter.set(rules)
+
+	changes := settingsDiff(oldSettings, ls)
+	if oldRules == nil || !slices.Equal(oldRules.Allow, rules.Allow) {
+		changes = append(changes, slog.Any("ip_allow", rules.Allow))
+	}
+	if oldRules == nil || !slices.Equal(oldRules.Deny, rules.Deny) {
+		changes = append(changes, slog.Any("ip_deny", rules.Deny))
+	}
+	slog.Info("config reloaded", "file", s.cfg.ConfigFile, slog.Group("changed", changes...))
+	return raw
+}
+
+// settingsDiff lists the fields of b that differ from a, keyed by JSON name,
+// as "old → new" strings.
+func settingsDiff(a, b liveSettings) []any {
+	var out []any
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	t := va.Type()
+	for i := 0; i < t.NumField(); i++ {
+		x, y := va.Field(i).Interface(), vb.Field(i).Interface()
+		if x != y {
+			out = append(out, slog.String(t.Field(i).Tag.Get("json"), fmt.Sprintf("%v → %v", x, y)))
+		}
+	}
+	return out
+}
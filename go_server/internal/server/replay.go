@@ -0,0 +1,91 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"strings"
+
+	"yolo-server/internal/inference"
+	"yolo-server/internal/recording"
+)
+
+// ── 재생 ─────────────────────────────────────────────────────────────────────
+
+// Replay runs every frame of a session recording through det with the
+// stream settings recorded for it and the current confidence/NMS config,
+// and reports to out each frame whose response differs from the recorded
+// one. It returns the number of differing frames.
+func Replay(cfg Config, det inference.Detector, path string, out io.Writer) (int, error) {
+	r, err := recording.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	ls := settingsFromConfig(cfg)
+	var frames, changed int
+	for ; ; frames++ {
+		e, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			fmt.Fprintf(out, "recording truncated after %d frames\n", frames)
+			break
+		}
+		if err != nil {
+			return changed, err
+		}
+
+		st := &streamState{tiled: e.Tile, tta: e.TTA, imgsz: e.ImgSz, confMargin: e.Margin, confFloor: e.Conf}
+		if len(e.ROI) == 4 {
+			st.roi = image.Rect(e.ROI[0], e.ROI[1], e.ROI[2], e.ROI[3])
+		}
+		for _, z := range e.Mask {
+			if len(z) == 4 {
+				st.mask = append(st.mask, image.Rect(z[0], z[1], z[2], z[3]))
+			}
+		}
+		var got []byte
+		if dets, err := det.Detect(e.Frame, st.options(&ls, false)); err != nil {
+			got, _ = json.Marshal(detectError(err))
+		} else {
+			var fields detFields // all, unless the recording was trimmed
+			if len(e.Fields) > 0 {
+				fields, _ = parseDetFields(strings.Join(e.Fields, ","))
+			}
+			got = wsResponse{Detections: cfg.Postprocess.Run(dets), fields: fields}.appendJSON(nil)
+		}
+
+		want, err := replayOutcome(e.Response)
+		if err != nil {
+			return changed, fmt.Errorf("frame %d: %w", frames, err)
+		}
+		if got, _ = replayOutcome(got); !bytes.Equal(want, got) {
+			changed++
+			fmt.Fprintf(out, "frame %d (%s) differs\n  recorded: %s\n  replayed: %s\n",
+				frames, e.Time.Format("15:04:05.000"), want, got)
+		}
+	}
+	fmt.Fprintf(out, "%d frames replayed, %d differ\n", frames, changed)
+	return changed, nil
+}
+
+// replayOutcome keeps the part of a response that depends on the model:
+// the detections, or the error. Frame metadata such as the timestamp is
+// dropped.
+func replayOutcome(resp []byte) ([]byte, error) {
+	var o struct {
+		Detections json.RawMessage `json:"detections,omitempty"`
+		Error      string          `json:"error,omitempty"`
+		Code       string          `json:"code,omitempty"`
+	}
+	if err := json.Unmarshal(resp, &o); err != nil {
+		return nil, err
+	}
+	return json.Marshal(o)
+}
@@ -0,0 +1,253 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"yolo-server/internal/redis"
+	"yolo-server/internal/track"
+)
+
+// ── 재개 토큰 ────────────────────────────────────────────────────────────────
+// Mobile networks drop sockets constantly. With RESUME_WINDOW set, a stream
+// is sent {"resume": "<token>"} before anything else, and when it ends its
+// settings (as changed by control messages), sampling position, frame
+// counter and tracker are kept under that token for RESUME_WINDOW. A stream
+// opened with ?resume=<token> within the window, with the same credential,
+// takes them over instead of its query settings, continues the frame IDs,
+// and is told so with "resumed": true. Each token resumes once; the resumed
+// stream gets a new one. An unknown or expired token starts from scratch.
+// With REDIS_URL set the state is kept in Redis, so the reconnect may land
+// on any replica.
+//
+// A client often reconnects before the server has noticed that the old
+// socket is dead. If the token's stream still runs on this replica, it is
+// closed and its state taken over once it has stopped.
+
+const (
+	maxResumeToken = 64
+	resumeTakeover = 2 * time.Second // longest wait for the old stream to stop
+)
+
+// resumeState is what a token resumes.
+type resumeState struct {
+	Client string `json:"client"` // clientLabel of the stream
+
+	ROI       [4]int   `json:"roi"`
+	Mask      [][4]int `json:"mask,omitempty"`
+	Tile      bool     `json:"tile"`
+	TTA       bool     `json:"tta"`
+	ImgSz     int      `json:"imgsz"`
+	Every     int      `json:"every"`
+	FPS       float64  `json:"fps"`
+	Echo      bool     `json:"echo"`
+	Margin    float64  `json:"conf_margin,omitempty"`
+	Stable    string   `json:"stable,omitempty"`
+	Inflight  int      `json:"inflight"`
+	Unordered bool     `json:"unordered"`
+	Stream    string   `json:"stream"`
+	Video     bool     `json:"video"`
+	HLS       bool     `json:"hls"`
+	Seen      int      `json:"seen"`
+
+	Seq     uint64         `json:"seq"`
+	Tracker *track.Tracker `json:"tracker"`
+}
+
+type resumeStore struct {
+	window  time.Duration
+	rdb     *redis.Client // nil = in memory
+	results *counterVec   // resume attempts by result
+
+	mu   sync.Mutex
+	mem  map[string][]byte
+	live map[string]*liveStream // streams still running, by token
+}
+
+type liveStream struct {
+	client  string
+	closeFn func(reason string)
+	done    chan struct{} // closed once the state is kept
+}
+
+// takeover stops token's stream if it still runs here for client.
+func (rs *resumeStore) takeover(token, client string) {
+	rs.mu.Lock()
+	ls := rs.live[token]
+	rs.mu.Unlock()
+	if ls == nil || ls.client != client {
+		return
+	}
+	if ls.closeFn != nil {
+		ls.closeFn("resumed by another connection")
+	}
+	select {
+	case <-ls.done:
+	case <-time.After(resumeTakeover):
+	}
+}
+
+func (rs *resumeStore) put(token string, b []byte) {
+	if rs.rdb != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), streamLoadTimeout)
+		defer cancel()
+		if err := rs.rdb.Set(ctx, "yolo:resume:"+token, b, rs.window); err != nil {
+			slog.Warn("resume state save", "err", err)
+		}
+		return
+	}
+	rs.mu.Lock()
+	rs.mem[token] = b
+	rs.mu.Unlock()
+	time.AfterFunc(rs.window, func() {
+		rs.mu.Lock()
+		delete(rs.mem, token)
+		rs.mu.Unlock()
+	})
+}
+
+// take removes and returns token's state if it belongs to client. Another
+// client's token is left alone, so presenting it cannot discard the
+// owner's state.
+func (rs *resumeStore) take(token, client string) ([]byte, bool) {
+	if rs.rdb != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), streamLoadTimeout)
+		defer cancel()
+		key := "yolo:resume:" + token
+		b, err := rs.rdb.Get(ctx, key)
+		if err == nil {
+			if stateOwner(b) != client {
+				return nil, false
+			}
+			// Of two racing resumes only one gets the state back.
+			b, err = rs.rdb.GetDel(ctx, key)
+		}
+		if err != nil && !errors.Is(err, redis.ErrNil) {
+			slog.Warn("resume state load", "err", err)
+		}
+		return b, err == nil
+	}
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	b, ok := rs.mem[token]
+	if !ok || stateOwner(b) != client {
+		return nil, false
+	}
+	delete(rs.mem, token)
+	return b, true
+}
+
+// stateOwner returns the client a stored resumeState belongs to.
+func stateOwner(b []byte) string {
+	var owner struct {
+		Client string `json:"client"`
+	}
+	if json.Unmarshal(b, &owner) != nil {
+		return ""
+	}
+	return owner.Client
+}
+
+// resume takes over the state of ?resume=, if it is still kept, and sends
+// the stream its own token.
+func (p *pipeline) resume() error {
+	rs := p.s.resumes
+	if rs == nil || p.muxed {
+		return nil
+	}
+	resumed := false
+	if token := p.r.URL.Query().Get("resume"); token != "" && len(token) <= maxResumeToken {
+		rs.takeover(token, clientLabel(p.r))
+		resumed = p.restore(token)
+		outcome := "expired"
+		if resumed {
+			outcome = "resumed"
+		}
+		rs.results.inc(outcome)
+	}
+	p.token = newSessionID()
+	rs.mu.Lock()
+	rs.live[p.token] = &liveStream{client: clientLabel(p.r), closeFn: p.ci.closeFn, done: make(chan struct{})}
+	rs.mu.Unlock()
+	return p.WriteJSON(struct {
+		Resume  string `json:"resume"`
+		Resumed bool   `json:"resumed,omitempty"`
+	}{p.token, resumed})
+}
+
+func (p *pipeline) restore(token string) bool {
+	b, ok := p.s.resumes.take(token, clientLabel(p.r))
+	if !ok {
+		return false
+	}
+	var tr track.Tracker
+	state := resumeState{Tracker: &tr}
+	if err := json.Unmarshal(b, &state); err != nil {
+		return false
+	}
+	st := p.st
+	r := state.ROI
+	st.roi = image.Rect(r[0], r[1], r[2], r[3])
+	st.mask = nil
+	for _, z := range state.Mask {
+		st.mask = append(st.mask, image.Rect(z[0], z[1], z[2], z[3]))
+	}
+	st.tiled, st.tta, st.echo = state.Tile, state.TTA, state.Echo
+	if state.Margin >= 0 && state.Margin <= 1 {
+		st.confMargin = state.Margin
+	}
+	if sb, err := track.ParseStable(state.Stable); err == nil {
+		st.stable = sb // its history starts over
+	}
+	if state.ImgSz == 0 || slices.Contains(st.sizes, state.ImgSz) {
+		st.imgsz = state.ImgSz
+	}
+	st.every, st.fps, st.seen = max(state.Every, 1), state.FPS, state.Seen
+	st.inflight = min(max(state.Inflight, 1), maxInflight)
+	st.unordered, st.id = state.Unordered, state.Stream
+	st.video = state.Video && p.s.cfg.VideoDir != ""
+	st.hls = state.HLS && p.s.cfg.HLSDir != ""
+	p.tracker = tr
+	p.seq, p.next = state.Seq, state.Seq+1
+	return true
+}
+
+// suspend keeps the stream's state under its token for RESUME_WINDOW.
+func (p *pipeline) suspend() {
+	if p.token == "" {
+		return
+	}
+	rs := p.s.resumes
+	defer func() {
+		rs.mu.Lock()
+		close(rs.live[p.token].done)
+		delete(rs.live, p.token)
+		rs.mu.Unlock()
+	}()
+	st := p.st
+	state := resumeState{
+		Client: clientLabel(p.r),
+		ROI:    [4]int{st.roi.Min.X, st.roi.Min.Y, st.roi.Max.X, st.roi.Max.Y},
+		Tile:   st.tiled, TTA: st.tta, ImgSz: st.imgsz,
+		Every: st.every, FPS: st.fps, Echo: st.echo, Margin: st.confMargin,
+		Inflight: st.inflight, Unordered: st.unordered, Stream: st.id, Video: st.video, HLS: st.hls, Seen: st.seen,
+		Seq: p.seq, Tracker: &p.tracker,
+	}
+	for _, z := range st.mask {
+		state.Mask = append(state.Mask, [4]int{z.Min.X, z.Min.Y, z.Max.X, z.Max.Y})
+	}
+	if st.stable != nil {
+		state.Stable = st.stable.String()
+	}
+	b, err := json.Marshal(state)
+	if err != nil {
+		return
+	}
+	rs.put(p.token, b)
+}
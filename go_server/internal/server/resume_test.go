@@ -0,0 +1,130 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func newTestResumeStore(window time.Duration) *resumeStore {
+	return &resumeStore{window: window, mem: map[string][]byte{}, live: map[string]*liveStream{}}
+}
+
+func TestResumeTake(t *testing.T) {
+	rs := newTestResumeStore(time.Minute)
+	state := []byte(`{"client": "alice", "seq": 7}`)
+	rs.put("tok", state)
+
+	if _, ok := rs.take("tok", "mallory"); ok {
+		t.Error("another client took the state")
+	}
+	b, ok := rs.take("tok", "alice")
+	if !ok || string(b) != string(state) {
+		t.Errorf("owner's take = %s, %v; want the state", b, ok)
+	}
+	if _, ok := rs.take("tok", "alice"); ok {
+		t.Error("a token resumed twice")
+	}
+	if _, ok := rs.take("nope", "alice"); ok {
+		t.Error("an unknown token resumed")
+	}
+
+	rs = newTestResumeStore(10 * time.Millisecond)
+	rs.put("tok", state)
+	time.Sleep(50 * time.Millisecond)
+	if _, ok := rs.take("tok", "alice"); ok {
+		t.Error("a token resumed after RESUME_WINDOW")
+	}
+}
+
+func TestResumeTakeover(t *testing.T) {
+	rs := newTestResumeStore(time.Minute)
+	done := make(chan struct{})
+	var reason string
+	rs.live["tok"] = &liveStream{client: "alice", done: done, closeFn: func(r string) {
+		reason = r
+		close(done)
+	}}
+
+	rs.takeover("tok", "mallory")
+	if reason != "" {
+		t.Errorf("another client's takeover closed the stream: %q", reason)
+	}
+	rs.takeover("nope", "alice")
+	if reason != "" {
+		t.Errorf("an unknown token closed the stream: %q", reason)
+	}
+	rs.takeover("tok", "alice")
+	if reason == "" {
+		t.Error("the owner's takeover left the old stream running")
+	}
+	select {
+	case <-done:
+	default:
+		t.Error("takeover returned before the old stream stopped")
+	}
+}
+
+func TestStreamResume(t *testing.T) {
+	t.Setenv("RESUME_WINDOW", "1m")
+	srv := httptest.NewServer(newTestServer(t, ""))
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws/stream"
+
+	type message struct {
+		Resume  string           `json:"resume"`
+		Resumed bool             `json:"resumed"`
+		Frame   uint64           `json:"frame"`
+		Dets    *json.RawMessage `json:"detections"`
+	}
+	// open dials url and returns the stream's resume message and the
+	// answer to one frame.
+	open := func(url string) (first, answer message) {
+		t.Helper()
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+		if err := conn.ReadJSON(&first); err != nil {
+			t.Fatal(err)
+		}
+		if err := conn.WriteMessage(websocket.BinaryMessage, testPNG(t, 64, 48)); err != nil {
+			t.Fatal(err)
+		}
+		for answer.Dets == nil {
+			answer = message{}
+			if err := conn.ReadJSON(&answer); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return first, answer
+	}
+
+	first, answer := open(url)
+	if first.Resume == "" || first.Resumed {
+		t.Fatalf("first message = %+v, want a token", first)
+	}
+	if answer.Frame != 1 {
+		t.Errorf("frame = %d, want 1", answer.Frame)
+	}
+
+	// The old stream may still be running; resuming takes it over.
+	again, answer := open(url + "?resume=" + first.Resume)
+	if !again.Resumed || again.Resume == "" || again.Resume == first.Resume {
+		t.Errorf("resumed stream's first message = %+v, want resumed with a new token", again)
+	}
+	if answer.Frame != 2 {
+		t.Errorf("resumed frame = %d, want 2", answer.Frame)
+	}
+
+	third, _ := open(url + "?resume=" + first.Resume)
+	if third.Resumed {
+		t.Error("a token resumed twice")
+	}
+}
@@ -0,0 +1,215 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ── 보존 기간 ────────────────────────────────────────────────────────────────
+// RETAIN_AGE and RETAIN_BYTES bound what the server keeps on disk, per kind:
+//
+//	recordings  session recordings in RECORD_DIR
+//	videos      stream videos in VIDEO_DIR
+//	events      events, with their snapshots and clips in EVENT_CLIP_DIR
+//	gallery     search gallery crops in GALLERY_DIR
+//
+// Every RETAIN_INTERVAL a janitor removes what is older than the kind's
+// age, then the oldest until the rest fits in its bytes. Recording and video
+// files written to in the last minute are still open and left alone.
+// Removed items and their bytes are counted in yolo_retention_removed_total
+// and yolo_retention_reclaimed_bytes_total, and what is left in
+// yolo_retention_stored_bytes.
+
+var retainKinds = []string{"recordings", "videos", "events", "gallery"}
+
+// retainBusy is how recently a file was written to for the janitor to take
+// it as still open.
+const retainBusy = time.Minute
+
+// parseRetain parses kind=value pairs, checking that each kind is stored at
+// all under cfg.
+func parseRetain[T any](v string, cfg Config, parse func(string) (T, error)) (map[string]T, error) {
+	stored := map[string]bool{
+		"recordings": cfg.RecordDir != "",
+		"videos":     cfg.VideoDir != "",
+		"events":     len(cfg.EventClasses) > 0,
+		"gallery":    cfg.GalleryDir != "",
+	}
+	m := map[string]T{}
+	for _, pair := range strings.Split(v, ",") {
+		kind, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("want kind=value pairs, got %q", pair)
+		}
+		on, known := stored[kind]
+		switch {
+		case !known:
+			return nil, fmt.Errorf("unknown kind %q; want one of %s", kind, strings.Join(retainKinds, ", "))
+		case !on:
+			return nil, fmt.Errorf("%s: nothing is stored; set its directory or classes", kind)
+		}
+		t, err := parse(strings.TrimSpace(val))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", kind, err)
+		}
+		m[kind] = t
+	}
+	return m, nil
+}
+
+// parseRetainAge is a positive duration, which may also be whole days, "7d".
+func parseRetainAge(v string) (time.Duration, error) {
+	var d time.Duration
+	var err error
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		var n int
+		n, err = strconv.Atoi(days)
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(v)
+	}
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("want a positive duration such as 72h or 7d, got %q", v)
+	}
+	return d, nil
+}
+
+// pruned is what one sweep of a kind did.
+type pruned struct {
+	removed int
+	freed   int64 // bytes
+	kept    int64 // bytes
+}
+
+type janitor struct {
+	s         *Server
+	kinds     []string
+	removed   *counterVec // by kind
+	reclaimed *counterVec // bytes by kind
+
+	mu     sync.Mutex
+	stored map[string]int64 // bytes by kind, as of the last sweep
+}
+
+// newJanitor returns nil without RETAIN_AGE and RETAIN_BYTES.
+func newJanitor(s *Server) *janitor {
+	j := &janitor{s: s, stored: map[string]int64{}}
+	for _, k := range retainKinds {
+		_, age := s.cfg.RetainAge[k]
+		_, bytes := s.cfg.RetainBytes[k]
+		if age || bytes {
+			j.kinds = append(j.kinds, k)
+		}
+	}
+	if len(j.kinds) == 0 {
+		return nil
+	}
+	j.removed = s.metrics.newCounterVec("yolo_retention_removed_total",
+		"Stored items removed by retention, by kind.", "kind")
+	j.reclaimed = s.metrics.newCounterVec("yolo_retention_reclaimed_bytes_total",
+		"Bytes freed by retention, by kind.", "kind")
+	s.metrics.newGaugeFunc("yolo_retention_stored_bytes",
+		"Bytes kept under retention, by kind, as of the last sweep.", "kind", j.storedBytes)
+	return j
+}
+
+func (j *janitor) storedBytes() map[string]int64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	m := make(map[string]int64, len(j.stored))
+	for k, v := range j.stored {
+		m[k] = v
+	}
+	return m
+}
+
+// run sweeps at once and then every RETAIN_INTERVAL until ctx ends.
+func (j *janitor) run(ctx context.Context) {
+	t := time.NewTicker(j.s.cfg.RetainInterval)
+	defer t.Stop()
+	for {
+		j.sweep(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (j *janitor) sweep(now time.Time) {
+	s := j.s
+	for _, kind := range j.kinds {
+		var cutoff time.Time
+		if age, ok := s.cfg.RetainAge[kind]; ok {
+			cutoff = now.Add(-age)
+		}
+		quota := s.cfg.RetainBytes[kind] // 0 = none
+		var p pruned
+		switch kind {
+		case "recordings":
+			p = sweepDir(s.cfg.RecordDir, ".rec", cutoff, quota, now)
+		case "videos":
+			p = sweepDir(s.cfg.VideoDir, ".mp4", cutoff, quota, now)
+		case "events":
+			p = s.events.prune(cutoff, quota)
+		case "gallery":
+			p = s.gallery.prune(cutoff, quota)
+		}
+		j.removed.add(kind, uint64(p.removed))
+		j.reclaimed.add(kind, uint64(p.freed))
+		j.mu.Lock()
+		j.stored[kind] = p.kept
+		j.mu.Unlock()
+		if p.removed > 0 {
+			slog.Info("retention", "kind", kind, "removed", p.removed, "bytes", p.freed, "kept_bytes", p.kept)
+		}
+	}
+}
+
+// sweepDir removes the files of dir ending in suffix that were last written
+// before cutoff, then the oldest while the rest take more than quota bytes.
+// Files written since now minus retainBusy are left alone.
+func sweepDir(dir, suffix string, cutoff time.Time, quota int64, now time.Time) pruned {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		slog.Warn("retention", "dir", dir, "err", err)
+		return pruned{}
+	}
+	var files []os.FileInfo
+	var p pruned
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || !info.Mode().IsRegular() || !strings.HasSuffix(e.Name(), suffix) {
+			continue
+		}
+		files = append(files, info)
+		p.kept += info.Size()
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().Before(files[j].ModTime()) })
+	for _, f := range files {
+		old := f.ModTime().Before(cutoff)
+		if !old && (quota == 0 || p.kept <= quota) {
+			break
+		}
+		if now.Sub(f.ModTime()) < retainBusy {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, f.Name())); err != nil {
+			slog.Warn("retention", "file", f.Name(), "err", err)
+			continue
+		}
+		p.removed++
+		p.freed += f.Size()
+		p.kept -= f.Size()
+	}
+	return p
+}
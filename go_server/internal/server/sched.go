@@ -0,0 +1,128 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// ── 우선순위 ─────────────────────────────────────────────────────────────────
+// With INFER_WORKERS set, at most that many frames run at the model at once,
+// server-wide, and the others wait for a slot. A freed slot goes to the
+// longest-waiting realtime frame, and to a batch frame only when no realtime
+// frame waits, so backfill jobs soak up spare capacity without delaying
+// interactive streams. Batch frames can starve while realtime traffic
+// saturates the workers; that is the point.
+//
+// A request's class is ?priority=, else its API key's class from
+// KEY_PRIORITY="name:batch,...", else realtime. A key configured as batch
+// stays batch whatever it asks for.
+
+type priority int
+
+const (
+	prioRealtime priority = iota
+	prioBatch
+	priorities
+)
+
+var priorityNames = [priorities]string{"realtime", "batch"}
+
+func (p priority) String() string { return priorityNames[p] }
+
+func parsePriority(v string) (priority, error) {
+	for p, name := range priorityNames {
+		if v == name {
+			return priority(p), nil
+		}
+	}
+	return 0, fmt.Errorf("priority: want realtime or batch, got %q", v)
+}
+
+func parseKeyPriority(raw string) (map[string]priority, error) {
+	m := make(map[string]priority)
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, class, ok := strings.Cut(entry, ":")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("KEY_PRIORITY: want name:class, got %q", entry)
+		}
+		p, err := parsePriority(class)
+		if err != nil {
+			return nil, fmt.Errorf("KEY_PRIORITY: %w", err)
+		}
+		m[name] = p
+	}
+	return m, nil
+}
+
+// priorityOf is r's class; a ?priority= above its key's class is refused.
+func (s *Server) priorityOf(r *http.Request) (priority, error) {
+	p := s.cfg.KeyPriority[keyName(r)]
+	if v := r.URL.Query().Get("priority"); v != "" {
+		asked, err := parsePriority(v)
+		if err != nil {
+			return 0, err
+		}
+		if asked < p {
+			return 0, fmt.Errorf("priority: key is limited to %s", p)
+		}
+		p = asked
+	}
+	return p, nil
+}
+
+type scheduler struct {
+	mu      sync.Mutex
+	slots   int // INFER_WORKERS; 0 = unlimited
+	busy    int
+	waiting [priorities][]chan struct{} // oldest first
+}
+
+// acquire waits for a worker slot for a frame of class p. The returned func
+// gives the slot back.
+func (sc *scheduler) acquire(p priority) func() {
+	if sc.slots == 0 {
+		return func() {}
+	}
+	sc.mu.Lock()
+	if sc.busy < sc.slots {
+		sc.busy++
+		sc.mu.Unlock()
+		return sc.release
+	}
+	ready := make(chan struct{})
+	sc.waiting[p] = append(sc.waiting[p], ready)
+	sc.mu.Unlock()
+	<-ready // release handed its slot over; busy is unchanged
+	return sc.release
+}
+
+func (sc *scheduler) release() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	for p, q := range sc.waiting {
+		if len(q) > 0 {
+			close(q[0])
+			q[0] = nil
+			sc.waiting[p] = q[1:]
+			return
+		}
+	}
+	sc.busy--
+}
+
+// queued is the number of frames waiting per class.
+func (sc *scheduler) queued() map[string]int64 {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	m := make(map[string]int64, priorities)
+	for p, q := range sc.waiting {
+		m[priorityNames[p]] = int64(len(q))
+	}
+	return m
+}
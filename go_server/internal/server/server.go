@@ -0,0 +1,714 @@
+// Package server is the HTTP/WebSocket front end: streaming and REST
+// detection, auth, limits, admin API, probes and metrics.
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"yolo-server/internal/inference"
+	"yolo-server/internal/postprocess"
+	"yolo-server/internal/preprocess"
+	"yolo-server/internal/redis"
+)
+
+const maxUploadSize = 32 << 20 // REST /detect body limit
+
+// ── 타입 ────────────────────────────────────────────────────────────────────
+
+// Stream answers and errors carry the ID of the frame they belong to: the
+// frame's 1-based position among the binary messages of its stream. Errors
+// that do not belong to a frame (a bad control message) have none, and
+// every error has a Code.
+
+type wsResponse struct {
+	Frame        uint64                  `json:"frame,omitempty"` // 0 outside streams
+	Detections   []postprocess.Detection `json:"detections"`
+	Skipped      bool                    `json:"skipped,omitempty"`      // frame was not inferred
+	Interpolated bool                    `json:"interpolated,omitempty"` // Detections are the previous frame's
+	Crowd        *crowdEstimate          `json:"crowd,omitempty"`        // ?crowd=1 (crowd.go)
+	fields       detFields               // ?fields=, keys written per detection (encode.go)
+
+	// Frame metadata, so clients need not know the image size to scale boxes.
+	Width        int       `json:"width,omitempty"` // source frame after EXIF orientation; 0 when unknown
+	Height       int       `json:"height,omitempty"`
+	ImgSz        int       `json:"imgsz,omitempty"` // model input edge the frame ran (or would have run) at
+	Model        string    `json:"model,omitempty"`
+	ModelVersion string    `json:"model_version,omitempty"` // first 12 hex digits of the model's SHA256
+	Time         time.Time `json:"-"`                       // encoded as "ts", Unix milliseconds
+}
+type wsError struct {
+	Frame uint64 `json:"frame,omitempty"`
+	Error string `json:"error"`
+	Code  string `json:"code,omitempty"` // machine-readable, e.g. "rate_limited"
+}
+
+// detectError types a Detector failure.
+func detectError(err error) wsError {
+	code := "inference_error"
+	switch {
+	case errors.Is(err, preprocess.ErrDecode):
+		code = "decode_error"
+	case errors.Is(err, inference.ErrHung):
+		code = "hung"
+	case errors.Is(err, inference.ErrNoWorkers):
+		code = "no_workers"
+	}
+	return wsError{Error: err.Error(), Code: code}
+}
+
+// ── Server ───────────────────────────────────────────────────────────────────
+// Server holds the shared request state around a Detector.
+// Methods are the HTTP/WS handlers, so the mux wires directly to methods.
+
+type Server struct {
+	cfg         Config
+	det         inference.Detector
+	upgrader    websocket.Upgrader
+	bufPool     sync.Pool    // *bytes.Buffer — stream answers and notices
+	jwt         *jwtVerifier // nil when JWT auth is off
+	limiter     *limiter
+	ipFilter    ipFilter
+	conns       connRegistry
+	tenants     map[string]*tenant // by name
+	tenantKeys  map[string]*tenant // by API key name
+	polls       pollRegistry
+	live        atomic.Pointer[liveSettings]
+	liveMu      sync.Mutex  // serializes settings updates; reads use live
+	started     atomic.Bool // warmup done
+	draining    atomic.Bool // shutting down; readiness fails
+	versionInfo VersionInfo
+	model       inference.ModelInfo
+	configRaw   []byte    // last applied CONFIG_FILE contents
+	adapt       *adaptive // nil when adaptive quality is off
+	load        loadStats
+	sched       scheduler
+	mem         memLedger
+	advice      atomic.Pointer[advice] // latest backpressure advice; nil until the first sample
+	gpu         *gpuMonitor            // nil unless ORT runs on CUDA
+	shared      *streamStore           // nil without REDIS_URL
+	resumes     *resumeStore           // nil when RESUME_WINDOW is 0
+	hls         *hlsRegistry           // nil without HLS_DIR
+	events      *eventLog              // nil without EVENT_CLASSES
+	notifier    *notifier              // nil without EVENT_NOTIFY
+	ha          *homeAssistant         // nil without MQTT_URL
+	gallery     *gallery               // nil without GALLERY_DIR
+	janitor     *janitor               // nil without RETAIN_AGE or RETAIN_BYTES
+	spool       *spool                 // nil without SPOOL_DIR
+	world       *world
+	feeds       *feeds
+	calibration *calibrationStore
+	crops       *cropStore
+	arming      *armingStore
+
+	metrics             metricSet
+	framesTotal         *counterVec
+	framesRateLimited   *counterVec
+	framesQuotaExceeded *counterVec
+	framesMemoryLimited *counterVec
+	e2eFrames           *counterVec // stamped frames answered (e2e.go)
+	e2eWithinSLO        *counterVec
+	videoDropped        *counterVec // nil without VIDEO_DIR and HLS_DIR
+}
+
+// New builds a Server around det and applies CONFIG_FILE, if set.
+func New(cfg Config, det inference.Detector, version VersionInfo, model inference.ModelInfo) (*Server, error) {
+	s := &Server{
+		cfg:         cfg,
+		det:         det,
+		versionInfo: version,
+		model:       model,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:    1 << 20,
+			WriteBufferSize:   1 << 20,
+			CheckOrigin:       cfg.Origins.checkOrigin,
+			EnableCompression: cfg.WSCompression,
+		},
+	}
+	s.bufPool.New = func() any { return new(bytes.Buffer) }
+	if cfg.JWTJWKSURL != "" {
+		s.jwt = newJWTVerifier(cfg.JWTJWKSURL, cfg.JWTIssuer, cfg.JWTAudience)
+	}
+	s.ipFilter.set(&ipRules{Allow: cfg.IPAllow, Deny: cfg.IPDeny})
+	s.limiter = newLimiter(cfg.RateLimitFPS, cfg.RateLimitBurst, cfg.FrameQuota)
+	s.initTenants()
+	s.setSettings(settingsFromConfig(cfg))
+	s.adapt = newAdaptive(cfg)
+	s.mem.limit, s.mem.connLimit = cfg.MemLimit, cfg.MemConnLimit
+	s.sched.slots = cfg.InferWorkers
+	s.framesTotal = s.metrics.newCounterVec("yolo_frames_total",
+		"Frames accepted for inference.", "client")
+	s.framesRateLimited = s.metrics.newCounterVec("yolo_frames_rate_limited_total",
+		"Frames rejected by the per-client FPS limit.", "client")
+	s.framesQuotaExceeded = s.metrics.newCounterVec("yolo_frames_quota_exceeded_total",
+		"Frames rejected by the monthly frame quota.", "client")
+	s.framesMemoryLimited = s.metrics.newCounterVec("yolo_frames_memory_limited_total",
+		"Frames refused by MEM_CONN_LIMIT or MEM_LIMIT.", "client")
+	s.e2eFrames = s.metrics.newCounterVec("yolo_e2e_frames_total",
+		"Inferred frames with a capture stamp.", "client")
+	s.e2eWithinSLO = s.metrics.newCounterVec("yolo_e2e_frames_within_slo_total",
+		"Stamped frames answered within LATENCY_SLO of capture.", "client")
+	s.metrics.newGaugeFunc("yolo_memory_bytes",
+		"Bytes held for frames, decodes, buffers and recordings.", "kind",
+		func() map[string]int64 { return s.mem.stats().ByKind })
+	s.metrics.newGaugeFunc("yolo_inference_waiting",
+		"Frames waiting for an INFER_WORKERS slot.", "priority", s.sched.queued)
+	if h, ok := det.(interface{ Hangs() int64 }); ok {
+		s.metrics.newCounterFunc("yolo_inference_hung_total",
+			"Model runs abandoned by the watchdog.", "backend",
+			func() map[string]int64 { return map[string]int64{cfg.Backend: h.Hangs()} })
+	}
+	if d, ok := det.(workerPool); ok {
+		s.metrics.newGaugeFunc("yolo_worker_up",
+			"Whether each inference worker passed its last health check.", "worker",
+			func() map[string]int64 {
+				m := make(map[string]int64)
+				for _, w := range d.Workers() {
+					m[w.URL] = 0
+					if w.Up {
+						m[w.URL] = 1
+					}
+				}
+				return m
+			})
+		s.metrics.newGaugeFunc("yolo_worker_in_flight",
+			"Frames dispatched to each inference worker and not yet answered.", "worker",
+			func() map[string]int64 {
+				m := make(map[string]int64)
+				for _, w := range d.Workers() {
+					m[w.URL] = w.InFlight
+				}
+				return m
+			})
+	}
+	if cfg.Backend == "onnxruntime" && cfg.ORTProvider == "cuda" {
+		s.gpu = newGPUMonitor(cfg.ORTDeviceID)
+		s.metrics.newGaugeFunc("yolo_gpu_memory_bytes",
+			"GPU memory in use and in total, as reported by nvidia-smi.", "kind",
+			func() map[string]int64 {
+				st := s.gpu.current()
+				return map[string]int64{"used": st.MemUsed, "total": st.MemTotal}
+			})
+		s.metrics.newGaugeFunc("yolo_gpu_up",
+			"1 while the CUDA device answers, 0 once it is lost.", "device",
+			func() map[string]int64 {
+				up := int64(1)
+				if s.gpu.lost() {
+					up = 0
+				}
+				return map[string]int64{strconv.Itoa(cfg.ORTDeviceID): up}
+			})
+	}
+
+	if cfg.RedisURL != "" {
+		rdb, err := redis.New(cfg.RedisURL)
+		if err != nil {
+			return nil, fmt.Errorf("REDIS_URL: %w", err)
+		}
+		s.shared = &streamStore{rdb: rdb, ttl: cfg.StreamStateTTL,
+			errors: s.metrics.newCounterVec("yolo_stream_state_errors_total",
+				"Failed reads and writes of shared stream state.", "op")}
+		ctx, cancel := context.WithTimeout(context.Background(), streamLoadTimeout)
+		if err := rdb.Ping(ctx); err != nil {
+			slog.Warn("redis unreachable; streams start without shared state until it is back", "err", err)
+		}
+		cancel()
+	}
+	if cfg.ResumeWindow > 0 {
+		s.resumes = &resumeStore{window: cfg.ResumeWindow, mem: make(map[string][]byte), live: make(map[string]*liveStream),
+			results: s.metrics.newCounterVec("yolo_stream_resumes_total",
+				"Streams opened with ?resume=, by whether the token was still valid.", "result")}
+		if s.shared != nil {
+			s.resumes.rdb = s.shared.rdb
+		}
+	}
+
+	if cfg.ConfigFile != "" {
+		if err := s.loadConfigFile(); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.RecordDir != "" {
+		if err := os.MkdirAll(cfg.RecordDir, 0o755); err != nil {
+			return nil, fmt.Errorf("RECORD_DIR: %w", err)
+		}
+	}
+	if cfg.VideoDir != "" {
+		if err := os.MkdirAll(cfg.VideoDir, 0o755); err != nil {
+			return nil, fmt.Errorf("VIDEO_DIR: %w", err)
+		}
+	}
+	if cfg.HLSDir != "" {
+		// Playlists do not outlive the process; whatever is left is stale.
+		if err := os.RemoveAll(cfg.HLSDir); err != nil {
+			return nil, fmt.Errorf("HLS_DIR: %w", err)
+		}
+		if err := os.MkdirAll(cfg.HLSDir, 0o755); err != nil {
+			return nil, fmt.Errorf("HLS_DIR: %w", err)
+		}
+		s.hls = &hlsRegistry{m: map[string]*hlsStream{}}
+	}
+	if len(cfg.EventClasses) > 0 {
+		if cfg.EventClipDir != "" {
+			if err := os.MkdirAll(cfg.EventClipDir, 0o755); err != nil {
+				return nil, fmt.Errorf("EVENT_CLIP_DIR: %w", err)
+			}
+		}
+		s.events = newEventLog(cfg, &s.metrics)
+	}
+	if len(cfg.EventNotify) > 0 {
+		n, err := newNotifier(cfg, &s.metrics)
+		if err != nil {
+			return nil, err
+		}
+		s.notifier = n
+	}
+	s.arming = &armingStore{def: cfg.ArmDefault, classes: cfg.ArmClasses, streams: map[string]*arming{}}
+	if cfg.MQTTURL != "" {
+		ha, err := newHomeAssistant(cfg, haModel(version), s.arming)
+		if err != nil {
+			return nil, fmt.Errorf("MQTT_URL: %w", err)
+		}
+		s.ha = ha
+		s.arming.changed = ha.armingChanged
+	}
+	s.calibration = newCalibrationStore(cfg)
+	s.crops = newCropStore(cfg.CropCache)
+	if cfg.GalleryDir != "" {
+		g, err := newGallery(cfg, det, &s.metrics)
+		if err != nil {
+			return nil, fmt.Errorf("GALLERY_DIR: %w", err)
+		}
+		s.gallery = g
+	}
+	s.world = newWorld(cfg)
+	s.feeds = newFeeds()
+	s.janitor = newJanitor(s)
+	if cfg.SpoolDir != "" {
+		sp, err := newSpool(cfg, &s.metrics)
+		if err != nil {
+			return nil, fmt.Errorf("SPOOL_DIR: %w", err)
+		}
+		s.spool = sp
+	}
+	if cfg.VideoDir != "" || cfg.HLSDir != "" {
+		s.videoDropped = s.metrics.newCounterVec("yolo_video_frames_dropped_total",
+			"Frames left out of stream videos and HLS because the encoder was behind.", "client")
+	}
+	if s.jwt != nil {
+		if err := s.jwt.refresh(context.Background()); err != nil {
+			slog.Warn("jwks prefetch failed; will retry on demand", "err", err)
+		}
+	}
+	return s, nil
+}
+
+// Handler returns the full route table behind the IP filter and CORS.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.readyz)
+	mux.HandleFunc("GET /livez", s.livez)
+	mux.HandleFunc("GET /readyz", s.readyz)
+	mux.HandleFunc("GET /startupz", s.startupz)
+	mux.HandleFunc("GET /version", s.version)
+	mux.HandleFunc("GET /model/info", s.modelInfo)
+	if s.cfg.AdminToken != "" {
+		// Labels name API keys and tenants.
+		mux.Handle("/metrics", s.requireAdmin(s.metrics.ServeHTTP))
+	} else {
+		mux.Handle("/metrics", &s.metrics)
+	}
+	mux.Handle("/ws/stream", s.requireAuth(http.HandlerFunc(s.wsStream)))
+	mux.Handle("/detect", s.requireAuth(http.HandlerFunc(s.detectUpload)))
+	mux.Handle("POST /poll/sessions", s.requireAuth(http.HandlerFunc(s.pollOpen)))
+	mux.Handle("POST /poll/sessions/{id}/frames", s.requireAuth(http.HandlerFunc(s.pollFrame)))
+	mux.Handle("GET /poll/sessions/{id}/messages", s.requireAuth(http.HandlerFunc(s.pollMessages)))
+	mux.Handle("DELETE /poll/sessions/{id}", s.requireAuth(http.HandlerFunc(s.pollClose)))
+	mux.Handle("GET /hls/{name}/{file}", s.requireAuth(http.HandlerFunc(s.hlsFile)))
+	mux.Handle("GET /streams/{id}/arming", s.requireAuth(http.HandlerFunc(s.getArming)))
+	mux.Handle("PUT /streams/{id}/arming", s.requireAuth(http.HandlerFunc(s.putArming)))
+	mux.Handle("POST /streams/{id}/arming/set", s.requireAuth(http.HandlerFunc(s.setArming)))
+	mux.Handle("GET /streams/{id}/events", s.requireAuth(http.HandlerFunc(s.streamEvents)))
+	mux.Handle("GET /streams/{id}/calibration", s.requireAuth(http.HandlerFunc(s.getCalibration)))
+	mux.Handle("PUT /streams/{id}/calibration", s.requireAuth(http.HandlerFunc(s.putCalibration)))
+	mux.Handle("DELETE /streams/{id}/calibration", s.requireAuth(http.HandlerFunc(s.deleteCalibration)))
+	mux.Handle("GET /crops/{id}", s.requireAuth(http.HandlerFunc(s.getCrop)))
+	mux.Handle("POST /search", s.requireAuth(http.HandlerFunc(s.searchGallery)))
+	mux.Handle("GET /search", s.requireAuth(http.HandlerFunc(s.searchGallery)))
+	mux.Handle("GET /gallery/{id}", s.requireAuth(http.HandlerFunc(s.getGalleryCrop)))
+	mux.Handle("GET /world", s.requireAuth(http.HandlerFunc(s.getWorld)))
+	mux.Handle("GET /ws/world", s.requireAuth(http.HandlerFunc(s.wsWorld)))
+	mux.Handle("GET /events", s.requireAuth(ownEvents(s.listEvents)))
+	mux.Handle("GET /events/{id}", s.requireAuth(ownEvents(s.getEvent)))
+	mux.Handle("POST /events/{id}/ack", s.requireAuth(ownEvents(s.ackEvent)))
+	mux.Handle("GET /events/{id}/snapshot", s.requireAuth(ownEvents(s.eventSnapshot)))
+	mux.Handle("GET /events/{id}/clip", s.requireAuth(ownEvents(s.eventClip)))
+	s.registerAdmin(mux)
+	return s.filterIPs(s.cfg.Origins.cors().Handler(mux))
+}
+
+// Run serves until ctx is cancelled, then drains and shuts down.
+func (s *Server) Run(ctx context.Context) error {
+	cfg := s.cfg
+	tlsConfig, redirect, err := cfg.tlsSetup()
+	if err != nil {
+		return err
+	}
+	handler := s.Handler()
+	specs := cfg.listeners()
+	servers := make([]*http.Server, len(specs))
+	listeners := make([]net.Listener, len(specs))
+	anyTLS := false
+	for i := range specs {
+		l := &specs[i]
+		if listeners[i], err = l.listen(); err != nil {
+			for _, ln := range listeners[:i] {
+				ln.Close()
+			}
+			return fmt.Errorf("listen %s: %w", l, err)
+		}
+		servers[i] = &http.Server{Handler: handler, BaseContext: l.baseContext}
+		switch {
+		case l.tls:
+			servers[i].TLSConfig = tlsConfig // HTTP/2 is negotiated by ALPN
+			anyTLS = true
+		case cfg.H2C:
+			servers[i].Handler = h2c.NewHandler(handler, &http2.Server{})
+		}
+	}
+	var redirectSrv *http.Server
+	if anyTLS && redirect != nil && cfg.HTTPRedirectAddr != "" {
+		redirectSrv = &http.Server{Addr: cfg.HTTPRedirectAddr, Handler: redirect}
+		go func() {
+			slog.Info("https redirect started", "addr", cfg.HTTPRedirectAddr)
+			if err := redirectSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				slog.Error("https redirect error", "err", err)
+			}
+		}()
+	}
+
+	if cfg.ConfigFile != "" {
+		if err := s.watchConfigFile(ctx); err != nil {
+			slog.Warn("config watch disabled", "file", cfg.ConfigFile, "err", err)
+		}
+	}
+	go func() {
+		<-ctx.Done()
+		// Fail readiness first so the load balancer stops routing here
+		// before the listeners go away.
+		s.draining.Store(true)
+		if cfg.DrainDelay > 0 {
+			slog.Info("draining", "delay", cfg.DrainDelay)
+			time.Sleep(cfg.DrainDelay)
+		}
+		if redirectSrv != nil {
+			_ = redirectSrv.Shutdown(context.Background())
+		}
+		for _, srv := range servers {
+			_ = srv.Shutdown(context.Background())
+		}
+	}()
+
+	go s.monitorLoad(ctx)
+	if s.janitor != nil {
+		go s.janitor.run(ctx)
+	}
+	if s.gpu != nil {
+		go s.gpu.run(ctx)
+	}
+	if s.cfg.ModelIdleUnload > 0 {
+		go s.unloadIdleModels(ctx)
+	}
+	go s.warmup()
+	defer s.closeTenantModels()
+	defer s.ha.close() // after the listeners, so the server goes offline last
+	errc := make(chan error, len(servers))
+	for i, srv := range servers {
+		slog.Info("server started", "addr", specs[i].String(), "tls", specs[i].tls, "auth", !specs[i].noAuth)
+		go func(srv *http.Server, ln net.Listener) {
+			if srv.TLSConfig != nil {
+				errc <- srv.ServeTLS(ln, "", "") // certificates come from TLSConfig
+			} else {
+				errc <- srv.Serve(ln)
+			}
+		}(srv, listeners[i])
+	}
+	// One listener failing stops the server; Shutdown ends the others.
+	for range servers {
+		if err := <-errc; err != nil && err != http.ErrServerClosed {
+			return err
+		}
+	}
+	return nil
+}
+
+// ── 핸들러 ───────────────────────────────────────────────────────────────────
+
+func (s *Server) wsStream(w http.ResponseWriter, r *http.Request) {
+	st, err := newStreamState(r.URL.Query(), &s.cfg)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	fl, err := newFlowState(r.URL.Query(), s.cfg.FlowCredits)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	prio, err := s.priorityOf(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	mux := false
+	if v := r.URL.Query().Get("mux"); v != "" {
+		if mux, err = strconv.ParseBool(v); err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("mux: want a boolean, got %q", v))
+			return
+		}
+		if mux && st.id != "" {
+			writeJSONError(w, http.StatusBadRequest, "mux: streams are named by their messages, not ?stream=")
+			return
+		}
+	}
+	t := tenantOf(r)
+	if s.tooManyConns(t) {
+		writeJSONError(w, http.StatusServiceUnavailable, "too many connections")
+		return
+	}
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.Error("ws upgrade", "err", err)
+		return
+	}
+	defer conn.Close()
+	if s.mem.connLimit > 0 {
+		conn.SetReadLimit(s.mem.connLimit) // a larger frame closes the connection
+	}
+
+	ci := &connInfo{remote: s.clientIP(r), key: keyName(r), model: s.modelName(t), transport: "ws", priority: prio, started: time.Now()}
+	if t != nil {
+		ci.tenant = t.name
+	}
+	if mux {
+		s.setWSCompression(conn, r)
+		m := &muxConn{s: s, r: r, conn: conn, tmpl: ci, streams: map[string]*muxStream{}}
+		m.serve()
+		return
+	}
+	ci.closeFn = func(reason string) {
+		msg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason)
+		_ = conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+		_ = conn.Close() // the blocked ReadMessage below returns
+	}
+	s.conns.add(ci)
+	defer s.conns.remove(ci.id)
+	slog.Debug("ws connected", "id", ci.id, "remote", ci.remote, "key", ci.key)
+
+	s.setWSCompression(conn, r)
+
+	// The reader ends when the socket does: the client left, or the
+	// deferred Close above once the pipeline has stopped.
+	in := make(chan streamMsg, streamReadQueue)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		defer close(in)
+		for {
+			msgType, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			select {
+			case in <- streamMsg{data: data, control: msgType == websocket.TextMessage}:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	s.newPipeline(r, ci, st, fl, conn).run(in, stop)
+}
+
+// setWSCompression applies WS_COMPRESSION and ?compress= to conn.
+// Compression only takes effect if the client negotiated the extension.
+func (s *Server) setWSCompression(conn *websocket.Conn, r *http.Request) {
+	if s.cfg.WSCompression {
+		if r.URL.Query().Get("compress") == "0" {
+			conn.EnableWriteCompression(false)
+		} else if err := conn.SetCompressionLevel(s.cfg.WSCompressionLevel); err != nil {
+			slog.Warn("ws compression level", "err", err)
+		}
+	}
+}
+
+// detectUpload is the REST counterpart of wsStream for single images:
+// POST the encoded image as the request body, get one wsResponse back.
+func (s *Server) detectUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	st, err := newStreamState(r.URL.Query(), &s.cfg)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	prio, err := s.priorityOf(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxUploadSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, "image too large")
+		} else {
+			writeJSONError(w, http.StatusBadRequest, "read body failed")
+		}
+		return
+	}
+
+	// An upload is accounted like a one-frame connection, so MEM_CONN_LIMIT
+	// caps it as well.
+	release, err := s.reserveFrame(&connInfo{}, data)
+	if err != nil {
+		s.framesMemoryLimited.inc(clientLabel(r))
+		code := http.StatusServiceUnavailable
+		if errors.Is(err, errConnMemory) {
+			code = http.StatusRequestEntityTooLarge
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(memError(err))
+		return
+	}
+	defer release()
+
+	if retryAfter, err := s.admitFrame(r); err != nil {
+		if retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_ = json.NewEncoder(w).Encode(limitError(err))
+		return
+	}
+
+	t := tenantOf(r)
+	// Workers of BACKEND=workers pass ?exif=0 for stream frames.
+	opts := st.options(s.settingsFor(t), r.URL.Query().Get("exif") != "0")
+	free := s.sched.acquire(prio)
+	done := s.load.begin()
+	detections, err := s.detector(t).Detect(data, opts)
+	var dm *inference.DensityMap
+	if err == nil {
+		dm = s.density(t, st, data, opts)
+	}
+	done()
+	free()
+	if errors.Is(err, preprocess.ErrDecode) {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errors.Is(err, inference.ErrHung) || errors.Is(err, inference.ErrNoWorkers) {
+		writeJSONError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.calibration.locate(clientLabel(r), st.id, detections)
+	detections = s.cfg.Postprocess.Run(detections)
+	orientation := 1
+	if opts.Upright {
+		orientation = preprocess.ExifOrientation(data)
+	}
+	s.addCrops(r, st, data, orientation, opts.Mask, detections)
+	resp := wsResponse{Detections: detections, Crowd: st.estimateCrowd(dm, detections, s.cfg.CrowdClass), fields: st.fields}
+	s.frameMeta(&resp, t, data, opts.InputSize)
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(resp.appendJSON(nil))
+}
+
+// frameMeta fills in the metadata of an answer to frame, run for t at
+// imgsz (0 = default).
+func (s *Server) frameMeta(resp *wsResponse, t *tenant, frame []byte, imgsz int) {
+	if w, h, ok := preprocess.FrameDims(frame); ok {
+		if preprocess.ExifOrientation(frame) >= 5 { // 5..8 transpose the image
+			w, h = h, w
+		}
+		resp.Width, resp.Height = w, h
+	}
+	if imgsz == 0 {
+		imgsz = preprocess.InputSize
+	}
+	resp.ImgSz = imgsz
+	var sha string
+	resp.Model, sha = s.modelVersion(t)
+	if len(sha) >= 12 {
+		resp.ModelVersion = sha[:12]
+	}
+	resp.Time = time.Now()
+}
+
+// admitFrame charges one frame to the client behind r and reports whether
+// the rate limit or quota rejected it.
+func (s *Server) admitFrame(r *http.Request) (time.Duration, error) {
+	label := clientLabel(r)
+	l, id := s.limiterFor(tenantOf(r), r)
+	retryAfter, err := l.allow(id, time.Now())
+	switch {
+	case errors.Is(err, errRateLimited):
+		s.framesRateLimited.inc(label)
+	case errors.Is(err, errQuotaExceeded):
+		s.framesQuotaExceeded.inc(label)
+	case err == nil:
+		s.framesTotal.inc(label)
+	}
+	return retryAfter, err
+}
+
+// clientLabel is the metrics label for the client behind r.
+func clientLabel(r *http.Request) string {
+	if t := tenantOf(r); t != nil {
+		return t.name + "/" + keyName(r)
+	}
+	if name := keyName(r); name != "" {
+		return name
+	}
+	return "anonymous"
+}
+
+func limitError(err error) wsError {
+	code := "rate_limited"
+	if errors.Is(err, errQuotaExceeded) {
+		code = "quota_exceeded"
+	}
+	return wsError{Error: err.Error(), Code: code}
+}
+
+func writeJSONError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(wsError{Error: msg})
+}
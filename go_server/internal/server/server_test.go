@@ -0,0 +1,92 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"yolo-server/internal/inference"
+	"yolo-server/internal/postprocess"
+)
+
+// newTestServer serves a mock detector with the default configuration and
+// the given API keys.
+func newTestServer(t *testing.T, apiKeys string) http.Handler {
+	t.Helper()
+	t.Setenv("API_KEYS", apiKeys)
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	det, err := inference.NewMock(postprocess.Labels{0: "person", 1: "car"}, "", 0, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(cfg, det, VersionInfo{}, inference.ModelInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s.Handler()
+}
+
+func testPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDetectUpload(t *testing.T) {
+	h := newTestServer(t, "ci:secret")
+	frame := testPNG(t, 320, 240)
+
+	tests := []struct {
+		name   string
+		method string
+		key    string
+		body   []byte
+		want   int
+	}{
+		{"detects", http.MethodPost, "secret", frame, http.StatusOK},
+		{"missing key", http.MethodPost, "", frame, http.StatusUnauthorized},
+		{"wrong key", http.MethodPost, "nope", frame, http.StatusUnauthorized},
+		{"not an image", http.MethodPost, "secret", []byte("garbage"), http.StatusBadRequest},
+		{"GET", http.MethodGet, "secret", nil, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/detect", bytes.NewReader(tt.body))
+			if tt.key != "" {
+				req.Header.Set("X-API-Key", tt.key)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.want, rec.Body)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			var resp struct {
+				Detections []postprocess.Detection `json:"detections"`
+				Width      int                     `json:"width"`
+				Height     int                     `json:"height"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("response %s: %v", rec.Body, err)
+			}
+			if resp.Width != 320 || resp.Height != 240 {
+				t.Errorf("size = %d×%d, want 320×240", resp.Width, resp.Height)
+			}
+			if len(resp.Detections) != 1 || resp.Detections[0].Box != [4]int{80, 60, 240, 180} {
+				t.Errorf("detections = %+v, want the mock's middle-half box", resp.Detections)
+			}
+		})
+	}
+}
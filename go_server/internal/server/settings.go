@@ -0,0 +1,140 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+// ── 런타임 설정 ──────────────────────────────────────────────────────────────
+// liveSettings are the global knobs that can change without a redeploy via
+// GET/PATCH /admin/config. They start from Config and are swapped as a
+// whole behind an atomic pointer, so a frame always sees one consistent set.
+
+type liveSettings struct {
+	ConfThreshold  float64    `json:"conf_threshold"`
+	NMSIoU         float64    `json:"nms_iou"`
+	MaxConnections int        `json:"max_connections"` // 0 = unlimited
+	RateLimitFPS   float64    `json:"rate_limit_fps"`
+	RateLimitBurst int        `json:"rate_limit_burst"`
+	FrameQuota     uint64     `json:"frame_quota_monthly"`
+	LogLevel       slog.Level `json:"log_level"`
+	LogFrames      bool       `json:"log_frames"`
+}
+
+func settingsFromConfig(cfg Config) liveSettings {
+	return liveSettings{
+		ConfThreshold:  cfg.ConfThreshold,
+		NMSIoU:         cfg.NMSIoU,
+		MaxConnections: cfg.MaxConnections,
+		RateLimitFPS:   cfg.RateLimitFPS,
+		RateLimitBurst: cfg.RateLimitBurst,
+		FrameQuota:     cfg.FrameQuota,
+		LogLevel:       cfg.LogLevel,
+		LogFrames:      cfg.LogFrames,
+	}
+}
+
+// settingsPatch is a PATCH body; nil fields are left unchanged.
+type settingsPatch struct {
+	ConfThreshold  *float64    `json:"conf_threshold"`
+	NMSIoU         *float64    `json:"nms_iou"`
+	MaxConnections *int        `json:"max_connections"`
+	RateLimitFPS   *float64    `json:"rate_limit_fps"`
+	RateLimitBurst *int        `json:"rate_limit_burst"`
+	FrameQuota     *uint64     `json:"frame_quota_monthly"`
+	LogLevel       *slog.Level `json:"log_level"`
+	LogFrames      *bool       `json:"log_frames"`
+}
+
+// apply returns ls with p applied, or an error naming the first bad field.
+func (p settingsPatch) apply(ls liveSettings) (liveSettings, error) {
+	if v := p.ConfThreshold; v != nil {
+		if *v < 0 || *v > 1 {
+			return ls, fmt.Errorf("conf_threshold: want [0, 1]")
+		}
+		ls.ConfThreshold = *v
+	}
+	if v := p.NMSIoU; v != nil {
+		if *v < 0 || *v > 1 {
+			return ls, fmt.Errorf("nms_iou: want [0, 1]")
+		}
+		ls.NMSIoU = *v
+	}
+	if v := p.MaxConnections; v != nil {
+		if *v < 0 {
+			return ls, fmt.Errorf("max_connections: want >= 0")
+		}
+		ls.MaxConnections = *v
+	}
+	if v := p.RateLimitFPS; v != nil {
+		if *v < 0 {
+			return ls, fmt.Errorf("rate_limit_fps: want >= 0")
+		}
+		ls.RateLimitFPS = *v
+	}
+	if v := p.RateLimitBurst; v != nil {
+		if *v < 0 {
+			return ls, fmt.Errorf("rate_limit_burst: want >= 0")
+		}
+		ls.RateLimitBurst = *v
+	}
+	if v := p.FrameQuota; v != nil {
+		ls.FrameQuota = *v
+	}
+	if v := p.LogLevel; v != nil {
+		ls.LogLevel = *v
+	}
+	if v := p.LogFrames; v != nil {
+		ls.LogFrames = *v
+	}
+	return ls, nil
+}
+
+func (s *Server) settings() *liveSettings { return s.live.Load() }
+
+// setSettings installs ls and pushes the parts owned by other components.
+func (s *Server) setSettings(ls liveSettings) {
+	s.live.Store(&ls)
+	s.limiter.setLimits(ls.RateLimitFPS, ls.RateLimitBurst, ls.FrameQuota)
+	for _, t := range s.tenants {
+		tls := s.settingsFor(t)
+		t.limiter.setLimits(tls.RateLimitFPS, tls.RateLimitBurst, tls.FrameQuota)
+	}
+	logLevel.Set(ls.LogLevel)
+}
+
+// updateSettings installs fn's result for the current settings, serialized
+// against other updates so concurrent changes are not lost.
+func (s *Server) updateSettings(fn func(liveSettings) (liveSettings, error)) (old, next liveSettings, err error) {
+	s.liveMu.Lock()
+	defer s.liveMu.Unlock()
+	old = *s.settings()
+	if next, err = fn(old); err != nil {
+		return old, next, err
+	}
+	s.setSettings(next)
+	return old, next, nil
+}
+
+func (s *Server) adminGetConfig(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.settings())
+}
+
+func (s *Server) adminPatchConfig(w http.ResponseWriter, r *http.Request) {
+	var patch settingsPatch
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&patch); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	old, next, err := s.updateSettings(patch.apply)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	slog.Info("admin: config updated", "remote", s.clientIP(r), "old", old, "new", next)
+	writeJSON(w, http.StatusOK, next)
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"yolo-server/internal/redis"
+	"yolo-server/internal/track"
+)
+
+// ── 공유 스트림 상태 ─────────────────────────────────────────────────────────
+// Behind a load balancer, a client that reconnects may land on another
+// replica. With REDIS_URL set, a stream opened with ?stream=<id> keeps its
+// tracker in Redis under its credential and id, so the next connection with
+// the same id, on any replica, extrapolates skipped frames from where the
+// last one left off. The state is written after every inferred frame, off
+// the pipeline and only the newest if writes fall behind, and expires
+// STREAM_STATE_TTL after the last write. Redis being down costs continuity,
+// never frames.
+
+const (
+	maxStreamID       = 128
+	streamLoadTimeout = time.Second
+)
+
+func validStreamID(id string) bool {
+	if len(id) == 0 || len(id) > maxStreamID {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9',
+			c == '.', c == '_', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+type streamStore struct {
+	rdb    *redis.Client
+	ttl    time.Duration
+	errors *counterVec // by op: load, save
+}
+
+// streamKey scopes id to r's credential, so one client cannot pick up
+// another's stream. Anonymous clients share one scope.
+func (s *Server) streamKey(r *http.Request, id string) string {
+	return "yolo:stream:" + clientLabel(r) + ":" + id
+}
+
+// stateSaver writes one stream's tracker to Redis in the background.
+type stateSaver struct {
+	ss     *streamStore
+	key    string
+	latest chan []byte // the newest unwritten state
+}
+
+// open restores tr from key, if it is stored and tr is not nil, and starts
+// the stream's saver.
+func (ss *streamStore) open(key string, tr *track.Tracker) *stateSaver {
+	sv := &stateSaver{ss: ss, key: key, latest: make(chan []byte, 1)}
+	go sv.run()
+	if tr == nil {
+		return sv
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), streamLoadTimeout)
+	defer cancel()
+	b, err := ss.rdb.Get(ctx, key)
+	switch {
+	case errors.Is(err, redis.ErrNil):
+	case err != nil:
+		ss.errors.inc("load")
+		slog.Warn("stream state load", "key", key, "err", err)
+	default:
+		if err := json.Unmarshal(b, tr); err != nil {
+			ss.errors.inc("load")
+			slog.Warn("stream state load", "key", key, "err", err)
+		}
+	}
+	return sv
+}
+
+// save queues tr's state, replacing any not yet written.
+func (sv *stateSaver) save(tr *track.Tracker) {
+	if sv == nil {
+		return
+	}
+	b, err := json.Marshal(tr)
+	if err != nil {
+		return
+	}
+	for {
+		select {
+		case sv.latest <- b:
+			return
+		default:
+		}
+		select {
+		case <-sv.latest:
+		default:
+		}
+	}
+}
+
+// close lets the saver write what is queued and stop.
+func (sv *stateSaver) close() {
+	if sv != nil {
+		close(sv.latest)
+	}
+}
+
+func (sv *stateSaver) run() {
+	for b := range sv.latest {
+		ctx, cancel := context.WithTimeout(context.Background(), streamLoadTimeout)
+		err := sv.ss.rdb.Set(ctx, sv.key, b, sv.ss.ttl)
+		cancel()
+		if err != nil {
+			sv.ss.errors.inc("save")
+			slog.Debug("stream state save", "key", sv.key, "err", err)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"strings"
+
+	"yolo-server/internal/inference"
+)
+
+// ── 모델 서명 ────────────────────────────────────────────────────────────────
+// Models the server loads itself, MODEL_PATH under the onnxruntime backend
+// and tenant models, are checked before they are loaded. With
+// MODEL_SIGNING_KEYS, a model may come with a detached signature next to
+// it, <model>.sig: the base64 Ed25519 signature, by one of the keys, of the
+// file's SHA-256 digest. A signature that does not verify rejects the
+// model; a missing one only does with MODEL_REQUIRE_SIGNED and is logged
+// otherwise. MODEL_LICENSES rejects models whose "license" metadata does
+// not start with one of the listed values. A lazy tenant model is checked
+// again every time it loads, so a swapped file is caught too. Under the
+// onnxruntime backend the model is read once, and its metadata and
+// signature are checked over the same bytes ONNX Runtime loads.
+
+// loadSigningKeys reads Ed25519 public keys from PEM files.
+func loadSigningKeys(paths []string) ([]ed25519.PublicKey, error) {
+	var keys []ed25519.PublicKey
+	for _, path := range paths {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for {
+			var block *pem.Block
+			if block, raw = pem.Decode(raw); block == nil {
+				break
+			}
+			if block.Type != "PUBLIC KEY" {
+				continue
+			}
+			k, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			ek, ok := k.(ed25519.PublicKey)
+			if !ok {
+				return nil, fmt.Errorf("%s: want an Ed25519 key, got %T", path, k)
+			}
+			keys = append(keys, ek)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no PUBLIC KEY blocks in %s", strings.Join(paths, ", "))
+	}
+	return keys, nil
+}
+
+// VerifyModel checks the model file at path, whose metadata is model,
+// against MODEL_LICENSES and its signature. data is the file as it will be
+// loaded; nil hashes the file itself.
+func VerifyModel(cfg Config, path string, data []byte, model inference.ModelInfo) error {
+	if len(cfg.ModelLicenses) > 0 {
+		lic := strings.TrimSpace(model.Metadata["license"])
+		ok := false
+		for _, want := range cfg.ModelLicenses {
+			ok = ok || (lic != "" && strings.HasPrefix(strings.ToLower(lic), strings.ToLower(want)))
+		}
+		if !ok {
+			return fmt.Errorf("%s: license %q is not in MODEL_LICENSES", path, lic)
+		}
+	}
+	if len(cfg.ModelSigningKeys) == 0 {
+		return nil
+	}
+	raw, err := os.ReadFile(path + ".sig")
+	if errors.Is(err, fs.ErrNotExist) {
+		if cfg.ModelRequireSigned {
+			return fmt.Errorf("%s: not signed; MODEL_REQUIRE_SIGNED wants %s.sig", path, path)
+		}
+		slog.Warn("model is not signed", "path", path)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(raw)), ""))
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return fmt.Errorf("%s.sig: want a base64 Ed25519 signature", path)
+	}
+	var digest []byte
+	if data != nil {
+		sum := sha256.Sum256(data)
+		digest = sum[:]
+	} else if digest, err = fileDigest(path); err != nil {
+		return err
+	}
+	for _, k := range cfg.ModelSigningKeys {
+		if ed25519.Verify(k, digest, sig) {
+			slog.Info("model signature verified", "path", path)
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: signature does not match any MODEL_SIGNING_KEYS key", path)
+}
+
+func fileDigest(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
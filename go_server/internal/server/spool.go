@@ -0,0 +1,207 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ── 디스크 스풀 ──────────────────────────────────────────────────────────────
+// With SPOOL_DIR set, a frame posted to a batch long-poll session whose
+// queue is full is written to disk instead of refused, and fed to the
+// session's pipeline as the queue drains. Once a session has spooled, its
+// later frames and control messages queue behind the spooled ones, so the
+// pipeline still sees them in the order they were posted. Spooled frames
+// take no memory. All sessions' spools together hold at most SPOOL_BYTES;
+// beyond that frames are refused with 429 as without a spool. A spool does
+// not outlive its session, nor the process. Spools live in a yolo-spool
+// directory the server owns inside SPOOL_DIR, emptied on start; nothing
+// else in SPOOL_DIR is touched.
+
+// spoolSubdir is the directory under SPOOL_DIR the server owns.
+const spoolSubdir = "yolo-spool"
+
+type spool struct {
+	dir     string
+	limit   int64
+	spooled *counterVec // frames by client
+
+	mu   sync.Mutex
+	used map[string]int64 // bytes by client
+	sum  int64
+}
+
+func newSpool(cfg Config, m *metricSet) (*spool, error) {
+	dir := filepath.Join(cfg.SpoolDir, spoolSubdir)
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	sp := &spool{
+		dir: dir, limit: cfg.SpoolBytes, used: map[string]int64{},
+		spooled: m.newCounterVec("yolo_spool_frames_total",
+			"Batch long-poll frames spooled to disk because the session queue was full.", "client"),
+	}
+	m.newGaugeFunc("yolo_spool_bytes", "Bytes of spooled frames waiting, by client.", "client", sp.bytes)
+	return sp, nil
+}
+
+func (sp *spool) bytes() map[string]int64 {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	m := make(map[string]int64, len(sp.used))
+	for c, n := range sp.used {
+		m[c] = n
+	}
+	return m
+}
+
+// reserve takes n bytes of the spool for client; false when it is full.
+func (sp *spool) reserve(client string, n int64) bool {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if sp.sum+n > sp.limit {
+		return false
+	}
+	sp.sum += n
+	sp.used[client] += n
+	return true
+}
+
+func (sp *spool) release(client string, n int64) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	sp.sum -= n
+	if sp.used[client] -= n; sp.used[client] == 0 {
+		delete(sp.used, client)
+	}
+}
+
+// sessionSpool is one poll session's spool.
+type sessionSpool struct {
+	sp     *spool
+	client string
+	dir    string
+	wake   chan struct{}
+
+	mu      sync.Mutex
+	queue   []spooled // oldest first
+	next    int
+	created bool // dir
+	closed  bool
+}
+
+type spooled struct {
+	name    string
+	size    int64
+	control bool
+}
+
+// open starts spooling for a session of client; in is the session's queue
+// and done closes when it ends.
+func (sp *spool) open(id, client string, in chan<- streamMsg, done <-chan struct{}) *sessionSpool {
+	ss := &sessionSpool{sp: sp, client: client, dir: filepath.Join(sp.dir, id), wake: make(chan struct{}, 1)}
+	go ss.feed(in, done)
+	return ss
+}
+
+// put queues m for in: at once while nothing is spooled and in has room,
+// else on disk. false when the spool is full too.
+func (ss *sessionSpool) put(m streamMsg, in chan<- streamMsg) bool {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.closed {
+		return false
+	}
+	if len(ss.queue) == 0 {
+		select {
+		case in <- m:
+			return true
+		default:
+		}
+	}
+	size := int64(len(m.data))
+	if !ss.sp.reserve(ss.client, size) {
+		return false
+	}
+	name := fmt.Sprintf("%09d", ss.next)
+	if err := ss.write(name, m.data); err != nil {
+		ss.sp.release(ss.client, size)
+		slog.Warn("spool write", "dir", ss.dir, "err", err)
+		return false
+	}
+	ss.queue = append(ss.queue, spooled{name: name, size: size, control: m.control})
+	ss.next++
+	ss.sp.spooled.inc(ss.client)
+	select {
+	case ss.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// write stores a spooled message as name. ss.mu is held.
+func (ss *sessionSpool) write(name string, data []byte) error {
+	if !ss.created {
+		if err := os.MkdirAll(ss.dir, 0o755); err != nil {
+			return err
+		}
+		ss.created = true
+	}
+	return os.WriteFile(filepath.Join(ss.dir, name), data, 0o600)
+}
+
+// feed moves spooled messages into in, oldest first, until done closes,
+// and then removes what is left.
+func (ss *sessionSpool) feed(in chan<- streamMsg, done <-chan struct{}) {
+	defer ss.drop()
+	for {
+		select {
+		case <-ss.wake:
+		case <-done:
+			return
+		}
+		for {
+			ss.mu.Lock()
+			if len(ss.queue) == 0 {
+				ss.mu.Unlock()
+				break
+			}
+			head := ss.queue[0]
+			ss.mu.Unlock()
+			path := filepath.Join(ss.dir, head.name)
+			data, err := os.ReadFile(path)
+			if err != nil {
+				slog.Warn("spool read", "file", path, "err", err)
+			} else {
+				select {
+				case in <- streamMsg{data: data, control: head.control}:
+				case <-done:
+					return
+				}
+			}
+			_ = os.Remove(path)
+			ss.sp.release(ss.client, head.size)
+			ss.mu.Lock()
+			ss.queue = ss.queue[1:]
+			ss.mu.Unlock()
+		}
+	}
+}
+
+// drop removes the spool of an ended session.
+func (ss *sessionSpool) drop() {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	for _, m := range ss.queue {
+		ss.sp.release(ss.client, m.size)
+	}
+	ss.queue, ss.closed = nil, true
+	if ss.created {
+		_ = os.RemoveAll(ss.dir)
+	}
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNewSpoolKeepsOtherFiles(t *testing.T) {
+	root := t.TempDir()
+	unrelated := filepath.Join(root, "important.db")
+	stale := filepath.Join(root, spoolSubdir, "old-session", "000000000")
+	if err := os.WriteFile(unrelated, []byte("keep"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(stale), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(stale, []byte("frame"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := newSpool(Config{SpoolDir: root, SpoolBytes: 1 << 20}, &metricSet{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(unrelated); err != nil {
+		t.Errorf("file next to the spool was removed: %v", err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("stale spool file survived start: %v", err)
+	}
+}
+
+func TestSessionSpool(t *testing.T) {
+	sp, err := newSpool(Config{SpoolDir: t.TempDir(), SpoolBytes: 3}, &metricSet{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := make(chan streamMsg, 1)
+	done := make(chan struct{})
+	defer close(done)
+	ss := sp.open("s1", "c", in, done)
+
+	// Nothing reads in yet: "0" fills it, "1" and "2" go to disk, and
+	// "34" would take the spool past its 3 bytes.
+	for i := range 3 {
+		if !ss.put(streamMsg{data: []byte(strconv.Itoa(i))}, in) {
+			t.Fatalf("put %d refused", i)
+		}
+	}
+	if ss.put(streamMsg{data: []byte("34")}, in) {
+		t.Error("put beyond SpoolBytes accepted")
+	}
+	for i := range 3 {
+		select {
+		case m := <-in:
+			if got := string(m.data); got != strconv.Itoa(i) {
+				t.Fatalf("message %d = %q, want %d", i, got, i)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("message %d never arrived", i)
+		}
+	}
+}
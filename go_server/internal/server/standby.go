@@ -0,0 +1,285 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"yolo-server/internal/inference"
+	"yolo-server/internal/postprocess"
+)
+
+// ── 모델 대기 ────────────────────────────────────────────────────────────────
+// A tenant model named in MODEL_PRELOAD, or any when it is unset, is loaded
+// at start, warmed up before the server reports ready and kept loaded: a
+// warm standby. The others are lazy. The first frame for one loads and
+// warms it up, and it and the frames behind it wait for that; once no frame
+// has used it for MODEL_IDLE_UNLOAD, it is closed again and its memory
+// freed. POST /admin/models/{tenant}/pin loads a lazy model and keeps it
+// loaded like a preloaded one, and DELETE unpins any model, leaving it to
+// unload when idle. The MODEL_PATH model is always loaded.
+
+// ModelLoader opens a tenant's detector, returning it and what closes it.
+type ModelLoader func() (inference.Detector, func(), error)
+
+// standby is a tenant's detector, loaded when it is pinned or in use.
+type standby struct {
+	tenant string
+	load   ModelLoader
+
+	mu      sync.Mutex
+	det     inference.Detector // nil while unloaded
+	closeFn func()
+	warm    bool // det's Warmup ran
+	pinned  bool
+	busy    int // calls running on det
+	used    time.Time
+	loads   int
+}
+
+// open loads the model. sb.mu is held.
+func (sb *standby) open() error {
+	det, closeFn, err := sb.load()
+	if err != nil {
+		return fmt.Errorf("tenant %s: load model: %w", sb.tenant, err)
+	}
+	sb.det, sb.closeFn, sb.warm = det, closeFn, false
+	sb.loads++
+	return nil
+}
+
+// warmup runs the loaded model's Warmup once. sb.mu is held.
+func (sb *standby) warmup() error {
+	if sb.warm {
+		return nil
+	}
+	if err := sb.det.Warmup(); err != nil {
+		return fmt.Errorf("tenant %s: warm up model: %w", sb.tenant, err)
+	}
+	sb.warm = true
+	return nil
+}
+
+// acquire is the model, loaded and warmed up; release it after use.
+func (sb *standby) acquire() (inference.Detector, error) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	if sb.det == nil {
+		start := time.Now()
+		if err := sb.open(); err != nil {
+			return nil, err
+		}
+		if err := sb.warmup(); err != nil {
+			sb.unload()
+			return nil, err
+		}
+		slog.Info("tenant model loaded", "tenant", sb.tenant, "elapsed", time.Since(start))
+	}
+	sb.busy++
+	return sb.det, nil
+}
+
+func (sb *standby) release() {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	sb.busy--
+	sb.used = time.Now()
+}
+
+// unload closes the model. sb.mu is held.
+func (sb *standby) unload() {
+	sb.closeFn()
+	sb.det, sb.closeFn, sb.warm = nil, nil, false
+}
+
+func (sb *standby) Detect(frame []byte, opts inference.Options) ([]postprocess.Detection, error) {
+	det, err := sb.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer sb.release()
+	return det.Detect(frame, opts)
+}
+
+func (sb *standby) Density(frame []byte, opts inference.Options) (*inference.DensityMap, error) {
+	det, err := sb.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer sb.release()
+	de, ok := det.(inference.DensityEstimator)
+	if !ok {
+		return nil, fmt.Errorf("tenant %s: no density model", sb.tenant)
+	}
+	return de.Density(frame, opts)
+}
+
+// Warmup warms up a loaded model; a lazy one is warmed up when it loads.
+func (sb *standby) Warmup() error {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	if sb.det == nil {
+		return nil
+	}
+	return sb.warmup()
+}
+
+// pin loads the model if need be and keeps it loaded until unpin.
+func (sb *standby) pin() error {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	if sb.det == nil {
+		if err := sb.open(); err != nil {
+			return err
+		}
+	}
+	if err := sb.warmup(); err != nil {
+		return err
+	}
+	sb.pinned, sb.used = true, time.Now()
+	return nil
+}
+
+func (sb *standby) unpin() {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	sb.pinned, sb.used = false, time.Now()
+}
+
+// unloadIdle closes the model when it is unpinned and unused since cutoff.
+func (sb *standby) unloadIdle(cutoff time.Time) bool {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	if sb.det == nil || sb.pinned || sb.busy > 0 || sb.used.After(cutoff) {
+		return false
+	}
+	sb.unload()
+	return true
+}
+
+// close closes the model at shutdown.
+func (sb *standby) close() {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	if sb.det != nil {
+		sb.unload()
+	}
+}
+
+// modelStatus is the JSON view of a tenant model in GET /admin/models.
+type modelStatus struct {
+	Tenant   string     `json:"tenant"`
+	Model    string     `json:"model"`
+	Loaded   bool       `json:"loaded"`
+	Pinned   bool       `json:"pinned"`
+	Loads    int        `json:"loads"`
+	LastUsed *time.Time `json:"last_used,omitempty"`
+}
+
+func (sb *standby) status() modelStatus {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	st := modelStatus{Tenant: sb.tenant, Loaded: sb.det != nil, Pinned: sb.pinned, Loads: sb.loads}
+	if !sb.used.IsZero() {
+		used := sb.used
+		st.LastUsed = &used
+	}
+	return st
+}
+
+func (s *Server) loadedModels() map[string]int64 {
+	m := map[string]int64{}
+	for _, t := range s.tenants {
+		if t.standby != nil {
+			var n int64
+			if t.standby.status().Loaded {
+				n = 1
+			}
+			m[t.name] = n
+		}
+	}
+	return m
+}
+
+// unloadIdleModels unloads idle lazy models until ctx ends.
+func (s *Server) unloadIdleModels(ctx context.Context) {
+	idle := s.cfg.ModelIdleUnload
+	t := time.NewTicker(min(max(idle/4, time.Second), time.Minute))
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			for _, tn := range s.tenants {
+				if tn.standby != nil && tn.standby.unloadIdle(now.Add(-idle)) {
+					slog.Info("tenant model unloaded", "tenant", tn.name, "idle", idle)
+				}
+			}
+		}
+	}
+}
+
+func (s *Server) closeTenantModels() {
+	for _, t := range s.tenants {
+		if t.standby != nil {
+			t.standby.close()
+		}
+	}
+}
+
+// ── API ──────────────────────────────────────────────────────────────────────
+
+func (s *Server) adminModels(w http.ResponseWriter, _ *http.Request) {
+	out := []modelStatus{}
+	for _, t := range s.tenants {
+		if t.standby != nil {
+			st := t.standby.status()
+			st.Model, _ = s.modelVersion(t)
+			out = append(out, st)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Tenant < out[j].Tenant })
+	writeJSON(w, http.StatusOK, out)
+}
+
+// standbyFor is the path's tenant model, or nil after answering 404.
+func (s *Server) standbyFor(w http.ResponseWriter, r *http.Request) *tenant {
+	t := s.tenants[r.PathValue("tenant")]
+	if t == nil || t.standby == nil {
+		writeJSONError(w, http.StatusNotFound, "no such tenant model")
+		return nil
+	}
+	return t
+}
+
+func (s *Server) adminPinModel(w http.ResponseWriter, r *http.Request) {
+	t := s.standbyFor(w, r)
+	if t == nil {
+		return
+	}
+	start := time.Now()
+	if err := t.standby.pin(); err != nil {
+		slog.Error("admin: pin model", "tenant", t.name, "err", err)
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	slog.Info("admin: model pinned", "remote", s.clientIP(r), "tenant", t.name, "elapsed", time.Since(start))
+	st := t.standby.status()
+	st.Model, _ = s.modelVersion(t)
+	writeJSON(w, http.StatusOK, st)
+}
+
+func (s *Server) adminUnpinModel(w http.ResponseWriter, r *http.Request) {
+	t := s.standbyFor(w, r)
+	if t == nil {
+		return
+	}
+	t.standby.unpin()
+	slog.Info("admin: model unpinned", "remote", s.clientIP(r), "tenant", t.name)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,445 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"math"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"yolo-server/internal/inference"
+	"yolo-server/internal/track"
+)
+
+// ── 스트림 설정 ──────────────────────────────────────────────────────────────
+// streamState holds the per-connection settings of a /ws/stream client.
+// Initial values come from the query string; the client can change them
+// later by sending a JSON text message (binary messages are always frames).
+
+type streamState struct {
+	roi   image.Rectangle   // source-frame pixels; empty = whole frame
+	mask  []image.Rectangle // privacy zones, source-frame pixels
+	tiled bool              // SAHI-style tiled inference
+	tta   bool              // test-time augmentation
+	imgsz int               // model input edge; 0 = default
+	sizes []int             // accepted imgsz values (INPUT_SIZES)
+
+	// Sampling: only every Nth frame, and at most fps frames per second,
+	// are inferred. The others are answered with "skipped": true and, with
+	// echo, the last result extrapolated by internal/track and flagged
+	// "interpolated".
+	every int
+	fps   float64 // 0 = unlimited
+	echo  bool
+	seen  int       // frames received
+	next  time.Time // earliest arrival of the next frame to infer under fps
+
+	// Adaptive threshold, see STREAM_CONF_MARGIN.
+	confMargin float64 // 0 = conf_threshold applies
+	confFloor  float64
+
+	stable *track.Stabilizer // ?stable=K/N; nil = every box is reported
+
+	inflight  int  // frames at the model at once (?inflight=)
+	unordered bool // answer frames as they finish (?order=any)
+
+	id string // ?stream=, names the stream across reconnects (shared.go)
+
+	video bool // ?video=1, also record an annotated MP4 (video.go)
+	hls   bool // ?hls=1, also publish a live HLS playlist (hls.go)
+
+	crops   string        // ?crops=, "inline" or "ref" thumbnails (crops.go); "" = none
+	summary time.Duration // ?summary=, answer with a summary this often (summary.go); 0 = every frame
+
+	crowd      bool        // ?crowd=1, count people (crowd.go)
+	crowdZones []crowdZone // ?crowd_zone=, counted apart
+
+	fields detFields // ?fields=, detection keys answered (encode.go); 0 = all
+}
+
+// controlMsg is a client → server text message. Absent fields are left
+// unchanged; "roi": null clears the region of interest, "mask": null the
+// privacy zones.
+type controlMsg struct {
+	ROI   json.RawMessage `json:"roi"`
+	Mask  json.RawMessage `json:"mask"`
+	Tile  *bool           `json:"tile"`
+	TTA   *bool           `json:"tta"`
+	ImgSz *int            `json:"imgsz"`
+	Every *int            `json:"every"`
+	FPS   *float64        `json:"fps"`
+	Echo  *bool           `json:"echo"`
+
+	ConfMargin *float64 `json:"conf_margin"`
+	Stable     *string  `json:"stable"` // "K/N" or "off"
+}
+
+// newStreamState starts from the STREAM_* defaults in cfg and applies the
+// query string.
+func newStreamState(q url.Values, cfg *Config) (*streamState, error) {
+	st := &streamState{sizes: cfg.InputSizes, every: cfg.StreamEvery, fps: cfg.StreamFPS, echo: cfg.StreamEcho, inflight: cfg.StreamInflight,
+		confMargin: cfg.StreamConfMargin, confFloor: cfg.StreamConfFloor}
+	st.stable, _ = track.ParseStable(cfg.StreamStable) // checked by LoadConfig
+	if v := q.Get("roi"); v != "" {
+		roi, err := parseROI(strings.Split(v, ","))
+		if err != nil {
+			return nil, err
+		}
+		st.roi = roi
+	}
+	if vs := q["mask"]; len(vs) > 0 {
+		boxes := make([][]string, len(vs))
+		for i, v := range vs {
+			boxes[i] = strings.Split(v, ",")
+		}
+		mask, err := parseMask(boxes)
+		if err != nil {
+			return nil, err
+		}
+		st.mask = mask
+	}
+	if v := q.Get("tile"); v != "" {
+		tiled, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("tile: want a boolean, got %q", v)
+		}
+		st.tiled = tiled
+	}
+	if v := q.Get("tta"); v != "" {
+		tta, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("tta: want a boolean, got %q", v)
+		}
+		st.tta = tta
+	}
+	if v := q.Get("imgsz"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("imgsz: want an integer, got %q", v)
+		}
+		if err := st.setImgSz(n); err != nil {
+			return nil, err
+		}
+	}
+	if v := q.Get("every"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("every: want an integer, got %q", v)
+		}
+		if err := st.setEvery(n); err != nil {
+			return nil, err
+		}
+	}
+	if v := q.Get("fps"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("fps: want a number, got %q", v)
+		}
+		if err := st.setFPS(f); err != nil {
+			return nil, err
+		}
+	}
+	if v := q.Get("echo"); v != "" {
+		echo, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("echo: want a boolean, got %q", v)
+		}
+		st.echo = echo
+	}
+	if v := q.Get("conf_margin"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("conf_margin: want a number, got %q", v)
+		}
+		if err := st.setConfMargin(f); err != nil {
+			return nil, err
+		}
+	}
+	if v := q.Get("stable"); v != "" {
+		sb, err := track.ParseStable(v)
+		if err != nil {
+			return nil, err
+		}
+		st.stable = sb
+	}
+	if v := q.Get("inflight"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxInflight {
+			return nil, fmt.Errorf("inflight: want 1..%d, got %q", maxInflight, v)
+		}
+		st.inflight = n
+	}
+	switch v := q.Get("order"); v {
+	case "", "frame":
+	case "any":
+		st.unordered = true
+	default:
+		return nil, fmt.Errorf("order: want frame or any, got %q", v)
+	}
+	if v := q.Get("stream"); v != "" {
+		if !validStreamID(v) {
+			return nil, fmt.Errorf("stream: want 1..%d of [A-Za-z0-9._-], got %q", maxStreamID, v)
+		}
+		st.id = v
+	}
+	if v := q.Get("video"); v != "" {
+		on, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("video: want a boolean, got %q", v)
+		}
+		if on && cfg.VideoDir == "" {
+			return nil, fmt.Errorf("video: recording is not enabled on this server")
+		}
+		st.video = on
+	}
+	if v := q.Get("hls"); v != "" {
+		on, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("hls: want a boolean, got %q", v)
+		}
+		if on && cfg.HLSDir == "" {
+			return nil, fmt.Errorf("hls: live playlists are not enabled on this server")
+		}
+		st.hls = on
+	}
+	if v := q.Get("fields"); v != "" {
+		f, err := parseDetFields(v)
+		if err != nil {
+			return nil, err
+		}
+		st.fields = f
+	}
+	switch v := q.Get("crops"); v {
+	case "", cropsInline, cropsRef:
+		st.crops = v
+	default:
+		return nil, fmt.Errorf("crops: want inline or ref, got %q", v)
+	}
+	if v := q.Get("summary"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < minSummaryWindow || d > maxSummaryWindow {
+			return nil, fmt.Errorf("summary: want a duration from %s to %s, got %q", minSummaryWindow, maxSummaryWindow, v)
+		}
+		st.summary = d
+	}
+	if v := q.Get("crowd"); v != "" {
+		on, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("crowd: want a boolean, got %q", v)
+		}
+		st.crowd = on
+	}
+	if vs := q["crowd_zone"]; len(vs) > 0 {
+		zones, err := parseCrowdZones(vs)
+		if err != nil {
+			return nil, err
+		}
+		st.crowd, st.crowdZones = true, zones
+	}
+	return st, nil
+}
+
+// streamName is how events, playlists and arming refer to a stream: its
+// ?stream= id, or conn<id> without one.
+func streamName(ci *connInfo, st *streamState) string {
+	if st.id != "" {
+		return st.id
+	}
+	return fmt.Sprintf("conn%d", ci.id)
+}
+
+func (st *streamState) setEvery(n int) error {
+	if n < 1 {
+		return fmt.Errorf("every: want at least 1, got %d", n)
+	}
+	st.every = n
+	return nil
+}
+
+func (st *streamState) setFPS(f float64) error {
+	if f < 0 || math.IsInf(f, 0) || math.IsNaN(f) {
+		return fmt.Errorf("fps: want a non-negative number, got %v", f)
+	}
+	st.fps = f
+	st.next = time.Time{}
+	return nil
+}
+
+func (st *streamState) setConfMargin(f float64) error {
+	if !(f >= 0 && f <= 1) {
+		return fmt.Errorf("conf_margin: want [0, 1], got %v", f)
+	}
+	st.confMargin = f
+	return nil
+}
+
+// sample reports whether the frame arriving at now should be inferred.
+// The fps schedule advances by whole intervals so arrival jitter does not
+// drift the rate; after a pause it restarts from now.
+func (st *streamState) sample(now time.Time) bool {
+	st.seen++
+	if st.every > 1 && (st.seen-1)%st.every != 0 {
+		return false
+	}
+	if st.fps > 0 {
+		if now.Before(st.next) {
+			return false
+		}
+		interval := time.Duration(float64(time.Second) / st.fps)
+		if st.next = st.next.Add(interval); st.next.Before(now) {
+			st.next = now.Add(interval)
+		}
+	}
+	return true
+}
+
+func (st *streamState) setImgSz(n int) error {
+	if !slices.Contains(st.sizes, n) {
+		return fmt.Errorf("imgsz: %d is not enabled; want one of %v", n, st.sizes)
+	}
+	st.imgsz = n
+	return nil
+}
+
+func (st *streamState) applyControl(data []byte) error {
+	var msg controlMsg
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return fmt.Errorf("invalid control message: %w", err)
+	}
+	if len(msg.ROI) > 0 {
+		if string(msg.ROI) == "null" {
+			st.roi = image.Rectangle{}
+		} else {
+			var box []int
+			if err := json.Unmarshal(msg.ROI, &box); err != nil {
+				return fmt.Errorf("roi: want [x1, y1, x2, y2]")
+			}
+			parts := make([]string, len(box))
+			for i, v := range box {
+				parts[i] = strconv.Itoa(v)
+			}
+			roi, err := parseROI(parts)
+			if err != nil {
+				return err
+			}
+			st.roi = roi
+		}
+	}
+	if len(msg.Mask) > 0 {
+		var boxes [][]int
+		if err := json.Unmarshal(msg.Mask, &boxes); err != nil {
+			return fmt.Errorf("mask: want [[x1, y1, x2, y2], ...]")
+		}
+		parts := make([][]string, len(boxes))
+		for i, box := range boxes {
+			for _, v := range box {
+				parts[i] = append(parts[i], strconv.Itoa(v))
+			}
+		}
+		mask, err := parseMask(parts)
+		if err != nil {
+			return err
+		}
+		st.mask = mask
+	}
+	if msg.Tile != nil {
+		st.tiled = *msg.Tile
+	}
+	if msg.TTA != nil {
+		st.tta = *msg.TTA
+	}
+	if msg.Echo != nil {
+		st.echo = *msg.Echo
+	}
+	if msg.ConfMargin != nil {
+		if err := st.setConfMargin(*msg.ConfMargin); err != nil {
+			return err
+		}
+	}
+	if msg.Stable != nil {
+		sb, err := track.ParseStable(*msg.Stable)
+		if err != nil {
+			return err
+		}
+		st.stable = sb
+	}
+	if msg.Every != nil {
+		if err := st.setEvery(*msg.Every); err != nil {
+			return err
+		}
+	}
+	if msg.FPS != nil {
+		if err := st.setFPS(*msg.FPS); err != nil {
+			return err
+		}
+	}
+	if msg.ImgSz != nil {
+		return st.setImgSz(*msg.ImgSz)
+	}
+	return nil
+}
+
+// parseROI parses x1, y1, x2, y2 in source-frame pixels.
+func parseROI(parts []string) (image.Rectangle, error) { return parseRect("roi", parts) }
+
+// parseRect parses x1, y1, x2, y2 for the parameter name.
+func parseRect(name string, parts []string) (image.Rectangle, error) {
+	if len(parts) != 4 {
+		return image.Rectangle{}, fmt.Errorf("%s: want x1,y1,x2,y2", name)
+	}
+	var v [4]int
+	for i, p := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil || n < 0 {
+			return image.Rectangle{}, fmt.Errorf("%s: invalid coordinate %q", name, p)
+		}
+		v[i] = n
+	}
+	r := image.Rect(v[0], v[1], v[2], v[3])
+	if r.Empty() {
+		return image.Rectangle{}, fmt.Errorf("%s: empty rectangle", name)
+	}
+	return r, nil
+}
+
+// parseMask parses privacy zones, each x1, y1, x2, y2 in source-frame
+// pixels. Frames are blacked out inside them before inference, and boxes
+// centred in them are dropped. Videos, event snapshots and clips,
+// notifications and session recordings are masked too.
+func parseMask(boxes [][]string) ([]image.Rectangle, error) {
+	if len(boxes) > maxMaskZones {
+		return nil, fmt.Errorf("mask: at most %d zones", maxMaskZones)
+	}
+	var mask []image.Rectangle
+	for i, parts := range boxes {
+		z, err := parseRect(fmt.Sprintf("mask[%d]", i), parts)
+		if err != nil {
+			return nil, err
+		}
+		mask = append(mask, z)
+	}
+	return mask, nil
+}
+
+// options combines the stream's settings with the live server settings.
+func (st *streamState) options(ls *liveSettings, upright bool) inference.Options {
+	conf := ls.ConfThreshold
+	if st.confMargin > 0 {
+		conf = st.confFloor
+	}
+	return inference.Options{
+		ConfThreshold: conf,
+		ConfMargin:    st.confMargin,
+		NMSIoU:        ls.NMSIoU,
+		ROI:           st.roi,
+		Mask:          st.mask,
+		Tile:          st.tiled,
+		TTA:           st.tta,
+		Upright:       upright,
+		InputSize:     st.imgsz,
+	}
+}
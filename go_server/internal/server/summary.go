@@ -0,0 +1,105 @@
+package server
+
+import (
+	"sort"
+	"time"
+
+	"yolo-server/internal/postprocess"
+)
+
+// ── 결과 요약 ────────────────────────────────────────────────────────────────
+// A stream opened with ?summary=500ms is not answered frame by frame.
+// Instead, at most every 500 ms and only when frames arrived, it is sent
+//
+//	{"summary": {"frames": 14, "inferred": 5, "first": 31, "last": 44,
+//	             "from": 1767268800000, "to": 1767268800480,
+//	             "detections": [{"track": 3, "seen": 5, "box": [...], "score": 0.93, ...}]}}
+//
+// frames counts the frames of the window, first and last their IDs, and
+// from and to their arrival in Unix milliseconds. Every track of the
+// inferred frames is listed once, with the box it scored highest in and
+// the number of inferred frames it was seen in. Errors are still sent at
+// once, and credits are still handed back per frame, for low-bandwidth
+// consumers that need what was there rather than where it was each frame.
+
+const (
+	minSummaryWindow = 100 * time.Millisecond
+	maxSummaryWindow = time.Hour
+)
+
+type summaryMsg struct {
+	Frames     int                `json:"frames"`
+	Inferred   int                `json:"inferred"`
+	First      uint64             `json:"first"`
+	Last       uint64             `json:"last"`
+	From       int64              `json:"from"`
+	To         int64              `json:"to"`
+	Detections []summaryDetection `json:"detections"`
+}
+
+type summaryDetection struct {
+	Track uint64 `json:"track"`
+	Seen  int    `json:"seen"`
+	postprocess.Detection
+}
+
+// summary collects one window of a stream's answers; it belongs to the
+// pipeline goroutine.
+type summary struct {
+	msg    summaryMsg
+	from   time.Time
+	to     time.Time
+	tracks map[uint64]*summaryDetection
+}
+
+// add takes the answer a; ids are its detections' track IDs, nil when the
+// tracker did not see them.
+func (sm *summary) add(a *answer, ids []uint64) {
+	if sm.msg.Frames == 0 {
+		sm.msg.First, sm.from = a.seq, a.arrived
+		sm.tracks = map[uint64]*summaryDetection{}
+	}
+	sm.msg.Frames++
+	sm.msg.Last, sm.to = a.seq, a.arrived
+	if ids == nil || len(ids) != len(a.dets) {
+		return
+	}
+	sm.msg.Inferred++
+	for i, d := range a.dets {
+		t := sm.tracks[ids[i]]
+		if t == nil {
+			t = &summaryDetection{Track: ids[i]}
+			sm.tracks[ids[i]] = t
+		}
+		t.Seen++
+		if t.Seen == 1 || d.Score > t.Score {
+			t.Detection = d
+		}
+	}
+}
+
+// take returns the window's summary and starts the next; false when no
+// frame arrived.
+func (sm *summary) take() (summaryMsg, bool) {
+	if sm.msg.Frames == 0 {
+		return summaryMsg{}, false
+	}
+	m := sm.msg
+	m.From, m.To = sm.from.UnixMilli(), sm.to.UnixMilli()
+	m.Detections = make([]summaryDetection, 0, len(sm.tracks))
+	for _, t := range sm.tracks {
+		m.Detections = append(m.Detections, *t)
+	}
+	sort.Slice(m.Detections, func(i, j int) bool { return m.Detections[i].Track < m.Detections[j].Track })
+	*sm = summary{}
+	return m, true
+}
+
+// sendSummary writes the window's summary, if there is one.
+func (p *pipeline) sendSummary() error {
+	m, ok := p.sum.take()
+	if !ok {
+		return nil
+	}
+	return p.WriteJSON(map[string]summaryMsg{"summary": m})
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"yolo-server/internal/inference"
+)
+
+// ── 테넌트 ───────────────────────────────────────────────────────────────────
+// TENANTS_FILE splits one deployment between customers:
+//
+//	{"acme": {"keys": ["acme-ui", "acme-jobs"], "model": "/models/acme.onnx",
+//	          "settings": {"conf_threshold": 0.4, "rate_limit_fps": 10,
+//	                       "frame_quota_monthly": 1000000, "max_connections": 20}}}
+//
+// Each API key name (or "jwt:<sub>") belongs to at most one tenant. A
+// tenant's requests run on its own model, or on MODEL_PATH when it has
+// none, and only ever on that one. "settings" overrides the /admin/config
+// settings for the tenant; what it leaves out follows them. The rate limit
+// and quota are the tenant's own, shared by its keys, and max_connections
+// caps its streams within MAX_CONNECTIONS. Metrics label its clients
+// "tenant/key". Keys outside every tenant are served as before.
+
+// TenantConfig is one entry of TENANTS_FILE.
+type TenantConfig struct {
+	Keys     []string      `json:"keys"`
+	Model    string        `json:"model"` // ONNX file; "" = MODEL_PATH
+	Settings settingsPatch `json:"settings"`
+}
+
+func loadTenants(path string, base liveSettings) (map[string]TenantConfig, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("TENANTS_FILE: %w", err)
+	}
+	var tenants map[string]TenantConfig
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&tenants); err != nil {
+		return nil, fmt.Errorf("TENANTS_FILE: %w", err)
+	}
+	owner := make(map[string]string)
+	for name, t := range tenants {
+		if name == "" {
+			return nil, fmt.Errorf("TENANTS_FILE: empty tenant name")
+		}
+		if len(t.Keys) == 0 {
+			return nil, fmt.Errorf("TENANTS_FILE: tenant %q has no keys", name)
+		}
+		for _, k := range t.Keys {
+			if prev, ok := owner[k]; ok {
+				return nil, fmt.Errorf("TENANTS_FILE: key %q is in tenants %q and %q", k, prev, name)
+			}
+			owner[k] = name
+		}
+		if t.Settings.LogLevel != nil || t.Settings.LogFrames != nil {
+			return nil, fmt.Errorf("TENANTS_FILE: tenant %q: logging is not per tenant", name)
+		}
+		if _, err := t.Settings.apply(base); err != nil {
+			return nil, fmt.Errorf("TENANTS_FILE: tenant %q: %w", name, err)
+		}
+	}
+	return tenants, nil
+}
+
+type tenant struct {
+	name    string
+	cfg     TenantConfig
+	limiter *limiter
+
+	// Set by SetTenantModel; nil det means the server's.
+	det     inference.Detector // standby
+	standby *standby
+	model   inference.ModelInfo
+	version VersionInfo
+}
+
+func (s *Server) initTenants() {
+	s.tenants = make(map[string]*tenant, len(s.cfg.Tenants))
+	s.tenantKeys = make(map[string]*tenant)
+	gauged := false
+	for name, tc := range s.cfg.Tenants {
+		t := &tenant{name: name, cfg: tc, limiter: newLimiter(0, 0, 0)}
+		s.tenants[name] = t
+		for _, k := range tc.Keys {
+			s.tenantKeys[k] = t
+		}
+		if tc.Model != "" && !gauged {
+			gauged = true
+			s.metrics.newGaugeFunc("yolo_model_loaded", "Whether a tenant's model is loaded, by tenant.", "tenant", s.loadedModels)
+		}
+	}
+}
+
+// SetTenantModel installs the detector for a tenant with its own model,
+// which load opens. A model in MODEL_PRELOAD is loaded now (standby.go).
+func (s *Server) SetTenantModel(name string, load ModelLoader, version VersionInfo, model inference.ModelInfo) error {
+	t := s.tenants[name]
+	if t == nil {
+		return fmt.Errorf("unknown tenant %q", name)
+	}
+	sb := &standby{tenant: name, load: load, pinned: s.cfg.ModelPreload == nil || slices.Contains(s.cfg.ModelPreload, name)}
+	if sb.pinned {
+		if err := sb.open(); err != nil {
+			return err
+		}
+	}
+	t.det, t.standby, t.version, t.model = sb, sb, version, model
+	return nil
+}
+
+// tenantOf is the tenant r's credential belongs to, or nil.
+func tenantOf(r *http.Request) *tenant {
+	t, _ := r.Context().Value(ctxTenant).(*tenant)
+	return t
+}
+
+// settingsFor is the live settings with t's overrides applied.
+func (s *Server) settingsFor(t *tenant) *liveSettings {
+	ls := s.settings()
+	if t == nil {
+		return ls
+	}
+	next, err := t.cfg.Settings.apply(*ls)
+	if err != nil { // validated at load; the overrides cannot go bad later
+		return ls
+	}
+	return &next
+}
+
+func (s *Server) detector(t *tenant) inference.Detector {
+	if t == nil || t.det == nil {
+		return s.det
+	}
+	return t.det
+}
+
+func (s *Server) modelName(t *tenant) string {
+	name, _ := s.modelVersion(t)
+	return name
+}
+
+// modelVersion is the model file name and SHA256 frames for t are run with.
+func (s *Server) modelVersion(t *tenant) (name, sha string) {
+	if t == nil || t.det == nil {
+		return filepath.Base(s.cfg.ModelPath), s.versionInfo.ModelSHA256
+	}
+	return filepath.Base(t.version.ModelPath), t.version.ModelSHA256
+}
+
+// limiterFor is the limiter frames from t are charged to, and the bucket
+// id within it.
+func (s *Server) limiterFor(t *tenant, r *http.Request) (*limiter, string) {
+	if t != nil {
+		return t.limiter, t.name
+	}
+	if id := keyName(r); id != "" {
+		return s.limiter, id
+	}
+	return s.limiter, "ip:" + s.clientIP(r)
+}
+
+// tooManyConns applies MAX_CONNECTIONS and t's max_connections.
+func (s *Server) tooManyConns(t *tenant) bool {
+	if limit := s.settings().MaxConnections; limit > 0 && s.conns.count() >= limit {
+		return true
+	}
+	if t == nil {
+		return false
+	}
+	limit := s.settingsFor(t).MaxConnections
+	return limit > 0 && s.conns.countTenant(t.name) >= limit
+}
+
+// tenantSummary is the JSON view served by GET /admin/tenants.
+type tenantSummary struct {
+	Name     string       `json:"name"`
+	Keys     []string     `json:"keys"`
+	Model    string       `json:"model"`
+	Task     string       `json:"task"`
+	SHA256   string       `json:"sha256,omitempty"`
+	Conns    int          `json:"connections"`
+	Settings liveSettings `json:"settings"`
+}
+
+func (s *Server) adminTenants(w http.ResponseWriter, _ *http.Request) {
+	out := make([]tenantSummary, 0, len(s.tenants))
+	for _, t := range s.tenants {
+		model, sha := s.modelVersion(t)
+		info := s.model
+		if t.det != nil {
+			info = t.model
+		}
+		out = append(out, tenantSummary{
+			Name: t.name, Keys: t.cfg.Keys, Model: model, Task: info.Task(), SHA256: sha,
+			Conns:    s.conns.countTenant(t.name),
+			Settings: *s.settingsFor(t),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	writeJSON(w, http.StatusOK, out)
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// ── TLS ──────────────────────────────────────────────────────────────────────
+// The server can terminate TLS itself (and therefore serve wss://) instead
+// of relying on nginx or Cloud Run. Certificates come either from files or
+// from Let's Encrypt via autocert. With TLS on, a plain-HTTP listener
+// redirects to HTTPS and answers ACME http-01 challenges.
+
+// tlsSetup returns the TLS config for the TLS listeners and the handler for
+// the plain-HTTP redirect listener, or (nil, nil) when TLS is off.
+func (cfg Config) tlsSetup() (*tls.Config, http.Handler, error) {
+	switch {
+	case cfg.TLSCertFile != "" || cfg.TLSKeyFile != "":
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("tls keypair: %w", err)
+		}
+		tc := &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			Certificates: []tls.Certificate{cert},
+		}
+		return tc, httpsRedirect(cfg.tlsAddr()), nil
+
+	case len(cfg.AutocertDomains) > 0:
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.AutocertDomains...),
+			Cache:      autocert.DirCache(cfg.AutocertCacheDir),
+		}
+		tc := m.TLSConfig()
+		tc.MinVersion = tls.VersionTLS12
+		return tc, m.HTTPHandler(httpsRedirect(cfg.tlsAddr())), nil
+	}
+	return nil, nil, nil
+}
+
+// httpsRedirect sends every request to the same host and path over HTTPS
+// on the port of tlsAddr.
+func httpsRedirect(tlsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(tlsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
@@ -0,0 +1,21 @@
+package server
+
+import "net/http"
+
+// ── 버전 ─────────────────────────────────────────────────────────────────────
+
+// VersionInfo is served as-is by /version; main fills it at startup.
+type VersionInfo struct {
+	GitCommit     string `json:"git_commit"`
+	BuildDate     string `json:"build_date"`
+	GoVersion     string `json:"go_version"`
+	ORTVersion    string `json:"onnxruntime_version"`
+	GoCVVersion   string `json:"gocv_version"`
+	OpenCVVersion string `json:"opencv_version"`
+	ModelPath     string `json:"model_path"`
+	ModelSHA256   string `json:"model_sha256"`
+}
+
+func (s *Server) version(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.versionInfo)
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"yolo-server/internal/postprocess"
+	"yolo-server/internal/video"
+)
+
+// ── 영상 녹화 ────────────────────────────────────────────────────────────────
+// With VIDEO_DIR set, a stream opened with ?video=1 is also written as MP4
+// with its answers drawn in, to <dir>/<start>-conn<id>-<n>.mp4, starting a
+// new file every VIDEO_SEGMENT or VIDEO_SEGMENT_BYTES. RECORD_DIR keeps
+// sessions for replay; these are for people to watch. GET /admin/videos
+// lists the files; GET and DELETE /admin/videos/{name} fetch or remove one.
+
+// blurRegions are the boxes of dets in BLUR_CLASSES, widened by a tenth on
+// each side so the edges of a face or body are covered too.
+func (s *Server) blurRegions(dets []postprocess.Detection) []image.Rectangle {
+	var out []image.Rectangle
+	for _, d := range dets {
+		if !slices.Contains(s.cfg.BlurClasses, d.Name) {
+			continue
+		}
+		r := image.Rect(d.Box[0], d.Box[1], d.Box[2], d.Box[3])
+		out = append(out, r.Inset(-max(r.Dx(), r.Dy())/10))
+	}
+	return out
+}
+
+func (s *Server) videoConfig() video.Config {
+	return video.Config{
+		FPS:          s.cfg.VideoFPS,
+		Codec:        s.cfg.VideoCodec,
+		Segment:      s.cfg.VideoSegment,
+		SegmentBytes: s.cfg.VideoSegmentBytes,
+	}
+}
+
+// newVideoRecorder starts the stream's video, or returns nil without
+// ?video=1.
+func (s *Server) newVideoRecorder(ci *connInfo, st *streamState) *video.Recorder {
+	if !st.video || s.cfg.VideoDir == "" {
+		return nil
+	}
+	prefix := fmt.Sprintf("%s-conn%d", ci.started.UTC().Format("20060102T150405Z"), ci.id)
+	return video.Start(s.videoConfig(), filepath.Join(s.cfg.VideoDir, prefix))
+}
+
+type videoFile struct {
+	Name     string    `json:"name"`
+	Bytes    int64     `json:"bytes"`
+	Modified time.Time `json:"modified"`
+}
+
+func (s *Server) adminVideos(w http.ResponseWriter, _ *http.Request) {
+	files := []videoFile{}
+	if s.cfg.VideoDir != "" {
+		entries, err := os.ReadDir(s.cfg.VideoDir)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		for _, e := range entries {
+			info, err := e.Info()
+			if err != nil || !info.Mode().IsRegular() || !strings.HasSuffix(e.Name(), ".mp4") {
+				continue
+			}
+			files = append(files, videoFile{Name: e.Name(), Bytes: info.Size(), Modified: info.ModTime()})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	writeJSON(w, http.StatusOK, map[string]any{"videos": files})
+}
+
+// videoPath is the file {name} refers to; names never leave VIDEO_DIR.
+func (s *Server) videoPath(w http.ResponseWriter, r *http.Request) (string, bool) {
+	name := r.PathValue("name")
+	if s.cfg.VideoDir == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".mp4") {
+		writeJSONError(w, http.StatusNotFound, "no such video")
+		return "", false
+	}
+	return filepath.Join(s.cfg.VideoDir, name), true
+}
+
+func (s *Server) adminGetVideo(w http.ResponseWriter, r *http.Request) {
+	path, ok := s.videoPath(w, r)
+	if !ok {
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "no such video")
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "video/mp4")
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+func (s *Server) adminDeleteVideo(w http.ResponseWriter, r *http.Request) {
+	path, ok := s.videoPath(w, r)
+	if !ok {
+		return
+	}
+	if err := os.Remove(path); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			writeJSONError(w, http.StatusNotFound, "no such video")
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,258 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"yolo-server/internal/video"
+)
+
+// ── 다중 카메라 융합 ─────────────────────────────────────────────────────────
+// The detections of every calibrated stream's inferred frames stand on a
+// common ground plane (calibration.go). Each client's streams make up one
+// world: detections of one class from different streams that land
+// within WORLD_MERGE_RADIUS metres of each other are one object, seen
+// twice. A stream counts until its newest frame is WORLD_WINDOW old or it
+// ends. GET /world is the caller's world now, and GET /ws/world pushes it
+// after every frame that changes it.
+
+// worldSubQueue is how many views a slow /ws/world client may fall behind
+// before views are skipped.
+const worldSubQueue = 4
+
+type worldView struct {
+	Time    time.Time     `json:"time"`
+	Objects []worldObject `json:"objects"`
+}
+
+type worldObject struct {
+	Class     string          `json:"class"`
+	X         float64         `json:"x"` // metres on the ground plane
+	Y         float64         `json:"y"`
+	Score     float64         `json:"score"` // the best sighting's
+	Sightings []worldSighting `json:"sightings"`
+}
+
+type worldSighting struct {
+	Stream string  `json:"stream"`
+	Box    [4]int  `json:"box"`
+	Score  float64 `json:"score"`
+	x, y   float64
+	class  string
+}
+
+type world struct {
+	radius float64
+	window time.Duration
+
+	mu      sync.Mutex
+	clients map[string]*worldClient
+}
+
+type worldClient struct {
+	frames map[string]worldFrame // newest sightings by stream id
+	subs   map[chan []byte]struct{}
+}
+
+type worldFrame struct {
+	at        time.Time
+	sightings []worldSighting
+}
+
+func newWorld(cfg Config) *world {
+	return &world{radius: cfg.WorldMergeRadius, window: cfg.WorldWindow, clients: map[string]*worldClient{}}
+}
+
+// client returns the world of client, creating it. w.mu is held.
+func (w *world) client(client string) *worldClient {
+	wc := w.clients[client]
+	if wc == nil {
+		wc = &worldClient{frames: map[string]worldFrame{}, subs: map[chan []byte]struct{}{}}
+		w.clients[client] = wc
+	}
+	return wc
+}
+
+// set replaces stream's sightings, nil when it ended, and pushes the new
+// view to client's subscribers.
+func (w *world) set(client, stream string, f *worldFrame) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	wc := w.client(client)
+	if f == nil {
+		delete(wc.frames, stream)
+	} else {
+		wc.frames[stream] = *f
+	}
+	if len(wc.subs) > 0 {
+		b, _ := json.Marshal(w.view(wc, time.Now()))
+		for ch := range wc.subs {
+			select {
+			case ch <- b:
+			default: // behind; it gets the next one
+			}
+		}
+	}
+	if len(wc.frames) == 0 && len(wc.subs) == 0 {
+		delete(w.clients, client)
+	}
+}
+
+// view fuses wc's current sightings. w.mu is held.
+func (w *world) view(wc *worldClient, now time.Time) worldView {
+	var all []worldSighting
+	for _, f := range wc.frames {
+		if now.Sub(f.at) <= w.window {
+			all = append(all, f.sightings...)
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Score > all[j].Score })
+	objects := []worldObject{}
+	var weights []float64
+	for _, s := range all {
+		best, bestDist := -1, w.radius
+		for i, o := range objects {
+			if o.Class != s.class || seenBy(o, s.Stream) {
+				continue
+			}
+			if d := math.Hypot(o.X-s.x, o.Y-s.y); d <= bestDist {
+				best, bestDist = i, d
+			}
+		}
+		if best < 0 {
+			objects = append(objects, worldObject{Class: s.class, X: s.x, Y: s.y, Score: s.Score, Sightings: []worldSighting{s}})
+			weights = append(weights, s.Score)
+			continue
+		}
+		// The position is the score-weighted mean of the sightings.
+		o, wt := &objects[best], weights[best]
+		o.X = (o.X*wt + s.x*s.Score) / (wt + s.Score)
+		o.Y = (o.Y*wt + s.y*s.Score) / (wt + s.Score)
+		o.Sightings = append(o.Sightings, s)
+		weights[best] += s.Score
+	}
+	for i := range objects {
+		objects[i].X = math.Round(objects[i].X*100) / 100
+		objects[i].Y = math.Round(objects[i].Y*100) / 100
+	}
+	return worldView{Time: now, Objects: objects}
+}
+
+// seenBy reports whether o already has a sighting from stream; one camera
+// does not see one object twice.
+func seenBy(o worldObject, stream string) bool {
+	for _, s := range o.Sightings {
+		if s.Stream == stream {
+			return true
+		}
+	}
+	return false
+}
+
+// worldWatch feeds one named stream into its client's world while the
+// stream is calibrated.
+type worldWatch struct {
+	w              *world
+	cs             *calibrationStore
+	client, stream string
+	fed            bool // the world has frames of the stream
+}
+
+func (s *Server) newWorldWatch(r *http.Request, st *streamState) *worldWatch {
+	if st.id == "" {
+		return nil
+	}
+	return &worldWatch{w: s.world, cs: s.calibration, client: clientLabel(r), stream: st.id}
+}
+
+func (ww *worldWatch) observe(f video.Frame, inferred bool) {
+	if ww == nil || !inferred {
+		return
+	}
+	if ww.cs.lookup(ww.client, ww.stream) == nil {
+		ww.close()
+		return
+	}
+	wf := &worldFrame{at: f.At, sightings: make([]worldSighting, 0, len(f.Dets))}
+	for _, d := range f.Dets {
+		if d.Attributes != nil && d.Attributes.Ground != nil {
+			g := d.Attributes.Ground
+			wf.sightings = append(wf.sightings, worldSighting{Stream: ww.stream, Box: d.Box, Score: d.Score, x: g[0], y: g[1], class: d.Name})
+		}
+	}
+	ww.w.set(ww.client, ww.stream, wf)
+	ww.fed = true
+}
+
+func (ww *worldWatch) close() {
+	if ww != nil && ww.fed {
+		ww.w.set(ww.client, ww.stream, nil)
+		ww.fed = false
+	}
+}
+
+// ── API ──────────────────────────────────────────────────────────────────────
+
+func (s *Server) getWorld(w http.ResponseWriter, r *http.Request) {
+	s.world.mu.Lock()
+	wc := s.world.clients[clientLabel(r)]
+	if wc == nil {
+		wc = &worldClient{}
+	}
+	v := s.world.view(wc, time.Now())
+	s.world.mu.Unlock()
+	writeJSON(w, http.StatusOK, v)
+}
+
+// wsWorld pushes the caller's world until the client leaves.
+func (s *Server) wsWorld(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.Error("ws upgrade", "err", err)
+		return
+	}
+	defer conn.Close()
+	client := clientLabel(r)
+	ch := make(chan []byte, worldSubQueue)
+	s.world.mu.Lock()
+	wc := s.world.client(client)
+	wc.subs[ch] = struct{}{}
+	first, _ := json.Marshal(s.world.view(wc, time.Now()))
+	s.world.mu.Unlock()
+	defer func() {
+		s.world.mu.Lock()
+		delete(wc.subs, ch)
+		if len(wc.frames) == 0 && len(wc.subs) == 0 {
+			delete(s.world.clients, client)
+		}
+		s.world.mu.Unlock()
+	}()
+
+	// Reading is only for noticing the client leave.
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	for b := first; ; {
+		if err := conn.WriteMessage(websocket.TextMessage, b); err != nil {
+			return
+		}
+		select {
+		case b = <-ch:
+		case <-gone:
+			return
+		}
+	}
+}
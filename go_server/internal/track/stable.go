@@ -0,0 +1,134 @@
+package track
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+
+	"yolo-server/internal/postprocess"
+)
+
+// ── 안정화 ───────────────────────────────────────────────────────────────────
+// A Stabilizer holds back objects the model only glimpses. It follows the
+// boxes of every inferred frame like the Tracker, by label and IoU, but
+// remembers which of the last N frames each object was seen in, and keeps
+// an unseen object for as long as that window has hits. An object is
+// reported while it was seen in at least K of the last N frames: a box
+// that flickers in for one frame never is, and one that was reported
+// stays, at its last box, through an occlusion shorter than N-K frames.
+
+// MaxStableWindow is the largest N.
+const MaxStableWindow = 64
+
+// Stabilizer belongs to one stream; it is not safe for concurrent use.
+type Stabilizer struct {
+	k, n     int
+	objects  []stableObject
+	reported map[uint64]bool // Tracker IDs of the last Filter's seen, reported boxes
+}
+
+type stableObject struct {
+	det  postprocess.Detection
+	id   uint64 // Tracker ID when last seen
+	hits uint64 // bit i: seen i frames ago
+}
+
+// ParseStable parses "K/N"; "" or "off" is nil.
+func ParseStable(v string) (*Stabilizer, error) {
+	if v == "" || v == "off" {
+		return nil, nil
+	}
+	ks, ns, ok := strings.Cut(v, "/")
+	k, kerr := strconv.Atoi(ks)
+	n, nerr := strconv.Atoi(ns)
+	if !ok || kerr != nil || nerr != nil || k < 1 || k > n || n > MaxStableWindow {
+		return nil, fmt.Errorf("stable: want K/N with 1 <= K <= N <= %d, got %q", MaxStableWindow, v)
+	}
+	return &Stabilizer{k: k, n: n}, nil
+}
+
+// String is the stabilizer's "K/N".
+func (sb *Stabilizer) String() string { return fmt.Sprintf("%d/%d", sb.k, sb.n) }
+
+// Filter takes an inferred frame's detections and their Tracker IDs and
+// returns those to report, followed by the reported objects not seen in
+// it, with their IDs.
+func (sb *Stabilizer) Filter(dets []postprocess.Detection, ids []uint64) ([]postprocess.Detection, []uint64) {
+	window := uint64(1)<<sb.n - 1
+	if sb.n == MaxStableWindow {
+		window = ^uint64(0)
+	}
+	for i := range sb.objects {
+		sb.objects[i].hits = sb.objects[i].hits << 1 & window
+	}
+	used := make([]bool, len(sb.objects))
+	seen := make([]int, len(dets)) // index into sb.objects
+	for i, d := range dets {
+		best, bestIoU := -1, minIoU
+		for j, o := range sb.objects {
+			if used[j] || o.det.Label != d.Label {
+				continue
+			}
+			if v := postprocess.IoU(o.det.Box, d.Box); v >= bestIoU {
+				best, bestIoU = j, v
+			}
+		}
+		if best < 0 {
+			best = len(sb.objects)
+			sb.objects = append(sb.objects, stableObject{})
+			used = append(used, false)
+		}
+		used[best] = true
+		o := &sb.objects[best]
+		o.det, o.hits = d, o.hits|1
+		if i < len(ids) {
+			o.id = ids[i]
+		}
+		seen[i] = best
+	}
+
+	var out []postprocess.Detection
+	var outIDs []uint64
+	sb.reported = map[uint64]bool{}
+	for i, d := range dets {
+		if o := sb.objects[seen[i]]; sb.confirmed(o) {
+			out, outIDs = append(out, d), append(outIDs, o.id)
+			sb.reported[o.id] = true
+		}
+	}
+	keep := sb.objects[:0]
+	for j, o := range sb.objects {
+		if o.hits == 0 {
+			continue
+		}
+		if !used[j] && sb.confirmed(o) {
+			out, outIDs = append(out, o.det), append(outIDs, o.id)
+		}
+		keep = append(keep, o)
+	}
+	sb.objects = keep
+	return out, outIDs
+}
+
+func (sb *Stabilizer) confirmed(o stableObject) bool {
+	return bits.OnesCount64(o.hits) >= sb.k
+}
+
+// Hold filters the Tracker's prediction for a skipped frame, whose boxes
+// have the Tracker IDs ids, like the last Filter: boxes it did not report
+// are dropped and the reported unseen objects are added.
+func (sb *Stabilizer) Hold(pred []postprocess.Detection, ids []uint64) []postprocess.Detection {
+	var out []postprocess.Detection
+	for i, d := range pred {
+		if i < len(ids) && sb.reported[ids[i]] {
+			out = append(out, d)
+		}
+	}
+	for _, o := range sb.objects {
+		if o.hits&1 == 0 && sb.confirmed(o) {
+			out = append(out, o.det)
+		}
+	}
+	return out
+}
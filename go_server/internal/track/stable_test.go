@@ -0,0 +1,82 @@
+package track
+
+import (
+	"testing"
+
+	"yolo-server/internal/postprocess"
+)
+
+func TestParseStable(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string // "" = nil
+		wantErr bool
+	}{
+		{"", "", false},
+		{"off", "", false},
+		{"3/5", "3/5", false},
+		{"1/1", "1/1", false},
+		{"64/64", "64/64", false},
+		{"0/5", "", true},
+		{"6/5", "", true},
+		{"1/65", "", true},
+		{"3", "", true},
+		{"a/b", "", true},
+	}
+	for _, tt := range tests {
+		sb, err := ParseStable(tt.in)
+		switch {
+		case tt.wantErr:
+			if err == nil {
+				t.Errorf("ParseStable(%q) succeeded, want an error", tt.in)
+			}
+		case err != nil:
+			t.Errorf("ParseStable(%q): %v", tt.in, err)
+		case tt.want == "" && sb != nil, tt.want != "" && (sb == nil || sb.String() != tt.want):
+			t.Errorf("ParseStable(%q) = %v, want %q", tt.in, sb, tt.want)
+		}
+	}
+}
+
+func TestStabilizer(t *testing.T) {
+	sb, err := ParseStable("2/3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	car := det(2, 0, 0, 100, 100)
+	glimpse := det(0, 500, 500, 550, 550)
+	frames := []struct {
+		dets []postprocess.Detection
+		want int // detections reported
+	}{
+		{[]postprocess.Detection{car, glimpse}, 0}, // seen once each
+		{[]postprocess.Detection{car}, 1},          // car 2 of 3
+		{nil, 1},                                   // car held: still 2 of 3
+		{nil, 0},                                   // car 1 of 3: dropped
+		{[]postprocess.Detection{car}, 0},          // starts over
+	}
+	for i, f := range frames {
+		ids := make([]uint64, len(f.dets))
+		for j := range ids {
+			ids[j] = uint64(f.dets[j].Label + 1)
+		}
+		out, outIDs := sb.Filter(f.dets, ids)
+		if len(out) != f.want || len(outIDs) != len(out) {
+			t.Errorf("frame %d: reported %v (IDs %v), want %d", i, out, outIDs, f.want)
+		}
+	}
+}
+
+func TestStabilizerHold(t *testing.T) {
+	sb, _ := ParseStable("1/2")
+	a, b := det(0, 0, 0, 100, 100), det(1, 300, 0, 400, 100)
+	sb.Filter([]postprocess.Detection{a, b}, []uint64{1, 2})
+	sb.Filter([]postprocess.Detection{a}, []uint64{1}) // b unseen but held
+
+	// The prediction has a (reported) and an unknown track 9.
+	pred := []postprocess.Detection{a, det(5, 0, 0, 5, 5)}
+	out := sb.Hold(pred, []uint64{1, 9})
+	if len(out) != 2 || out[0].Label != 0 || out[1].Label != 1 {
+		t.Errorf("Hold = %v, want a then the held b", out)
+	}
+}
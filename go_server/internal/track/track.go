@@ -0,0 +1,172 @@
+// Package track follows detections across the inferred frames of one
+// stream so results for frames in between can be extrapolated.
+package track
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+
+	"yolo-server/internal/postprocess"
+)
+
+// ── 추적 ─────────────────────────────────────────────────────────────────────
+// Each detection of an update is matched to the previous update's box of the
+// same label with the highest IoU (greedy, in detection order). A match carries
+// the track's velocity forward, smoothed so one jittery box does not fling
+// the prediction; an unmatched detection starts at rest. Tracks that are not
+// seen in an update are dropped, so predictions only ever move boxes the
+// model currently reports. Motion reports the velocities, so clients can be
+// told which way things travel, and IDs numbers the tracks, from 1, so
+// results can be told apart per object.
+
+const (
+	minIoU      = 0.3                    // below this two boxes are different objects
+	velAlpha    = 0.5                    // EWMA weight of the newest velocity sample
+	maxHorizon  = 500 * time.Millisecond // predictions freeze this long after an update
+	maxVelocity = 10000                  // px/s per coordinate; larger is a bad match
+)
+
+type object struct {
+	det     postprocess.Detection
+	box     [4]float64 // unrounded, so slow motion is not lost to integer boxes
+	vel     [4]float64 // px/s per coordinate
+	matched bool       // vel is measured, not the rest a new track starts at
+	id      uint64
+}
+
+// Tracker belongs to one stream; it is not safe for concurrent use.
+type Tracker struct {
+	objects []object
+	at      time.Time // time of the last Update
+	lastID  uint64
+}
+
+// Update replaces the tracked set with dets, observed at t.
+func (tr *Tracker) Update(dets []postprocess.Detection, t time.Time) {
+	dt := t.Sub(tr.at).Seconds()
+	used := make([]bool, len(tr.objects))
+	next := make([]object, 0, len(dets))
+	for _, d := range dets {
+		o := object{det: d}
+		for i, c := range d.Box {
+			o.box[i] = float64(c)
+		}
+		best, bestIoU := -1, minIoU
+		for i, prev := range tr.objects {
+			if used[i] || prev.det.Label != d.Label {
+				continue
+			}
+			if v := postprocess.IoU(prev.det.Box, d.Box); v >= bestIoU {
+				best, bestIoU = i, v
+			}
+		}
+		if best >= 0 {
+			used[best] = true
+			o.id = tr.objects[best].id
+		} else {
+			tr.lastID++
+			o.id = tr.lastID
+		}
+		if best >= 0 && dt > 0 {
+			o.matched = true
+			prev := tr.objects[best]
+			for i := range o.vel {
+				v := (o.box[i] - prev.box[i]) / dt
+				v = math.Max(-maxVelocity, math.Min(maxVelocity, v))
+				o.vel[i] = prev.vel[i] + velAlpha*(v-prev.vel[i])
+			}
+		}
+		next = append(next, o)
+	}
+	tr.objects, tr.at = next, t
+}
+
+// Predict returns the tracked detections moved to where their velocity puts
+// them at t. Before the first Update it returns nil.
+func (tr *Tracker) Predict(t time.Time) []postprocess.Detection {
+	if tr.objects == nil {
+		return nil
+	}
+	dt := min(max(t.Sub(tr.at), 0), maxHorizon).Seconds()
+	out := make([]postprocess.Detection, len(tr.objects))
+	for i, o := range tr.objects {
+		d := o.det
+		for j := range d.Box {
+			d.Box[j] = max(int(math.Round(o.box[j]+o.vel[j]*dt)), 0)
+		}
+		if d.Box[2] <= d.Box[0] || d.Box[3] <= d.Box[1] {
+			d.Box = o.det.Box // collapsed; keep the last seen box
+		}
+		out[i] = d
+	}
+	return out
+}
+
+// Motion returns the velocity of each tracked box centre, in the order of
+// the last Update's detections, which is also Predict's.
+func (tr *Tracker) Motion() []Velocity {
+	out := make([]Velocity, len(tr.objects))
+	for i, o := range tr.objects {
+		out[i] = Velocity{
+			X:  (o.vel[0] + o.vel[2]) / 2,
+			Y:  (o.vel[1] + o.vel[3]) / 2,
+			OK: o.matched,
+		}
+	}
+	return out
+}
+
+// IDs returns the track ID of each tracked box, in the order of the last
+// Update's detections. A box keeps its ID for as long as it is matched.
+func (tr *Tracker) IDs() []uint64 {
+	out := make([]uint64, len(tr.objects))
+	for i, o := range tr.objects {
+		out[i] = o.id
+	}
+	return out
+}
+
+// Velocity is a box centre's motion in px/s. OK is false for a track seen
+// once, whose velocity is not known yet.
+type Velocity struct {
+	X, Y float64
+	OK   bool
+}
+
+// state is the JSON form of a Tracker, so a stream's tracks can follow it
+// to another replica.
+type state struct {
+	At      time.Time     `json:"at"`
+	Objects []objectState `json:"objects"`
+	LastID  uint64        `json:"last_id,omitempty"`
+}
+
+type objectState struct {
+	Det     postprocess.Detection `json:"det"`
+	Box     [4]float64            `json:"box"`
+	Vel     [4]float64            `json:"vel"`
+	Matched bool                  `json:"matched,omitempty"`
+	ID      uint64                `json:"id,omitempty"`
+}
+
+func (tr *Tracker) MarshalJSON() ([]byte, error) {
+	st := state{At: tr.at, Objects: make([]objectState, len(tr.objects)), LastID: tr.lastID}
+	for i, o := range tr.objects {
+		st.Objects[i] = objectState{Det: o.det, Box: o.box, Vel: o.vel, Matched: o.matched, ID: o.id}
+	}
+	return json.Marshal(st)
+}
+
+func (tr *Tracker) UnmarshalJSON(b []byte) error {
+	var st state
+	if err := json.Unmarshal(b, &st); err != nil {
+		return err
+	}
+	objects := make([]object, len(st.Objects))
+	for i, o := range st.Objects {
+		objects[i] = object{det: o.Det, box: o.Box, vel: o.Vel, matched: o.Matched, id: o.ID}
+	}
+	tr.objects, tr.at, tr.lastID = objects, st.At, st.LastID
+	return nil
+}
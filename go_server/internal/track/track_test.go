@@ -0,0 +1,103 @@
+package track
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"yolo-server/internal/postprocess"
+)
+
+func det(label int, x1, y1, x2, y2 int) postprocess.Detection {
+	return postprocess.Detection{Box: [4]int{x1, y1, x2, y2}, Score: 0.9, Label: label}
+}
+
+func TestTrackerIDs(t *testing.T) {
+	var tr Tracker
+	t0 := time.Unix(1000, 0)
+	tr.Update([]postprocess.Detection{det(0, 0, 0, 100, 100), det(1, 200, 0, 300, 100)}, t0)
+	if got := tr.IDs(); !reflect.DeepEqual(got, []uint64{1, 2}) {
+		t.Fatalf("IDs = %v, want [1 2]", got)
+	}
+
+	tests := []struct {
+		name string
+		dets []postprocess.Detection
+		want []uint64
+	}{
+		{"moved a little keeps IDs, in the new order",
+			[]postprocess.Detection{det(1, 205, 0, 305, 100), det(0, 5, 0, 105, 100)}, []uint64{2, 1}},
+		{"other label at the same place is new",
+			[]postprocess.Detection{det(2, 5, 0, 105, 100)}, []uint64{3}},
+		{"dropped track does not come back",
+			[]postprocess.Detection{det(0, 5, 0, 105, 100)}, []uint64{4}},
+		{"far jump is a new object",
+			[]postprocess.Detection{det(0, 500, 500, 600, 600)}, []uint64{5}},
+	}
+	for i, tt := range tests {
+		tr.Update(tt.dets, t0.Add(time.Duration(i+1)*100*time.Millisecond))
+		if got := tr.IDs(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: IDs = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTrackerPredict(t *testing.T) {
+	var tr Tracker
+	t0 := time.Unix(1000, 0)
+	if tr.Predict(t0) != nil {
+		t.Fatal("Predict before Update is not nil")
+	}
+	tr.Update([]postprocess.Detection{det(0, 100, 100, 200, 200)}, t0)
+	if v := tr.Motion(); len(v) != 1 || v[0].OK {
+		t.Fatalf("Motion of a new track = %v, want not OK", v)
+	}
+	// 10 px right in 100 ms: 100 px/s, halved by the smoothing.
+	tr.Update([]postprocess.Detection{det(0, 110, 100, 210, 200)}, t0.Add(100*time.Millisecond))
+	v := tr.Motion()
+	if len(v) != 1 || !v[0].OK || v[0].X != 50 || v[0].Y != 0 {
+		t.Fatalf("Motion = %+v, want {50 0 true}", v)
+	}
+
+	tests := []struct {
+		after time.Duration
+		want  [4]int
+	}{
+		{0, [4]int{110, 100, 210, 200}},
+		{200 * time.Millisecond, [4]int{120, 100, 220, 200}},
+		{-time.Second, [4]int{110, 100, 210, 200}},     // no going back
+		{10 * time.Second, [4]int{135, 100, 235, 200}}, // frozen at maxHorizon
+	}
+	for _, tt := range tests {
+		got := tr.Predict(t0.Add(100*time.Millisecond + tt.after))
+		if len(got) != 1 || got[0].Box != tt.want {
+			t.Errorf("Predict(+%v) = %v, want box %v", tt.after, got, tt.want)
+		}
+	}
+}
+
+func TestTrackerJSON(t *testing.T) {
+	var tr Tracker
+	t0 := time.Unix(1000, 0).UTC()
+	tr.Update([]postprocess.Detection{det(0, 100, 100, 200, 200)}, t0)
+	tr.Update([]postprocess.Detection{det(0, 110, 100, 210, 200), det(3, 0, 0, 10, 10)}, t0.Add(100*time.Millisecond))
+	b, err := json.Marshal(&tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back Tracker
+	if err := json.Unmarshal(b, &back); err != nil {
+		t.Fatal(err)
+	}
+	at := t0.Add(300 * time.Millisecond)
+	if !reflect.DeepEqual(back.Predict(at), tr.Predict(at)) || !reflect.DeepEqual(back.IDs(), tr.IDs()) ||
+		!reflect.DeepEqual(back.Motion(), tr.Motion()) {
+		t.Errorf("tracker changed in a JSON round trip:\n%s", b)
+	}
+	// New tracks continue the numbering.
+	back.Update([]postprocess.Detection{det(5, 900, 900, 950, 950)}, at)
+	if got := back.IDs(); !reflect.DeepEqual(got, []uint64{3}) {
+		t.Errorf("IDs after restore = %v, want [3]", got)
+	}
+}
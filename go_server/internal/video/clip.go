@@ -0,0 +1,64 @@
+package video
+
+import (
+	"errors"
+	"time"
+)
+
+// ── 이벤트 클립 ──────────────────────────────────────────────────────────────
+// A clip is a short file around an event. A stream keeps its last seconds
+// in a Buffer, so the clip can start before the event, collects the frames
+// after it the same way, and encodes them all at once with WriteClip.
+
+// Buffer holds a stream's frames of the last span, thinned to one per
+// frame of FPS. It is not safe for concurrent use.
+type Buffer struct {
+	span   time.Duration
+	every  time.Duration
+	frames []Frame
+	bytes  int64 // encoded image bytes held
+}
+
+// NewBuffer keeps span worth of frames at fps.
+func NewBuffer(span time.Duration, fps float64) *Buffer {
+	return &Buffer{span: span, every: time.Duration(float64(time.Second) / fps)}
+}
+
+// Add keeps f, unless it follows the last frame by less than a frame, and
+// lets go of frames older than span before it.
+func (b *Buffer) Add(f Frame) {
+	if n := len(b.frames); n > 0 && f.At.Sub(b.frames[n-1].At) < b.every {
+		return
+	}
+	cutoff := f.At.Add(-b.span)
+	i := 0
+	for i < len(b.frames) && b.frames[i].At.Before(cutoff) {
+		b.bytes -= int64(len(b.frames[i].Data))
+		i++
+	}
+	b.frames = append(b.frames[:copy(b.frames, b.frames[i:])], f)
+	b.bytes += int64(len(f.Data))
+}
+
+// Bytes is the size of the encoded images held.
+func (b *Buffer) Bytes() int64 { return b.bytes }
+
+// Frames returns the kept frames, oldest first.
+func (b *Buffer) Frames() []Frame {
+	return append([]Frame(nil), b.frames...)
+}
+
+// WriteClip encodes frames to one file at path and waits until it is
+// written.
+func WriteClip(cfg Config, path string, frames []Frame) error {
+	if len(frames) == 0 {
+		return errors.New("video: no frames")
+	}
+	cfg.Segment, cfg.SegmentBytes = 0, 0
+	r := start(cfg, func() string { return path }, nil)
+	for _, f := range frames {
+		r.frames <- f
+	}
+	r.Close()
+	return r.err
+}
@@ -0,0 +1,115 @@
+//go:build !nocv
+
+package video
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+
+	"gocv.io/x/gocv"
+
+	"yolo-server/internal/preprocess"
+)
+
+// Supported reports whether this build can encode video.
+const Supported = true
+
+var boxColor = color.RGBA{0, 255, 0, 0}
+
+// encoder writes one file. The writer is opened with the first frame,
+// whose size every later frame is scaled to.
+type encoder struct {
+	path  string
+	codec string
+	fps   float64
+
+	vw    *gocv.VideoWriter
+	size  image.Point
+	img   gocv.Mat // decoded and drawn on
+	fixed gocv.Mat // img at the file's size; the frame written last
+	ready bool     // fixed holds a frame
+}
+
+func openEncoder(path, codec string, fps float64) (*encoder, error) {
+	return &encoder{path: path, codec: codec, fps: fps, img: gocv.NewMat(), fixed: gocv.NewMat()}, nil
+}
+
+// write redacts the frame, draws its detections and appends it. Stream
+// boxes are in the frame's stored orientation, so EXIF is ignored here too.
+func (e *encoder) write(f Frame) error {
+	if err := preprocess.Decode(f.Data, &e.img, gocv.IMReadColor|gocv.IMReadIgnoreOrientation); err != nil {
+		return e.repeat(1) // the client was told; the video holds the last frame
+	}
+	bounds := image.Rect(0, 0, e.img.Cols(), e.img.Rows())
+	for _, r := range f.Blur {
+		e.pixelate(r.Intersect(bounds))
+	}
+	for _, z := range f.Mask {
+		gocv.Rectangle(&e.img, z, color.RGBA{}, -1)
+	}
+	for _, d := range f.Dets {
+		r := image.Rect(d.Box[0], d.Box[1], d.Box[2], d.Box[3])
+		gocv.Rectangle(&e.img, r, boxColor, 2)
+		gocv.PutText(&e.img, fmt.Sprintf("%s %.2f", d.Name, d.Score), image.Pt(r.Min.X, r.Min.Y-4),
+			gocv.FontHersheySimplex, 0.5, boxColor, 1)
+	}
+	if e.vw == nil {
+		e.size = image.Pt(e.img.Cols(), e.img.Rows())
+		vw, err := gocv.VideoWriterFile(e.path, e.codec, e.fps, e.size.X, e.size.Y, true)
+		if err != nil {
+			return err
+		}
+		if !vw.IsOpened() {
+			vw.Close()
+			return fmt.Errorf("video: cannot open %s with codec %q", e.path, e.codec)
+		}
+		e.vw = vw
+	}
+	// Copied even at the same size, so a later frame that fails to decode
+	// leaves the last one intact.
+	if e.img.Cols() != e.size.X || e.img.Rows() != e.size.Y {
+		gocv.Resize(e.img, &e.fixed, e.size, 0, 0, gocv.InterpolationLinear)
+	} else {
+		e.img.CopyTo(&e.fixed)
+	}
+	e.ready = true
+	return e.vw.Write(e.fixed)
+}
+
+// pixelate shrinks r of the frame to preprocess.PixelCells cells across
+// and blows it up again, as preprocess.Redact does for images.
+func (e *encoder) pixelate(r image.Rectangle) {
+	if r.Empty() {
+		return
+	}
+	n := preprocess.PixelSize(r)
+	region := e.img.Region(r)
+	defer region.Close()
+	small := gocv.NewMat()
+	defer small.Close()
+	gocv.Resize(region, &small, image.Pt((r.Dx()+n-1)/n, (r.Dy()+n-1)/n), 0, 0, gocv.InterpolationArea)
+	gocv.Resize(small, &region, r.Size(), 0, 0, gocv.InterpolationNearestNeighbor)
+}
+
+// repeat appends the last frame n more times.
+func (e *encoder) repeat(n int) error {
+	if !e.ready {
+		return nil
+	}
+	for i := 0; i < n; i++ {
+		if err := e.vw.Write(e.fixed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *encoder) close() error {
+	e.img.Close()
+	e.fixed.Close()
+	if e.vw == nil {
+		return nil
+	}
+	return e.vw.Close()
+}
@@ -0,0 +1,20 @@
+//go:build nocv
+
+package video
+
+import "errors"
+
+// Supported reports whether this build can encode video.
+const Supported = false
+
+type encoder struct{}
+
+func openEncoder(path, codec string, fps float64) (*encoder, error) {
+	return nil, errors.New("video: not supported in a nocv build")
+}
+
+func (e *encoder) write(f Frame) error { return nil }
+
+func (e *encoder) repeat(n int) error { return nil }
+
+func (e *encoder) close() error { return nil }
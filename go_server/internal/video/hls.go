@@ -0,0 +1,123 @@
+package video
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ── HLS ──────────────────────────────────────────────────────────────────────
+// A Playlist is a live HLS media playlist, index.m3u8, over transport
+// stream segments in one directory. It lists the newest keep segments and
+// deletes older ones. Recorders started on it in turn continue the same
+// playlist, with a discontinuity where one ends and the next begins, so a
+// player survives its source reconnecting. End closes the playlist for
+// good. The segments are H.264 only where OpenCV's FFmpeg has an encoder
+// for Config.Codec; most players need "avc1".
+
+// PlaylistName is the playlist's file name within its directory.
+const PlaylistName = "index.m3u8"
+
+type segment struct {
+	name          string
+	dur           time.Duration
+	discontinuity bool
+}
+
+type Playlist struct {
+	dir    string
+	target time.Duration
+	keep   int
+
+	mu      sync.Mutex
+	segs    []segment
+	seq     int  // media sequence of segs[0]
+	disc    int  // discontinuities before segs[0]
+	n       int  // segments named so far
+	broken  bool // the next segment follows a discontinuity
+	started bool // a recorder has been started
+}
+
+// NewPlaylist starts an empty playlist in dir, removing whatever was
+// there. target is the longest segment.
+func NewPlaylist(dir string, target time.Duration, keep int) (*Playlist, error) {
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Playlist{dir: dir, target: target, keep: max(keep, 1)}, nil
+}
+
+// Dir is the playlist's directory.
+func (pl *Playlist) Dir() string { return pl.dir }
+
+// StartHLS records into pl. cfg.Segment must be pl's target duration.
+func StartHLS(cfg Config, pl *Playlist) *Recorder {
+	pl.mu.Lock()
+	pl.broken = pl.started
+	pl.started = true
+	pl.mu.Unlock()
+	return start(cfg, pl.nextSegment, pl.add)
+}
+
+func (pl *Playlist) nextSegment() string {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	pl.n++
+	return filepath.Join(pl.dir, fmt.Sprintf("seg-%d.ts", pl.n))
+}
+
+func (pl *Playlist) add(path string, dur time.Duration) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	pl.segs = append(pl.segs, segment{name: filepath.Base(path), dur: dur, discontinuity: pl.broken})
+	pl.broken = false
+	for len(pl.segs) > pl.keep {
+		_ = os.Remove(filepath.Join(pl.dir, pl.segs[0].name))
+		if pl.segs[0].discontinuity {
+			pl.disc++
+		}
+		pl.segs = pl.segs[1:]
+		pl.seq++
+	}
+	pl.write(false)
+}
+
+// End marks the playlist complete; players stop at its last segment.
+func (pl *Playlist) End() {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	pl.write(true)
+}
+
+// write replaces index.m3u8, through a rename so readers never see half
+// of it.
+func (pl *Playlist) write(ended bool) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:%d\n#EXT-X-MEDIA-SEQUENCE:%d\n#EXT-X-DISCONTINUITY-SEQUENCE:%d\n",
+		int(math.Ceil(pl.target.Seconds())), pl.seq, pl.disc)
+	for _, s := range pl.segs {
+		if s.discontinuity {
+			b.WriteString("#EXT-X-DISCONTINUITY\n")
+		}
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\n%s\n", s.dur.Seconds(), s.name)
+	}
+	if ended {
+		b.WriteString("#EXT-X-ENDLIST\n")
+	}
+	tmp := filepath.Join(pl.dir, "."+PlaylistName)
+	err := os.WriteFile(tmp, []byte(b.String()), 0o644)
+	if err == nil {
+		err = os.Rename(tmp, filepath.Join(pl.dir, PlaylistName))
+	}
+	if err != nil {
+		slog.Warn("hls playlist", "dir", pl.dir, "err", err)
+	}
+}
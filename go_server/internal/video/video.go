@@ -0,0 +1,207 @@
+// Package video writes a stream's frames to MP4 files, event clips or a live
+// HLS playlist, with its detections drawn on them, so a session can be watched
+// as the client saw it. Encoding needs OpenCV; in a nocv build Supported is
+// false.
+package video
+
+import (
+	"fmt"
+	"image"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"yolo-server/internal/postprocess"
+)
+
+// ── 녹화 ─────────────────────────────────────────────────────────────────────
+// Frames reach a stream irregularly, and the file plays at a fixed FPS, so
+// each frame is held on screen until the next one arrives, and frames that
+// arrive faster than FPS are dropped. A pause longer than maxGap is cut to
+// maxGap. A file is closed and the next one started once it plays for
+// Config.Segment or has grown past Config.SegmentBytes; a hold that would
+// run past Config.Segment is cut short, so HLS segments never exceed their
+// target duration. Encoding runs on the recorder's own goroutine behind a
+// queue of queueLen frames; frames that find it full, or arrive after
+// Close, are dropped rather than slowing the stream.
+
+const (
+	queueLen  = 8
+	maxGap    = 2 * time.Second
+	statEvery = 30 // frames written between file size checks
+)
+
+// Config is shared by a server's recorders.
+type Config struct {
+	FPS          float64       // frame rate of the files
+	Codec        string        // FourCC, e.g. "mp4v" or "avc1"
+	Segment      time.Duration // longest file; 0 = one file per stream
+	SegmentBytes int64         // largest file; 0 = no limit
+}
+
+// Frame is one answered frame and the detections sent with it.
+type Frame struct {
+	Data []byte // encoded image as received
+	Dets []postprocess.Detection
+	At   time.Time
+	Mask []image.Rectangle // privacy zones, painted black
+	Blur []image.Rectangle // pixelated
+
+	Captured time.Time // when the client captured it, on the server's clock; zero unknown
+}
+
+// Recorder records one stream to a series of files.
+type Recorder struct {
+	cfg      Config
+	next     func() string                        // path of the next file
+	finished func(path string, dur time.Duration) // a file is complete; may be nil
+	frames   chan Frame
+	done     chan struct{}
+	dropped  atomic.Uint64
+
+	mu     sync.Mutex
+	closed bool
+
+	// The goroutine's alone until done.
+	err    error // what stopped the recording
+	enc    *encoder
+	path   string
+	start  time.Time // when the current file's first frame arrived, less cut time
+	count  int       // video frames in the current file
+	unstat int       // frames added since the last size check
+}
+
+// Start records to <prefix>-<n>.mp4, n counting from 1; Close ends it.
+func Start(cfg Config, prefix string) *Recorder {
+	n := 0
+	return start(cfg, func() string {
+		n++
+		return fmt.Sprintf("%s-%d.mp4", prefix, n)
+	}, nil)
+}
+
+func start(cfg Config, next func() string, finished func(string, time.Duration)) *Recorder {
+	r := &Recorder{cfg: cfg, next: next, finished: finished, frames: make(chan Frame, queueLen), done: make(chan struct{})}
+	go r.run()
+	return r
+}
+
+// Add queues f, or drops it when the encoder is behind.
+func (r *Recorder) Add(f Frame) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.closed {
+		select {
+		case r.frames <- f:
+			return true
+		default:
+		}
+	}
+	r.dropped.Add(1)
+	return false
+}
+
+// Dropped is the number of frames Add could not queue.
+func (r *Recorder) Dropped() uint64 { return r.dropped.Load() }
+
+// Close encodes the queued frames and closes the file. Later calls only
+// wait for the first.
+func (r *Recorder) Close() {
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.frames)
+	}
+	r.mu.Unlock()
+	<-r.done
+}
+
+func (r *Recorder) run() {
+	defer close(r.done)
+	for f := range r.frames {
+		if r.err != nil {
+			continue
+		}
+		if r.err = r.add(f); r.err != nil {
+			slog.Warn("video recording stopped", "path", r.path, "err", r.err)
+		}
+	}
+	r.closeFile()
+}
+
+func (r *Recorder) add(f Frame) error {
+	if r.enc != nil && r.full() {
+		r.closeFile()
+	}
+	if r.enc == nil {
+		r.path = r.next()
+		enc, err := openEncoder(r.path, r.cfg.Codec, r.cfg.FPS)
+		if err != nil {
+			return err
+		}
+		r.enc, r.start, r.count = enc, f.At, 0
+	}
+	frameDur := r.frameDur()
+	slot := int(f.At.Sub(r.start) / frameDur) // where f belongs in the file
+	if slot < r.count {
+		return nil // faster than FPS; this frame is not needed
+	}
+	hold := min(slot-r.count, int(maxGap/frameDur))
+	if n := r.segmentFrames(); n > 0 {
+		hold = min(hold, n-1-r.count)
+	}
+	r.start = r.start.Add(time.Duration(slot-r.count-hold) * frameDur) // time cut from the hold
+	if err := r.enc.repeat(hold); err != nil {
+		return err
+	}
+	if err := r.enc.write(f); err != nil {
+		return err
+	}
+	r.count += hold + 1
+	return nil
+}
+
+func (r *Recorder) frameDur() time.Duration {
+	return time.Duration(float64(time.Second) / r.cfg.FPS)
+}
+
+// segmentFrames is the most frames a file holds; 0 = no limit.
+func (r *Recorder) segmentFrames() int {
+	if r.cfg.Segment <= 0 {
+		return 0
+	}
+	return max(int(r.cfg.Segment/r.frameDur()), 1)
+}
+
+// full reports whether the current file is done.
+func (r *Recorder) full() bool {
+	if n := r.segmentFrames(); n > 0 && r.count >= n {
+		return true
+	}
+	if r.unstat++; r.cfg.SegmentBytes > 0 && r.unstat >= statEvery {
+		r.unstat = 0
+		if st, err := os.Stat(r.path); err == nil && st.Size() >= r.cfg.SegmentBytes {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Recorder) closeFile() {
+	if r.enc == nil {
+		return
+	}
+	err := r.enc.close()
+	if err != nil {
+		slog.Warn("video close", "path", r.path, "err", err)
+		if r.err == nil {
+			r.err = err
+		}
+	}
+	r.enc = nil
+	if err == nil && r.count > 0 && r.finished != nil {
+		r.finished(r.path, time.Duration(r.count)*r.frameDur())
+	}
+}
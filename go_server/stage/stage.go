@@ -0,0 +1,66 @@
+// Package stage is what a postprocessing stage needs to know of the server:
+// the Detection it works on and the Stage interface it implements. It is
+// the one package Go plugins for the plugin stage (POSTPROCESS=plugin?...)
+// import from this module, so it depends on nothing but the standard
+// library. A plugin exports
+//
+//	func NewStage(args url.Values) (stage.Stage, error)
+//
+// and lives in a module of its own, built against the server's source and
+// Go version (see the README).
+package stage
+
+import (
+	"image"
+	"net/url"
+)
+
+type Detection struct {
+	Box        [4]int      `json:"box"`
+	Score      float64     `json:"score"`
+	Label      int         `json:"label"`
+	Name       string      `json:"name"`
+	Attributes *Attributes `json:"attributes,omitempty"`
+}
+
+// Attributes are what later stages found out about a detection; nil when
+// there is nothing. They are never changed once set, so copies of a
+// detection share them.
+type Attributes struct {
+	Plate      string      `json:"plate,omitempty"`       // licence plate text
+	PlateScore float64     `json:"plate_score,omitempty"` // its confidence, 0..1
+	Color      string      `json:"color,omitempty"`       // dominant colour name, e.g. "red"
+	Direction  string      `json:"direction,omitempty"`   // way of travel in the image; "" at rest
+	Velocity   *[2]float64 `json:"velocity,omitempty"`    // box centre, px/s; nil untracked
+	Ground     *[2]float64 `json:"ground,omitempty"`      // where it stands, plane metres; nil uncalibrated
+	Distance   float64     `json:"distance,omitempty"`    // from the camera's foot, metres
+	SpeedKmh   float64     `json:"speed_kmh,omitempty"`   // over the ground; 0 untracked or uncalibrated
+	Crop       string      `json:"crop,omitempty"`        // JPEG thumbnail, base64
+	CropID     string      `json:"crop_id,omitempty"`     // thumbnail kept on the server
+}
+
+// SetAttributes gives d a changed copy of its Attributes, so the detections
+// sharing the old ones keep them.
+func (d *Detection) SetAttributes(set func(a *Attributes)) {
+	var a Attributes
+	if d.Attributes != nil {
+		a = *d.Attributes
+	}
+	set(&a)
+	d.Attributes = &a
+}
+
+// Centre is the middle of d's box.
+func (d *Detection) Centre() image.Point {
+	return image.Pt((d.Box[0]+d.Box[2])/2, (d.Box[1]+d.Box[3])/2)
+}
+
+// A Stage transforms one frame's detections. It may change dets in place
+// and is called from many goroutines at once.
+type Stage interface {
+	Process(dets []Detection) []Detection
+}
+
+// NewStageFunc is the type of a plugin's NewStage. It is called once at
+// startup with the stage's arguments, path included.
+type NewStageFunc = func(args url.Values) (Stage, error)
@@ -0,0 +1,229 @@
+//go:build ignore
+
+// gen writes the golden fixtures: tiny.onnx and the images in golden/.
+//
+//	go run testdata/gen.go
+//
+// tiny.onnx is a stand-in detector small enough to commit. It has the
+// interface of an end-to-end YOLO26 export (images 1×3×H×W in, output0
+// 1×3×6 out, ultralytics metadata) but no weights: row i is a fixed box
+// in input pixels scored with the mean of input channel i, i.e. how blue,
+// green and red the frame is (the input is BGR). Its output therefore
+// depends on the whole pipeline — decode, EXIF orientation, resize, BGR
+// CHW /255 — and boxes must come back scaled to the source image.
+//
+// The *.golden.json files follow from that definition and are not
+// written here; after changing it, rewrite them with
+// go run ./cmd/golden -update and review the diff.
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+func main() {
+	must(os.WriteFile(filepath.Join("testdata", "tiny.onnx"), tinyModel(), 0o644))
+	dir := filepath.Join("testdata", "golden")
+	must(os.MkdirAll(dir, 0o755))
+
+	// 640×480 pure red: only the red row scores.
+	red := solid(640, 480, color.RGBA{R: 255, A: 255})
+	must(os.WriteFile(filepath.Join(dir, "red.png"), encodePNG(red), 0o644))
+
+	// 800×400, left half blue and right half green: blue and green score
+	// about 0.5 each and boxes scale differently along x and y.
+	halves := solid(800, 400, color.RGBA{B: 255, A: 255})
+	for y := 0; y < 400; y++ {
+		for x := 400; x < 800; x++ {
+			halves.Set(x, y, color.RGBA{G: 255, A: 255})
+		}
+	}
+	must(os.WriteFile(filepath.Join(dir, "halves.png"), encodePNG(halves), 0o644))
+
+	// A 320×480 grey JPEG tagged Orientation 6, upright 480×320. Grey keeps
+	// the JPEG exact; the tag decides which way the boxes scale.
+	gray := image.NewGray(image.Rect(0, 0, 320, 480))
+	for i := range gray.Pix {
+		gray.Pix[i] = 204 // 0.8
+	}
+	var buf bytes.Buffer
+	must(jpeg.Encode(&buf, gray, &jpeg.Options{Quality: 100}))
+	must(os.WriteFile(filepath.Join(dir, "rotated.jpg"), withOrientation(buf.Bytes(), 6), 0o644))
+}
+
+func must(err error) {
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func solid(w, h int, c color.Color) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func encodePNG(img image.Image) []byte {
+	var buf bytes.Buffer
+	must(png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+// withOrientation inserts an APP1 Exif segment holding only the
+// Orientation tag after the SOI marker of a JPEG.
+func withOrientation(jpg []byte, orientation uint16) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08") // big endian, IFD at 8
+	tiff = binary.BigEndian.AppendUint16(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, 0x0112) // Orientation
+	tiff = binary.BigEndian.AppendUint16(tiff, 3)      // SHORT
+	tiff = binary.BigEndian.AppendUint32(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0) // value padding, no next IFD
+	seg := append([]byte("Exif\x00\x00"), tiff...)
+
+	out := append([]byte{}, jpg[:2]...)
+	out = append(out, 0xFF, 0xE1)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(seg)+2))
+	out = append(out, seg...)
+	return append(out, jpg[2:]...)
+}
+
+// ── ONNX ─────────────────────────────────────────────────────────────────────
+// Field numbers are from onnx.proto; repeated scalars are written unpacked,
+// which every proto2 parser accepts.
+
+const (
+	tensorFloat = 1
+	tensorInt64 = 7
+	attrInt     = 2
+	attrInts    = 7
+)
+
+type msg []byte
+
+func (m msg) varint(field int, v uint64) msg {
+	m = binary.AppendUvarint(m, uint64(field)<<3)
+	return binary.AppendUvarint(m, v)
+}
+
+func (m msg) bytes(field int, b []byte) msg {
+	m = binary.AppendUvarint(m, uint64(field)<<3|2)
+	m = binary.AppendUvarint(m, uint64(len(b)))
+	return append(m, b...)
+}
+
+func (m msg) str(field int, s string) msg { return m.bytes(field, []byte(s)) }
+
+// tinyModel is ModelProto{ir_version 8, opset 13, graph, metadata}.
+func tinyModel() []byte {
+	var m msg
+	m = m.varint(1, 8)
+	m = m.str(2, "stream-yolo testdata")
+	m = m.str(3, "1")
+	m = m.varint(5, 1)
+	m = m.bytes(8, msg(nil).str(1, "").varint(2, 13))
+	m = m.bytes(7, graph())
+	for _, kv := range [][2]string{
+		{"description", "tiny fixture model: scores are channel means"},
+		{"task", "detect"},
+		{"stride", "32"},
+		{"batch", "1"},
+		{"imgsz", "[640, 640]"},
+		{"names", "{0: 'blue', 1: 'green', 2: 'red'}"},
+	} {
+		m = m.bytes(14, msg(nil).str(1, kv[0]).str(2, kv[1]))
+	}
+	return m
+}
+
+// graph is
+//
+//	means   = ReduceMean(images, axes=[2, 3], keepdims=0)  // 1×3
+//	scores  = Reshape(means, [1, 3, 1])
+//	output0 = Concat(boxes, scores, labels, axis=2)       // 1×3×6
+func graph() []byte {
+	var g msg
+	g = g.bytes(1, node("ReduceMean", []string{"images"}, "means",
+		msg(nil).str(1, "axes").varint(8, 2).varint(8, 3).varint(20, attrInts),
+		msg(nil).str(1, "keepdims").varint(3, 0).varint(20, attrInt)))
+	g = g.bytes(1, node("Reshape", []string{"means", "score_shape"}, "scores"))
+	g = g.bytes(1, node("Concat", []string{"boxes", "scores", "labels"}, "output0",
+		msg(nil).str(1, "axis").varint(3, 2).varint(20, attrInt)))
+	g = g.str(2, "tiny")
+	g = g.bytes(5, floatTensor("boxes", []int64{1, 3, 4}, []float32{
+		0, 0, 320, 320, // blue: top left
+		320, 0, 640, 320, // green: top right
+		160, 320, 480, 640, // red: bottom centre
+	}))
+	g = g.bytes(5, int64Tensor("score_shape", []int64{3}, []int64{1, 3, 1}))
+	g = g.bytes(5, floatTensor("labels", []int64{1, 3, 1}, []float32{0, 1, 2}))
+	g = g.bytes(11, valueInfo("images", dim(1), dim(3), param("height"), param("width")))
+	g = g.bytes(12, valueInfo("output0", dim(1), dim(3), dim(6)))
+	return g
+}
+
+func node(op string, inputs []string, output string, attrs ...msg) []byte {
+	var n msg
+	for _, in := range inputs {
+		n = n.str(1, in)
+	}
+	n = n.str(2, output)
+	n = n.str(3, op)
+	n = n.str(4, op)
+	for _, a := range attrs {
+		n = n.bytes(5, a)
+	}
+	return n
+}
+
+func floatTensor(name string, dims []int64, vals []float32) []byte {
+	raw := make([]byte, 0, 4*len(vals))
+	for _, v := range vals {
+		raw = binary.LittleEndian.AppendUint32(raw, math.Float32bits(v))
+	}
+	return tensor(name, tensorFloat, dims, raw)
+}
+
+func int64Tensor(name string, dims []int64, vals []int64) []byte {
+	raw := make([]byte, 0, 8*len(vals))
+	for _, v := range vals {
+		raw = binary.LittleEndian.AppendUint64(raw, uint64(v))
+	}
+	return tensor(name, tensorInt64, dims, raw)
+}
+
+func tensor(name string, dataType int, dims []int64, raw []byte) []byte {
+	var t msg
+	for _, d := range dims {
+		t = t.varint(1, uint64(d))
+	}
+	t = t.varint(2, uint64(dataType))
+	t = t.str(8, name)
+	return t.bytes(9, raw)
+}
+
+// valueInfo is a float tensor ValueInfoProto.
+func valueInfo(name string, dims ...[]byte) []byte {
+	var shape msg
+	for _, d := range dims {
+		shape = shape.bytes(1, d)
+	}
+	tensorType := msg(nil).varint(1, tensorFloat).bytes(2, shape)
+	return msg(nil).str(1, name).bytes(2, msg(nil).bytes(1, tensorType))
+}
+
+func dim(v int64) []byte    { return msg(nil).varint(1, uint64(v)) }
+func param(p string) []byte { return msg(nil).str(2, p) }